@@ -0,0 +1,144 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/mwojtyna/swift-api/config"
+	"github.com/mwojtyna/swift-api/internal/auth"
+	"github.com/mwojtyna/swift-api/internal/db"
+)
+
+var logger = log.New(os.Stderr, "[APIKEY] ", log.LstdFlags)
+
+func main() {
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), `Usage: %s <command>
+
+Commands:
+  create <name> <role>    Store a new key in the db and print it
+  generate <name> <role>  Print a new key and its API_KEYS_FILE entry, without storing it
+  list                    List keys in the db
+  revoke <name>           Delete a key from the db
+
+Roles: reader, editor, admin
+`, os.Args[0])
+	}
+	flag.Parse()
+	if flag.NArg() == 0 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	switch flag.Arg(0) {
+	case "create":
+		name, role := readNameAndRole()
+		key, hash := generateKey()
+
+		conn := connect()
+		defer conn.Close()
+		err := db.InsertApiKey(conn, db.ApiKey{Name: name, KeyHash: hash, Role: string(role)})
+		if err != nil {
+			logger.Fatalf(`ERROR: "%s"`, err.Error())
+		}
+
+		logger.Printf("Created key '%s' with role %s, it won't be shown again", name, role)
+		// Printed to stdout, so it can be piped somewhere
+		fmt.Println(key)
+
+	case "generate":
+		name, role := readNameAndRole()
+		key, hash := generateKey()
+
+		entry, err := json.Marshal(map[string]string{"name": name, "role": string(role), "hash": hash})
+		if err != nil {
+			logger.Fatalf(`ERROR: "%s"`, err.Error())
+		}
+
+		logger.Println("Add the entry to the array in API_KEYS_FILE and give the key to the client")
+		fmt.Printf("key:   %s\nentry: %s\n", key, entry)
+
+	case "list":
+		conn := connect()
+		defer conn.Close()
+		keys, err := db.GetApiKeys(conn)
+		if err != nil {
+			logger.Fatalf(`ERROR: "%s"`, err.Error())
+		}
+		for _, k := range keys {
+			fmt.Printf("%s\t%s\t%s\n", k.Name, k.Role, k.CreatedAt.Format("2006-01-02 15:04:05"))
+		}
+
+	case "revoke":
+		if flag.NArg() != 2 {
+			flag.Usage()
+			os.Exit(2)
+		}
+		name := flag.Arg(1)
+
+		conn := connect()
+		defer conn.Close()
+		err := db.DeleteApiKey(conn, name)
+		if errors.Is(err, sql.ErrNoRows) {
+			logger.Fatalf("Error: there's no key named '%s'", name)
+		} else if err != nil {
+			logger.Fatalf(`ERROR: "%s"`, err.Error())
+		}
+		logger.Printf("Revoked key '%s'", name)
+
+	default:
+		flag.Usage()
+		os.Exit(2)
+	}
+}
+
+func readNameAndRole() (string, auth.Role) {
+	if flag.NArg() != 3 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	role, err := auth.ParseRole(flag.Arg(2))
+	if err != nil {
+		logger.Fatalf("Error: %s", err.Error())
+	}
+
+	return flag.Arg(1), role
+}
+
+func generateKey() (string, string) {
+	key, err := auth.GenerateKey()
+	if err != nil {
+		logger.Fatalf(`ERROR generating key: "%s"`, err.Error())
+	}
+	return key, auth.HashKey(key)
+}
+
+// Keys in the db are only used by the postgres and sqlite backends
+func connect() *sqlx.DB {
+	env, err := config.LoadEnv()
+	if err != nil {
+		logger.Fatalf(`ERROR reading envs: "%s"`, err.Error())
+	}
+
+	var conn *sqlx.DB
+	switch env.STORAGE_BACKEND {
+	case config.StorageBackendMemory:
+		logger.Fatal("Error: STORAGE_BACKEND=memory has no db, use generate and API_KEYS_FILE instead")
+	case config.StorageBackendSqlite:
+		conn, err = db.ConnectSqlite(env.SQLITE_PATH)
+	default:
+		conn, err = db.Connect(env.DB_USER, env.DB_PASS, env.DB_NAME, env.DB_HOST, db.Port)
+	}
+	if err != nil {
+		logger.Fatalf(`ERROR connecting to db: "%s"`, err.Error())
+	}
+
+	return conn
+}
@@ -0,0 +1,117 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/mwojtyna/swift-api/config"
+	"github.com/mwojtyna/swift-api/internal/db"
+	"github.com/mwojtyna/swift-api/internal/migrate"
+)
+
+var logger = log.New(os.Stderr, "[MIGRATE] ", log.LstdFlags)
+
+func main() {
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), `Usage: %s <command>
+
+Commands:
+  up        Apply all pending migrations
+  down [N]  Revert the last N migrations (default 1)
+  status    List migrations and whether they're applied
+  version   Print the current schema version
+`, os.Args[0])
+	}
+	flag.Parse()
+	if flag.NArg() == 0 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	env, err := config.LoadEnv()
+	if err != nil {
+		logger.Fatalf(`ERROR reading envs: "%s"`, err.Error())
+	}
+
+	var conn *sqlx.DB
+	switch env.STORAGE_BACKEND {
+	case config.StorageBackendMemory:
+		logger.Fatal("Error: nothing to migrate with STORAGE_BACKEND=memory")
+	case config.StorageBackendSqlite:
+		conn, err = db.ConnectSqlite(env.SQLITE_PATH)
+	default:
+		conn, err = db.Connect(env.DB_USER, env.DB_PASS, env.DB_NAME, env.DB_HOST, db.Port)
+	}
+	if err != nil {
+		logger.Fatalf(`ERROR connecting to db: "%s"`, err.Error())
+	}
+	defer conn.Close()
+
+	migrator, err := migrate.New(conn)
+	if err != nil {
+		logger.Fatalf(`ERROR loading migrations: "%s"`, err.Error())
+	}
+
+	switch flag.Arg(0) {
+	case "up":
+		applied, err := migrator.Up()
+		for _, m := range applied {
+			logger.Printf("Applied %06d_%s", m.Version, m.Name)
+		}
+		if err != nil {
+			logger.Fatalf(`ERROR: "%s"`, err.Error())
+		}
+		logger.Printf("Applied %d migrations", len(applied))
+
+	case "down":
+		steps := 1
+		if flag.NArg() > 1 {
+			steps, err = strconv.Atoi(flag.Arg(1))
+			if err != nil || steps < 1 {
+				logger.Fatalf("Error: N must be a positive integer, got '%s'", flag.Arg(1))
+			}
+		}
+
+		reverted, err := migrator.Down(steps)
+		for _, m := range reverted {
+			logger.Printf("Reverted %06d_%s", m.Version, m.Name)
+		}
+		if err != nil {
+			logger.Fatalf(`ERROR: "%s"`, err.Error())
+		}
+		logger.Printf("Reverted %d migrations", len(reverted))
+
+	case "status":
+		statuses, err := migrator.Status()
+		if err != nil {
+			logger.Fatalf(`ERROR: "%s"`, err.Error())
+		}
+		// Printed to stdout, so it can be piped somewhere
+		for _, s := range statuses {
+			state := "pending"
+			if s.Applied {
+				state = "applied"
+			}
+			fmt.Printf("%06d_%s\t%s\n", s.Version, s.Name, state)
+		}
+
+	case "version":
+		version, dirty, err := migrator.Version()
+		if err != nil {
+			logger.Fatalf(`ERROR: "%s"`, err.Error())
+		}
+		if dirty {
+			fmt.Printf("%d (dirty)\n", version)
+		} else {
+			fmt.Println(version)
+		}
+
+	default:
+		flag.Usage()
+		os.Exit(2)
+	}
+}
@@ -1,60 +1,234 @@
 package main
 
 import (
+	"bufio"
+	"flag"
+	"fmt"
 	"log"
 	"os"
 
+	"github.com/jmoiron/sqlx"
 	"github.com/mwojtyna/swift-api/config"
 	"github.com/mwojtyna/swift-api/internal/db"
+	"github.com/mwojtyna/swift-api/internal/migrate"
 	"github.com/mwojtyna/swift-api/internal/parser"
 )
 
 var logger = log.New(os.Stderr, "[CSV PARSER] ", log.LstdFlags|log.Lshortfile)
 
 func main() {
-	if len(os.Args) != 2 {
-		logger.Fatal("Error: CSV filename not specified")
+	sync := flag.Bool("sync", false, "Update the DB to match the CSV, by default the CSV is only imported into an empty DB")
+	deleteMissing := flag.Bool("delete-missing", false, "With -sync, delete banks which aren't in the CSV")
+	dryRun := flag.Bool("dry-run", false, "With -sync, only report what would change")
+	strict := flag.Bool("strict", false, "Fail on the first invalid row instead of skipping it")
+	format := flag.String("format", "auto", "Format of the file: csv, fixed (fixed-width BIC Directory), xml (XML BIC Directory) or auto to detect it")
+	columnsName := flag.String("columns", "", "JSON file with extra CSV column name aliases, e.g. {\"swiftCode\": [\"BIC CODE\"]}")
+	rejectsName := flag.String("rejects", "", "File to write invalid rows to (default \"<file>.rejects.csv\")")
+	actor := flag.String("actor", os.Getenv("USER"), "Who to record the changes as in the bank history")
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "Usage: %s [flags] <csv, fixed-width or XML file>\n", os.Args[0])
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	if flag.NArg() != 1 {
+		logger.Fatal("Error: filename not specified")
+	}
+	fileName := flag.Arg(0)
+	if *rejectsName == "" {
+		*rejectsName = fileName + ".rejects.csv"
 	}
-	csvName := os.Args[1]
 
 	env, err := config.LoadEnv()
 	if err != nil {
 		logger.Fatalf(`ERROR reading envs: "%s"`, err.Error())
 	}
 	logger.Println("Read envs")
+	audit := db.Audit{Actor: *actor, Source: db.HistorySourceImport}
 
-	pg, err := db.Connect(env.DB_USER, env.DB_PASS, env.DB_NAME, env.DB_HOST, db.Port)
-	if err != nil {
-		logger.Fatalf(`ERROR connecting to db: "%s"`, err.Error())
+	var conn *sqlx.DB
+	switch env.STORAGE_BACKEND {
+	case config.StorageBackendMemory:
+		logger.Fatal("Error: nothing to import into with STORAGE_BACKEND=memory, the server loads MEMORY_CSV itself")
+	case config.StorageBackendSqlite:
+		conn, err = db.ConnectSqlite(env.SQLITE_PATH)
+		if err != nil {
+			logger.Fatalf(`ERROR opening SQLite db '%s': "%s"`, env.SQLITE_PATH, err.Error())
+		}
+		logger.Printf("Opened SQLite db '%s'", env.SQLITE_PATH)
+	default:
+		conn, err = db.Connect(env.DB_USER, env.DB_PASS, env.DB_NAME, env.DB_HOST, db.Port)
+		if err != nil {
+			logger.Fatalf(`ERROR connecting to db: "%s"`, err.Error())
+		}
+		logger.Println("Connected to db")
 	}
-	logger.Println("Connected to db")
 
-	empty, err := db.IsEmpty(pg)
+	migrator, err := migrate.New(conn)
 	if err != nil {
-		logger.Fatalf(`ERROR checking if DB is empty: "%s"`, err.Error())
+		logger.Fatalf(`ERROR loading migrations: "%s"`, err.Error())
+	}
+	if *sync && *dryRun {
+		// A dry run doesn't change the database, so it can't migrate it either
+		pending, err := migrator.Pending()
+		if err != nil {
+			logger.Fatalf(`ERROR checking migrations: "%s"`, err.Error())
+		}
+		if len(pending) > 0 {
+			logger.Fatalf("ERROR: db schema is behind by %d migrations, run the parser without -dry-run or `migrate up` first", len(pending))
+		}
+	} else {
+		applied, err := migrator.Up()
+		if err != nil {
+			logger.Fatalf(`ERROR migrating db: "%s"`, err.Error())
+		}
+		logger.Printf("Applied %d migrations", len(applied))
 	}
-	if !empty {
-		logger.Println("DB isn't empty, will not parse csv")
-		os.Exit(0)
+
+	if !*sync {
+		empty, err := db.IsEmpty(conn)
+		if err != nil {
+			logger.Fatalf(`ERROR checking if DB is empty: "%s"`, err.Error())
+		}
+		if !empty {
+			logger.Println("DB isn't empty, will not parse csv (use -sync to update it)")
+			os.Exit(0)
+		}
 	}
 
-	file, err := os.Open(csvName)
+	file, err := os.Open(fileName)
 	if err != nil {
-		logger.Fatalf("ERROR opening csv file '%s'", csvName)
+		logger.Fatalf("ERROR opening file '%s'", fileName)
 	}
 	defer file.Close()
 
-	banks, err := parser.ParseCsv(file)
-	if err != nil {
-		logger.Fatalf(`ERROR parsing file and inserting data to db '%s': "%s"`, csvName, err.Error())
+	mapping := parser.DefaultColumnMapping
+	if *columnsName != "" {
+		columnsFile, err := os.Open(*columnsName)
+		if err != nil {
+			logger.Fatalf("ERROR opening column mapping file '%s'", *columnsName)
+		}
+		mapping, err = parser.LoadColumnMapping(columnsFile)
+		columnsFile.Close()
+		if err != nil {
+			logger.Fatalf(`ERROR reading column mapping file '%s': "%s"`, *columnsName, err.Error())
+		}
 	}
-	logger.Printf("Parsed %d banks", len(banks))
 
-	err = db.InsertBanks(pg, banks)
+	input := bufio.NewReader(file)
+	fileFormat := parser.Format(*format)
+	if fileFormat == "auto" {
+		fileFormat, err = parser.DetectFormat(input)
+		if err != nil {
+			logger.Fatalf(`ERROR detecting format of '%s': "%s"`, fileName, err.Error())
+		}
+		logger.Printf("Detected %s format", fileFormat)
+	}
+	importer, err := parser.NewImporter(fileFormat, mapping)
 	if err != nil {
-		logger.Fatalf(`ERROR inserting banks: "%s"`, err.Error())
+		logger.Fatalf(`ERROR: "%s"`, err.Error())
+	}
+
+	var rejectsFile *os.File
+	var rejects *parser.RejectsWriter
+	rejectsClosed := false
+	closeRejects := func() error {
+		if rejects == nil || rejectsClosed {
+			return nil
+		}
+		rejectsClosed = true
+		err := rejects.Flush()
+		if closeErr := rejectsFile.Close(); err == nil {
+			err = closeErr
+		}
+		return err
+	}
+	// Rows rejected before a failure are still worth fixing, but logger.Fatalf exits without running deferred calls
+	defer closeRejects()
+	fatalf := func(format string, v ...any) {
+		closeRejects()
+		logger.Fatalf(format, v...)
+	}
+	stream := importer.Stream(input)
+	if !*strict {
+		stream = parser.SkipInvalid(stream, func(rowErr *parser.RowError) {
+			// Only create the file if something gets rejected
+			if rejects == nil {
+				var err error
+				rejectsFile, err = os.Create(*rejectsName)
+				if err != nil {
+					logger.Fatalf(`ERROR creating rejects file '%s': "%s"`, *rejectsName, err.Error())
+				}
+				rejects = parser.NewRejectsWriter(rejectsFile)
+			}
+
+			logger.Printf("Skipping %s", rowErr.Error())
+			err := rejects.Write(rowErr)
+			if err != nil {
+				logger.Fatalf(`ERROR writing to rejects file '%s': "%s"`, *rejectsName, err.Error())
+			}
+		})
+	}
+
+	if *sync {
+		// Diffing needs all banks at once
+		banks, err := parser.CollectBanks(stream)
+		if err != nil {
+			fatalf(`ERROR parsing file '%s': "%s"`, fileName, err.Error())
+		}
+		logger.Printf("Parsed %d banks", len(banks))
+
+		diff, err := db.SyncBanks(conn, banks, db.SyncOptions{DeleteMissing: *deleteMissing, DryRun: *dryRun}, audit)
+		if err != nil {
+			fatalf(`ERROR syncing banks: "%s"`, err.Error())
+		}
+		printDiff(diff)
+
+		if *dryRun {
+			logger.Printf("Dry run, would add %d, change %d and remove %d banks", len(diff.Added), len(diff.Changed), len(diff.Removed))
+		} else {
+			logger.Printf("Synced banks, added %d, changed %d and removed %d", len(diff.Added), len(diff.Changed), len(diff.Removed))
+		}
+	} else if env.STORAGE_BACKEND == config.StorageBackendSqlite {
+		// SQLite has no COPY, the directory is small enough to insert at once
+		banks, err := parser.CollectBanks(stream)
+		if err != nil {
+			fatalf(`ERROR parsing file '%s': "%s"`, fileName, err.Error())
+		}
+		err = db.InsertBanks(conn, banks, audit)
+		if err != nil {
+			fatalf(`ERROR inserting data to db: "%s"`, err.Error())
+		}
+		logger.Printf("Inserted %d banks", len(banks))
+	} else {
+		// Stream straight from the file into the DB, so big files don't have to fit in memory
+		inserted, err := db.LoadBanks(conn, stream, audit)
+		if err != nil {
+			fatalf(`ERROR parsing file and inserting data to db '%s': "%s"`, fileName, err.Error())
+		}
+		logger.Printf("Inserted %d banks", inserted)
+	}
+
+	if rejects != nil {
+		err := closeRejects()
+		if err != nil {
+			logger.Fatalf(`ERROR writing to rejects file '%s': "%s"`, *rejectsName, err.Error())
+		}
+		logger.Printf("Skipped %d invalid rows, see '%s'", rejects.Count(), *rejectsName)
 	}
-	logger.Println("Inserted banks")
 
 	logger.Println("Done!")
 }
+
+// Prints changed codes to stdout, so the report can be piped somewhere
+func printDiff(diff db.BankDiff) {
+	for _, b := range diff.Added {
+		fmt.Printf("+ %s\n", b.SwiftCode)
+	}
+	for _, b := range diff.Changed {
+		fmt.Printf("~ %s\n", b.SwiftCode)
+	}
+	for _, code := range diff.Removed {
+		fmt.Printf("- %s\n", code)
+	}
+}
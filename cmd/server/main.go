@@ -5,9 +5,14 @@ import (
 	"log"
 	"os"
 
+	"github.com/jmoiron/sqlx"
 	"github.com/mwojtyna/swift-api/config"
 	"github.com/mwojtyna/swift-api/internal/api"
+	"github.com/mwojtyna/swift-api/internal/auth"
 	"github.com/mwojtyna/swift-api/internal/db"
+	"github.com/mwojtyna/swift-api/internal/migrate"
+	"github.com/mwojtyna/swift-api/internal/parser"
+	"github.com/mwojtyna/swift-api/internal/ratelimit"
 )
 
 var logger = log.New(os.Stderr, "[API] ", log.Ldate|log.Ltime)
@@ -19,15 +24,158 @@ func main() {
 	}
 	logger.Println("Read envs")
 
-	pg, err := db.Connect(env.DB_USER, env.DB_PASS, env.DB_NAME, env.DB_HOST, db.Port)
-	if err != nil {
-		logger.Fatalf(`ERROR connecting to db: "%s"`, err.Error())
+	var repo db.BankRepository
+	var keys auth.KeyStores
+	switch env.STORAGE_BACKEND {
+	case config.StorageBackendMemory:
+		repo, err = loadMemoryRepository(env.MEMORY_CSV)
+		if err != nil {
+			logger.Fatalf(`ERROR loading '%s': "%s"`, env.MEMORY_CSV, err.Error())
+		}
+		logger.Printf("Loaded banks from '%s' into memory, changes will be lost on exit", env.MEMORY_CSV)
+	case config.StorageBackendSqlite:
+		sqlite, err := db.ConnectSqlite(env.SQLITE_PATH)
+		if err != nil {
+			logger.Fatalf(`ERROR opening SQLite db '%s': "%s"`, env.SQLITE_PATH, err.Error())
+		}
+		logger.Printf("Opened SQLite db '%s'", env.SQLITE_PATH)
+		migrateUp(sqlite)
+		repo = db.NewSqliteRepository(sqlite)
+		keys = append(keys, auth.NewDbKeyStore(sqlite))
+	default:
+		pg, err := db.Connect(env.DB_USER, env.DB_PASS, env.DB_NAME, env.DB_HOST, db.Port)
+		if err != nil {
+			logger.Fatalf(`ERROR connecting to db: "%s"`, err.Error())
+		}
+		logger.Println("Connected to db")
+		migrateUp(pg)
+		repo = db.NewPostgresRepository(pg)
+		keys = append(keys, auth.NewDbKeyStore(pg))
+	}
+
+	// Memory is already as fast as the cache
+	if env.CACHE_SIZE > 0 && env.STORAGE_BACKEND != config.StorageBackendMemory {
+		repo = db.NewCachedRepository(repo, env.CACHE_SIZE, env.CACHE_TTL)
+		logger.Printf("Caching up to %d reads for %s", env.CACHE_SIZE, env.CACHE_TTL)
 	}
-	logger.Println("Connected to db")
+
+	authCfg := loadAuthConfig(env, keys)
+	limiter := loadLimiter(env.RATE_LIMIT_FILE)
 
 	addr := fmt.Sprintf(":%s", env.API_PORT)
-	server := api.NewApiServer(addr, pg, logger)
+	server := api.NewApiServer(addr, repo, authCfg, limiter, logger)
 
 	logger.Printf("Server running on %s", addr)
 	server.Run()
 }
+
+func loadMemoryRepository(fileName string) (*db.MemoryRepository, error) {
+	file, err := os.Open(fileName)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	banks, err := parser.ParseCsv(file)
+	if err != nil {
+		return nil, err
+	}
+
+	return db.NewMemoryRepository(banks)
+}
+
+// Keys from API_KEYS_FILE are looked up before the ones in the DB
+func loadAuthConfig(env config.Env, dbKeys auth.KeyStores) api.AuthConfig {
+	if env.DISABLE_AUTH {
+		logger.Println("WARNING: authentication is disabled, every client can change and purge banks")
+		return api.AuthConfig{}
+	}
+
+	var keys auth.KeyStores
+	if env.API_KEYS_FILE != "" {
+		fileKeys, err := auth.LoadKeysFile(env.API_KEYS_FILE)
+		if err != nil {
+			logger.Fatalf(`ERROR loading API keys from '%s': "%s"`, env.API_KEYS_FILE, err.Error())
+		}
+		logger.Printf("Loaded %d API keys from '%s'", len(fileKeys), env.API_KEYS_FILE)
+		// An empty file has nothing to look up, it mustn't turn auth on by itself
+		if len(fileKeys) > 0 {
+			keys = append(keys, fileKeys)
+		}
+	}
+	keys = append(keys, dbKeys...)
+
+	tokens := loadTokenVerifier(env)
+	if len(keys) == 0 && tokens == nil {
+		logger.Println("WARNING: no API keys or JWKS configured, so authentication is disabled and every client can change and purge banks. Set API_KEYS_FILE or JWKS_FILE to enable it")
+		return api.AuthConfig{}
+	}
+	if env.PUBLIC_READS {
+		logger.Println("Reads don't need credentials")
+	}
+
+	cfg := api.AuthConfig{Tokens: tokens, PublicReads: env.PUBLIC_READS}
+	// Keys is an interface, an empty KeyStores in it would still enable API keys
+	if len(keys) > 0 {
+		cfg.Keys = keys
+	}
+	return cfg
+}
+
+// Returns nil if neither JWKS_FILE nor JWKS_URL is set
+func loadTokenVerifier(env config.Env) *auth.TokenVerifier {
+	var jwks auth.KeySet
+	switch {
+	case env.JWKS_FILE != "":
+		fileJwks, err := auth.LoadJwksFile(env.JWKS_FILE)
+		if err != nil {
+			logger.Fatalf(`ERROR loading JWKS from '%s': "%s"`, env.JWKS_FILE, err.Error())
+		}
+		logger.Printf("Loaded %d signing keys from '%s'", fileJwks.Len(), env.JWKS_FILE)
+		jwks = fileJwks
+	case env.JWKS_URL != "":
+		remoteJwks, err := auth.FetchJwks(env.JWKS_URL)
+		if err != nil {
+			logger.Fatalf(`ERROR fetching JWKS from '%s': "%s"`, env.JWKS_URL, err.Error())
+		}
+		logger.Printf("Fetched %d signing keys from '%s'", remoteJwks.Len(), env.JWKS_URL)
+		jwks = remoteJwks
+	default:
+		return nil
+	}
+
+	return auth.NewTokenVerifier(jwks, env.JWT_ISSUER, env.JWT_AUDIENCE)
+}
+
+// Returns nil if there's no config file
+func loadLimiter(path string) *ratelimit.Limiter {
+	if path == "" {
+		return nil
+	}
+
+	cfg, err := ratelimit.LoadConfigFile(path)
+	if err != nil {
+		logger.Fatalf(`ERROR loading rate limits from '%s': "%s"`, path, err.Error())
+	}
+	limiter, err := ratelimit.New(cfg)
+	if err != nil {
+		logger.Fatalf(`ERROR in rate limits from '%s': "%s"`, path, err.Error())
+	}
+	logger.Printf("Loaded rate limits from '%s'", path)
+
+	return limiter
+}
+
+// Other instances starting at the same time wait for the first one to finish
+func migrateUp(conn *sqlx.DB) {
+	migrator, err := migrate.New(conn)
+	if err != nil {
+		logger.Fatalf(`ERROR loading migrations: "%s"`, err.Error())
+	}
+
+	applied, err := migrator.Up()
+	if err != nil {
+		logger.Fatalf(`ERROR migrating db: "%s"`, err.Error())
+	}
+	logger.Printf("Applied %d migrations", len(applied))
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/mwojtyna/swift-api/config"
+	"github.com/mwojtyna/swift-api/internal/api"
+	"github.com/mwojtyna/swift-api/internal/auth"
+	"github.com/mwojtyna/swift-api/internal/db"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLoadAuthConfig(t *testing.T) {
+	dbKeys := auth.KeyStores{auth.FileKeyStore{}}
+	repo, err := db.NewMemoryRepository([]db.Bank{{
+		SwiftCode:       "BPHKPLPKXXX",
+		IsHeadquarter:   true,
+		BankName:        "BANK BPH SA",
+		Address:         "UL. CYPRIANA KAMILA NORWIDA 1, 80-280 GDANSK",
+		TownName:        "GDANSK",
+		CountryISO2Code: "PL",
+		CountryName:     "POLAND",
+	}})
+	require.NoError(t, err)
+	tests := []struct {
+		name        string
+		keysFile    string
+		dbKeys      auth.KeyStores
+		wantEnabled bool
+	}{
+		{"no keys", "", nil, false},
+		{"empty keys file", "[]", nil, false},
+		{"keys file", `[{"name":"ci","role":"editor","hash":"` + auth.HashKey("secret") + `"}]`, nil, true},
+		{"empty keys file with db keys", "[]", dbKeys, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Arrange
+			env := config.Env{}
+			if tt.keysFile != "" {
+				env.API_KEYS_FILE = filepath.Join(t.TempDir(), "keys.json")
+				require.NoError(t, os.WriteFile(env.API_KEYS_FILE, []byte(tt.keysFile), 0o600))
+			}
+
+			// Act
+			cfg := loadAuthConfig(env, tt.dbKeys)
+			w := httptest.NewRecorder()
+			router := api.NewApiServer(":0", repo, cfg, nil, log.New(io.Discard, "", 0)).NewRouter()
+			router.ServeHTTP(w, httptest.NewRequest("GET", "/v1/swift-codes/BPHKPLPKXXX", nil))
+
+			// Assert
+			assert.Equal(t, tt.wantEnabled, cfg.Keys != nil, "auth is only enabled with keys to check")
+			assert.Nil(t, cfg.Tokens)
+			if tt.wantEnabled {
+				assert.Equal(t, http.StatusUnauthorized, w.Code)
+			} else {
+				assert.Equal(t, http.StatusOK, w.Code)
+			}
+		})
+	}
+}
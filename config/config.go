@@ -5,7 +5,9 @@ import (
 	"os"
 	"path/filepath"
 	"regexp"
+	"strconv"
 	"testing"
+	"time"
 
 	"github.com/go-playground/validator/v10"
 	"github.com/joho/godotenv"
@@ -19,13 +21,34 @@ const (
 	SwiftApiEnvProduction  envType = "production"
 )
 
+type storageBackend string
+
+const (
+	StorageBackendPostgres storageBackend = "postgres"
+	StorageBackendMemory   storageBackend = "memory" // Loads MEMORY_CSV on start, changes are lost on exit
+	StorageBackendSqlite   storageBackend = "sqlite" // Database file at SQLITE_PATH, created if it doesn't exist
+)
+
 type Env struct {
-	DB_USER         string  `validate:"required"`
-	DB_PASS         string  `validate:"required"`
-	DB_NAME         string  `validate:"required"`
-	DB_HOST         string  `validate:"required"`
-	API_PORT        string  `validate:"required"`
-	SWIFTAPI_ENV    envType `validate:"required"`
+	STORAGE_BACKEND storageBackend `validate:"required,oneof=postgres memory sqlite"`
+	DB_USER         string         `validate:"required_if=STORAGE_BACKEND postgres"`
+	DB_PASS         string         `validate:"required_if=STORAGE_BACKEND postgres"`
+	DB_NAME         string         `validate:"required_if=STORAGE_BACKEND postgres"`
+	DB_HOST         string         `validate:"required_if=STORAGE_BACKEND postgres"`
+	MEMORY_CSV      string         `validate:"required_if=STORAGE_BACKEND memory"`
+	SQLITE_PATH     string         `validate:"required_if=STORAGE_BACKEND sqlite"`
+	API_PORT        string         `validate:"required"`
+	API_KEYS_FILE   string         // Optional JSON file with API keys, in addition to the ones in the DB
+	JWKS_FILE       string         `validate:"excluded_with=JWKS_URL"` // Enables bearer tokens signed with these keys
+	JWKS_URL        string         `validate:"omitempty,http_url"`     // Same as JWKS_FILE, fetched from the identity provider
+	JWT_ISSUER      string         `validate:"required_with=JWKS_FILE JWKS_URL"`
+	JWT_AUDIENCE    string         `validate:"required_with=JWKS_FILE JWKS_URL"`
+	RATE_LIMIT_FILE string         // Optional JSON file with rate limits and quotas, see internal/ratelimit
+	CACHE_SIZE      int            `validate:"min=0"` // Entries in the read cache, 0 disables it
+	CACHE_TTL       time.Duration  `validate:"gt=0"`  // How long cached reads are served
+	PUBLIC_READS    bool           // Reads don't need credentials
+	DISABLE_AUTH    bool           // Every client can do everything, only for development
+	SWIFTAPI_ENV    envType        `validate:"required"`
 	ProjectRootPath string
 }
 
@@ -50,12 +73,48 @@ func LoadEnv() (Env, error) {
 		return Env{}, err
 	}
 
+	backend := storageBackend(os.Getenv("STORAGE_BACKEND"))
+	if backend == "" {
+		backend = StorageBackendPostgres
+	}
+
+	publicReads, err := parseBoolEnv("PUBLIC_READS")
+	if err != nil {
+		return Env{}, err
+	}
+	disableAuth, err := parseBoolEnv("DISABLE_AUTH")
+	if err != nil {
+		return Env{}, err
+	}
+
+	cacheSize, err := parseIntEnv("CACHE_SIZE", defaultCacheSize)
+	if err != nil {
+		return Env{}, err
+	}
+	cacheTtl, err := parseDurationEnv("CACHE_TTL", defaultCacheTtl)
+	if err != nil {
+		return Env{}, err
+	}
+
 	config := Env{
+		STORAGE_BACKEND: backend,
 		DB_USER:         os.Getenv("DB_USER"),
 		DB_PASS:         os.Getenv("DB_PASS"),
 		DB_NAME:         os.Getenv("DB_NAME"),
 		DB_HOST:         os.Getenv("DB_HOST"),
+		MEMORY_CSV:      os.Getenv("MEMORY_CSV"),
+		SQLITE_PATH:     os.Getenv("SQLITE_PATH"),
 		API_PORT:        os.Getenv("API_PORT"),
+		API_KEYS_FILE:   os.Getenv("API_KEYS_FILE"),
+		JWKS_FILE:       os.Getenv("JWKS_FILE"),
+		JWKS_URL:        os.Getenv("JWKS_URL"),
+		JWT_ISSUER:      os.Getenv("JWT_ISSUER"),
+		JWT_AUDIENCE:    os.Getenv("JWT_AUDIENCE"),
+		RATE_LIMIT_FILE: os.Getenv("RATE_LIMIT_FILE"),
+		CACHE_SIZE:      cacheSize,
+		CACHE_TTL:       cacheTtl,
+		PUBLIC_READS:    publicReads,
+		DISABLE_AUTH:    disableAuth,
 		SWIFTAPI_ENV:    env,
 		ProjectRootPath: root,
 	}
@@ -69,6 +128,55 @@ func LoadEnv() (Env, error) {
 	return config, nil
 }
 
+const (
+	defaultCacheSize = 10000
+	defaultCacheTtl  = 5 * time.Minute
+)
+
+func parseIntEnv(name string, def int) (int, error) {
+	raw := os.Getenv(name)
+	if raw == "" {
+		return def, nil
+	}
+
+	v, err := strconv.Atoi(raw)
+	if err != nil {
+		return 0, fmt.Errorf("%s must be an integer, got '%s'", name, raw)
+	}
+
+	return v, nil
+}
+
+// In Go's format, e.g. 30s or 5m
+func parseDurationEnv(name string, def time.Duration) (time.Duration, error) {
+	raw := os.Getenv(name)
+	if raw == "" {
+		return def, nil
+	}
+
+	v, err := time.ParseDuration(raw)
+	if err != nil {
+		return 0, fmt.Errorf("%s must be a duration like 30s or 5m, got '%s'", name, raw)
+	}
+
+	return v, nil
+}
+
+// Unset is false
+func parseBoolEnv(name string) (bool, error) {
+	raw := os.Getenv(name)
+	if raw == "" {
+		return false, nil
+	}
+
+	v, err := strconv.ParseBool(raw)
+	if err != nil {
+		return false, fmt.Errorf("%s must be true or false, got '%s'", name, raw)
+	}
+
+	return v, nil
+}
+
 const projectDirName = "swift-api"
 
 func findProjectRoot() string {
@@ -9,13 +9,23 @@ import (
 
 func TestLoadEnv(t *testing.T) {
 	tests := []struct {
-		name    string
-		dbUser  string
-		dbPass  string
-		dbName  string
-		dbHost  string
-		apiPort string
-		wantErr bool
+		name           string
+		storageBackend string
+		dbUser         string
+		dbPass         string
+		dbName         string
+		dbHost         string
+		memoryCsv      string
+		sqlitePath     string
+		apiPort        string
+		publicReads    string
+		jwksFile       string
+		jwksUrl        string
+		jwtIssuer      string
+		jwtAudience    string
+		cacheSize      string
+		cacheTtl       string
+		wantErr        bool
 	}{
 		{
 			name:    "correct",
@@ -35,15 +45,132 @@ func TestLoadEnv(t *testing.T) {
 			apiPort: "5678",
 			wantErr: true,
 		},
+		{
+			name:           "memory backend without db",
+			storageBackend: "memory",
+			memoryCsv:      "swift-codes.csv",
+			apiPort:        "5678",
+			wantErr:        false,
+		},
+		{
+			name:           "memory backend without csv",
+			storageBackend: "memory",
+			apiPort:        "5678",
+			wantErr:        true,
+		},
+		{
+			name:           "sqlite backend",
+			storageBackend: "sqlite",
+			sqlitePath:     "swift.db",
+			apiPort:        "5678",
+			wantErr:        false,
+		},
+		{
+			name:           "sqlite backend without path",
+			storageBackend: "sqlite",
+			apiPort:        "5678",
+			wantErr:        true,
+		},
+		{
+			name:           "public reads",
+			storageBackend: "memory",
+			memoryCsv:      "swift-codes.csv",
+			apiPort:        "5678",
+			publicReads:    "true",
+			wantErr:        false,
+		},
+		{
+			name:           "invalid public reads",
+			storageBackend: "memory",
+			memoryCsv:      "swift-codes.csv",
+			apiPort:        "5678",
+			publicReads:    "sometimes",
+			wantErr:        true,
+		},
+		{
+			name:           "jwks file",
+			storageBackend: "memory",
+			memoryCsv:      "swift-codes.csv",
+			apiPort:        "5678",
+			jwksFile:       "jwks.json",
+			jwtIssuer:      "https://id.example.com",
+			jwtAudience:    "swift-api",
+			wantErr:        false,
+		},
+		{
+			name:           "jwks url without issuer",
+			storageBackend: "memory",
+			memoryCsv:      "swift-codes.csv",
+			apiPort:        "5678",
+			jwksUrl:        "https://id.example.com/jwks.json",
+			jwtAudience:    "swift-api",
+			wantErr:        true,
+		},
+		{
+			name:           "jwks file and url",
+			storageBackend: "memory",
+			memoryCsv:      "swift-codes.csv",
+			apiPort:        "5678",
+			jwksFile:       "jwks.json",
+			jwksUrl:        "https://id.example.com/jwks.json",
+			jwtIssuer:      "https://id.example.com",
+			jwtAudience:    "swift-api",
+			wantErr:        true,
+		},
+		{
+			name:           "cache disabled",
+			storageBackend: "sqlite",
+			sqlitePath:     "swift.db",
+			apiPort:        "5678",
+			cacheSize:      "0",
+			cacheTtl:       "30s",
+			wantErr:        false,
+		},
+		{
+			name:           "negative cache size",
+			storageBackend: "sqlite",
+			sqlitePath:     "swift.db",
+			apiPort:        "5678",
+			cacheSize:      "-1",
+			wantErr:        true,
+		},
+		{
+			name:           "invalid cache ttl",
+			storageBackend: "sqlite",
+			sqlitePath:     "swift.db",
+			apiPort:        "5678",
+			cacheTtl:       "5",
+			wantErr:        true,
+		},
+		{
+			name:           "unknown backend",
+			storageBackend: "mysql",
+			dbUser:         "user",
+			dbPass:         "password",
+			dbName:         "name",
+			dbHost:         "host",
+			apiPort:        "5678",
+			wantErr:        true,
+		},
 	}
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("STORAGE_BACKEND", tt.storageBackend)
 			t.Setenv("DB_USER", tt.dbUser)
 			t.Setenv("DB_PASS", tt.dbPass)
 			t.Setenv("DB_NAME", tt.dbName)
 			t.Setenv("DB_HOST", tt.dbHost)
+			t.Setenv("MEMORY_CSV", tt.memoryCsv)
+			t.Setenv("SQLITE_PATH", tt.sqlitePath)
 			t.Setenv("API_PORT", tt.apiPort)
+			t.Setenv("PUBLIC_READS", tt.publicReads)
+			t.Setenv("JWKS_FILE", tt.jwksFile)
+			t.Setenv("JWKS_URL", tt.jwksUrl)
+			t.Setenv("JWT_ISSUER", tt.jwtIssuer)
+			t.Setenv("JWT_AUDIENCE", tt.jwtAudience)
+			t.Setenv("CACHE_SIZE", tt.cacheSize)
+			t.Setenv("CACHE_TTL", tt.cacheTtl)
 
 			got, err := LoadEnv()
 			if tt.wantErr {
@@ -54,7 +181,13 @@ func TestLoadEnv(t *testing.T) {
 				assert.Equal(t, tt.dbPass, got.DB_PASS)
 				assert.Equal(t, tt.dbName, got.DB_NAME)
 				assert.Equal(t, tt.dbHost, got.DB_HOST)
+				assert.Equal(t, tt.memoryCsv, got.MEMORY_CSV)
+				assert.Equal(t, tt.sqlitePath, got.SQLITE_PATH)
 				assert.Equal(t, tt.apiPort, got.API_PORT)
+				assert.Equal(t, tt.publicReads == "true", got.PUBLIC_READS)
+				assert.Equal(t, tt.jwksFile, got.JWKS_FILE)
+				assert.Equal(t, tt.jwtIssuer, got.JWT_ISSUER)
+				assert.Equal(t, tt.jwtAudience, got.JWT_AUDIENCE)
 			}
 		})
 	}
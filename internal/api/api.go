@@ -1,16 +1,22 @@
 package api
 
 import (
+	"encoding/base64"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"log"
 	"net/http"
 	"reflect"
+	"strconv"
 	"strings"
 
 	"github.com/go-playground/validator/v10"
-	"github.com/jmoiron/sqlx"
+	"github.com/mwojtyna/swift-api/internal/auth"
+	"github.com/mwojtyna/swift-api/internal/bic"
+	"github.com/mwojtyna/swift-api/internal/db"
+	"github.com/mwojtyna/swift-api/internal/ratelimit"
+	"github.com/mwojtyna/swift-api/internal/utils"
 )
 
 func ValidateStruct[T any](t T, validate *validator.Validate) error {
@@ -20,7 +26,16 @@ func ValidateStruct[T any](t T, validate *validator.Validate) error {
 	if err != nil && errors.As(err, &ve) {
 		msg := "Format checks failed for fields:\n"
 		for _, fe := range ve {
-			msg += fmt.Sprintf("'%s': %s\n", fe.Field(), fe.Tag())
+			msg += fmt.Sprintf("'%s': %s", fe.Field(), fe.Tag())
+
+			// Explain what exactly is wrong with the code
+			var bicErr *bic.ValidationError
+			if fe.Tag() == bic.Tag && errors.As(bic.Validate(fe.Value().(string)), &bicErr) {
+				reasons := utils.Map(bicErr.Reasons, func(r bic.Reason) string { return r.String() })
+				msg += fmt.Sprintf(" (%s)", strings.Join(reasons, "; "))
+			}
+
+			msg += "\n"
 		}
 
 		return errors.New(msg)
@@ -42,6 +57,55 @@ func ReadJson[T any](w http.ResponseWriter, r *http.Request, t *T) error {
 	return nil
 }
 
+// Reads an optional integer query parameter, returns def if it isn't set
+func ReadQueryInt(r *http.Request, name string, def int, min int, max int) (int, error) {
+	raw := r.URL.Query().Get(name)
+	if raw == "" {
+		return def, nil
+	}
+
+	v, err := strconv.Atoi(raw)
+	if err != nil || v < min || v > max {
+		return 0, fmt.Errorf(`Query parameter "%s" must be an integer between %d and %d`, name, min, max)
+	}
+
+	return v, nil
+}
+
+// Reads an optional boolean query parameter, returns def if it isn't set
+func ReadQueryBool(r *http.Request, name string, def bool) (bool, error) {
+	raw := r.URL.Query().Get(name)
+	if raw == "" {
+		return def, nil
+	}
+
+	v, err := strconv.ParseBool(raw)
+	if err != nil {
+		return false, fmt.Errorf(`Query parameter "%s" must be true or false`, name)
+	}
+
+	return v, nil
+}
+
+// Cursors are opaque to clients, but really just the last SWIFT code of the previous page
+func encodeCursor(swiftCode string) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(swiftCode))
+}
+
+// Returns an empty string for an empty cursor
+func decodeCursor(cursor string) (string, error) {
+	if cursor == "" {
+		return "", nil
+	}
+
+	swiftCode, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil || len(swiftCode) == 0 {
+		return "", fmt.Errorf("Invalid cursor")
+	}
+
+	return string(swiftCode), nil
+}
+
 func WriteJson[T any](w http.ResponseWriter, status int, v T) error {
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(status)
@@ -52,7 +116,8 @@ func WriteHttpError(w http.ResponseWriter, status int) {
 	http.Error(w, "", status)
 }
 
-func NewApiServer(address string, db *sqlx.DB, logger *log.Logger) *ApiServer {
+// A nil limiter disables rate limiting
+func NewApiServer(address string, repo db.BankRepository, authCfg AuthConfig, limiter *ratelimit.Limiter, logger *log.Logger) *ApiServer {
 	validate := validator.New(validator.WithRequiredStructEnabled())
 	// Return json name instead of struct name
 	validate.RegisterTagNameFunc(func(fld reflect.StructField) string {
@@ -62,10 +127,16 @@ func NewApiServer(address string, db *sqlx.DB, logger *log.Logger) *ApiServer {
 		}
 		return name
 	})
+	// Can only fail if the tag is invalid
+	if err := bic.RegisterValidation(validate); err != nil {
+		panic(err)
+	}
 
 	return &ApiServer{
 		address:  address,
-		db:       db,
+		repo:     repo,
+		authCfg:  authCfg,
+		limiter:  limiter,
 		logger:   logger,
 		validate: validate,
 	}
@@ -73,10 +144,33 @@ func NewApiServer(address string, db *sqlx.DB, logger *log.Logger) *ApiServer {
 
 func (s *ApiServer) NewRouter() *http.ServeMux {
 	routerV1 := http.NewServeMux()
-	routerV1.HandleFunc("GET /swift-codes/{swiftCode}", s.handleError(s.handleGetSwiftCodeV1))
-	routerV1.HandleFunc("GET /swift-codes/country/{countryISO2code}", s.handleError(s.handleGetSwiftCodesForCountryV1))
-	routerV1.HandleFunc("POST /swift-codes", s.handleError(s.handleAddSwiftCodeV1))
-	routerV1.HandleFunc("DELETE /swift-codes/{swiftCode}", s.handleError(s.handleDeleteSwiftCodeV1))
+	var patterns []string
+	handle := func(pattern string, role auth.Role, h http.Handler) {
+		routerV1.Handle(pattern, s.rateLimit(pattern)(s.requireRole(role)(h)))
+		patterns = append(patterns, pattern)
+	}
+
+	handle("GET /swift-codes/{swiftCode}", auth.RoleReader, s.handleError(negotiate(s.handleGetSwiftCodeV1, csvMediaTypes...)))
+	handle("GET /swift-codes/{swiftCode}/{resource}", auth.RoleReader, s.handleError(negotiate(s.handleGetSwiftCodeHistoryV1, defaultMediaTypes...)))
+	handle("GET /swift-codes/search", auth.RoleReader, s.handleError(negotiate(s.handleSearchSwiftCodesV1, defaultMediaTypes...)))
+	handle("POST /swift-codes/lookup", auth.RoleReader, s.handleError(negotiate(s.handleLookupSwiftCodesV1, defaultMediaTypes...)))
+	handle("GET /swift-codes/country/{countryISO2code}", auth.RoleReader, s.handleError(negotiate(s.handleGetSwiftCodesForCountryV1, csvMediaTypes...)))
+	handle("POST /swift-codes", auth.RoleEditor, s.handleError(negotiate(s.handleAddSwiftCodeV1, defaultMediaTypes...)))
+	handle("POST /swift-codes/batch", auth.RoleEditor, s.handleError(negotiate(s.handleAddSwiftCodesBatchV1, defaultMediaTypes...)))
+	handle("PUT /swift-codes/{swiftCode}", auth.RoleEditor, s.handleError(negotiate(s.handleReplaceSwiftCodeV1, defaultMediaTypes...)))
+	handle("PATCH /swift-codes/{swiftCode}", auth.RoleEditor, s.handleError(negotiate(s.handleUpdateSwiftCodeV1, defaultMediaTypes...)))
+	handle("DELETE /swift-codes/{swiftCode}", auth.RoleEditor, s.handleError(negotiate(s.handleDeleteSwiftCodeV1, defaultMediaTypes...)))
+	handle("POST /swift-codes/{swiftCode}/{action}", auth.RoleEditor, s.handleError(negotiate(s.handleRestoreSwiftCodeV1, defaultMediaTypes...)))
+	handle("DELETE /admin/swift-codes/{swiftCode}", auth.RoleAdmin, s.handleError(negotiate(s.handlePurgeSwiftCodeV1, defaultMediaTypes...)))
+	handle("GET /admin/cache", auth.RoleAdmin, s.handleError(negotiate(s.handleGetCacheStatsV1, defaultMediaTypes...)))
+	// The format is picked with a query parameter, since exports are downloaded as files
+	handle("GET /export", auth.RoleReader, s.handleError(s.handleExportV1))
+
+	if s.limiter != nil {
+		for _, route := range s.limiter.UnknownRoutes(patterns) {
+			s.logger.Printf("WARNING: rate limit for unknown route '%s'", route)
+		}
+	}
 
 	rootRouter := http.NewServeMux()
 	rootRouter.Handle("/v1/", http.StripPrefix("/v1", routerV1))
@@ -84,9 +178,19 @@ func (s *ApiServer) NewRouter() *http.ServeMux {
 	return rootRouter
 }
 
+// Authenticates requests before they reach the handler, with the middlewares enabled in AuthConfig
+func (s *ApiServer) withAuth(handler http.Handler) http.Handler {
+	if s.authCfg.Keys != nil {
+		handler = AuthMiddleware(handler, s.authCfg.Keys, s.logger)
+	}
+	if s.authCfg.Tokens != nil {
+		handler = BearerMiddleware(handler, s.authCfg.Tokens, s.logger)
+	}
+	return handler
+}
+
 func (s *ApiServer) Run() {
-	rootRouter := s.NewRouter()
-	http.ListenAndServe(s.address, LoggingMiddleware(rootRouter, s.logger))
+	http.ListenAndServe(s.address, LoggingMiddleware(s.withAuth(s.NewRouter()), s.logger))
 }
 
 func (s *ApiServer) handleError(f func(http.ResponseWriter, *http.Request) error) http.HandlerFunc {
@@ -98,3 +202,10 @@ func (s *ApiServer) handleError(f func(http.ResponseWriter, *http.Request) error
 		}
 	})
 }
+
+// For errors after the response started streaming, when the status can't be changed anymore.
+// Closes the connection, so the client can tell the response is incomplete.
+func (s *ApiServer) abortResponse(r *http.Request, err error) {
+	s.logger.Printf(`ERROR on %s %s after writing the response: "%s"`, r.Method, r.URL.Path, err)
+	panic(http.ErrAbortHandler)
+}
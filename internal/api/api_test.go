@@ -10,6 +10,7 @@ import (
 	"testing"
 
 	"github.com/go-playground/validator/v10"
+	"github.com/mwojtyna/swift-api/internal/bic"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
@@ -42,6 +43,19 @@ func TestValidateStruct(t *testing.T) {
 	}
 }
 
+func TestValidateStructBicReasons(t *testing.T) {
+	type ts struct {
+		SwiftCode string `validate:"bic"`
+	}
+
+	validate := validator.New()
+	require.NoError(t, bic.RegisterValidation(validate))
+
+	err := ValidateStruct(ts{SwiftCode: "ABCDQQ2LXXX"}, validate)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), `'SwiftCode': bic (country: "QQ" is not an ISO 3166-1 country code)`)
+}
+
 func TestReadJson(t *testing.T) {
 	type ts struct {
 		Name string `json:"name"`
@@ -97,6 +111,62 @@ func TestReadJson(t *testing.T) {
 	}
 }
 
+func TestReadQueryInt(t *testing.T) {
+	tests := []struct {
+		name    string
+		query   string
+		want    int
+		wantErr bool
+	}{
+		{"not set returns default", "", 10, false},
+		{"parsed", "limit=5", 5, false},
+		{"not an integer", "limit=abc", 0, true},
+		{"below min", "limit=0", 0, true},
+		{"above max", "limit=101", 0, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/?"+tt.query, nil)
+
+			got, err := ReadQueryInt(req, "limit", 10, 1, 100)
+
+			if tt.wantErr {
+				assert.Error(t, err)
+			} else {
+				require.NoError(t, err)
+				assert.Equal(t, tt.want, got)
+			}
+		})
+	}
+}
+
+func TestDecodeCursor(t *testing.T) {
+	tests := []struct {
+		name    string
+		cursor  string
+		want    string
+		wantErr bool
+	}{
+		{"empty cursor", "", "", false},
+		{"round trip", encodeCursor("ABCDGB2LXXX"), "ABCDGB2LXXX", false},
+		{"not base64", "!!!", "", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := decodeCursor(tt.cursor)
+
+			if tt.wantErr {
+				assert.Error(t, err)
+			} else {
+				require.NoError(t, err)
+				assert.Equal(t, tt.want, got)
+			}
+		})
+	}
+}
+
 func TestWriteJson(t *testing.T) {
 	type ts struct {
 		Name string `json:"name"`
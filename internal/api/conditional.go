@@ -0,0 +1,193 @@
+package api
+
+import (
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/mwojtyna/swift-api/internal/db"
+)
+
+// Strong ETag of a response made of the banks, which changes whenever one of them changes or a bank joins or leaves
+// the response. Responses in different media types get different tags. extra is for the parts of the response which
+// don't come from the banks. The order of the banks doesn't matter, so the same banks read by another query get
+// the same tag.
+func banksETag(mediaType string, extra string, banks []db.Bank) string {
+	banks = slices.SortedFunc(slices.Values(banks), func(a, b db.Bank) int {
+		return strings.Compare(a.SwiftCode, b.SwiftCode)
+	})
+
+	h := sha256.New()
+	fmt.Fprintf(h, "%s\n%s\n", mediaType, extra)
+	for _, b := range banks {
+		fmt.Fprintf(h, "%s %d\n", b.SwiftCode, b.Version)
+	}
+
+	return `"` + hex.EncodeToString(h.Sum(nil)[:16]) + `"`
+}
+
+// The newest change of the banks. Only right for responses which no bank can leave without changing another one in
+// them, like an HQ with its branches, which gets a new version when a branch is deleted or relinked.
+func banksLastModified(banks []db.Bank) time.Time {
+	var last time.Time
+	for _, b := range banks {
+		if b.UpdatedAt.After(last) {
+			last = b.UpdatedAt
+		}
+	}
+
+	return last
+}
+
+// Responses can be stored by shared caches only if anyone can read them. Banks can change at any time,
+// so clients have to revalidate before reusing a response, which is cheap with the ETag.
+func (s *ApiServer) cacheControl() string {
+	if s.authCfg.enabled() && !s.authCfg.PublicReads {
+		return "private, no-cache"
+	}
+	return "public, no-cache"
+}
+
+// Sets the validators of a successful GET response, lastModified can be zero to only use the ETag. Responds with 304
+// and returns true if the client's copy is still fresh. Like RFC 9110 section 13.2.2, If-Modified-Since is ignored
+// when If-None-Match is present.
+func (s *ApiServer) checkNotModified(w http.ResponseWriter, r *http.Request, etag string, lastModified time.Time) bool {
+	w.Header().Set("ETag", etag)
+	if !lastModified.IsZero() {
+		w.Header().Set("Last-Modified", lastModified.UTC().Format(http.TimeFormat))
+	}
+	w.Header().Set("Cache-Control", s.cacheControl())
+
+	if ifNoneMatch := r.Header.Values("If-None-Match"); len(ifNoneMatch) > 0 {
+		if !matchETag(parseETags(ifNoneMatch), etag, false) {
+			return false
+		}
+	} else {
+		since, err := http.ParseTime(r.Header.Get("If-Modified-Since"))
+		// Last-Modified is only precise to the second
+		if err != nil || lastModified.IsZero() || lastModified.Truncate(time.Second).After(since) {
+			return false
+		}
+	}
+
+	w.WriteHeader(http.StatusNotModified)
+	return true
+}
+
+// Implemented by db.CachedRepository
+type uncachedRepository interface {
+	Uncached() db.BankRepository
+}
+
+// Preconditions are checked against the database, since a cached bank can be older than the client's copy
+func (s *ApiServer) uncachedRepo() db.BankRepository {
+	if cached, ok := s.repo.(uncachedRepository); ok {
+		return cached.Uncached()
+	}
+	return s.repo
+}
+
+// Writes 412 unless the bank's current ETag is in the If-Match header. The ETags are the ones of
+// GET /v1/swift-codes/{swiftCode}, in any media type, or for deleted banks the one DELETE responded with.
+// Returns the version the change has to be made against, which is 0 if it can be made against any version,
+// because there's no If-Match or it's "*". An HQ gets a new version whenever its branches change, so the HQ's
+// version alone guards everything its ETag was computed from.
+func (s *ApiServer) checkIfMatch(w http.ResponseWriter, r *http.Request, swiftCode string, deleted bool) (int64, bool, error) {
+	bank, ok, err := s.checkIfMatchBank(w, r, swiftCode, deleted)
+	if bank == nil {
+		return 0, ok, err
+	}
+	return bank.Version, ok, err
+}
+
+// Same as checkIfMatch, but returns the bank the ETag matched, as read from the database. It's nil if the change
+// can be made against any version.
+func (s *ApiServer) checkIfMatchBank(w http.ResponseWriter, r *http.Request, swiftCode string, deleted bool) (*db.Bank, bool, error) {
+	header := r.Header.Values("If-Match")
+	if len(header) == 0 {
+		return nil, true, nil
+	}
+	etags := parseETags(header)
+
+	// Deleted banks have no branches, they lost them when they were deleted. Others are read with their branches
+	// in one query, so the tag isn't computed from a mix of versions.
+	repo := s.uncachedRepo()
+	var banks []db.Bank
+	var err error
+	if deleted {
+		var bank db.Bank
+		bank, err = repo.GetDeletedBank(swiftCode)
+		banks = []db.Bank{bank}
+	} else {
+		banks, err = repo.GetBanksWithBranches([]string{swiftCode})
+	}
+	i := slices.IndexFunc(banks, func(b db.Bank) bool {
+		return b.SwiftCode == swiftCode
+	})
+	if errors.Is(err, sql.ErrNoRows) || (err == nil && i < 0) {
+		// Even "*" needs the bank to exist
+		writePreconditionFailed(w, swiftCode)
+		return nil, false, nil
+	} else if err != nil {
+		return nil, false, err
+	}
+	if slices.Contains(etags, "*") {
+		return nil, true, nil
+	}
+
+	for _, mediaType := range csvMediaTypes {
+		if matchETag(etags, banksETag(mediaType, "", banks), true) {
+			return &banks[i], true, nil
+		}
+	}
+
+	writePreconditionFailed(w, swiftCode)
+	return nil, false, nil
+}
+
+func writePreconditionFailed(w http.ResponseWriter, swiftCode string) {
+	res := MessageRes{Message: fmt.Sprintf("Bank with SWIFT code %s was changed or deleted, fetch it again before changing it", swiftCode)}
+	WriteResponse(w, http.StatusPreconditionFailed, res)
+}
+
+// Splits If-Match and If-None-Match headers into entity tags, keeping the quotes and W/ prefixes
+func parseETags(headers []string) []string {
+	var etags []string
+	for _, header := range headers {
+		for _, etag := range strings.Split(header, ",") {
+			etag = strings.TrimSpace(etag)
+			if etag != "" {
+				etags = append(etags, etag)
+			}
+		}
+	}
+
+	return etags
+}
+
+// Strong comparison for If-Match, where weak tags never match, and weak comparison for If-None-Match.
+// "*" in the list matches any tag.
+func matchETag(etags []string, etag string, strong bool) bool {
+	for _, candidate := range etags {
+		if candidate == "*" {
+			return true
+		}
+		if strings.HasPrefix(candidate, "W/") {
+			if strong {
+				continue
+			}
+			candidate = strings.TrimPrefix(candidate, "W/")
+		}
+		if candidate == etag {
+			return true
+		}
+	}
+
+	return false
+}
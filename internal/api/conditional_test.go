@@ -0,0 +1,312 @@
+package api
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mwojtyna/swift-api/internal/auth"
+	"github.com/mwojtyna/swift-api/internal/db"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMatchETag(t *testing.T) {
+	tests := []struct {
+		name     string
+		header   []string
+		strong   bool
+		expected bool
+	}{
+		{"same", []string{`"abc"`}, true, true},
+		{"different", []string{`"abd"`}, true, false},
+		{"any", []string{"*"}, true, true},
+		{"list", []string{`"x", "abc"`}, true, true},
+		{"multiple headers", []string{`"x"`, `"abc"`}, true, true},
+		{"weak in strong comparison", []string{`W/"abc"`}, true, false},
+		{"weak in weak comparison", []string{`W/"abc"`}, false, true},
+		{"unquoted", []string{"abc"}, false, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.expected, matchETag(parseETags(tt.header), `"abc"`, tt.strong))
+		})
+	}
+}
+
+func TestCacheControl(t *testing.T) {
+	keys := auth.FileKeyStore{}
+	tests := []struct {
+		name     string
+		authCfg  AuthConfig
+		expected string
+	}{
+		{"auth disabled", AuthConfig{}, "public, no-cache"},
+		{"public reads", AuthConfig{Keys: keys, PublicReads: true}, "public, no-cache"},
+		{"auth required", AuthConfig{Keys: keys}, "private, no-cache"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := &ApiServer{authCfg: tt.authCfg}
+			assert.Equal(t, tt.expected, s.cacheControl())
+		})
+	}
+}
+
+func TestConditionalRequestsWithMemoryRepository(t *testing.T) {
+	// Arrange
+	router := testMemoryApi(t, memoryTestCsv)
+	serve := func(method string, target string, body string, headers map[string]string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(method, target, strings.NewReader(body))
+		r.Header.Set("Content-Type", "application/json")
+		for name, value := range headers {
+			r.Header.Set(name, value)
+		}
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, r)
+		return w
+	}
+	const hq = "/v1/swift-codes/ABCDGB2LXXX"
+
+	w := serve("GET", hq, "", nil)
+	require.Equal(t, http.StatusOK, w.Code)
+	etag := w.Header().Get("ETag")
+	lastModified := w.Header().Get("Last-Modified")
+	require.NotEmpty(t, etag)
+	require.NotEmpty(t, lastModified)
+	assert.Equal(t, "public, no-cache", w.Header().Get("Cache-Control"))
+
+	t.Run("if-none-match", func(t *testing.T) {
+		// Act
+		w := serve("GET", hq, "", map[string]string{"If-None-Match": etag})
+		weak := serve("GET", hq, "", map[string]string{"If-None-Match": "W/" + etag})
+		other := serve("GET", hq, "", map[string]string{"If-None-Match": `"other"`, "If-Modified-Since": lastModified})
+
+		// Assert
+		assert.Equal(t, http.StatusNotModified, w.Code)
+		assert.Empty(t, w.Body.String())
+		assert.Equal(t, etag, w.Header().Get("ETag"))
+		assert.Equal(t, http.StatusNotModified, weak.Code)
+		assert.Equal(t, http.StatusOK, other.Code, "If-Modified-Since is ignored with If-None-Match")
+	})
+
+	t.Run("if-modified-since", func(t *testing.T) {
+		// Arrange
+		modified, err := http.ParseTime(lastModified)
+		require.NoError(t, err)
+
+		// Act
+		w := serve("GET", hq, "", map[string]string{"If-Modified-Since": lastModified})
+		older := serve("GET", hq, "", map[string]string{"If-Modified-Since": modified.Add(-time.Second).Format(http.TimeFormat)})
+
+		// Assert
+		assert.Equal(t, http.StatusNotModified, w.Code)
+		assert.Equal(t, http.StatusOK, older.Code)
+	})
+
+	t.Run("media types have their own etags", func(t *testing.T) {
+		// Act
+		w := serve("GET", hq, "", map[string]string{"Accept": mediaTypeCsv, "If-None-Match": etag})
+
+		// Assert
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.NotEqual(t, etag, w.Header().Get("ETag"))
+	})
+
+	t.Run("country", func(t *testing.T) {
+		// Act
+		w := serve("GET", "/v1/swift-codes/country/GB", "", nil)
+		require.Equal(t, http.StatusOK, w.Code)
+		notModified := serve("GET", "/v1/swift-codes/country/GB", "", map[string]string{"If-None-Match": w.Header().Get("ETag")})
+		page := serve("GET", "/v1/swift-codes/country/GB?limit=1", "", map[string]string{"If-None-Match": w.Header().Get("ETag")})
+
+		// Assert
+		assert.Equal(t, http.StatusNotModified, notModified.Code)
+		assert.Equal(t, http.StatusOK, page.Code)
+	})
+
+	t.Run("if-match", func(t *testing.T) {
+		// Act & Assert
+		patch := `{"address":"1 New Street"}`
+		w := serve("PATCH", hq, patch, map[string]string{"If-Match": `"stale"`})
+		assert.Equal(t, http.StatusPreconditionFailed, w.Code)
+		w = serve("PATCH", hq, patch, map[string]string{"If-Match": "W/" + etag})
+		assert.Equal(t, http.StatusPreconditionFailed, w.Code, "weak tags don't match")
+		w = serve("PATCH", "/v1/swift-codes/ZZZZGB2LXXX", patch, map[string]string{"If-Match": "*"})
+		assert.Equal(t, http.StatusPreconditionFailed, w.Code)
+
+		w = serve("PATCH", hq, patch, map[string]string{"If-Match": etag})
+		require.Equal(t, http.StatusOK, w.Code)
+
+		// The first edit changed the ETag, so an edit made against the same one fails
+		w = serve("PUT", hq, `{"address":"2 New Street","bankName":"HQ Bank","countryISO2":"GB","countryName":"UNITED KINGDOM","isHeadquarter":true,"swiftCode":"ABCDGB2LXXX"}`,
+			map[string]string{"If-Match": etag})
+		assert.Equal(t, http.StatusPreconditionFailed, w.Code)
+		w = serve("GET", hq, "", map[string]string{"If-None-Match": etag})
+		require.Equal(t, http.StatusOK, w.Code)
+		assert.Contains(t, w.Body.String(), "1 New Street")
+		etag = w.Header().Get("ETag")
+
+		// Changing a branch changes its HQ's response too
+		w = serve("PATCH", "/v1/swift-codes/ABCDGB2L001", patch, map[string]string{"If-Match": "*"})
+		require.Equal(t, http.StatusOK, w.Code)
+		w = serve("DELETE", hq, "", map[string]string{"If-Match": etag})
+		assert.Equal(t, http.StatusPreconditionFailed, w.Code)
+		w = serve("DELETE", hq, "", map[string]string{"If-Match": serve("GET", hq, "", nil).Header().Get("ETag")})
+		assert.Equal(t, http.StatusOK, w.Code)
+	})
+
+	t.Run("deleted banks", func(t *testing.T) {
+		// Arrange
+		const pl = "/v1/swift-codes/EFGHPLPWXXX"
+		const purge = "/v1/admin/swift-codes/EFGHPLPWXXX"
+		etag := serve("GET", pl, "", nil).Header().Get("ETag")
+
+		// Act & Assert
+		w := serve("DELETE", pl, "", map[string]string{"If-Match": etag})
+		require.Equal(t, http.StatusOK, w.Code)
+		deletedETag := w.Header().Get("ETag")
+		require.NotEmpty(t, deletedETag)
+		assert.NotEqual(t, etag, deletedETag)
+
+		w = serve("POST", pl+"/restore", "", map[string]string{"If-Match": etag})
+		assert.Equal(t, http.StatusPreconditionFailed, w.Code)
+		w = serve("POST", pl+"/restore", "", map[string]string{"If-Match": deletedETag})
+		require.Equal(t, http.StatusOK, w.Code)
+		w = serve("POST", pl+"/restore", "", map[string]string{"If-Match": "*"})
+		assert.Equal(t, http.StatusPreconditionFailed, w.Code, "not deleted anymore")
+
+		w = serve("DELETE", pl, "", nil)
+		require.Equal(t, http.StatusOK, w.Code)
+		purged := serve("DELETE", purge, "", map[string]string{"If-Match": deletedETag})
+		assert.Equal(t, http.StatusPreconditionFailed, purged.Code, "deleted again since")
+		purged = serve("DELETE", purge, "", map[string]string{"If-Match": w.Header().Get("ETag")})
+		assert.Equal(t, http.StatusOK, purged.Code)
+	})
+}
+
+func TestLastModifiedWithMemoryRepository(t *testing.T) {
+	// Arrange
+	router := testMemoryApi(t, memoryTestCsv)
+	serve := func(method string, target string, headers map[string]string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(method, target, nil)
+		for name, value := range headers {
+			r.Header.Set(name, value)
+		}
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, r)
+		return w
+	}
+	const hq = "/v1/swift-codes/ABCDGB2LXXX"
+
+	w := serve("GET", hq, nil)
+	require.Equal(t, http.StatusOK, w.Code)
+	lastModified := w.Header().Get("Last-Modified")
+	modified, err := http.ParseTime(lastModified)
+	require.NoError(t, err)
+	// Last-Modified is only precise to the second, so the change has to be made in the next one
+	time.Sleep(time.Until(modified.Add(time.Second)))
+
+	// Act
+	deleted := serve("DELETE", "/v1/swift-codes/ABCDGB2L001", nil)
+	w = serve("GET", hq, map[string]string{"If-Modified-Since": lastModified})
+	country := serve("GET", "/v1/swift-codes/country/GB", nil)
+
+	// Assert
+	require.Equal(t, http.StatusOK, deleted.Code)
+	assert.Equal(t, http.StatusOK, w.Code, "deleting a branch changes its HQ")
+	assert.NotContains(t, w.Body.String(), "ABCDGB2L001")
+	assert.NotEqual(t, lastModified, w.Header().Get("Last-Modified"))
+	assert.Equal(t, http.StatusOK, country.Code)
+	assert.Empty(t, country.Header().Get("Last-Modified"))
+}
+
+func TestIfMatchWithCachedRepository(t *testing.T) {
+	// Arrange
+	inner := testMemoryRepository(t, memoryTestCsv)
+	logger := log.New(io.Discard, "", 0)
+	cached := NewApiServer(":0", db.NewCachedRepository(inner, 100, time.Hour), AuthConfig{}, nil, logger).NewRouter()
+	uncached := NewApiServer(":0", inner, AuthConfig{}, nil, logger).NewRouter()
+	serve := func(router http.Handler, method string, target string, headers map[string]string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(method, target, strings.NewReader(`{"address":"1 New Street"}`))
+		r.Header.Set("Content-Type", "application/json")
+		for name, value := range headers {
+			r.Header.Set(name, value)
+		}
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, r)
+		return w
+	}
+	const hq = "/v1/swift-codes/ABCDGB2LXXX"
+
+	stale := serve(cached, "GET", hq, nil).Header().Get("ETag")
+	// Changed behind the cache's back, like by a sync
+	require.Equal(t, http.StatusOK, serve(uncached, "PATCH", hq, nil).Code)
+	fresh := serve(uncached, "GET", hq, nil).Header().Get("ETag")
+	require.Equal(t, stale, serve(cached, "GET", hq, nil).Header().Get("ETag"), "still cached")
+
+	// Act
+	staleRes := serve(cached, "DELETE", hq, map[string]string{"If-Match": stale})
+	freshRes := serve(cached, "DELETE", hq, map[string]string{"If-Match": fresh})
+
+	// Assert
+	assert.Equal(t, http.StatusPreconditionFailed, staleRes.Code)
+	assert.Equal(t, http.StatusOK, freshRes.Code)
+}
+
+func TestPatchWithStaleCachedBank(t *testing.T) {
+	// Arrange
+	inner := testMemoryRepository(t, memoryTestCsv)
+	logger := log.New(io.Discard, "", 0)
+	cached := NewApiServer(":0", db.NewCachedRepository(inner, 100, time.Hour), AuthConfig{}, nil, logger).NewRouter()
+	uncached := NewApiServer(":0", inner, AuthConfig{}, nil, logger).NewRouter()
+	serve := func(router http.Handler, method string, target string, body string, headers map[string]string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(method, target, strings.NewReader(body))
+		r.Header.Set("Content-Type", "application/json")
+		for name, value := range headers {
+			r.Header.Set(name, value)
+		}
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, r)
+		return w
+	}
+	const hq = "/v1/swift-codes/ABCDGB2LXXX"
+
+	tests := []struct {
+		name    string
+		ifMatch bool
+	}{
+		{"with if-match", true},
+		{"without if-match", false},
+	}
+
+	for i, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Arrange
+			require.Equal(t, http.StatusOK, serve(cached, "GET", hq, "", nil).Code)
+			// Changed behind the cache's back, like by a sync
+			bankName := fmt.Sprintf("Renamed Bank %d", i)
+			require.Equal(t, http.StatusOK, serve(uncached, "PATCH", hq, `{"bankName":"`+bankName+`"}`, nil).Code)
+			headers := map[string]string{}
+			if tt.ifMatch {
+				headers["If-Match"] = serve(uncached, "GET", hq, "", nil).Header().Get("ETag")
+			}
+
+			// Act
+			w := serve(cached, "PATCH", hq, `{"address":"1 New Street"}`, headers)
+
+			// Assert
+			require.Equal(t, http.StatusOK, w.Code)
+			body := serve(uncached, "GET", hq, "", nil).Body.String()
+			assert.Contains(t, body, "1 New Street")
+			assert.Contains(t, body, bankName, "the other change isn't reverted")
+		})
+	}
+}
@@ -0,0 +1,113 @@
+package api
+
+import (
+	"encoding/json"
+	"io"
+
+	"github.com/mwojtyna/swift-api/internal/db"
+	"github.com/mwojtyna/swift-api/internal/parser"
+	"github.com/parquet-go/parquet-go"
+)
+
+// Writes banks one at a time in some file format. Close must be called to finish the file.
+type exportEncoder interface {
+	Encode(bank db.Bank) error
+	Close() error
+}
+
+type exportFormat struct {
+	contentType string
+	extension   string
+	newEncoder  func(w io.Writer) exportEncoder
+}
+
+const defaultExportFormat = "csv"
+
+var exportFormats = map[string]exportFormat{
+	"csv": {
+		contentType: "text/csv",
+		extension:   "csv",
+		newEncoder:  func(w io.Writer) exportEncoder { return &csvExportEncoder{parser.NewCsvWriter(w)} },
+	},
+	"jsonl": {
+		contentType: "application/jsonl",
+		extension:   "jsonl",
+		newEncoder:  func(w io.Writer) exportEncoder { return &jsonlExportEncoder{json.NewEncoder(w)} },
+	},
+	"parquet": {
+		contentType: "application/vnd.apache.parquet",
+		extension:   "parquet",
+		newEncoder: func(w io.Writer) exportEncoder {
+			return &parquetExportEncoder{parquet.NewGenericWriter[ExportSwiftCode](w)}
+		},
+	},
+}
+
+// Uses the parser's format, so the export can be imported with the parser
+type csvExportEncoder struct {
+	w *parser.CsvWriter
+}
+
+func (e *csvExportEncoder) Encode(bank db.Bank) error {
+	return e.w.Write(bank)
+}
+
+func (e *csvExportEncoder) Close() error {
+	// Even an empty export should have a header
+	err := e.w.WriteHeader()
+	if err != nil {
+		return err
+	}
+	return e.w.Flush()
+}
+
+type jsonlExportEncoder struct {
+	enc *json.Encoder
+}
+
+func (e *jsonlExportEncoder) Encode(bank db.Bank) error {
+	return e.enc.Encode(exportFromBank(bank)) // Adds the newline
+}
+
+func (e *jsonlExportEncoder) Close() error {
+	return nil
+}
+
+type parquetExportEncoder struct {
+	w *parquet.GenericWriter[ExportSwiftCode]
+}
+
+func (e *parquetExportEncoder) Encode(bank db.Bank) error {
+	_, err := e.w.Write([]ExportSwiftCode{exportFromBank(bank)})
+	return err
+}
+
+func (e *parquetExportEncoder) Close() error {
+	return e.w.Close()
+}
+
+func exportFromBank(bank db.Bank) ExportSwiftCode {
+	res := ExportSwiftCode{
+		SwiftCode:     bank.SwiftCode,
+		IsHeadquarter: bank.IsHeadquarter,
+		BankName:      bank.BankName,
+		Address:       bank.Address,
+		TownName:      bank.TownName,
+		CountryISO2:   bank.CountryISO2Code,
+		CountryName:   bank.CountryName,
+	}
+	if bank.HqSwiftCode.Valid {
+		res.HqSwiftCode = &bank.HqSwiftCode.String
+	}
+
+	return res
+}
+
+func exportFromSnapshot(snapshot *db.BankSnapshot) *ExportSwiftCode {
+	if snapshot == nil {
+		return nil
+	}
+
+	res := exportFromBank(db.Bank(*snapshot))
+	return &res
+}
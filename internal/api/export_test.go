@@ -0,0 +1,68 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/mwojtyna/swift-api/internal/db"
+	"github.com/mwojtyna/swift-api/internal/parser"
+	"github.com/parquet-go/parquet-go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestExportFormats(t *testing.T) {
+	banks := []db.Bank{hqBank, branchBank1}
+
+	testCases := []struct {
+		format string
+		check  func(t *testing.T, body []byte)
+	}{
+		{
+			format: "csv",
+			check: func(t *testing.T, body []byte) {
+				parsed, err := parser.ParseCsv(bytes.NewReader(body))
+				require.NoError(t, err)
+				assert.Equal(t, banks, parsed)
+			},
+		},
+		{
+			format: "jsonl",
+			check: func(t *testing.T, body []byte) {
+				lines := strings.Split(strings.TrimSpace(string(body)), "\n")
+				require.Len(t, lines, 2)
+
+				var branch ExportSwiftCode
+				require.NoError(t, json.Unmarshal([]byte(lines[1]), &branch))
+				assert.Equal(t, exportFromBank(branchBank1), branch)
+			},
+		},
+		{
+			format: "parquet",
+			check: func(t *testing.T, body []byte) {
+				rows, err := parquet.Read[ExportSwiftCode](bytes.NewReader(body), int64(len(body)))
+				require.NoError(t, err)
+				assert.Equal(t, []ExportSwiftCode{exportFromBank(hqBank), exportFromBank(branchBank1)}, rows)
+			},
+		},
+	}
+
+	for _, tt := range testCases {
+		t.Run(tt.format, func(t *testing.T) {
+			// Arrange
+			var buf bytes.Buffer
+			enc := exportFormats[tt.format].newEncoder(&buf)
+
+			// Act
+			for _, bank := range banks {
+				require.NoError(t, enc.Encode(bank))
+			}
+			require.NoError(t, enc.Close())
+
+			// Assert
+			tt.check(t, buf.Bytes())
+		})
+	}
+}
@@ -1,8 +1,17 @@
 package api
 
 import (
+	"errors"
+	"fmt"
 	"log"
+	"math"
 	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mwojtyna/swift-api/internal/auth"
+	"github.com/mwojtyna/swift-api/internal/ratelimit"
 )
 
 type wrappedWriter struct {
@@ -27,3 +36,170 @@ func LoggingMiddleware(next http.Handler, l *log.Logger) http.Handler {
 		l.Printf("%d %s %s from %s", wrapped.statusCode, r.Method, r.URL.Path, r.RemoteAddr)
 	})
 }
+
+const apiKeyHeader = "X-API-Key"
+
+// Authenticates requests with a key in the X-API-Key header and puts it in the request context, see auth.KeyFromContext.
+// Requests without a key pass through, routes decide whether they need one with ApiServer.requireRole.
+func AuthMiddleware(next http.Handler, keys auth.KeyStore, l *log.Logger) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		raw := r.Header.Get(apiKeyHeader)
+		if raw == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		key, ok, err := keys.Lookup(auth.HashKey(raw))
+		if err != nil {
+			WriteHttpError(w, http.StatusInternalServerError)
+			l.Printf(`ERROR looking up API key on %s %s: "%s"`, r.Method, r.URL.Path, err)
+			return
+		}
+		if !ok {
+			writeAuthError(w, r, http.StatusUnauthorized, "Invalid API key", apiKeyHeader)
+			return
+		}
+
+		next.ServeHTTP(w, r.WithContext(auth.WithKey(r.Context(), key)))
+	})
+}
+
+// Authenticates requests with a JWT in the "Authorization: Bearer" header. Like AuthMiddleware, it puts the token's
+// subject and the role from its scopes in the request context, and lets requests without a token through.
+func BearerMiddleware(next http.Handler, tokens *auth.TokenVerifier, l *log.Logger) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		scheme, token, found := strings.Cut(r.Header.Get("Authorization"), " ")
+		if !found || !strings.EqualFold(scheme, "Bearer") {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		key, err := tokens.Verify(strings.TrimSpace(token))
+		if errors.Is(err, auth.ErrJwksUnavailable) {
+			// The key could be one the provider rotated to, but until it can be fetched the token can't be trusted
+			l.Printf(`ERROR verifying token on %s %s: "%s"`, r.Method, r.URL.Path, err)
+			writeAuthError(w, r, http.StatusUnauthorized, "Invalid bearer token: signed with an unknown key", `Bearer error="invalid_token"`)
+			return
+		}
+		if errors.Is(err, auth.ErrNoScope) {
+			writeAuthError(w, r, http.StatusForbidden, "Bearer "+err.Error())
+			return
+		}
+		if err != nil {
+			writeAuthError(w, r, http.StatusUnauthorized, fmt.Sprintf("Invalid bearer token: %s", err), `Bearer error="invalid_token"`)
+			return
+		}
+
+		next.ServeHTTP(w, r.WithContext(auth.WithKey(r.Context(), key)))
+	})
+}
+
+// Responds with 401 if the request has no credentials and 403 if their role isn't high enough.
+// Does nothing if authentication is disabled, or for RoleReader routes with AuthConfig.PublicReads.
+func (s *ApiServer) requireRole(role auth.Role) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		if !s.authCfg.enabled() || (role == auth.RoleReader && s.authCfg.PublicReads) {
+			return next
+		}
+
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			key, ok := auth.KeyFromContext(r.Context())
+			if !ok {
+				writeAuthError(w, r, http.StatusUnauthorized, s.missingCredentialsMessage(), s.authCfg.challenges()...)
+				return
+			}
+			if !key.Role.Allows(role) {
+				writeAuthError(w, r, http.StatusForbidden,
+					fmt.Sprintf("'%s' has role %s, this requires %s (scope %s)", key.Name, key.Role, role, auth.RoleScope(role)))
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+func (s *ApiServer) missingCredentialsMessage() string {
+	switch {
+	case s.authCfg.Keys != nil && s.authCfg.Tokens != nil:
+		return fmt.Sprintf("Missing credentials, send a bearer token in the Authorization header or an API key in the %s header", apiKeyHeader)
+	case s.authCfg.Tokens != nil:
+		return "Missing bearer token, send it in the Authorization header"
+	default:
+		return fmt.Sprintf("Missing API key, send it in the %s header", apiKeyHeader)
+	}
+}
+
+// Challenges go in WWW-Authenticate headers
+func writeAuthError(w http.ResponseWriter, r *http.Request, status int, message string, challenges ...string) {
+	for _, c := range challenges {
+		w.Header().Add("WWW-Authenticate", c)
+	}
+	writeMiddlewareError(w, r, status, message)
+}
+
+// Tells the client how many requests it has left for the route, and rejects the request with 429 if it has none.
+// Authenticated clients are limited by their API key or token subject, others by limiter's client header if a trusted
+// proxy sent it, and by their IP otherwise.
+func (s *ApiServer) rateLimit(route string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		if s.limiter == nil {
+			return next
+		}
+
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			d := s.limiter.Allow(rateLimitClient(r, s.limiter), route)
+
+			h := w.Header()
+			if d.Limited {
+				h.Set("RateLimit-Limit", strconv.Itoa(d.Limit))
+				h.Set("RateLimit-Remaining", strconv.Itoa(d.Remaining))
+				h.Set("RateLimit-Reset", strconv.Itoa(ceilSeconds(d.Reset)))
+			}
+			if d.Quota > 0 {
+				h.Set("X-Quota-Limit", strconv.Itoa(d.Quota))
+				h.Set("X-Quota-Remaining", strconv.Itoa(d.QuotaRemaining))
+				h.Set("X-Quota-Reset", strconv.Itoa(ceilSeconds(d.QuotaReset)))
+			}
+
+			if !d.Allowed {
+				h.Set("Retry-After", strconv.Itoa(max(1, ceilSeconds(d.RetryAfter))))
+				message := "Too many requests, try again later"
+				if d.QuotaExceeded {
+					message = fmt.Sprintf("Daily quota of %d requests exceeded, try again after it resets", d.Quota)
+				}
+				writeMiddlewareError(w, r, http.StatusTooManyRequests, message)
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// Credentials can't be made up, unlike headers, so they're preferred over the client header, which is only believed
+// from trusted proxies, and the IP. Prefixed so a key name, a client header and an IP can't share a bucket.
+func rateLimitClient(r *http.Request, limiter *ratelimit.Limiter) string {
+	if key, ok := auth.KeyFromContext(r.Context()); ok {
+		return "key:" + key.Name
+	}
+	if header := limiter.ClientHeader(); header != "" && limiter.FromTrustedProxy(r.RemoteAddr) {
+		if client := r.Header.Get(header); client != "" {
+			return "client:" + client
+		}
+	}
+	return "ip:" + limiter.ClientIP(r.RemoteAddr, r.Header.Values("X-Forwarded-For"))
+}
+
+func ceilSeconds(d time.Duration) int {
+	return int(math.Ceil(d.Seconds()))
+}
+
+// Written as a MessageRes in the format the client accepts, or JSON if it doesn't accept any of the default ones
+func writeMiddlewareError(w http.ResponseWriter, r *http.Request, status int, message string) {
+	mediaType, ok := selectMediaType(r.Header.Values("Accept"), defaultMediaTypes)
+	if ok {
+		w = &negotiatedWriter{ResponseWriter: w, mediaType: mediaType}
+	}
+	WriteResponse(w, status, MessageRes{Message: message})
+}
@@ -2,12 +2,27 @@ package api
 
 import (
 	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"io"
 	"log"
 	"net/http"
 	"net/http/httptest"
+	"os"
 	"testing"
+	"time"
 
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/mwojtyna/swift-api/internal/auth"
+	"github.com/mwojtyna/swift-api/internal/ratelimit"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func TestLoggingMiddleware(t *testing.T) {
@@ -59,3 +74,424 @@ func TestLoggingMiddleware(t *testing.T) {
 		})
 	}
 }
+
+func TestAuthMiddleware(t *testing.T) {
+	keys := auth.FileKeyStore{auth.HashKey("valid"): {Name: "ci", Role: auth.RoleReader}}
+
+	tests := []struct {
+		name           string
+		apiKey         string
+		expectedStatus int
+		expectedKey    *auth.Key
+	}{
+		{
+			name:           "no key",
+			apiKey:         "",
+			expectedStatus: http.StatusOK,
+			expectedKey:    nil,
+		},
+		{
+			name:           "valid key",
+			apiKey:         "valid",
+			expectedStatus: http.StatusOK,
+			expectedKey:    &auth.Key{Name: "ci", Role: auth.RoleReader},
+		},
+		{
+			name:           "invalid key",
+			apiKey:         "invalid",
+			expectedStatus: http.StatusUnauthorized,
+			expectedKey:    nil,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Arrange
+			var gotKey *auth.Key
+			handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if key, ok := auth.KeyFromContext(r.Context()); ok {
+					gotKey = &key
+				}
+			})
+			req := httptest.NewRequest(http.MethodGet, "/test", nil)
+			if tt.apiKey != "" {
+				req.Header.Set("X-API-Key", tt.apiKey)
+			}
+			w := httptest.NewRecorder()
+
+			// Act
+			AuthMiddleware(handler, keys, log.New(io.Discard, "", 0)).ServeHTTP(w, req)
+
+			// Assert
+			assert.Equal(t, tt.expectedStatus, w.Code)
+			assert.Equal(t, tt.expectedKey, gotKey)
+		})
+	}
+}
+
+func TestRequireRole(t *testing.T) {
+	t.Parallel()
+
+	keys := auth.FileKeyStore{
+		auth.HashKey("reader-key"): {Name: "reader", Role: auth.RoleReader},
+		auth.HashKey("editor-key"): {Name: "editor", Role: auth.RoleEditor},
+		auth.HashKey("admin-key"):  {Name: "admin", Role: auth.RoleAdmin},
+	}
+	addBody := `{"address":"1 Street","bankName":"New Bank","countryISO2":"GB","countryName":"UNITED KINGDOM","isHeadquarter":true,"swiftCode":"IJKLGB2LXXX"}`
+
+	tests := []struct {
+		name           string
+		publicReads    bool
+		method         string
+		target         string
+		body           string
+		apiKey         string
+		expectedStatus int
+	}{
+		{
+			name:           "read without key",
+			method:         "GET",
+			target:         "/v1/swift-codes/ABCDGB2LXXX",
+			expectedStatus: http.StatusUnauthorized,
+		},
+		{
+			name:           "public read without key",
+			publicReads:    true,
+			method:         "GET",
+			target:         "/v1/swift-codes/ABCDGB2LXXX",
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:           "read with reader",
+			method:         "GET",
+			target:         "/v1/swift-codes/ABCDGB2LXXX",
+			apiKey:         "reader-key",
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:           "lookup with reader",
+			method:         "POST",
+			target:         "/v1/swift-codes/lookup",
+			body:           `{"swiftCodes":["ABCDGB2LXXX"]}`,
+			apiKey:         "reader-key",
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:           "write without key",
+			publicReads:    true,
+			method:         "POST",
+			target:         "/v1/swift-codes",
+			body:           addBody,
+			expectedStatus: http.StatusUnauthorized,
+		},
+		{
+			name:           "write with reader",
+			method:         "POST",
+			target:         "/v1/swift-codes",
+			body:           addBody,
+			apiKey:         "reader-key",
+			expectedStatus: http.StatusForbidden,
+		},
+		{
+			name:           "write with editor",
+			method:         "POST",
+			target:         "/v1/swift-codes",
+			body:           addBody,
+			apiKey:         "editor-key",
+			expectedStatus: http.StatusCreated,
+		},
+		{
+			name:           "purge with editor",
+			method:         "DELETE",
+			target:         "/v1/admin/swift-codes/ABCDGB2LXXX",
+			apiKey:         "editor-key",
+			expectedStatus: http.StatusForbidden,
+		},
+		{
+			name:           "purge with admin",
+			method:         "DELETE",
+			target:         "/v1/admin/swift-codes/ABCDGB2LXXX",
+			apiKey:         "admin-key",
+			expectedStatus: http.StatusConflict,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			// Arrange
+			router := testMemoryAuthApi(t, memoryTestCsv, AuthConfig{Keys: keys, PublicReads: tt.publicReads})
+			w := httptest.NewRecorder()
+			r := httptest.NewRequest(tt.method, tt.target, bytes.NewBufferString(tt.body))
+			if tt.body != "" {
+				r.Header.Set("Content-Type", "application/json")
+			}
+			if tt.apiKey != "" {
+				r.Header.Set("X-API-Key", tt.apiKey)
+			}
+
+			// Act
+			router.ServeHTTP(w, r)
+
+			// Assert
+			assert.Equal(t, tt.expectedStatus, w.Code)
+			if tt.expectedStatus == http.StatusUnauthorized || tt.expectedStatus == http.StatusForbidden {
+				var res MessageRes
+				require.NoError(t, json.NewDecoder(w.Body).Decode(&res))
+				assert.NotEmpty(t, res.Message)
+			}
+			if tt.expectedStatus == http.StatusUnauthorized {
+				assert.Equal(t, "X-API-Key", w.Header().Get("WWW-Authenticate"))
+			}
+		})
+	}
+}
+
+func TestAuthErrorNegotiation(t *testing.T) {
+	// Arrange
+	router := testMemoryAuthApi(t, memoryTestCsv, AuthConfig{Keys: auth.FileKeyStore{}})
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest("GET", "/v1/swift-codes/ABCDGB2LXXX", nil)
+	r.Header.Set("Accept", "application/xml")
+
+	// Act
+	router.ServeHTTP(w, r)
+
+	// Assert
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+	assert.Equal(t, "application/xml", w.Header().Get("Content-Type"))
+	assert.Contains(t, w.Body.String(), "<response><message>Missing API key")
+}
+
+func TestBearerMiddleware(t *testing.T) {
+	t.Parallel()
+
+	// The JWKS fixture of the auth package
+	jwks, err := auth.LoadJwksFile("../auth/testdata/jwks.json")
+	require.NoError(t, err)
+	raw, err := os.ReadFile("../auth/testdata/ec_private_key.pem")
+	require.NoError(t, err)
+	block, _ := pem.Decode(raw)
+	require.NotNil(t, block)
+	signingKey, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	require.NoError(t, err)
+
+	authCfg := AuthConfig{
+		Keys:   auth.FileKeyStore{auth.HashKey("editor-key"): {Name: "editor", Role: auth.RoleEditor}},
+		Tokens: auth.NewTokenVerifier(jwks, "https://id.example.com", "swift-api"),
+	}
+	token := func(scope string, expiresIn time.Duration) string {
+		claims := jwt.MapClaims{
+			"iss":   "https://id.example.com",
+			"aud":   "swift-api",
+			"sub":   "service-a",
+			"exp":   time.Now().Add(expiresIn).Unix(),
+			"scope": scope,
+		}
+		tok := jwt.NewWithClaims(jwt.SigningMethodES256, claims)
+		tok.Header["kid"] = "test-ec"
+		signed, err := tok.SignedString(signingKey)
+		require.NoError(t, err)
+		return signed
+	}
+
+	tests := []struct {
+		name           string
+		method         string
+		target         string
+		authorization  string
+		apiKey         string
+		expectedStatus int
+		expectedAuth   string // WWW-Authenticate header
+	}{
+		{
+			name:           "read with read scope",
+			method:         "GET",
+			target:         "/v1/swift-codes/ABCDGB2LXXX",
+			authorization:  "Bearer " + token("swift:read", time.Hour),
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:           "delete with read scope",
+			method:         "DELETE",
+			target:         "/v1/swift-codes/ABCDGB2LXXX",
+			authorization:  "Bearer " + token("swift:read", time.Hour),
+			expectedStatus: http.StatusForbidden,
+		},
+		{
+			name:           "delete with write scope",
+			method:         "DELETE",
+			target:         "/v1/swift-codes/ABCDGB2LXXX",
+			authorization:  "bearer " + token("swift:write", time.Hour),
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:           "purge with write scope",
+			method:         "DELETE",
+			target:         "/v1/admin/swift-codes/ABCDGB2LXXX",
+			authorization:  "Bearer " + token("swift:write", time.Hour),
+			expectedStatus: http.StatusForbidden,
+		},
+		{
+			name:           "purge with admin scope",
+			method:         "DELETE",
+			target:         "/v1/admin/swift-codes/ABCDGB2LXXX",
+			authorization:  "Bearer " + token("swift:admin", time.Hour),
+			expectedStatus: http.StatusConflict,
+		},
+		{
+			name:           "no swift scope",
+			method:         "GET",
+			target:         "/v1/swift-codes/ABCDGB2LXXX",
+			authorization:  "Bearer " + token("openid", time.Hour),
+			expectedStatus: http.StatusForbidden,
+		},
+		{
+			name:           "expired token",
+			method:         "GET",
+			target:         "/v1/swift-codes/ABCDGB2LXXX",
+			authorization:  "Bearer " + token("swift:read", -time.Hour),
+			expectedStatus: http.StatusUnauthorized,
+			expectedAuth:   `Bearer error="invalid_token"`,
+		},
+		{
+			name:           "no credentials",
+			method:         "GET",
+			target:         "/v1/swift-codes/ABCDGB2LXXX",
+			expectedStatus: http.StatusUnauthorized,
+			expectedAuth:   "Bearer",
+		},
+		{
+			name:           "api key still works",
+			method:         "DELETE",
+			target:         "/v1/swift-codes/ABCDGB2LXXX",
+			apiKey:         "editor-key",
+			expectedStatus: http.StatusOK,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			// Arrange
+			router := testMemoryAuthApi(t, memoryTestCsv, authCfg)
+			w := httptest.NewRecorder()
+			r := httptest.NewRequest(tt.method, tt.target, nil)
+			if tt.authorization != "" {
+				r.Header.Set("Authorization", tt.authorization)
+			}
+			if tt.apiKey != "" {
+				r.Header.Set("X-API-Key", tt.apiKey)
+			}
+
+			// Act
+			router.ServeHTTP(w, r)
+
+			// Assert
+			assert.Equal(t, tt.expectedStatus, w.Code)
+			if tt.expectedAuth != "" {
+				assert.Equal(t, tt.expectedAuth, w.Header().Get("WWW-Authenticate"))
+			}
+		})
+	}
+}
+
+// A JWKS whose provider is down and which doesn't know the token's key
+type unavailableJwks struct{}
+
+func (unavailableJwks) PublicKey(kid string) (crypto.PublicKey, error) {
+	return nil, fmt.Errorf("Unknown key '%s', %w: connection refused", kid, auth.ErrJwksUnavailable)
+}
+
+func TestBearerMiddlewareJwksUnavailable(t *testing.T) {
+	// Arrange
+	authCfg := AuthConfig{Tokens: auth.NewTokenVerifier(unavailableJwks{}, "https://id.example.com", "swift-api")}
+	router := testMemoryAuthApi(t, memoryTestCsv, authCfg)
+	signingKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	tok := jwt.NewWithClaims(jwt.SigningMethodES256, jwt.MapClaims{"iss": "https://id.example.com", "aud": "swift-api", "exp": time.Now().Add(time.Hour).Unix()})
+	tok.Header["kid"] = "rotated"
+	signed, err := tok.SignedString(signingKey)
+	require.NoError(t, err)
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest("GET", "/v1/swift-codes/ABCDGB2LXXX", nil)
+	r.Header.Set("Authorization", "Bearer "+signed)
+
+	// Act
+	router.ServeHTTP(w, r)
+
+	// Assert
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+	assert.Equal(t, `Bearer error="invalid_token"`, w.Header().Get("WWW-Authenticate"))
+	assert.NotContains(t, w.Body.String(), "connection refused")
+}
+
+func TestRateLimit(t *testing.T) {
+	// Arrange
+	limiter, err := ratelimit.New(ratelimit.Config{
+		ClientHeader:   "X-Client-ID",
+		TrustedProxies: []string{"10.0.0.1"},
+		Routes:         map[string]ratelimit.Limit{"GET /swift-codes/{swiftCode}": {RequestsPerSecond: 0.001, Burst: 2}},
+		DailyQuota:     3,
+	})
+	require.NoError(t, err)
+	logger := log.New(io.Discard, "", 0)
+	keys := auth.FileKeyStore{auth.HashKey("valid"): {Name: "ci", Role: auth.RoleReader}}
+	server := NewApiServer(":0", testMemoryRepository(t, memoryTestCsv), AuthConfig{Keys: keys, PublicReads: true}, limiter, logger)
+	router := server.withAuth(server.NewRouter())
+	serve := func(target string, remoteAddr string, headers map[string]string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest("GET", target, nil)
+		r.RemoteAddr = remoteAddr
+		for name, value := range headers {
+			r.Header.Set(name, value)
+		}
+		router.ServeHTTP(w, r)
+		return w
+	}
+
+	// Act & Assert
+	w := serve("/v1/swift-codes/ABCDGB2LXXX", "1.2.3.4:1000", nil)
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "2", w.Header().Get("RateLimit-Limit"))
+	assert.Equal(t, "1", w.Header().Get("RateLimit-Remaining"))
+	assert.Equal(t, "3", w.Header().Get("X-Quota-Limit"))
+	assert.Equal(t, "2", w.Header().Get("X-Quota-Remaining"))
+
+	// Same IP from another port
+	require.Equal(t, http.StatusOK, serve("/v1/swift-codes/ABCDGB2LXXX", "1.2.3.4:2000", nil).Code)
+
+	w = serve("/v1/swift-codes/ABCDGB2LXXX", "1.2.3.4:1000", nil)
+	assert.Equal(t, http.StatusTooManyRequests, w.Code)
+	assert.Equal(t, "0", w.Header().Get("RateLimit-Remaining"))
+	assert.NotEmpty(t, w.Header().Get("Retry-After"))
+	var res MessageRes
+	require.NoError(t, json.NewDecoder(w.Body).Decode(&res))
+	assert.NotEmpty(t, res.Message)
+
+	// Other routes only count against the quota
+	w = serve("/v1/swift-codes/country/PL", "1.2.3.4:1000", nil)
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Empty(t, w.Header().Get("RateLimit-Limit"))
+	assert.Equal(t, "0", w.Header().Get("X-Quota-Remaining"))
+
+	w = serve("/v1/swift-codes/country/PL", "1.2.3.4:1000", nil)
+	assert.Equal(t, http.StatusTooManyRequests, w.Code)
+	assert.NotEmpty(t, w.Header().Get("Retry-After"))
+
+	// Clients can't get a new bucket by making up X-Forwarded-For, only trusted proxies can set it
+	assert.Equal(t, http.StatusTooManyRequests, serve("/v1/swift-codes/ABCDGB2LXXX", "1.2.3.4:1000", map[string]string{"X-Forwarded-For": "5.6.7.8"}).Code)
+	assert.Equal(t, http.StatusOK, serve("/v1/swift-codes/ABCDGB2LXXX", "10.0.0.1:1000", map[string]string{"X-Forwarded-For": "5.6.7.8"}).Code)
+	assert.Equal(t, http.StatusTooManyRequests, serve("/v1/swift-codes/ABCDGB2LXXX", "10.0.0.1:1000", map[string]string{"X-Forwarded-For": "1.2.3.4"}).Code)
+
+	// The client header takes precedence over the IP, but only when a trusted proxy sends it
+	assert.Equal(t, http.StatusTooManyRequests, serve("/v1/swift-codes/ABCDGB2LXXX", "1.2.3.4:1000", map[string]string{"X-Client-ID": "client-a"}).Code)
+	assert.Equal(t, http.StatusOK, serve("/v1/swift-codes/ABCDGB2LXXX", "10.0.0.1:1000", map[string]string{"X-Client-ID": "client-a", "X-Forwarded-For": "1.2.3.4"}).Code)
+
+	// Authenticated clients are limited by their key, wherever they connect from
+	assert.Equal(t, http.StatusOK, serve("/v1/swift-codes/ABCDGB2LXXX", "1.2.3.4:1000", map[string]string{"X-API-Key": "valid"}).Code)
+	assert.Equal(t, http.StatusOK, serve("/v1/swift-codes/ABCDGB2LXXX", "9.9.9.9:1000", map[string]string{"X-API-Key": "valid"}).Code)
+	assert.Equal(t, http.StatusTooManyRequests, serve("/v1/swift-codes/ABCDGB2LXXX", "9.9.9.9:1000", map[string]string{"X-API-Key": "valid"}).Code)
+}
@@ -0,0 +1,230 @@
+package api
+
+import (
+	"encoding/csv"
+	"encoding/xml"
+	"fmt"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/mwojtyna/swift-api/internal/utils"
+)
+
+const (
+	mediaTypeJson    = "application/json"
+	mediaTypeXml     = "application/xml"
+	mediaTypeTextXml = "text/xml"
+	mediaTypeCsv     = "text/csv"
+)
+
+var (
+	// Every response type can be written as JSON or XML
+	defaultMediaTypes = []string{mediaTypeJson, mediaTypeXml, mediaTypeTextXml}
+	// For routes whose responses also implement csvEncoder
+	csvMediaTypes = append(slices.Clone(defaultMediaTypes), mediaTypeCsv)
+)
+
+// Responses which can be written as a CSV table
+type csvEncoder interface {
+	csvHeader() []string
+	csvRecords() [][]string
+}
+
+// Remembers the media type picked by negotiate for WriteResponse
+type negotiatedWriter struct {
+	http.ResponseWriter
+	mediaType string
+}
+
+// Picks the media type of the response from the Accept header, out of the ones the route supports.
+// Responds with 406 if the client doesn't accept any of them. Offers are in order of preference.
+func negotiate(f func(http.ResponseWriter, *http.Request) error, offers ...string) func(http.ResponseWriter, *http.Request) error {
+	return func(w http.ResponseWriter, r *http.Request) error {
+		w.Header().Add("Vary", "Accept")
+
+		// 406
+		mediaType, ok := selectMediaType(r.Header.Values("Accept"), offers)
+		if !ok {
+			res := MessageRes{Message: fmt.Sprintf("Can't respond with any of the accepted media types, supported are: %s", strings.Join(offers, ", "))}
+			WriteJson(w, http.StatusNotAcceptable, res)
+			return nil
+		}
+
+		return f(&negotiatedWriter{ResponseWriter: w, mediaType: mediaType}, r)
+	}
+}
+
+// The media type picked by negotiate, JSON if the route doesn't negotiate
+func responseMediaType(w http.ResponseWriter) string {
+	if nw, ok := w.(*negotiatedWriter); ok {
+		return nw.mediaType
+	}
+	return mediaTypeJson
+}
+
+// Writes v in the media type picked by negotiate, JSON if the route doesn't negotiate
+func WriteResponse(w http.ResponseWriter, status int, v any) error {
+	mediaType := responseMediaType(w)
+	switch mediaType {
+	case mediaTypeXml, mediaTypeTextXml:
+		return WriteXml(w, mediaType, status, v)
+	case mediaTypeCsv:
+		if enc, ok := v.(csvEncoder); ok {
+			return WriteCsv(w, status, enc)
+		}
+	}
+
+	return WriteJson(w, status, v)
+}
+
+func WriteXml(w http.ResponseWriter, mediaType string, status int, v any) error {
+	w.Header().Set("Content-Type", mediaType)
+	w.WriteHeader(status)
+
+	_, err := w.Write([]byte(xml.Header))
+	if err != nil {
+		return err
+	}
+	return xml.NewEncoder(w).Encode(v)
+}
+
+func WriteCsv(w http.ResponseWriter, status int, v csvEncoder) error {
+	w.Header().Set("Content-Type", mediaTypeCsv)
+	w.WriteHeader(status)
+
+	cw := csv.NewWriter(w)
+	err := cw.Write(v.csvHeader())
+	if err != nil {
+		return err
+	}
+	err = cw.WriteAll(v.csvRecords()) // Flushes
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+type mediaRange struct {
+	mediaType string // Can have wildcards, e.g. text/*
+	q         float64
+}
+
+// Returns the best offer according to the Accept headers. Without an Accept header the first offer is used.
+// Each offer gets the quality of the most specific matching range, ties are broken by the order of offers.
+func selectMediaType(accept []string, offers []string) (string, bool) {
+	ranges := parseAccept(accept)
+	if len(ranges) == 0 {
+		return offers[0], true
+	}
+
+	best, bestQ := "", 0.0
+	for _, offer := range offers {
+		q, specificity := 0.0, -1
+		for _, mr := range ranges {
+			s := matchMediaRange(mr.mediaType, offer)
+			if s > specificity {
+				q, specificity = mr.q, s
+			}
+		}
+
+		if q > bestQ {
+			best, bestQ = offer, q
+		}
+	}
+
+	return best, bestQ > 0
+}
+
+func parseAccept(accept []string) []mediaRange {
+	var ranges []mediaRange
+	for _, header := range accept {
+		for _, part := range strings.Split(header, ",") {
+			params := strings.Split(part, ";")
+			mediaType := strings.ToLower(strings.TrimSpace(params[0]))
+			if mediaType == "" {
+				continue
+			}
+
+			q := 1.0
+			for _, param := range params[1:] {
+				name, value, _ := strings.Cut(strings.TrimSpace(param), "=")
+				if strings.EqualFold(name, "q") {
+					parsed, err := strconv.ParseFloat(value, 64)
+					if err == nil && parsed >= 0 && parsed <= 1 {
+						q = parsed
+					}
+				}
+			}
+
+			ranges = append(ranges, mediaRange{mediaType: mediaType, q: q})
+		}
+	}
+
+	return ranges
+}
+
+// Returns how specific the match is (2 - exact, 1 - type/*, 0 - */*), or -1 if the range doesn't match
+func matchMediaRange(mediaRange string, mediaType string) int {
+	switch {
+	case mediaRange == mediaType:
+		return 2
+	case mediaRange == "*/*":
+		return 0
+	case strings.HasSuffix(mediaRange, "/*") && strings.HasPrefix(mediaType, strings.TrimSuffix(mediaRange, "*")):
+		return 1
+	default:
+		return -1
+	}
+}
+
+// CSV responses are tables of banks with the same columns, named like the JSON fields
+var bankCsvHeader = []string{"address", "bankName", "countryISO2", "countryName", "isHeadquarter", "swiftCode"}
+
+func bankCsvRecord(address, bankName, countryISO2, countryName string, isHeadquarter bool, swiftCode string) []string {
+	return []string{address, bankName, countryISO2, countryName, strconv.FormatBool(isHeadquarter), swiftCode}
+}
+
+// Errors on routes which negotiate CSV are CSV too
+func (res MessageRes) csvHeader() []string {
+	return []string{"message"}
+}
+
+func (res MessageRes) csvRecords() [][]string {
+	return [][]string{{res.Message}}
+}
+
+func (res GetSwiftCodeHqRes) csvHeader() []string {
+	return bankCsvHeader
+}
+
+// The HQ comes first, then its branches
+func (res GetSwiftCodeHqRes) csvRecords() [][]string {
+	records := [][]string{bankCsvRecord(res.Address, res.BankName, res.CountryISO2, res.CountryName, res.IsHeadquarter, res.SwiftCode)}
+	for _, b := range res.Branches {
+		// Branches are in the HQ's country, the country is part of the SWIFT code
+		records = append(records, bankCsvRecord(b.Address, b.BankName, b.CountryISO2, res.CountryName, b.IsHeadquarter, b.SwiftCode))
+	}
+	return records
+}
+
+func (res GetSwiftCodeBranchRes) csvHeader() []string {
+	return bankCsvHeader
+}
+
+func (res GetSwiftCodeBranchRes) csvRecords() [][]string {
+	return [][]string{bankCsvRecord(res.Address, res.BankName, res.CountryISO2, res.CountryName, res.IsHeadquarter, res.SwiftCode)}
+}
+
+func (res GetSwiftCodesForCountryRes) csvHeader() []string {
+	return bankCsvHeader
+}
+
+// The next page cursor is only in the Link header
+func (res GetSwiftCodesForCountryRes) csvRecords() [][]string {
+	return utils.Map(res.SwiftCodes, func(b GetSwiftCodesForCountrySwiftCode) []string {
+		return bankCsvRecord(b.Address, b.BankName, b.CountryISO2, res.CountryName, b.IsHeadquarter, b.SwiftCode)
+	})
+}
@@ -0,0 +1,119 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSelectMediaType(t *testing.T) {
+	tests := []struct {
+		name     string
+		accept   []string
+		expected string
+		ok       bool
+	}{
+		{"no accept header", nil, mediaTypeJson, true},
+		{"any", []string{"*/*"}, mediaTypeJson, true},
+		{"exact", []string{"text/csv"}, mediaTypeCsv, true},
+		{"quality", []string{"application/json;q=0.5, application/xml"}, mediaTypeXml, true},
+		{"tie keeps server preference", []string{"application/xml, application/json"}, mediaTypeJson, true},
+		{"type wildcard", []string{"text/*"}, mediaTypeTextXml, true},
+		{"browser", []string{"text/html,application/xhtml+xml,application/xml;q=0.9,*/*;q=0.8"}, mediaTypeXml, true},
+		{"more specific range wins", []string{"*/*;q=0.1, application/json;q=0"}, mediaTypeXml, true},
+		{"multiple headers", []string{"text/html", "text/csv"}, mediaTypeCsv, true},
+		{"case and whitespace", []string{" Text/CSV ; Q=1"}, mediaTypeCsv, true},
+		{"unsupported", []string{"text/html"}, "", false},
+		{"everything refused", []string{"*/*;q=0"}, "", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mediaType, ok := selectMediaType(tt.accept, csvMediaTypes)
+			assert.Equal(t, tt.ok, ok)
+			assert.Equal(t, tt.expected, mediaType)
+		})
+	}
+}
+
+func TestNegotiate(t *testing.T) {
+	branch := GetSwiftCodeBranchRes{
+		Address:       "456 Branch Street",
+		BankName:      "Branch Bank",
+		CountryISO2:   "GB",
+		CountryName:   "UNITED KINGDOM",
+		IsHeadquarter: false,
+		SwiftCode:     "ABCDGB2L001",
+	}
+	handler := negotiate(func(w http.ResponseWriter, r *http.Request) error {
+		return WriteResponse(w, http.StatusOK, branch)
+	}, csvMediaTypes...)
+
+	tests := []struct {
+		name                string
+		accept              string
+		expectedStatus      int
+		expectedContentType string
+		expectedBody        string
+	}{
+		{
+			name:                "json",
+			accept:              "application/json",
+			expectedStatus:      http.StatusOK,
+			expectedContentType: "application/json",
+			expectedBody:        `{"address":"456 Branch Street","bankName":"Branch Bank","countryISO2":"GB","countryName":"UNITED KINGDOM","isHeadquarter":false,"swiftCode":"ABCDGB2L001"}` + "\n",
+		},
+		{
+			name:                "xml",
+			accept:              "text/xml",
+			expectedStatus:      http.StatusOK,
+			expectedContentType: "text/xml",
+			expectedBody: `<?xml version="1.0" encoding="UTF-8"?>` + "\n" +
+				`<bank><address>456 Branch Street</address><bankName>Branch Bank</bankName><countryISO2>GB</countryISO2><countryName>UNITED KINGDOM</countryName><isHeadquarter>false</isHeadquarter><swiftCode>ABCDGB2L001</swiftCode></bank>`,
+		},
+		{
+			name:                "csv",
+			accept:              "text/csv",
+			expectedStatus:      http.StatusOK,
+			expectedContentType: "text/csv",
+			expectedBody: "address,bankName,countryISO2,countryName,isHeadquarter,swiftCode\n" +
+				"456 Branch Street,Branch Bank,GB,UNITED KINGDOM,false,ABCDGB2L001\n",
+		},
+		{
+			name:                "not acceptable",
+			accept:              "application/pdf",
+			expectedStatus:      http.StatusNotAcceptable,
+			expectedContentType: "application/json",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			r := httptest.NewRequest(http.MethodGet, "/", nil)
+			r.Header.Set("Accept", tt.accept)
+
+			err := handler(w, r)
+
+			assert.NoError(t, err)
+			assert.Equal(t, tt.expectedStatus, w.Code)
+			assert.Equal(t, tt.expectedContentType, w.Header().Get("Content-Type"))
+			assert.Equal(t, "Accept", w.Header().Get("Vary"))
+			if tt.expectedBody != "" {
+				assert.Equal(t, tt.expectedBody, w.Body.String())
+			}
+		})
+	}
+}
+
+func TestWriteResponseFallsBackToJson(t *testing.T) {
+	// Search results can't be written as CSV
+	w := &negotiatedWriter{ResponseWriter: httptest.NewRecorder(), mediaType: mediaTypeCsv}
+
+	err := WriteResponse(w, http.StatusOK, SearchSwiftCodesRes{Query: "bank"})
+
+	assert.NoError(t, err)
+	assert.Equal(t, "application/json", w.Header().Get("Content-Type"))
+}
@@ -4,9 +4,17 @@ import (
 	"database/sql"
 	"errors"
 	"fmt"
+	"iter"
 	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
 
-	"github.com/lib/pq"
+	"github.com/mwojtyna/swift-api/internal/auth"
+	"github.com/mwojtyna/swift-api/internal/bic"
+	"github.com/mwojtyna/swift-api/internal/cache"
 	"github.com/mwojtyna/swift-api/internal/db"
 	"github.com/mwojtyna/swift-api/internal/parser"
 	"github.com/mwojtyna/swift-api/internal/utils"
@@ -14,11 +22,26 @@ import (
 
 // NOTE: Return error in function only if status is 500!
 
+// Changes are attributed to the API key's name, or to the client's address if authentication is disabled
+func auditFromReq(r *http.Request) db.Audit {
+	actor := r.RemoteAddr
+	if key, ok := auth.KeyFromContext(r.Context()); ok {
+		actor = key.Name
+	}
+
+	return db.Audit{Actor: actor, Source: db.HistorySourceApi}
+}
+
+// Tells the client which canonical code the request resolved to
+func setSwiftCodeLocation(w http.ResponseWriter, header string, swiftCode string) {
+	w.Header().Set(header, "/v1/swift-codes/"+swiftCode)
+}
+
 func (s *ApiServer) handleGetSwiftCodeV1(w http.ResponseWriter, r *http.Request) error {
-	swiftCode := r.PathValue("swiftCode")
+	swiftCode := bic.Normalize(r.PathValue("swiftCode"))
 	// Don't have to check if swiftCode is empty, because then the route would not match
 
-	bank, err := db.GetBank(s.db, swiftCode)
+	bank, err := s.repo.GetBank(swiftCode)
 	if errors.Is(err, sql.ErrNoRows) {
 		WriteHttpError(w, http.StatusNotFound)
 		return nil
@@ -26,66 +49,227 @@ func (s *ApiServer) handleGetSwiftCodeV1(w http.ResponseWriter, r *http.Request)
 	if err != nil {
 		return err
 	}
+	setSwiftCodeLocation(w, "Content-Location", bank.SwiftCode)
 
-	if bank.IsHeadquarter {
-		branchesRaw, err := db.GetBankBranches(s.db, swiftCode)
-		if err != nil {
-			return err
+	branches, err := s.getBranches(bank)
+	if err != nil {
+		return err
+	}
+
+	// 304
+	banks := append([]db.Bank{bank}, branches...)
+	if s.checkNotModified(w, r, banksETag(responseMediaType(w), "", banks), banksLastModified(banks)) {
+		return nil
+	}
+
+	err = WriteResponse(w, http.StatusOK, swiftCodeRes(bank, branches))
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// Only HQs have branches
+func (s *ApiServer) getBranches(bank db.Bank) ([]db.Bank, error) {
+	if !bank.IsHeadquarter {
+		return nil, nil
+	}
+	return s.repo.GetBankBranches(bank.SwiftCode)
+}
+
+// Serves GET /v1/swift-codes/{swiftCode}/history. The last segment is a wildcard, because a literal one
+// would conflict with GET /v1/swift-codes/country/{countryISO2code}.
+func (s *ApiServer) handleGetSwiftCodeHistoryV1(w http.ResponseWriter, r *http.Request) error {
+	swiftCode := bic.Normalize(r.PathValue("swiftCode"))
+	if r.PathValue("resource") != "history" {
+		WriteHttpError(w, http.StatusNotFound)
+		return nil
+	}
+
+	// 404 only if the bank never existed, deleted banks keep their history
+	history, err := s.repo.GetBankHistory(swiftCode)
+	if err != nil {
+		return err
+	}
+	if len(history) == 0 {
+		WriteHttpError(w, http.StatusNotFound)
+		return nil
+	}
+
+	res := GetSwiftCodeHistoryRes{
+		SwiftCode: swiftCode,
+		Changes:   make([]GetSwiftCodeHistoryEntry, len(history)),
+	}
+	for i, entry := range history {
+		res.Changes[i] = GetSwiftCodeHistoryEntry{
+			Operation: entry.Operation,
+			ChangedAt: entry.ChangedAt,
+			Actor:     entry.Actor,
+			Source:    entry.Source,
+			Before:    exportFromSnapshot(entry.Before),
+			After:     exportFromSnapshot(entry.After),
 		}
+	}
 
-		branches := utils.Map(branchesRaw, func(b db.Bank) GetSwiftCodeHqBranch {
-			return GetSwiftCodeHqBranch{
-				Address:       b.Address,
-				BankName:      b.BankName,
-				CountryISO2:   b.CountryISO2Code,
-				IsHeadquarter: b.IsHeadquarter,
-				SwiftCode:     b.SwiftCode,
-			}
-		})
+	err = WriteResponse(w, http.StatusOK, res)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
 
-		res := GetSwiftCodeHqRes{
+// Returns GetSwiftCodeHqRes for HQs and GetSwiftCodeBranchRes for branches
+func swiftCodeRes(bank db.Bank, branches []db.Bank) any {
+	if !bank.IsHeadquarter {
+		return GetSwiftCodeBranchRes{
 			Address:       bank.Address,
 			BankName:      bank.BankName,
 			CountryISO2:   bank.CountryISO2Code,
 			CountryName:   bank.CountryName,
 			IsHeadquarter: bank.IsHeadquarter,
 			SwiftCode:     bank.SwiftCode,
-			Branches:      branches,
 		}
+	}
 
-		err = WriteJson(w, http.StatusOK, res)
-		if err != nil {
-			return err
+	return GetSwiftCodeHqRes{
+		Address:       bank.Address,
+		BankName:      bank.BankName,
+		CountryISO2:   bank.CountryISO2Code,
+		CountryName:   bank.CountryName,
+		IsHeadquarter: bank.IsHeadquarter,
+		SwiftCode:     bank.SwiftCode,
+		Branches: utils.Map(branches, func(b db.Bank) GetSwiftCodeHqBranch {
+			return GetSwiftCodeHqBranch{
+				Address:       b.Address,
+				BankName:      b.BankName,
+				CountryISO2:   b.CountryISO2Code,
+				IsHeadquarter: b.IsHeadquarter,
+				SwiftCode:     b.SwiftCode,
+			}
+		}),
+	}
+}
+
+func (s *ApiServer) handleLookupSwiftCodesV1(w http.ResponseWriter, r *http.Request) error {
+	var req LookupSwiftCodesReq
+
+	// 400
+	err := ReadJson(w, r, &req)
+	if err != nil {
+		res := MessageRes{Message: err.Error()}
+		WriteResponse(w, http.StatusBadRequest, res)
+		return nil
+	}
+	// 422
+	err = ValidateStruct(req, s.validate)
+	if err != nil {
+		res := MessageRes{Message: err.Error()}
+		WriteResponse(w, http.StatusUnprocessableEntity, res)
+		return nil
+	}
+
+	codes := utils.Map(req.SwiftCodes, bic.Normalize)
+	banks, err := s.repo.GetBanksWithBranches(codes)
+	if err != nil {
+		return err
+	}
+
+	// The query returns requested banks and branches of requested HQs mixed together
+	banksByCode := make(map[string]db.Bank, len(banks))
+	branchesByHq := make(map[string][]db.Bank)
+	for _, b := range banks {
+		banksByCode[b.SwiftCode] = b
+		if b.HqSwiftCode.Valid {
+			branchesByHq[b.HqSwiftCode.String] = append(branchesByHq[b.HqSwiftCode.String], b)
 		}
-	} else {
-		res := GetSwiftCodeBranchRes{
-			Address:       bank.Address,
-			BankName:      bank.BankName,
-			CountryISO2:   bank.CountryISO2Code,
-			CountryName:   bank.CountryName,
-			IsHeadquarter: bank.IsHeadquarter,
-			SwiftCode:     bank.SwiftCode,
+	}
+
+	// Results are in request order, each code only once
+	res := LookupSwiftCodesRes{Found: []any{}, NotFound: []string{}}
+	seen := make(map[string]struct{}, len(codes))
+	for i, code := range codes {
+		if _, ok := seen[code]; ok {
+			continue
 		}
+		seen[code] = struct{}{}
 
-		err = WriteJson(w, http.StatusOK, res)
-		if err != nil {
-			return err
+		bank, ok := banksByCode[code]
+		if !ok {
+			res.NotFound = append(res.NotFound, req.SwiftCodes[i])
+			continue
 		}
+		res.Found = append(res.Found, swiftCodeRes(bank, branchesByHq[code]))
+	}
+
+	err = WriteResponse(w, http.StatusOK, res)
+	if err != nil {
+		return err
 	}
 
 	return nil
 }
 
+const (
+	defaultCountryPageLimit = 100
+	maxCountryPageLimit     = 1000
+)
+
 func (s *ApiServer) handleGetSwiftCodesForCountryV1(w http.ResponseWriter, r *http.Request) error {
 	countryCode := r.PathValue("countryISO2code")
 
-	banks, err := db.GetBanksInCountry(s.db, countryCode)
-	if len(banks) == 0 {
-		WriteHttpError(w, http.StatusNotFound)
+	// 400
+	cursor := r.URL.Query().Get("cursor")
+	after, err := decodeCursor(cursor)
+	if err != nil {
+		res := MessageRes{Message: err.Error()}
+		WriteResponse(w, http.StatusBadRequest, res)
 		return nil
 	}
+	limit, err := ReadQueryInt(r, "limit", 0, 1, maxCountryPageLimit)
 	if err != nil {
-		return err
+		res := MessageRes{Message: err.Error()}
+		WriteResponse(w, http.StatusBadRequest, res)
+		return nil
+	}
+
+	var banks []db.Bank
+	var nextCursor string
+	// Without limit and cursor return the whole country, like before pagination was added
+	if limit == 0 && cursor == "" {
+		banks, err = s.repo.GetBanksInCountry(countryCode)
+		if err != nil {
+			return err
+		}
+	} else {
+		if limit == 0 {
+			limit = defaultCountryPageLimit
+		}
+
+		// Fetch one bank more than requested to know if there is a next page
+		banks, err = s.repo.GetBanksInCountryPage(countryCode, after, limit+1)
+		if err != nil {
+			return err
+		}
+		if len(banks) > limit {
+			banks = banks[:limit]
+			nextCursor = encodeCursor(banks[len(banks)-1].SwiftCode)
+		}
+	}
+
+	// 404. A page after a cursor can be empty if the banks ended on the previous page or were deleted since,
+	// that's only fine if the country still has banks.
+	country := banks
+	if len(banks) == 0 && cursor != "" {
+		country, err = s.repo.GetBanksInCountryPage(countryCode, "", 1)
+		if err != nil {
+			return err
+		}
+	}
+	if len(country) == 0 {
+		WriteHttpError(w, http.StatusNotFound)
+		return nil
 	}
 
 	codes := utils.Map(banks, func(b db.Bank) GetSwiftCodesForCountrySwiftCode {
@@ -97,18 +281,136 @@ func (s *ApiServer) handleGetSwiftCodesForCountryV1(w http.ResponseWriter, r *ht
 			SwiftCode:     b.SwiftCode,
 		}
 	})
+	if nextCursor != "" {
+		next := url.URL{Path: "/v1" + r.URL.Path, RawQuery: url.Values{"cursor": {nextCursor}, "limit": {strconv.Itoa(limit)}}.Encode()}
+		w.Header().Set("Link", fmt.Sprintf(`<%s>; rel="next"`, next.String()))
+	}
+
+	// 304. No Last-Modified, banks leaving the country or the page would leave it behind.
+	if s.checkNotModified(w, r, banksETag(responseMediaType(w), nextCursor, banks), time.Time{}) {
+		return nil
+	}
+
 	res := GetSwiftCodesForCountryRes{
 		// Since all banks are from the same country, just get the country data from any bank so we don't have to query the DB
-		CountryISO2: banks[0].CountryISO2Code,
-		CountryName: banks[0].CountryName,
+		CountryISO2: country[0].CountryISO2Code,
+		CountryName: country[0].CountryName,
 		SwiftCodes:  codes,
+		NextCursor:  nextCursor,
+	}
+
+	err = WriteResponse(w, http.StatusOK, res)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+const (
+	defaultSearchLimit = 20
+	maxSearchLimit     = 100
+)
+
+func (s *ApiServer) handleSearchSwiftCodesV1(w http.ResponseWriter, r *http.Request) error {
+	query := strings.TrimSpace(r.URL.Query().Get("q"))
+
+	// 400
+	if query == "" {
+		res := MessageRes{Message: `Query parameter "q" is required`}
+		WriteResponse(w, http.StatusBadRequest, res)
+		return nil
+	}
+	limit, err := ReadQueryInt(r, "limit", defaultSearchLimit, 1, maxSearchLimit)
+	if err != nil {
+		res := MessageRes{Message: err.Error()}
+		WriteResponse(w, http.StatusBadRequest, res)
+		return nil
+	}
+
+	matches, err := s.repo.SearchBanks(query, limit)
+	if err != nil {
+		return err
+	}
+
+	res := SearchSwiftCodesRes{
+		Query: query,
+		Results: utils.Map(matches, func(m db.BankSearchResult) SearchSwiftCodesResult {
+			return SearchSwiftCodesResult{
+				Address:       m.Address,
+				BankName:      m.BankName,
+				TownName:      m.TownName,
+				CountryISO2:   m.CountryISO2Code,
+				CountryName:   m.CountryName,
+				IsHeadquarter: m.IsHeadquarter,
+				SwiftCode:     m.SwiftCode,
+				Score:         m.Rank,
+			}
+		}),
+	}
+
+	err = WriteResponse(w, http.StatusOK, res)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (s *ApiServer) handleExportV1(w http.ResponseWriter, r *http.Request) error {
+	formatName := r.URL.Query().Get("format")
+	if formatName == "" {
+		formatName = defaultExportFormat
+	}
+	countryCode := strings.ToUpper(strings.TrimSpace(r.URL.Query().Get("country")))
+
+	// 400
+	format, ok := exportFormats[formatName]
+	if !ok {
+		res := MessageRes{Message: `Query parameter "format" must be one of csv, jsonl, parquet`}
+		WriteResponse(w, http.StatusBadRequest, res)
+		return nil
+	}
+	if countryCode != "" && len(countryCode) != 2 {
+		res := MessageRes{Message: `Query parameter "country" must be an ISO 3166-1 alpha-2 code`}
+		WriteResponse(w, http.StatusBadRequest, res)
+		return nil
+	}
+	hqOnly, err := ReadQueryBool(r, "hqOnly", false)
+	if err != nil {
+		res := MessageRes{Message: err.Error()}
+		WriteResponse(w, http.StatusBadRequest, res)
+		return nil
 	}
 
-	err = WriteJson(w, http.StatusOK, res)
+	next, stop := iter.Pull2(s.repo.StreamBanks(db.BankFilter{CountryISO2Code: countryCode, HqOnly: hqOnly}))
+	defer stop()
+
+	// Get the first bank before writing anything, so a failed query can still be reported with a 500
+	bank, err, ok := next()
 	if err != nil {
 		return err
 	}
 
+	w.Header().Set("Content-Type", format.contentType)
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="swift-codes.%s"`, format.extension))
+	w.WriteHeader(http.StatusOK)
+
+	enc := format.newEncoder(w)
+	for ; ok; bank, err, ok = next() {
+		if err == nil {
+			err = enc.Encode(bank)
+		}
+		if err != nil {
+			s.abortResponse(r, err)
+		}
+	}
+
+	err = enc.Close()
+	if err != nil {
+		s.abortResponse(r, err)
+	}
+
 	return nil
 }
 
@@ -119,29 +421,21 @@ func (s *ApiServer) handleAddSwiftCodeV1(w http.ResponseWriter, r *http.Request)
 	err := ReadJson(w, r, &req)
 	if err != nil {
 		res := MessageRes{Message: err.Error()}
-		WriteJson(w, http.StatusBadRequest, res)
+		WriteResponse(w, http.StatusBadRequest, res)
 		return nil
 	}
+	req.SwiftCode = bic.Normalize(req.SwiftCode)
 
 	// 422
-	err = ValidateStruct(req, s.validate)
-	if err != nil {
-		res := MessageRes{Message: err.Error()}
-		WriteJson(w, http.StatusUnprocessableEntity, res)
+	if !s.validateSwiftCodeReq(w, req) {
 		return nil
 	}
 
 	// HQ handling
 	isHq, hqCode := parser.IsSwiftCodeHq(req.SwiftCode)
-	if (isHq && !req.IsHeadquarter) || (!isHq && req.IsHeadquarter) {
-		res := MessageRes{Message: "isHeadquarter disagrees with swiftCode"}
-		WriteJson(w, http.StatusUnprocessableEntity, res)
-		return nil
-	}
-
 	dbHqCode := sql.NullString{}
 	if !isHq {
-		exists, err := db.CheckBankHqExists(s.db, hqCode)
+		exists, err := s.repo.CheckBankHqExists(hqCode)
 		if err != nil {
 			return err
 		}
@@ -154,25 +448,359 @@ func (s *ApiServer) handleAddSwiftCodeV1(w http.ResponseWriter, r *http.Request)
 		}
 	}
 
-	bank := db.Bank{
+	bank := bankFromReq(req)
+	bank.HqSwiftCode = dbHqCode
+
+	// Adding an HQ also links branches which were added before it
+	var linked *int64
+	if isHq {
+		var n int64
+		n, err = s.repo.InsertHqBank(bank, auditFromReq(r))
+		linked = &n
+	} else {
+		err = s.repo.InsertBank(bank, auditFromReq(r))
+	}
+
+	if errors.Is(err, db.ErrAlreadyExists) {
+		WriteHttpError(w, http.StatusConflict)
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	setSwiftCodeLocation(w, "Location", bank.SwiftCode)
+	res := AddSwiftCodeRes{
+		Message:        fmt.Sprintf("Added bank with SWIFT code %s", bank.SwiftCode),
+		LinkedBranches: linked,
+	}
+	err = WriteResponse(w, http.StatusCreated, res)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+const (
+	batchModeAtomic     = "atomic"
+	batchModeBestEffort = "best-effort"
+	maxBatchSize        = 1000
+)
+
+func (s *ApiServer) handleAddSwiftCodesBatchV1(w http.ResponseWriter, r *http.Request) error {
+	mode := r.URL.Query().Get("mode")
+	if mode == "" {
+		mode = batchModeAtomic
+	}
+	var reqs []AddSwiftCodeReq
+
+	// 400
+	if mode != batchModeAtomic && mode != batchModeBestEffort {
+		res := MessageRes{Message: fmt.Sprintf(`Query parameter "mode" must be %s or %s`, batchModeAtomic, batchModeBestEffort)}
+		WriteResponse(w, http.StatusBadRequest, res)
+		return nil
+	}
+	err := ReadJson(w, r, &reqs)
+	if err != nil {
+		res := MessageRes{Message: err.Error()}
+		WriteResponse(w, http.StatusBadRequest, res)
+		return nil
+	}
+	if len(reqs) == 0 || len(reqs) > maxBatchSize {
+		res := MessageRes{Message: fmt.Sprintf("Batch must have between 1 and %d items", maxBatchSize)}
+		WriteResponse(w, http.StatusBadRequest, res)
+		return nil
+	}
+
+	// Validate every item first, only valid ones go to the DB
+	results := make([]BatchAddSwiftCodeResult, len(reqs))
+	var banks []db.Bank
+	var bankItems []int // Index of the item each bank came from
+	firstItem := make(map[string]int, len(reqs))
+	for i, req := range reqs {
+		req.SwiftCode = bic.Normalize(req.SwiftCode)
+		results[i] = BatchAddSwiftCodeResult{Index: i, SwiftCode: req.SwiftCode}
+
+		err := s.checkSwiftCodeReq(req)
+		if err != nil {
+			results[i].Status = http.StatusUnprocessableEntity
+			results[i].Message = err.Error()
+			continue
+		}
+		if prev, ok := firstItem[req.SwiftCode]; ok {
+			results[i].Status = http.StatusConflict
+			results[i].Message = fmt.Sprintf("Duplicate of item %d", prev)
+			continue
+		}
+		firstItem[req.SwiftCode] = i
+
+		// The DB only links branches whose HQ exists
+		bank := bankFromReq(req)
+		if isHq, hqCode := parser.IsSwiftCodeHq(req.SwiftCode); !isHq {
+			bank.HqSwiftCode = sql.NullString{String: hqCode, Valid: true}
+		}
+		banks = append(banks, bank)
+		bankItems = append(bankItems, i)
+	}
+
+	invalid := len(banks) < len(reqs)
+	committed := false
+	// In atomic mode there's no point in touching the DB if something is already invalid
+	if !invalid || mode == batchModeBestEffort {
+		var dbResults []db.BatchInsertResult
+		dbResults, committed, err = s.repo.InsertBankBatch(banks, mode == batchModeAtomic, auditFromReq(r))
+		if err != nil {
+			return err
+		}
+
+		for j, dbRes := range dbResults {
+			res := &results[bankItems[j]]
+			if dbRes.Duplicate {
+				res.Status = http.StatusConflict
+				res.Message = fmt.Sprintf("Bank with SWIFT code %s already exists", res.SwiftCode)
+				continue
+			}
+
+			res.Status = http.StatusCreated
+			res.Message = fmt.Sprintf("Added bank with SWIFT code %s", res.SwiftCode)
+			if banks[j].IsHeadquarter {
+				res.LinkedBranches = &dbRes.LinkedBranches
+			}
+		}
+	}
+
+	// Items which would have been fine, but weren't added because of other items
+	if !committed {
+		for i := range results {
+			if results[i].Status == 0 || results[i].Status == http.StatusCreated {
+				results[i].Status = http.StatusFailedDependency
+				results[i].Message = "Not added because other items failed"
+				results[i].LinkedBranches = nil
+			}
+		}
+	}
+
+	status := http.StatusCreated
+	if !committed {
+		// 422
+		status = http.StatusUnprocessableEntity
+	} else if slices.ContainsFunc(results, func(res BatchAddSwiftCodeResult) bool { return res.Status != http.StatusCreated }) {
+		// 207
+		status = http.StatusMultiStatus
+	}
+
+	res := BatchAddSwiftCodesRes{Mode: mode, Results: results}
+	err = WriteResponse(w, status, res)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (s *ApiServer) handleReplaceSwiftCodeV1(w http.ResponseWriter, r *http.Request) error {
+	swiftCode := bic.Normalize(r.PathValue("swiftCode"))
+	var req AddSwiftCodeReq
+
+	// 400
+	err := ReadJson(w, r, &req)
+	if err != nil {
+		res := MessageRes{Message: err.Error()}
+		WriteResponse(w, http.StatusBadRequest, res)
+		return nil
+	}
+	req.SwiftCode = bic.Normalize(req.SwiftCode)
+
+	// 422
+	if !s.validateSwiftCodeReq(w, req) {
+		return nil
+	}
+
+	// 412
+	version, ok, err := s.checkIfMatch(w, r, swiftCode, false)
+	if err != nil || !ok {
+		return err
+	}
+
+	return s.updateBank(w, swiftCode, req, version, auditFromReq(r))
+}
+
+func (s *ApiServer) handleUpdateSwiftCodeV1(w http.ResponseWriter, r *http.Request) error {
+	swiftCode := bic.Normalize(r.PathValue("swiftCode"))
+	var patch PatchSwiftCodeReq
+
+	// 400
+	err := ReadJson(w, r, &patch)
+	if err != nil {
+		res := MessageRes{Message: err.Error()}
+		WriteResponse(w, http.StatusBadRequest, res)
+		return nil
+	}
+
+	// 412
+	matched, ok, err := s.checkIfMatchBank(w, r, swiftCode, false)
+	if err != nil || !ok {
+		return err
+	}
+
+	// The patch is applied to the bank the client's ETag matched, or else the bank as it's in the database, since
+	// a cached one can be older. UpdateBank gets its version, so a bank changed since can't be overwritten.
+	var bank db.Bank
+	if matched != nil {
+		bank = *matched
+	} else {
+		bank, err = s.uncachedRepo().GetBank(swiftCode)
+		if errors.Is(err, sql.ErrNoRows) {
+			WriteHttpError(w, http.StatusNotFound)
+			return nil
+		} else if err != nil {
+			return err
+		}
+	}
+
+	// Apply the patch on top of the current bank, so the result can be validated like a full replacement
+	req := reqFromBank(bank)
+	if patch.Address != nil {
+		req.Address = *patch.Address
+	}
+	if patch.BankName != nil {
+		req.BankName = *patch.BankName
+	}
+	if patch.CountryISO2 != nil {
+		req.CountryISO2 = *patch.CountryISO2
+	}
+	if patch.CountryName != nil {
+		req.CountryName = *patch.CountryName
+	}
+	if patch.IsHeadquarter != nil {
+		req.IsHeadquarter = *patch.IsHeadquarter
+	}
+	if patch.SwiftCode != nil {
+		req.SwiftCode = bic.Normalize(*patch.SwiftCode)
+	}
+
+	// 422
+	if !s.validateSwiftCodeReq(w, req) {
+		return nil
+	}
+
+	return s.updateBank(w, swiftCode, req, bank.Version, auditFromReq(r))
+}
+
+// Shared by PUT and PATCH, expects an already validated request. A version other than 0 is the one
+// from checkIfMatch, the bank is only updated if it's still at it.
+func (s *ApiServer) updateBank(w http.ResponseWriter, swiftCode string, req AddSwiftCodeReq, version int64, audit db.Audit) error {
+	// 422
+	if req.SwiftCode != swiftCode {
+		res := MessageRes{Message: "swiftCode disagrees with the URL, SWIFT codes can't be changed"}
+		WriteResponse(w, http.StatusUnprocessableEntity, res)
+		return nil
+	}
+
+	// HQ links are derived from the SWIFT code, which can't change, so they stay intact
+	bank := bankFromReq(req)
+	bank.Version = version
+	err := s.repo.UpdateBank(bank, audit)
+	if errors.Is(err, sql.ErrNoRows) {
+		WriteHttpError(w, http.StatusNotFound)
+		return nil
+	} else if errors.Is(err, db.ErrVersionConflict) {
+		// 412, changed since checkIfMatch
+		writePreconditionFailed(w, swiftCode)
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	setSwiftCodeLocation(w, "Content-Location", swiftCode)
+	res := MessageRes{Message: fmt.Sprintf("Updated bank with SWIFT code %s", swiftCode)}
+	err = WriteResponse(w, http.StatusOK, res)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// Runs format checks and makes sure isHeadquarter agrees with the SWIFT code, writes 422 if the request is invalid
+func (s *ApiServer) validateSwiftCodeReq(w http.ResponseWriter, req AddSwiftCodeReq) bool {
+	err := s.checkSwiftCodeReq(req)
+	if err != nil {
+		res := MessageRes{Message: err.Error()}
+		WriteResponse(w, http.StatusUnprocessableEntity, res)
+		return false
+	}
+
+	return true
+}
+
+func (s *ApiServer) checkSwiftCodeReq(req AddSwiftCodeReq) error {
+	err := ValidateStruct(req, s.validate)
+	if err != nil {
+		return err
+	}
+
+	isHq, _ := parser.IsSwiftCodeHq(req.SwiftCode)
+	if isHq != req.IsHeadquarter {
+		return errors.New("isHeadquarter disagrees with swiftCode")
+	}
+
+	return nil
+}
+
+// HqSwiftCode is left empty, it has to be resolved separately
+func bankFromReq(req AddSwiftCodeReq) db.Bank {
+	return db.Bank{
 		SwiftCode:       req.SwiftCode,
-		HqSwiftCode:     dbHqCode,
+		IsHeadquarter:   req.IsHeadquarter,
 		BankName:        req.BankName,
 		Address:         req.Address,
 		CountryISO2Code: req.CountryISO2,
 		CountryName:     req.CountryName,
 	}
+}
 
-	pgErr, isPgErr := db.InsertBank(s.db, bank).(*pq.Error)
-	if isPgErr && pgErr.Code == db.UniqueViolationErrorCode {
-		WriteHttpError(w, http.StatusConflict)
+func reqFromBank(bank db.Bank) AddSwiftCodeReq {
+	return AddSwiftCodeReq{
+		Address:       bank.Address,
+		BankName:      bank.BankName,
+		CountryISO2:   bank.CountryISO2Code,
+		CountryName:   bank.CountryName,
+		IsHeadquarter: bank.IsHeadquarter,
+		SwiftCode:     bank.SwiftCode,
+	}
+}
+
+func (s *ApiServer) handleDeleteSwiftCodeV1(w http.ResponseWriter, r *http.Request) error {
+	swiftCode := bic.Normalize(r.PathValue("swiftCode"))
+	// Don't have to check if swiftCode is empty, because then the route would not match
+
+	// 412
+	version, ok, err := s.checkIfMatch(w, r, swiftCode, false)
+	if err != nil || !ok {
+		return err
+	}
+
+	err = s.repo.DeleteBank(swiftCode, version, auditFromReq(r))
+	if errors.Is(err, sql.ErrNoRows) {
+		WriteHttpError(w, http.StatusNotFound)
 		return nil
-	} else if pgErr != nil {
-		return pgErr
+	} else if errors.Is(err, db.ErrVersionConflict) {
+		// 412, changed since checkIfMatch
+		writePreconditionFailed(w, swiftCode)
+		return nil
+	} else if err != nil {
+		return err
 	}
 
-	res := MessageRes{Message: fmt.Sprintf("Added bank with SWIFT code %s", bank.SwiftCode)}
-	err = WriteJson(w, http.StatusCreated, res)
+	// The deleted bank can't be read anymore, so this is the only way to get its ETag for restoring or purging it
+	// with If-Match. It's deleted already, so the response doesn't fail if it can't be read.
+	if deleted, err := s.repo.GetDeletedBank(swiftCode); err == nil {
+		w.Header().Set("ETag", banksETag(mediaTypeJson, "", []db.Bank{deleted}))
+	}
+	setSwiftCodeLocation(w, "Content-Location", swiftCode)
+	res := MessageRes{Message: fmt.Sprintf("Deleted bank with SWIFT code %s", swiftCode)}
+	err = WriteResponse(w, http.StatusOK, res)
 	if err != nil {
 		return err
 	}
@@ -180,20 +808,108 @@ func (s *ApiServer) handleAddSwiftCodeV1(w http.ResponseWriter, r *http.Request)
 	return nil
 }
 
-func (s *ApiServer) handleDeleteSwiftCodeV1(w http.ResponseWriter, r *http.Request) error {
-	swiftCode := r.PathValue("swiftCode")
-	// Don't have to check if swiftCode is empty, because then the route would not match
+// Serves POST /v1/swift-codes/{swiftCode}/restore, the last segment is a wildcard like in handleGetSwiftCodeHistoryV1
+func (s *ApiServer) handleRestoreSwiftCodeV1(w http.ResponseWriter, r *http.Request) error {
+	swiftCode := bic.Normalize(r.PathValue("swiftCode"))
+	if r.PathValue("action") != "restore" {
+		WriteHttpError(w, http.StatusNotFound)
+		return nil
+	}
 
-	err := db.DeleteBank(s.db, swiftCode)
+	// 412
+	version, ok, err := s.checkIfMatch(w, r, swiftCode, true)
+	if err != nil || !ok {
+		return err
+	}
+
+	linked, err := s.repo.RestoreBank(swiftCode, version, auditFromReq(r))
 	if errors.Is(err, sql.ErrNoRows) {
 		WriteHttpError(w, http.StatusNotFound)
 		return nil
+	} else if errors.Is(err, db.ErrVersionConflict) {
+		// 412, changed since checkIfMatch
+		writePreconditionFailed(w, swiftCode)
+		return nil
+	} else if errors.Is(err, db.ErrNotDeleted) {
+		res := MessageRes{Message: fmt.Sprintf("Bank with SWIFT code %s isn't deleted", swiftCode)}
+		WriteResponse(w, http.StatusConflict, res)
+		return nil
 	} else if err != nil {
 		return err
 	}
 
-	res := MessageRes{Message: fmt.Sprintf("Deleted bank with SWIFT code %s", swiftCode)}
-	err = WriteJson(w, http.StatusOK, res)
+	setSwiftCodeLocation(w, "Content-Location", swiftCode)
+	res := RestoreSwiftCodeRes{Message: fmt.Sprintf("Restored bank with SWIFT code %s", swiftCode)}
+	if isHq, _ := parser.IsSwiftCodeHq(swiftCode); isHq {
+		res.LinkedBranches = &linked
+	}
+	err = WriteResponse(w, http.StatusOK, res)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// Permanently removes a bank, which has to be deleted first
+func (s *ApiServer) handlePurgeSwiftCodeV1(w http.ResponseWriter, r *http.Request) error {
+	swiftCode := bic.Normalize(r.PathValue("swiftCode"))
+
+	// 412
+	version, ok, err := s.checkIfMatch(w, r, swiftCode, true)
+	if err != nil || !ok {
+		return err
+	}
+
+	err = s.repo.PurgeBank(swiftCode, version, auditFromReq(r))
+	if errors.Is(err, sql.ErrNoRows) {
+		WriteHttpError(w, http.StatusNotFound)
+		return nil
+	} else if errors.Is(err, db.ErrVersionConflict) {
+		// 412, changed since checkIfMatch
+		writePreconditionFailed(w, swiftCode)
+		return nil
+	} else if errors.Is(err, db.ErrNotDeleted) {
+		res := MessageRes{Message: fmt.Sprintf("Bank with SWIFT code %s isn't deleted, delete it before purging", swiftCode)}
+		WriteResponse(w, http.StatusConflict, res)
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	res := MessageRes{Message: fmt.Sprintf("Purged bank with SWIFT code %s", swiftCode)}
+	err = WriteResponse(w, http.StatusOK, res)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// Implemented by db.CachedRepository
+type cacheStatsRepository interface {
+	CacheStats() cache.Stats
+}
+
+func (s *ApiServer) handleGetCacheStatsV1(w http.ResponseWriter, r *http.Request) error {
+	cached, ok := s.repo.(cacheStatsRepository)
+	if !ok {
+		WriteResponse(w, http.StatusNotFound, MessageRes{Message: "Caching is disabled"})
+		return nil
+	}
+
+	stats := cached.CacheStats()
+	res := GetCacheStatsRes{
+		Hits:      stats.Hits,
+		Misses:    stats.Misses,
+		Evictions: stats.Evictions,
+		Entries:   stats.Entries,
+	}
+	if lookups := stats.Hits + stats.Misses; lookups > 0 {
+		res.HitRatio = float64(stats.Hits) / float64(lookups)
+	}
+
+	err := WriteResponse(w, http.StatusOK, res)
 	if err != nil {
 		return err
 	}
@@ -0,0 +1,326 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mwojtyna/swift-api/internal/auth"
+	"github.com/mwojtyna/swift-api/internal/db"
+	"github.com/mwojtyna/swift-api/internal/parser"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func testMemoryRepository(t *testing.T, csv string) *db.MemoryRepository {
+	t.Helper()
+
+	banks, err := parser.ParseCsv(strings.NewReader(csv))
+	require.NoError(t, err)
+	repo, err := db.NewMemoryRepository(banks)
+	require.NoError(t, err)
+
+	return repo
+}
+
+// Same as testApi, but backed by a MemoryRepository, so it runs without Docker
+func testMemoryApi(t *testing.T, csv string) *http.ServeMux {
+	t.Helper()
+
+	logger := log.New(io.Discard, "", 0)
+	return NewApiServer(":0", testMemoryRepository(t, csv), AuthConfig{}, nil, logger).NewRouter()
+}
+
+// Same as testMemoryApi, but with authentication
+func testMemoryAuthApi(t *testing.T, csv string, authCfg AuthConfig) http.Handler {
+	t.Helper()
+
+	logger := log.New(io.Discard, "", 0)
+	server := NewApiServer(":0", testMemoryRepository(t, csv), authCfg, nil, logger)
+	return server.withAuth(server.NewRouter())
+}
+
+const memoryTestCsv = `COUNTRY ISO2 CODE,SWIFT CODE,CODE TYPE,NAME,ADDRESS,TOWN NAME,COUNTRY NAME,TIME ZONE
+GB,ABCDGB2LXXX,BIC11,HQ Bank,456 HQ Street,LONDON,UNITED KINGDOM,Europe/London
+GB,ABCDGB2L001,BIC11,Branch Bank,456 Branch Street,LONDON,UNITED KINGDOM,Europe/London
+PL,EFGHPLPWXXX,BIC11,Polish Bank,Marszalkowska 1,WARSZAWA,POLAND,Europe/Warsaw
+`
+
+func TestRoutesWithMemoryRepository(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		name       string
+		method     string
+		target     string
+		body       string
+		statusCode int
+		expected   any // Compared as JSON if set
+	}{
+		{
+			name:       "get hq",
+			method:     "GET",
+			target:     "/v1/swift-codes/ABCDGB2LXXX",
+			statusCode: http.StatusOK,
+			expected: GetSwiftCodeHqRes{
+				Address:       "456 HQ Street",
+				BankName:      "HQ Bank",
+				CountryISO2:   "GB",
+				CountryName:   "UNITED KINGDOM",
+				IsHeadquarter: true,
+				SwiftCode:     "ABCDGB2LXXX",
+				Branches: []GetSwiftCodeHqBranch{
+					{
+						Address:     "456 Branch Street",
+						BankName:    "Branch Bank",
+						CountryISO2: "GB",
+						SwiftCode:   "ABCDGB2L001",
+					},
+				},
+			},
+		},
+		{
+			name:       "get missing",
+			method:     "GET",
+			target:     "/v1/swift-codes/ZZZZGB2LXXX",
+			statusCode: http.StatusNotFound,
+		},
+		{
+			name:       "get country",
+			method:     "GET",
+			target:     "/v1/swift-codes/country/PL",
+			statusCode: http.StatusOK,
+			expected: GetSwiftCodesForCountryRes{
+				CountryISO2: "PL",
+				CountryName: "POLAND",
+				SwiftCodes: []GetSwiftCodesForCountrySwiftCode{
+					{
+						Address:       "Marszalkowska 1",
+						BankName:      "Polish Bank",
+						CountryISO2:   "PL",
+						IsHeadquarter: true,
+						SwiftCode:     "EFGHPLPWXXX",
+					},
+				},
+			},
+		},
+		{
+			name:       "get missing country",
+			method:     "GET",
+			target:     "/v1/swift-codes/country/DE",
+			statusCode: http.StatusNotFound,
+		},
+		{
+			name:       "get country page after the last one",
+			method:     "GET",
+			target:     "/v1/swift-codes/country/PL?limit=1&cursor=" + encodeCursor("EFGHPLPWXXX"),
+			statusCode: http.StatusOK,
+			expected: GetSwiftCodesForCountryRes{
+				CountryISO2: "PL",
+				CountryName: "POLAND",
+				SwiftCodes:  []GetSwiftCodesForCountrySwiftCode{},
+			},
+		},
+		{
+			name:       "get country page of a country without banks",
+			method:     "GET",
+			target:     "/v1/swift-codes/country/ZZ?cursor=" + encodeCursor("ABCDZZFFXXX"),
+			statusCode: http.StatusNotFound,
+		},
+		{
+			name:       "get country page of a lowercase country",
+			method:     "GET",
+			target:     "/v1/swift-codes/country/pl?cursor=" + encodeCursor("EFGHPLPWXXX"),
+			statusCode: http.StatusNotFound,
+		},
+		{
+			name:       "add duplicate",
+			method:     "POST",
+			target:     "/v1/swift-codes",
+			body:       `{"address":"456 HQ Street","bankName":"HQ Bank","countryISO2":"GB","countryName":"UNITED KINGDOM","isHeadquarter":true,"swiftCode":"ABCDGB2LXXX"}`,
+			statusCode: http.StatusConflict,
+		},
+		{
+			name:       "add hq links branches",
+			method:     "POST",
+			target:     "/v1/swift-codes",
+			body:       `{"address":"1 Street","bankName":"New Bank","countryISO2":"GB","countryName":"UNITED KINGDOM","isHeadquarter":true,"swiftCode":"IJKLGB2LXXX"}`,
+			statusCode: http.StatusCreated,
+			expected:   AddSwiftCodeRes{Message: "Added bank with SWIFT code IJKLGB2LXXX", LinkedBranches: ptr(int64(0))},
+		},
+		{
+			name:       "delete",
+			method:     "DELETE",
+			target:     "/v1/swift-codes/EFGHPLPWXXX",
+			statusCode: http.StatusOK,
+			expected:   MessageRes{Message: "Deleted bank with SWIFT code EFGHPLPWXXX"},
+		},
+	}
+
+	for _, tt := range testCases {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			// Arrange
+			router := testMemoryApi(t, memoryTestCsv)
+			w := httptest.NewRecorder()
+			r := httptest.NewRequest(tt.method, tt.target, bytes.NewBufferString(tt.body))
+			if tt.body != "" {
+				r.Header.Set("Content-Type", "application/json")
+			}
+
+			// Act
+			router.ServeHTTP(w, r)
+
+			// Assert
+			res := w.Result()
+			assert.Equal(t, tt.statusCode, res.StatusCode)
+			if tt.expected != nil {
+				expectedJSON, err := json.Marshal(tt.expected)
+				require.NoError(t, err)
+				actualJSON, err := io.ReadAll(res.Body)
+				require.NoError(t, err)
+				assert.JSONEq(t, string(expectedJSON), string(actualJSON))
+			}
+		})
+	}
+}
+
+func TestDeleteAndRestoreWithMemoryRepository(t *testing.T) {
+	// Arrange
+	router := testMemoryApi(t, memoryTestCsv)
+	serve := func(method string, target string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(method, target, nil))
+		return w
+	}
+
+	// Act & Assert
+	require.Equal(t, http.StatusOK, serve("DELETE", "/v1/swift-codes/ABCDGB2LXXX").Code)
+	assert.Equal(t, http.StatusNotFound, serve("GET", "/v1/swift-codes/ABCDGB2LXXX").Code)
+	assert.Equal(t, http.StatusNotFound, serve("DELETE", "/v1/swift-codes/ABCDGB2LXXX").Code)
+
+	// The code is still taken until the bank is purged
+	body := `{"address":"456 HQ Street","bankName":"HQ Bank","countryISO2":"GB","countryName":"UNITED KINGDOM","isHeadquarter":true,"swiftCode":"ABCDGB2LXXX"}`
+	r := httptest.NewRequest("POST", "/v1/swift-codes", bytes.NewBufferString(body))
+	r.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, r)
+	assert.Equal(t, http.StatusConflict, w.Code)
+
+	w = serve("POST", "/v1/swift-codes/ABCDGB2LXXX/restore")
+	require.Equal(t, http.StatusOK, w.Code)
+	var res RestoreSwiftCodeRes
+	require.NoError(t, json.NewDecoder(w.Body).Decode(&res))
+	assert.Equal(t, ptr(int64(1)), res.LinkedBranches)
+
+	w = serve("GET", "/v1/swift-codes/ABCDGB2LXXX")
+	require.Equal(t, http.StatusOK, w.Code)
+	var hq GetSwiftCodeHqRes
+	require.NoError(t, json.NewDecoder(w.Body).Decode(&hq))
+	assert.Len(t, hq.Branches, 1)
+
+	assert.Equal(t, http.StatusConflict, serve("POST", "/v1/swift-codes/ABCDGB2LXXX/restore").Code)
+	assert.Equal(t, http.StatusNotFound, serve("POST", "/v1/swift-codes/ZZZZGB2LXXX/restore").Code)
+	assert.Equal(t, http.StatusNotFound, serve("POST", "/v1/swift-codes/ABCDGB2LXXX/other").Code)
+}
+
+func TestPurgeWithMemoryRepository(t *testing.T) {
+	// Arrange
+	router := testMemoryApi(t, memoryTestCsv)
+	serve := func(method string, target string) int {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(method, target, nil))
+		return w.Code
+	}
+
+	// Act & Assert
+	assert.Equal(t, http.StatusConflict, serve("DELETE", "/v1/admin/swift-codes/EFGHPLPWXXX"))
+	require.Equal(t, http.StatusOK, serve("DELETE", "/v1/swift-codes/EFGHPLPWXXX"))
+	assert.Equal(t, http.StatusOK, serve("DELETE", "/v1/admin/swift-codes/EFGHPLPWXXX"))
+	assert.Equal(t, http.StatusNotFound, serve("DELETE", "/v1/admin/swift-codes/EFGHPLPWXXX"))
+	assert.Equal(t, http.StatusNotFound, serve("POST", "/v1/swift-codes/EFGHPLPWXXX/restore"))
+}
+
+func TestHistoryWithMemoryRepository(t *testing.T) {
+	// Arrange
+	keys := auth.FileKeyStore{auth.HashKey("alice-key"): {Name: "alice", Role: auth.RoleEditor}}
+	router := testMemoryAuthApi(t, memoryTestCsv, AuthConfig{Keys: keys, PublicReads: true})
+	r := httptest.NewRequest("DELETE", "/v1/swift-codes/EFGHPLPWXXX", nil)
+	r.Header.Set("X-API-Key", "alice-key")
+	router.ServeHTTP(httptest.NewRecorder(), r)
+
+	// Act
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("GET", "/v1/swift-codes/efghplpwxxx/history", nil))
+
+	// Assert
+	require.Equal(t, http.StatusOK, w.Code)
+	var res GetSwiftCodeHistoryRes
+	require.NoError(t, json.NewDecoder(w.Body).Decode(&res))
+	assert.Equal(t, "EFGHPLPWXXX", res.SwiftCode)
+	require.Len(t, res.Changes, 2)
+
+	deleted := res.Changes[0]
+	assert.Equal(t, "delete", deleted.Operation)
+	assert.Equal(t, "alice", deleted.Actor)
+	assert.Equal(t, "api", deleted.Source)
+	require.NotNil(t, deleted.Before)
+	assert.Equal(t, "Polish Bank", deleted.Before.BankName)
+	assert.Nil(t, deleted.After)
+
+	inserted := res.Changes[1]
+	assert.Equal(t, "insert", inserted.Operation)
+	assert.Equal(t, "import", inserted.Source)
+	assert.Nil(t, inserted.Before)
+	assert.NotNil(t, inserted.After)
+
+	for _, target := range []string{"/v1/swift-codes/ZZZZGB2LXXX/history", "/v1/swift-codes/EFGHPLPWXXX/other"} {
+		w = httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest("GET", target, nil))
+		assert.Equal(t, http.StatusNotFound, w.Code, target)
+	}
+}
+
+func TestCacheWithMemoryRepository(t *testing.T) {
+	// Arrange
+	repo := db.NewCachedRepository(testMemoryRepository(t, memoryTestCsv), 100, time.Hour)
+	router := NewApiServer(":0", repo, AuthConfig{}, nil, log.New(io.Discard, "", 0)).NewRouter()
+	serve := func(method string, target string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(method, target, nil))
+		return w
+	}
+
+	// Act & Assert
+	require.Equal(t, http.StatusOK, serve("GET", "/v1/swift-codes/ABCDGB2LXXX").Code)
+	require.Equal(t, http.StatusOK, serve("GET", "/v1/swift-codes/ABCDGB2LXXX").Code)
+
+	// The HQ's cached branches don't have the deleted branch anymore
+	require.Equal(t, http.StatusOK, serve("DELETE", "/v1/swift-codes/ABCDGB2L001").Code)
+	w := serve("GET", "/v1/swift-codes/ABCDGB2LXXX")
+	require.Equal(t, http.StatusOK, w.Code)
+	var hq GetSwiftCodeHqRes
+	require.NoError(t, json.NewDecoder(w.Body).Decode(&hq))
+	assert.Empty(t, hq.Branches)
+
+	w = serve("GET", "/v1/admin/cache")
+	require.Equal(t, http.StatusOK, w.Code)
+	var stats GetCacheStatsRes
+	require.NoError(t, json.NewDecoder(w.Body).Decode(&stats))
+	// Bank and branches are hits the second time, the delete gave the HQ a new version so it's read again
+	assert.Equal(t, uint64(2), stats.Hits)
+	assert.Equal(t, uint64(4), stats.Misses)
+	assert.InDelta(t, 1.0/3, stats.HitRatio, 0.001)
+
+	uncached := testMemoryApi(t, memoryTestCsv)
+	w = httptest.NewRecorder()
+	uncached.ServeHTTP(w, httptest.NewRequest("GET", "/v1/admin/cache", nil))
+	assert.Equal(t, http.StatusNotFound, w.Code)
+}
@@ -3,15 +3,25 @@ package api
 import (
 	"bytes"
 	"database/sql"
+	"encoding/csv"
 	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
 	"log"
 	"net/http"
 	"net/http/httptest"
+	"net/url"
+	"slices"
+	"strings"
 	"testing"
 
 	"github.com/jmoiron/sqlx"
+	"github.com/mwojtyna/swift-api/internal/bic"
 	"github.com/mwojtyna/swift-api/internal/db"
+	"github.com/mwojtyna/swift-api/internal/parser"
 	"github.com/mwojtyna/swift-api/internal/utils"
+	"github.com/parquet-go/parquet-go"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
@@ -30,16 +40,20 @@ func testApi(f func(testApiArgs)) {
 
 		var logBuf bytes.Buffer
 		logger := log.New(&logBuf, "", 0)
-		api := NewApiServer(":"+args.Env.API_PORT, pg, logger)
+		api := NewApiServer(":"+args.Env.API_PORT, db.NewPostgresRepository(pg), AuthConfig{}, nil, logger)
 		router := api.NewRouter()
 
 		f(testApiArgs{router: router, db: pg})
 	})
 }
 
+func ptr[T any](v T) *T {
+	return &v
+}
+
 var (
 	hqBank = db.Bank{
-		SwiftCode:       "ABCDEFGHXXX",
+		SwiftCode:       "ABCDGB2LXXX",
 		HqSwiftCode:     sql.NullString{},
 		IsHeadquarter:   true,
 		BankName:        "HQ Bank",
@@ -48,7 +62,7 @@ var (
 		CountryName:     "UNITED KINGDOM",
 	}
 	branchBank1 = db.Bank{
-		SwiftCode:       "ABCDEFGH001",
+		SwiftCode:       "ABCDGB2L001",
 		HqSwiftCode:     sql.NullString{String: hqBank.SwiftCode, Valid: true},
 		IsHeadquarter:   false,
 		BankName:        "Branch Bank",
@@ -57,7 +71,7 @@ var (
 		CountryName:     "UNITED KINGDOM",
 	}
 	branchBank2 = db.Bank{
-		SwiftCode:       "ABCDEFGH002",
+		SwiftCode:       "ABCDGB2L002",
 		HqSwiftCode:     sql.NullString{String: hqBank.SwiftCode, Valid: true},
 		IsHeadquarter:   false,
 		BankName:        "Branch Bank",
@@ -73,6 +87,7 @@ func TestHandleGetSwiftCodeV1(t *testing.T) {
 	testCases := []struct {
 		name       string
 		swiftCode  string
+		location   string
 		setup      func(pg *sqlx.DB) error
 		expected   any
 		wantErr    bool
@@ -82,7 +97,7 @@ func TestHandleGetSwiftCodeV1(t *testing.T) {
 			name:      "hq response schema",
 			swiftCode: hqBank.SwiftCode,
 			setup: func(pg *sqlx.DB) error {
-				return db.InsertBanks(pg, []db.Bank{hqBank, branchBank1, branchBank2})
+				return db.InsertBanks(pg, []db.Bank{hqBank, branchBank1, branchBank2}, db.Audit{})
 			},
 			expected: GetSwiftCodeHqRes{
 				Address:       hqBank.Address,
@@ -114,7 +129,7 @@ func TestHandleGetSwiftCodeV1(t *testing.T) {
 			name:      "branch response schema",
 			swiftCode: branchBank1.SwiftCode,
 			setup: func(pg *sqlx.DB) error {
-				return db.InsertBanks(pg, []db.Bank{hqBank, branchBank1})
+				return db.InsertBanks(pg, []db.Bank{hqBank, branchBank1}, db.Audit{})
 			},
 			expected: GetSwiftCodeBranchRes{
 				Address:       branchBank1.Address,
@@ -126,6 +141,24 @@ func TestHandleGetSwiftCodeV1(t *testing.T) {
 			},
 			statusCode: http.StatusOK,
 		},
+		{
+			name:      "lowercase BIC8 resolves to hq",
+			swiftCode: "abcdgb2l",
+			location:  "/v1/swift-codes/" + hqBank.SwiftCode,
+			setup: func(pg *sqlx.DB) error {
+				return db.InsertBanks(pg, []db.Bank{hqBank}, db.Audit{})
+			},
+			expected: GetSwiftCodeHqRes{
+				Address:       hqBank.Address,
+				BankName:      hqBank.BankName,
+				CountryISO2:   hqBank.CountryISO2Code,
+				CountryName:   hqBank.CountryName,
+				IsHeadquarter: hqBank.IsHeadquarter,
+				SwiftCode:     hqBank.SwiftCode,
+				Branches:      []GetSwiftCodeHqBranch{},
+			},
+			statusCode: http.StatusOK,
+		},
 		{
 			name:       "not found",
 			swiftCode:  "MISSING",
@@ -151,6 +184,9 @@ func TestHandleGetSwiftCodeV1(t *testing.T) {
 
 				res := w.Result()
 				assert.Equal(t, tt.statusCode, res.StatusCode)
+				if tt.location != "" {
+					assert.Equal(t, tt.location, res.Header.Get("Content-Location"))
+				}
 
 				if !tt.wantErr {
 					var actualResponse any
@@ -175,6 +211,7 @@ func TestHandleGetSwiftCodesForCountryV1(t *testing.T) {
 	testCases := []struct {
 		name        string
 		countryCode string
+		query       string
 		statusCode  int
 		setup       func(pg *sqlx.DB) error
 		expected    any
@@ -185,7 +222,7 @@ func TestHandleGetSwiftCodesForCountryV1(t *testing.T) {
 			countryCode: hqBank.CountryISO2Code,
 			statusCode:  http.StatusOK,
 			setup: func(pg *sqlx.DB) error {
-				return db.InsertBanks(pg, []db.Bank{hqBank, branchBank1})
+				return db.InsertBanks(pg, []db.Bank{hqBank, branchBank1}, db.Audit{})
 			},
 			expected: GetSwiftCodesForCountryRes{
 				CountryISO2: hqBank.CountryISO2Code,
@@ -208,6 +245,86 @@ func TestHandleGetSwiftCodesForCountryV1(t *testing.T) {
 				},
 			},
 		},
+		{
+			name:        "first page",
+			countryCode: hqBank.CountryISO2Code,
+			query:       "limit=1",
+			statusCode:  http.StatusOK,
+			setup: func(pg *sqlx.DB) error {
+				return db.InsertBanks(pg, []db.Bank{hqBank, branchBank1}, db.Audit{})
+			},
+			expected: GetSwiftCodesForCountryRes{
+				CountryISO2: hqBank.CountryISO2Code,
+				CountryName: hqBank.CountryName,
+				SwiftCodes: []GetSwiftCodesForCountrySwiftCode{
+					{
+						Address:       branchBank1.Address,
+						BankName:      branchBank1.BankName,
+						CountryISO2:   branchBank1.CountryISO2Code,
+						IsHeadquarter: branchBank1.IsHeadquarter,
+						SwiftCode:     branchBank1.SwiftCode,
+					},
+				},
+				NextCursor: encodeCursor(branchBank1.SwiftCode),
+			},
+		},
+		{
+			name:        "last page",
+			countryCode: hqBank.CountryISO2Code,
+			query:       "limit=1&cursor=" + encodeCursor(branchBank1.SwiftCode),
+			statusCode:  http.StatusOK,
+			setup: func(pg *sqlx.DB) error {
+				return db.InsertBanks(pg, []db.Bank{hqBank, branchBank1}, db.Audit{})
+			},
+			expected: GetSwiftCodesForCountryRes{
+				CountryISO2: hqBank.CountryISO2Code,
+				CountryName: hqBank.CountryName,
+				SwiftCodes: []GetSwiftCodesForCountrySwiftCode{
+					{
+						Address:       hqBank.Address,
+						BankName:      hqBank.BankName,
+						CountryISO2:   hqBank.CountryISO2Code,
+						IsHeadquarter: hqBank.IsHeadquarter,
+						SwiftCode:     hqBank.SwiftCode,
+					},
+				},
+			},
+		},
+		{
+			name:        "past the last page",
+			countryCode: hqBank.CountryISO2Code,
+			query:       "limit=1&cursor=" + encodeCursor(hqBank.SwiftCode),
+			statusCode:  http.StatusOK,
+			setup: func(pg *sqlx.DB) error {
+				return db.InsertBanks(pg, []db.Bank{hqBank, branchBank1}, db.Audit{})
+			},
+			expected: GetSwiftCodesForCountryRes{
+				CountryISO2: hqBank.CountryISO2Code,
+				CountryName: hqBank.CountryName,
+				SwiftCodes:  []GetSwiftCodesForCountrySwiftCode{},
+			},
+		},
+		{
+			name:        "page of a country without banks",
+			countryCode: "ZZ",
+			query:       "cursor=" + encodeCursor(hqBank.SwiftCode),
+			statusCode:  http.StatusNotFound,
+			wantErr:     true,
+		},
+		{
+			name:        "invalid cursor",
+			countryCode: hqBank.CountryISO2Code,
+			query:       "cursor=!!!",
+			statusCode:  http.StatusBadRequest,
+			wantErr:     true,
+		},
+		{
+			name:        "invalid limit",
+			countryCode: hqBank.CountryISO2Code,
+			query:       "limit=-1",
+			statusCode:  http.StatusBadRequest,
+			wantErr:     true,
+		},
 		{
 			name:        "not found",
 			countryCode: "ABC",
@@ -227,7 +344,7 @@ func TestHandleGetSwiftCodesForCountryV1(t *testing.T) {
 				})
 
 				w := httptest.NewRecorder()
-				r := httptest.NewRequest("GET", "/v1/swift-codes/country/"+tt.countryCode, nil)
+				r := httptest.NewRequest("GET", "/v1/swift-codes/country/"+tt.countryCode+"?"+tt.query, nil)
 
 				args.router.ServeHTTP(w, r)
 
@@ -273,7 +390,25 @@ func TestHandleAddSwiftCodeV1(t *testing.T) {
 				SwiftCode:     hqBank.SwiftCode,
 			},
 			expectedStatus: http.StatusCreated,
-			expectedBody:   MessageRes{Message: "Added bank with SWIFT code " + hqBank.SwiftCode},
+			expectedBody:   AddSwiftCodeRes{Message: "Added bank with SWIFT code " + hqBank.SwiftCode, LinkedBranches: ptr(int64(0))},
+		},
+		{
+			name: "hq creation links orphaned branches",
+			requestBody: AddSwiftCodeReq{
+				Address:       hqBank.Address,
+				BankName:      hqBank.BankName,
+				CountryISO2:   hqBank.CountryISO2Code,
+				CountryName:   hqBank.CountryName,
+				IsHeadquarter: hqBank.IsHeadquarter,
+				SwiftCode:     hqBank.SwiftCode,
+			},
+			setup: func(pg *sqlx.DB) error {
+				orphan := branchBank1
+				orphan.HqSwiftCode = sql.NullString{}
+				return db.InsertBank(pg, orphan, db.Audit{})
+			},
+			expectedStatus: http.StatusCreated,
+			expectedBody:   AddSwiftCodeRes{Message: "Added bank with SWIFT code " + hqBank.SwiftCode, LinkedBranches: ptr(int64(1))},
 		},
 		{
 			name: "successful branch bank creation",
@@ -286,10 +421,23 @@ func TestHandleAddSwiftCodeV1(t *testing.T) {
 				SwiftCode:     branchBank1.SwiftCode,
 			},
 			setup: func(pg *sqlx.DB) error {
-				return db.InsertBank(pg, hqBank)
+				return db.InsertBank(pg, hqBank, db.Audit{})
+			},
+			expectedStatus: http.StatusCreated,
+			expectedBody:   AddSwiftCodeRes{Message: "Added bank with SWIFT code " + branchBank1.SwiftCode},
+		},
+		{
+			name: "BIC8 swift code is stored as BIC11",
+			requestBody: AddSwiftCodeReq{
+				Address:       hqBank.Address,
+				BankName:      hqBank.BankName,
+				CountryISO2:   hqBank.CountryISO2Code,
+				CountryName:   hqBank.CountryName,
+				IsHeadquarter: hqBank.IsHeadquarter,
+				SwiftCode:     " abcdgb2l ",
 			},
 			expectedStatus: http.StatusCreated,
-			expectedBody:   MessageRes{Message: "Added bank with SWIFT code " + branchBank1.SwiftCode},
+			expectedBody:   AddSwiftCodeRes{Message: "Added bank with SWIFT code " + hqBank.SwiftCode, LinkedBranches: ptr(int64(0))},
 		},
 		{
 			name:           "unparsable JSON",
@@ -305,6 +453,19 @@ func TestHandleAddSwiftCodeV1(t *testing.T) {
 			expectedStatus: http.StatusUnprocessableEntity,
 			wantErr:        true,
 		},
+		{
+			name: "swift code with invalid structure",
+			requestBody: AddSwiftCodeReq{
+				SwiftCode:     "ABCDQQ2LXXX", // unknown country code
+				BankName:      "Test Bank",
+				Address:       "123 Test Street",
+				CountryISO2:   "GB",
+				CountryName:   "UNITED KINGDOM",
+				IsHeadquarter: true,
+			},
+			expectedStatus: http.StatusUnprocessableEntity,
+			wantErr:        true,
+		},
 		{
 			name: "hq flag mismatch with swift code",
 			requestBody: AddSwiftCodeReq{
@@ -345,7 +506,7 @@ func TestHandleAddSwiftCodeV1(t *testing.T) {
 			},
 			setup: func(pg *sqlx.DB) error {
 				// Insert the same bank first
-				return db.InsertBank(pg, hqBank)
+				return db.InsertBank(pg, hqBank, db.Audit{})
 			},
 			expectedStatus: http.StatusConflict,
 			wantErr:        true,
@@ -385,16 +546,26 @@ func TestHandleAddSwiftCodeV1(t *testing.T) {
 				assert.Equal(t, tt.expectedStatus, res.StatusCode, "status code mismatch")
 
 				if !tt.wantErr {
-					var actualBody MessageRes
+					var actualBody AddSwiftCodeRes
 					require.NoError(t, json.NewDecoder(res.Body).Decode(&actualBody))
 					assert.Equal(t, tt.expectedBody, actualBody)
 
 					// Verify the bank was actually created in DB
 					if tt.expectedStatus == http.StatusCreated {
+						swiftCode := bic.Normalize(tt.requestBody.(AddSwiftCodeReq).SwiftCode)
+						assert.Equal(t, "/v1/swift-codes/"+swiftCode, res.Header.Get("Location"))
+
 						var count int
-						err := args.db.Get(&count, "SELECT COUNT(*) FROM bank WHERE swift_code = $1", tt.requestBody.(AddSwiftCodeReq).SwiftCode)
+						err := args.db.Get(&count, "SELECT COUNT(*) FROM bank WHERE swift_code = $1", swiftCode)
 						require.NoError(t, err)
 						assert.Equal(t, 1, count)
+
+						if actualBody.LinkedBranches != nil {
+							var linkedCount int64
+							err := args.db.Get(&linkedCount, "SELECT COUNT(*) FROM bank WHERE hq_swift_code = $1", swiftCode)
+							require.NoError(t, err)
+							assert.Equal(t, *actualBody.LinkedBranches, linkedCount)
+						}
 					}
 				}
 			})
@@ -417,7 +588,7 @@ func TestHandleDeleteSwiftCodeV1(t *testing.T) {
 			name:      "delete branch bank",
 			swiftCode: hqBank.SwiftCode,
 			setup: func(pg *sqlx.DB) error {
-				return db.InsertBanks(pg, []db.Bank{hqBank, branchBank1, branchBank2})
+				return db.InsertBanks(pg, []db.Bank{hqBank, branchBank1, branchBank2}, db.Audit{})
 			},
 			expectedStatus: http.StatusOK,
 			expectedBody:   MessageRes{Message: "Deleted bank with SWIFT code " + hqBank.SwiftCode},
@@ -426,7 +597,16 @@ func TestHandleDeleteSwiftCodeV1(t *testing.T) {
 			name:      "delete branch bank",
 			swiftCode: branchBank1.SwiftCode,
 			setup: func(pg *sqlx.DB) error {
-				return db.InsertBanks(pg, []db.Bank{hqBank, branchBank1})
+				return db.InsertBanks(pg, []db.Bank{hqBank, branchBank1}, db.Audit{})
+			},
+			expectedStatus: http.StatusOK,
+			expectedBody:   MessageRes{Message: "Deleted bank with SWIFT code " + branchBank1.SwiftCode},
+		},
+		{
+			name:      "delete by lowercase code",
+			swiftCode: "abcdgb2l001",
+			setup: func(pg *sqlx.DB) error {
+				return db.InsertBanks(pg, []db.Bank{hqBank, branchBank1}, db.Audit{})
 			},
 			expectedStatus: http.StatusOK,
 			expectedBody:   MessageRes{Message: "Deleted bank with SWIFT code " + branchBank1.SwiftCode},
@@ -464,14 +644,14 @@ func TestHandleDeleteSwiftCodeV1(t *testing.T) {
 					require.NoError(t, json.NewDecoder(res.Body).Decode(&actualBody))
 					assert.Equal(t, tt.expectedBody, actualBody)
 
-					// Verify the bank was actually deleted from DB
+					// Verify the bank was actually soft deleted in DB
 					var count int
-					err := args.db.Get(&count, "SELECT COUNT(*) FROM bank WHERE swift_code = $1", tt.swiftCode)
+					err := args.db.Get(&count, "SELECT COUNT(*) FROM bank WHERE swift_code = $1 AND deleted_at IS NULL", bic.Normalize(tt.swiftCode))
 					require.NoError(t, err)
 					assert.Equal(t, 0, count)
 
 					var hqCount int
-					err = args.db.Get(&hqCount, "SELECT COUNT(*) FROM bank WHERE hq_swift_code = $1", tt.swiftCode)
+					err = args.db.Get(&hqCount, "SELECT COUNT(*) FROM bank WHERE hq_swift_code = $1", bic.Normalize(tt.swiftCode))
 					require.NoError(t, err)
 					assert.Equal(t, 0, hqCount)
 				}
@@ -479,3 +659,743 @@ func TestHandleDeleteSwiftCodeV1(t *testing.T) {
 		}
 	})
 }
+
+func TestHandleSearchSwiftCodesV1(t *testing.T) {
+	t.Parallel()
+
+	otherBank := db.Bank{
+		SwiftCode:       "ZYXWPLPWXXX",
+		HqSwiftCode:     sql.NullString{},
+		IsHeadquarter:   true,
+		BankName:        "Other Bank",
+		Address:         "1 Old Branch Street",
+		TownName:        "WARSZAWA",
+		CountryISO2Code: "PL",
+		CountryName:     "POLAND",
+	}
+
+	testCases := []struct {
+		name           string
+		query          string
+		setup          func(pg *sqlx.DB) error
+		expectedStatus int
+		expectedCodes  []string
+		wantErr        bool
+	}{
+		{
+			name:  "prefix match ranks before substring match",
+			query: "q=branch",
+			setup: func(pg *sqlx.DB) error {
+				return db.InsertBanks(pg, []db.Bank{hqBank, branchBank1, otherBank}, db.Audit{})
+			},
+			expectedStatus: http.StatusOK,
+			expectedCodes:  []string{branchBank1.SwiftCode, otherBank.SwiftCode},
+		},
+		{
+			name:  "matches town name",
+			query: "q=warszawa",
+			setup: func(pg *sqlx.DB) error {
+				return db.InsertBanks(pg, []db.Bank{hqBank, otherBank}, db.Audit{})
+			},
+			expectedStatus: http.StatusOK,
+			expectedCodes:  []string{otherBank.SwiftCode},
+		},
+		{
+			name:  "fuzzy match with typo",
+			query: "q=otherr",
+			setup: func(pg *sqlx.DB) error {
+				return db.InsertBanks(pg, []db.Bank{hqBank, otherBank}, db.Audit{})
+			},
+			expectedStatus: http.StatusOK,
+			expectedCodes:  []string{otherBank.SwiftCode},
+		},
+		{
+			name:           "no matches",
+			query:          "q=nothing",
+			expectedStatus: http.StatusOK,
+			expectedCodes:  []string{},
+		},
+		{
+			name:           "missing query",
+			query:          "",
+			expectedStatus: http.StatusBadRequest,
+			wantErr:        true,
+		},
+		{
+			name:           "invalid limit",
+			query:          "q=bank&limit=0",
+			expectedStatus: http.StatusBadRequest,
+			wantErr:        true,
+		},
+	}
+
+	testApi(func(args testApiArgs) {
+		for _, tt := range testCases {
+			t.Run(tt.name, func(t *testing.T) {
+				if tt.setup != nil {
+					require.NoError(t, tt.setup(args.db))
+				}
+				t.Cleanup(func() {
+					args.db.Exec("TRUNCATE bank")
+				})
+
+				w := httptest.NewRecorder()
+				r := httptest.NewRequest("GET", "/v1/swift-codes/search?"+tt.query, nil)
+
+				args.router.ServeHTTP(w, r)
+
+				res := w.Result()
+				defer res.Body.Close()
+
+				assert.Equal(t, tt.expectedStatus, res.StatusCode, "status code mismatch")
+
+				if !tt.wantErr {
+					var actualBody SearchSwiftCodesRes
+					require.NoError(t, json.NewDecoder(res.Body).Decode(&actualBody))
+
+					codes := utils.Map(actualBody.Results, func(r SearchSwiftCodesResult) string { return r.SwiftCode })
+					assert.Equal(t, tt.expectedCodes, codes)
+				}
+			})
+		}
+	})
+}
+
+func TestHandleReplaceSwiftCodeV1(t *testing.T) {
+	t.Parallel()
+
+	replacement := AddSwiftCodeReq{
+		Address:       "1 New Street",
+		BankName:      "New Bank Name",
+		CountryISO2:   hqBank.CountryISO2Code,
+		CountryName:   hqBank.CountryName,
+		IsHeadquarter: true,
+		SwiftCode:     hqBank.SwiftCode,
+	}
+
+	testCases := []struct {
+		name           string
+		swiftCode      string
+		requestBody    any
+		setup          func(pg *sqlx.DB) error
+		expectedStatus int
+		expectedBody   any
+		wantErr        bool
+	}{
+		{
+			name:        "replaces hq and keeps branches linked",
+			swiftCode:   hqBank.SwiftCode,
+			requestBody: replacement,
+			setup: func(pg *sqlx.DB) error {
+				return db.InsertBanks(pg, []db.Bank{hqBank, branchBank1}, db.Audit{})
+			},
+			expectedStatus: http.StatusOK,
+			expectedBody:   MessageRes{Message: "Updated bank with SWIFT code " + hqBank.SwiftCode},
+		},
+		{
+			name:           "unparsable JSON",
+			swiftCode:      hqBank.SwiftCode,
+			requestBody:    "unparsable json",
+			expectedStatus: http.StatusBadRequest,
+			wantErr:        true,
+		},
+		{
+			name:      "missing fields",
+			swiftCode: hqBank.SwiftCode,
+			requestBody: AddSwiftCodeReq{
+				SwiftCode: hqBank.SwiftCode,
+			},
+			setup: func(pg *sqlx.DB) error {
+				return db.InsertBank(pg, hqBank, db.Audit{})
+			},
+			expectedStatus: http.StatusUnprocessableEntity,
+			wantErr:        true,
+		},
+		{
+			name:        "swift code in body differs from URL",
+			swiftCode:   branchBank1.SwiftCode,
+			requestBody: replacement,
+			setup: func(pg *sqlx.DB) error {
+				return db.InsertBanks(pg, []db.Bank{hqBank, branchBank1}, db.Audit{})
+			},
+			expectedStatus: http.StatusUnprocessableEntity,
+			wantErr:        true,
+		},
+		{
+			name:           "non-existent bank",
+			swiftCode:      hqBank.SwiftCode,
+			requestBody:    replacement,
+			expectedStatus: http.StatusNotFound,
+			wantErr:        true,
+		},
+	}
+
+	testApi(func(args testApiArgs) {
+		for _, tt := range testCases {
+			t.Run(tt.name, func(t *testing.T) {
+				if tt.setup != nil {
+					require.NoError(t, tt.setup(args.db))
+				}
+				t.Cleanup(func() {
+					args.db.Exec("TRUNCATE bank")
+				})
+
+				var reqBody []byte
+				switch v := tt.requestBody.(type) {
+				case string:
+					reqBody = []byte(v)
+				default:
+					var err error
+					reqBody, err = json.Marshal(v)
+					require.NoError(t, err)
+				}
+
+				w := httptest.NewRecorder()
+				r := httptest.NewRequest("PUT", "/v1/swift-codes/"+tt.swiftCode, bytes.NewReader(reqBody))
+				r.Header.Set("Content-Type", "application/json")
+
+				args.router.ServeHTTP(w, r)
+
+				res := w.Result()
+				defer res.Body.Close()
+
+				assert.Equal(t, tt.expectedStatus, res.StatusCode, "status code mismatch")
+
+				if !tt.wantErr {
+					var actualBody MessageRes
+					require.NoError(t, json.NewDecoder(res.Body).Decode(&actualBody))
+					assert.Equal(t, tt.expectedBody, actualBody)
+
+					// Verify the bank was updated and its branches weren't detached
+					updated, err := db.GetBank(args.db, tt.swiftCode)
+					require.NoError(t, err)
+					assert.Equal(t, replacement.BankName, updated.BankName)
+					assert.Equal(t, replacement.Address, updated.Address)
+
+					branches, err := db.GetBankBranches(args.db, tt.swiftCode)
+					require.NoError(t, err)
+					assert.Len(t, branches, 1)
+				}
+			})
+		}
+	})
+}
+
+func TestHandleUpdateSwiftCodeV1(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		name           string
+		swiftCode      string
+		requestBody    string
+		setup          func(pg *sqlx.DB) error
+		expectedStatus int
+		expectedBank   db.Bank
+		wantErr        bool
+	}{
+		{
+			name:        "updates only given fields",
+			swiftCode:   branchBank1.SwiftCode,
+			requestBody: `{"address": "1 Patched Street"}`,
+			setup: func(pg *sqlx.DB) error {
+				return db.InsertBanks(pg, []db.Bank{hqBank, branchBank1}, db.Audit{})
+			},
+			expectedStatus: http.StatusOK,
+			expectedBank: func() db.Bank {
+				b := branchBank1
+				b.Address = "1 Patched Street"
+				return b
+			}(),
+		},
+		{
+			name:        "patched result is validated",
+			swiftCode:   branchBank1.SwiftCode,
+			requestBody: `{"countryISO2": "gb"}`,
+			setup: func(pg *sqlx.DB) error {
+				return db.InsertBanks(pg, []db.Bank{hqBank, branchBank1}, db.Audit{})
+			},
+			expectedStatus: http.StatusUnprocessableEntity,
+			wantErr:        true,
+		},
+		{
+			name:        "can't turn a branch into hq",
+			swiftCode:   branchBank1.SwiftCode,
+			requestBody: `{"isHeadquarter": true}`,
+			setup: func(pg *sqlx.DB) error {
+				return db.InsertBanks(pg, []db.Bank{hqBank, branchBank1}, db.Audit{})
+			},
+			expectedStatus: http.StatusUnprocessableEntity,
+			wantErr:        true,
+		},
+		{
+			name:        "can't change swift code",
+			swiftCode:   branchBank1.SwiftCode,
+			requestBody: `{"swiftCode": "` + branchBank2.SwiftCode + `"}`,
+			setup: func(pg *sqlx.DB) error {
+				return db.InsertBanks(pg, []db.Bank{hqBank, branchBank1}, db.Audit{})
+			},
+			expectedStatus: http.StatusUnprocessableEntity,
+			wantErr:        true,
+		},
+		{
+			name:           "non-existent bank",
+			swiftCode:      branchBank1.SwiftCode,
+			requestBody:    `{"address": "1 Patched Street"}`,
+			expectedStatus: http.StatusNotFound,
+			wantErr:        true,
+		},
+	}
+
+	testApi(func(args testApiArgs) {
+		for _, tt := range testCases {
+			t.Run(tt.name, func(t *testing.T) {
+				if tt.setup != nil {
+					require.NoError(t, tt.setup(args.db))
+				}
+				t.Cleanup(func() {
+					args.db.Exec("TRUNCATE bank")
+				})
+
+				w := httptest.NewRecorder()
+				r := httptest.NewRequest("PATCH", "/v1/swift-codes/"+tt.swiftCode, bytes.NewBufferString(tt.requestBody))
+				r.Header.Set("Content-Type", "application/json")
+
+				args.router.ServeHTTP(w, r)
+
+				res := w.Result()
+				defer res.Body.Close()
+
+				assert.Equal(t, tt.expectedStatus, res.StatusCode, "status code mismatch")
+
+				if !tt.wantErr {
+					updated, err := db.GetBank(args.db, tt.swiftCode)
+					require.NoError(t, err)
+					assert.Equal(t, tt.expectedBank, updated)
+				}
+			})
+		}
+	})
+}
+
+func TestHandleExportV1(t *testing.T) {
+	t.Parallel()
+
+	otherBank := db.Bank{
+		SwiftCode:       "ZYXWPLPWXXX",
+		HqSwiftCode:     sql.NullString{},
+		IsHeadquarter:   true,
+		BankName:        "Other Bank",
+		Address:         "1 Old Branch Street",
+		TownName:        "WARSZAWA",
+		CountryISO2Code: "PL",
+		CountryName:     "POLAND",
+	}
+
+	testCases := []struct {
+		name                string
+		query               string
+		expectedStatus      int
+		expectedContentType string
+		check               func(t *testing.T, body []byte)
+	}{
+		{
+			name:                "csv round-trips through the parser",
+			query:               "",
+			expectedStatus:      http.StatusOK,
+			expectedContentType: "text/csv",
+			check: func(t *testing.T, body []byte) {
+				banks, err := parser.ParseCsv(bytes.NewReader(body))
+				require.NoError(t, err)
+				assert.Equal(t, []db.Bank{hqBank, otherBank, branchBank1}, banks)
+			},
+		},
+		{
+			name:                "jsonl filtered by country",
+			query:               "format=jsonl&country=pl",
+			expectedStatus:      http.StatusOK,
+			expectedContentType: "application/jsonl",
+			check: func(t *testing.T, body []byte) {
+				lines := strings.Split(strings.TrimSpace(string(body)), "\n")
+				require.Len(t, lines, 1)
+
+				var actual ExportSwiftCode
+				require.NoError(t, json.Unmarshal([]byte(lines[0]), &actual))
+				assert.Equal(t, otherBank.SwiftCode, actual.SwiftCode)
+				assert.Equal(t, otherBank.TownName, actual.TownName)
+				assert.Nil(t, actual.HqSwiftCode)
+			},
+		},
+		{
+			name:                "parquet with HQs only",
+			query:               "format=parquet&hqOnly=true",
+			expectedStatus:      http.StatusOK,
+			expectedContentType: "application/vnd.apache.parquet",
+			check: func(t *testing.T, body []byte) {
+				rows, err := parquet.Read[ExportSwiftCode](bytes.NewReader(body), int64(len(body)))
+				require.NoError(t, err)
+				codes := utils.Map(rows, func(r ExportSwiftCode) string { return r.SwiftCode })
+				assert.Equal(t, []string{hqBank.SwiftCode, otherBank.SwiftCode}, codes)
+			},
+		},
+		{
+			name:                "empty csv still has a header",
+			query:               "country=DE",
+			expectedStatus:      http.StatusOK,
+			expectedContentType: "text/csv",
+			check: func(t *testing.T, body []byte) {
+				assert.Equal(t, "COUNTRY ISO2 CODE,SWIFT CODE,NAME,ADDRESS,TOWN NAME,COUNTRY NAME\n", string(body))
+			},
+		},
+		{
+			name:           "invalid format",
+			query:          "format=xlsx",
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:           "invalid country",
+			query:          "country=POL",
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:           "invalid hqOnly",
+			query:          "hqOnly=maybe",
+			expectedStatus: http.StatusBadRequest,
+		},
+	}
+
+	testApi(func(args testApiArgs) {
+		require.NoError(t, db.InsertBanks(args.db, []db.Bank{hqBank, branchBank1, otherBank}, db.Audit{}))
+
+		for _, tt := range testCases {
+			t.Run(tt.name, func(t *testing.T) {
+				w := httptest.NewRecorder()
+				r := httptest.NewRequest("GET", "/v1/export?"+tt.query, nil)
+
+				args.router.ServeHTTP(w, r)
+
+				res := w.Result()
+				defer res.Body.Close()
+
+				assert.Equal(t, tt.expectedStatus, res.StatusCode, "status code mismatch")
+
+				if tt.check != nil {
+					assert.Equal(t, tt.expectedContentType, res.Header.Get("Content-Type"))
+					body, err := io.ReadAll(res.Body)
+					require.NoError(t, err)
+					tt.check(t, body)
+				}
+			})
+		}
+	})
+}
+
+func TestContentNegotiation(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		name                string
+		path                string
+		accept              string
+		expectedStatus      int
+		expectedContentType string
+		check               func(t *testing.T, res *http.Response)
+	}{
+		{
+			name:                "hq as xml",
+			path:                "/v1/swift-codes/" + hqBank.SwiftCode,
+			accept:              "application/xml",
+			expectedStatus:      http.StatusOK,
+			expectedContentType: "application/xml",
+			check: func(t *testing.T, res *http.Response) {
+				var actual GetSwiftCodeHqRes
+				require.NoError(t, xml.NewDecoder(res.Body).Decode(&actual))
+				assert.Equal(t, hqBank.SwiftCode, actual.SwiftCode)
+				codes := utils.Map(actual.Branches, func(b GetSwiftCodeHqBranch) string { return b.SwiftCode })
+				assert.ElementsMatch(t, []string{branchBank1.SwiftCode, branchBank2.SwiftCode}, codes)
+			},
+		},
+		{
+			name:                "hq as csv",
+			path:                "/v1/swift-codes/" + hqBank.SwiftCode,
+			accept:              "text/csv",
+			expectedStatus:      http.StatusOK,
+			expectedContentType: "text/csv",
+			check: func(t *testing.T, res *http.Response) {
+				records, err := csv.NewReader(res.Body).ReadAll()
+				require.NoError(t, err)
+				require.Len(t, records, 4)
+				assert.Equal(t, []string{"address", "bankName", "countryISO2", "countryName", "isHeadquarter", "swiftCode"}, records[0])
+				assert.Equal(t, []string{hqBank.Address, hqBank.BankName, "GB", "UNITED KINGDOM", "true", hqBank.SwiftCode}, records[1])
+			},
+		},
+		{
+			name:                "country page as csv links the next page",
+			path:                "/v1/swift-codes/country/GB?limit=2",
+			accept:              "text/csv",
+			expectedStatus:      http.StatusOK,
+			expectedContentType: "text/csv",
+			check: func(t *testing.T, res *http.Response) {
+				records, err := csv.NewReader(res.Body).ReadAll()
+				require.NoError(t, err)
+				assert.Len(t, records, 3)
+
+				next := "/v1/swift-codes/country/GB?" + url.Values{"cursor": {encodeCursor(branchBank2.SwiftCode)}, "limit": {"2"}}.Encode()
+				assert.Equal(t, fmt.Sprintf(`<%s>; rel="next"`, next), res.Header.Get("Link"))
+			},
+		},
+		{
+			name:                "search can't be csv",
+			path:                "/v1/swift-codes/search?q=bank",
+			accept:              "text/csv",
+			expectedStatus:      http.StatusNotAcceptable,
+			expectedContentType: "application/json",
+		},
+		{
+			name:                "unsupported type",
+			path:                "/v1/swift-codes/" + hqBank.SwiftCode,
+			accept:              "application/pdf",
+			expectedStatus:      http.StatusNotAcceptable,
+			expectedContentType: "application/json",
+		},
+	}
+
+	testApi(func(args testApiArgs) {
+		require.NoError(t, db.InsertBanks(args.db, []db.Bank{hqBank, branchBank1, branchBank2}, db.Audit{}))
+
+		for _, tt := range testCases {
+			t.Run(tt.name, func(t *testing.T) {
+				w := httptest.NewRecorder()
+				r := httptest.NewRequest("GET", tt.path, nil)
+				r.Header.Set("Accept", tt.accept)
+
+				args.router.ServeHTTP(w, r)
+
+				res := w.Result()
+				defer res.Body.Close()
+
+				assert.Equal(t, tt.expectedStatus, res.StatusCode, "status code mismatch")
+				assert.Equal(t, tt.expectedContentType, res.Header.Get("Content-Type"))
+				if tt.check != nil {
+					tt.check(t, res)
+				}
+			})
+		}
+	})
+}
+
+func TestHandleAddSwiftCodesBatchV1(t *testing.T) {
+	t.Parallel()
+
+	hqReq := reqFromBank(hqBank)
+	branchReq := reqFromBank(branchBank1)
+	invalidReq := reqFromBank(branchBank2)
+	invalidReq.IsHeadquarter = true
+
+	testCases := []struct {
+		name             string
+		query            string
+		requestBody      any
+		setup            func(pg *sqlx.DB) error
+		expectedStatus   int
+		expectedStatuses []int
+		expectedCodes    []string // In the DB afterwards
+		wantErr          bool
+	}{
+		{
+			name:             "branch before its HQ is linked",
+			requestBody:      []AddSwiftCodeReq{branchReq, hqReq},
+			expectedStatus:   http.StatusCreated,
+			expectedStatuses: []int{http.StatusCreated, http.StatusCreated},
+			expectedCodes:    []string{branchBank1.SwiftCode, hqBank.SwiftCode},
+		},
+		{
+			name:             "atomic fails on invalid item",
+			requestBody:      []AddSwiftCodeReq{hqReq, invalidReq},
+			expectedStatus:   http.StatusUnprocessableEntity,
+			expectedStatuses: []int{http.StatusFailedDependency, http.StatusUnprocessableEntity},
+			expectedCodes:    []string{},
+		},
+		{
+			name:        "atomic fails on existing bank",
+			requestBody: []AddSwiftCodeReq{hqReq, branchReq},
+			setup: func(pg *sqlx.DB) error {
+				orphan := branchBank1
+				orphan.HqSwiftCode = sql.NullString{}
+				return db.InsertBank(pg, orphan, db.Audit{})
+			},
+			expectedStatus:   http.StatusUnprocessableEntity,
+			expectedStatuses: []int{http.StatusFailedDependency, http.StatusConflict},
+			expectedCodes:    []string{branchBank1.SwiftCode},
+		},
+		{
+			name:             "best effort adds valid items",
+			query:            "?mode=best-effort",
+			requestBody:      []AddSwiftCodeReq{hqReq, invalidReq, hqReq, branchReq},
+			expectedStatus:   http.StatusMultiStatus,
+			expectedStatuses: []int{http.StatusCreated, http.StatusUnprocessableEntity, http.StatusConflict, http.StatusCreated},
+			expectedCodes:    []string{branchBank1.SwiftCode, hqBank.SwiftCode},
+		},
+		{
+			name:           "empty batch",
+			requestBody:    []AddSwiftCodeReq{},
+			expectedStatus: http.StatusBadRequest,
+			wantErr:        true,
+		},
+		{
+			name:           "invalid mode",
+			query:          "?mode=sometimes",
+			requestBody:    []AddSwiftCodeReq{hqReq},
+			expectedStatus: http.StatusBadRequest,
+			wantErr:        true,
+		},
+		{
+			name:           "not an array",
+			requestBody:    hqReq,
+			expectedStatus: http.StatusBadRequest,
+			wantErr:        true,
+		},
+	}
+
+	testApi(func(args testApiArgs) {
+		for _, tt := range testCases {
+			t.Run(tt.name, func(t *testing.T) {
+				if tt.setup != nil {
+					require.NoError(t, tt.setup(args.db))
+				}
+				t.Cleanup(func() {
+					args.db.Exec("TRUNCATE bank")
+				})
+
+				reqBody, err := json.Marshal(tt.requestBody)
+				require.NoError(t, err)
+
+				w := httptest.NewRecorder()
+				r := httptest.NewRequest("POST", "/v1/swift-codes/batch"+tt.query, bytes.NewReader(reqBody))
+				r.Header.Set("Content-Type", "application/json")
+
+				args.router.ServeHTTP(w, r)
+
+				res := w.Result()
+				defer res.Body.Close()
+
+				assert.Equal(t, tt.expectedStatus, res.StatusCode, "status code mismatch")
+
+				if !tt.wantErr {
+					var actualBody BatchAddSwiftCodesRes
+					require.NoError(t, json.NewDecoder(res.Body).Decode(&actualBody))
+					statuses := utils.Map(actualBody.Results, func(r BatchAddSwiftCodeResult) int { return r.Status })
+					assert.Equal(t, tt.expectedStatuses, statuses)
+
+					codes := []string{}
+					err := args.db.Select(&codes, "SELECT swift_code FROM bank ORDER BY swift_code")
+					require.NoError(t, err)
+					assert.Equal(t, tt.expectedCodes, codes)
+
+					var hqCode sql.NullString
+					err = args.db.Get(&hqCode, "SELECT hq_swift_code FROM bank WHERE swift_code=$1", branchBank1.SwiftCode)
+					if err == nil && slices.Contains(tt.expectedCodes, hqBank.SwiftCode) {
+						assert.Equal(t, hqBank.SwiftCode, hqCode.String)
+					}
+				}
+			})
+		}
+	})
+}
+
+func TestHandleLookupSwiftCodesV1(t *testing.T) {
+	t.Parallel()
+
+	// Found entries have the shape of either, decoding all into the HQ one works for both
+	type lookupRes struct {
+		Found    []GetSwiftCodeHqRes `json:"found"`
+		NotFound []string            `json:"notFound"`
+	}
+
+	testCases := []struct {
+		name           string
+		requestBody    string
+		expectedStatus int
+		expected       lookupRes
+		wantErr        bool
+	}{
+		{
+			name:           "found and not found in request order",
+			requestBody:    `{"swiftCodes": ["ABCDGB2L001", "zzzzgb2lxxx", "abcdgb2l", "ABCDGB2L001"]}`,
+			expectedStatus: http.StatusOK,
+			expected: lookupRes{
+				Found: []GetSwiftCodeHqRes{
+					{
+						Address:       branchBank1.Address,
+						BankName:      branchBank1.BankName,
+						CountryISO2:   branchBank1.CountryISO2Code,
+						CountryName:   branchBank1.CountryName,
+						IsHeadquarter: false,
+						SwiftCode:     branchBank1.SwiftCode,
+					},
+					{
+						Address:       hqBank.Address,
+						BankName:      hqBank.BankName,
+						CountryISO2:   hqBank.CountryISO2Code,
+						CountryName:   hqBank.CountryName,
+						IsHeadquarter: true,
+						SwiftCode:     hqBank.SwiftCode,
+						Branches: []GetSwiftCodeHqBranch{
+							{
+								Address:       branchBank1.Address,
+								BankName:      branchBank1.BankName,
+								CountryISO2:   branchBank1.CountryISO2Code,
+								IsHeadquarter: false,
+								SwiftCode:     branchBank1.SwiftCode,
+							},
+							{
+								Address:       branchBank2.Address,
+								BankName:      branchBank2.BankName,
+								CountryISO2:   branchBank2.CountryISO2Code,
+								IsHeadquarter: false,
+								SwiftCode:     branchBank2.SwiftCode,
+							},
+						},
+					},
+				},
+				NotFound: []string{"zzzzgb2lxxx"},
+			},
+		},
+		{
+			name:           "empty list",
+			requestBody:    `{"swiftCodes": []}`,
+			expectedStatus: http.StatusUnprocessableEntity,
+			wantErr:        true,
+		},
+		{
+			name:           "invalid json",
+			requestBody:    `{"swiftCodes": "ABCDGB2L001"}`,
+			expectedStatus: http.StatusBadRequest,
+			wantErr:        true,
+		},
+	}
+
+	testApi(func(args testApiArgs) {
+		require.NoError(t, db.InsertBanks(args.db, []db.Bank{hqBank, branchBank1, branchBank2}, db.Audit{}))
+
+		for _, tt := range testCases {
+			t.Run(tt.name, func(t *testing.T) {
+				w := httptest.NewRecorder()
+				r := httptest.NewRequest("POST", "/v1/swift-codes/lookup", strings.NewReader(tt.requestBody))
+				r.Header.Set("Content-Type", "application/json")
+
+				args.router.ServeHTTP(w, r)
+
+				res := w.Result()
+				defer res.Body.Close()
+
+				assert.Equal(t, tt.expectedStatus, res.StatusCode, "status code mismatch")
+
+				if !tt.wantErr {
+					var actualBody lookupRes
+					require.NoError(t, json.NewDecoder(res.Body).Decode(&actualBody))
+					assert.Equal(t, tt.expected, actualBody)
+				}
+			})
+		}
+	})
+}
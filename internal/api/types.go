@@ -1,62 +1,125 @@
 package api
 
 import (
+	"encoding/xml"
 	"log"
+	"time"
 
 	"github.com/go-playground/validator/v10"
-	"github.com/jmoiron/sqlx"
+	"github.com/mwojtyna/swift-api/internal/auth"
+	"github.com/mwojtyna/swift-api/internal/db"
+	"github.com/mwojtyna/swift-api/internal/ratelimit"
 )
 
 type ApiServer struct {
 	address  string
-	db       *sqlx.DB
+	repo     db.BankRepository
+	authCfg  AuthConfig
+	limiter  *ratelimit.Limiter
 	logger   *log.Logger
 	validate *validator.Validate
 }
 
+// The zero value disables authentication, so every client can do everything
+type AuthConfig struct {
+	Keys        auth.KeyStore       // Enables API key authentication if set
+	Tokens      *auth.TokenVerifier // Enables bearer token authentication if set
+	PublicReads bool                // Let clients without credentials use routes that only need RoleReader
+}
+
+func (c AuthConfig) enabled() bool {
+	return c.Keys != nil || c.Tokens != nil
+}
+
+// For the WWW-Authenticate header of 401 responses
+func (c AuthConfig) challenges() []string {
+	var challenges []string
+	if c.Tokens != nil {
+		challenges = append(challenges, "Bearer")
+	}
+	if c.Keys != nil {
+		challenges = append(challenges, apiKeyHeader)
+	}
+	return challenges
+}
+
+// XML element names mirror the JSON ones, XMLName is only used for the root element
+
 type MessageRes struct {
-	Message string `json:"message"`
+	XMLName xml.Name `json:"-" xml:"response"`
+	Message string   `json:"message" xml:"message"`
 }
 
 type GetSwiftCodeHqRes struct {
-	Address       string                 `json:"address"`
-	BankName      string                 `json:"bankName"`
-	CountryISO2   string                 `json:"countryISO2"`
-	CountryName   string                 `json:"countryName"`
-	IsHeadquarter bool                   `json:"isHeadquarter"`
-	SwiftCode     string                 `json:"swiftCode"`
-	Branches      []GetSwiftCodeHqBranch `json:"branches"`
+	XMLName       xml.Name               `json:"-" xml:"bank"`
+	Address       string                 `json:"address" xml:"address"`
+	BankName      string                 `json:"bankName" xml:"bankName"`
+	CountryISO2   string                 `json:"countryISO2" xml:"countryISO2"`
+	CountryName   string                 `json:"countryName" xml:"countryName"`
+	IsHeadquarter bool                   `json:"isHeadquarter" xml:"isHeadquarter"`
+	SwiftCode     string                 `json:"swiftCode" xml:"swiftCode"`
+	Branches      []GetSwiftCodeHqBranch `json:"branches" xml:"branches>branch"`
 }
 
 type GetSwiftCodeHqBranch struct {
-	Address       string `json:"address"`
-	BankName      string `json:"bankName"`
-	CountryISO2   string `json:"countryISO2"`
-	IsHeadquarter bool   `json:"isHeadquarter"`
-	SwiftCode     string `json:"swiftCode"`
+	Address       string `json:"address" xml:"address"`
+	BankName      string `json:"bankName" xml:"bankName"`
+	CountryISO2   string `json:"countryISO2" xml:"countryISO2"`
+	IsHeadquarter bool   `json:"isHeadquarter" xml:"isHeadquarter"`
+	SwiftCode     string `json:"swiftCode" xml:"swiftCode"`
 }
 
 type GetSwiftCodeBranchRes struct {
-	Address       string `json:"address"`
-	BankName      string `json:"bankName"`
-	CountryISO2   string `json:"countryISO2"`
-	CountryName   string `json:"countryName"`
-	IsHeadquarter bool   `json:"isHeadquarter"`
-	SwiftCode     string `json:"swiftCode"`
+	XMLName       xml.Name `json:"-" xml:"bank"`
+	Address       string   `json:"address" xml:"address"`
+	BankName      string   `json:"bankName" xml:"bankName"`
+	CountryISO2   string   `json:"countryISO2" xml:"countryISO2"`
+	CountryName   string   `json:"countryName" xml:"countryName"`
+	IsHeadquarter bool     `json:"isHeadquarter" xml:"isHeadquarter"`
+	SwiftCode     string   `json:"swiftCode" xml:"swiftCode"`
+}
+
+type LookupSwiftCodesReq struct {
+	SwiftCodes []string `json:"swiftCodes" validate:"required,min=1,max=1000"`
+}
+
+type LookupSwiftCodesRes struct {
+	XMLName  xml.Name `json:"-" xml:"lookup"`
+	Found    []any    `json:"found" xml:"found>bank"`            // GetSwiftCodeHqRes or GetSwiftCodeBranchRes, like from GET /v1/swift-codes/{swiftCode}
+	NotFound []string `json:"notFound" xml:"notFound>swiftCode"` // As sent in the request
 }
 
 type GetSwiftCodesForCountryRes struct {
-	CountryISO2 string                             `json:"countryISO2"`
-	CountryName string                             `json:"countryName"`
-	SwiftCodes  []GetSwiftCodesForCountrySwiftCode `json:"swiftCodes"`
+	XMLName     xml.Name                           `json:"-" xml:"country"`
+	CountryISO2 string                             `json:"countryISO2" xml:"countryISO2"`
+	CountryName string                             `json:"countryName" xml:"countryName"`
+	SwiftCodes  []GetSwiftCodesForCountrySwiftCode `json:"swiftCodes" xml:"swiftCodes>bank"`
+	NextCursor  string                             `json:"nextCursor,omitempty" xml:"nextCursor,omitempty"` // Only set when paginating and there are more banks
 }
 
 type GetSwiftCodesForCountrySwiftCode struct {
-	Address       string `json:"address"`
-	BankName      string `json:"bankName"`
-	CountryISO2   string `json:"countryISO2"`
-	IsHeadquarter bool   `json:"isHeadquarter"`
-	SwiftCode     string `json:"swiftCode"`
+	Address       string `json:"address" xml:"address"`
+	BankName      string `json:"bankName" xml:"bankName"`
+	CountryISO2   string `json:"countryISO2" xml:"countryISO2"`
+	IsHeadquarter bool   `json:"isHeadquarter" xml:"isHeadquarter"`
+	SwiftCode     string `json:"swiftCode" xml:"swiftCode"`
+}
+
+type SearchSwiftCodesRes struct {
+	XMLName xml.Name                 `json:"-" xml:"search"`
+	Query   string                   `json:"query" xml:"query"`
+	Results []SearchSwiftCodesResult `json:"results" xml:"results>result"`
+}
+
+type SearchSwiftCodesResult struct {
+	Address       string  `json:"address" xml:"address"`
+	BankName      string  `json:"bankName" xml:"bankName"`
+	TownName      string  `json:"townName" xml:"townName"`
+	CountryISO2   string  `json:"countryISO2" xml:"countryISO2"`
+	CountryName   string  `json:"countryName" xml:"countryName"`
+	IsHeadquarter bool    `json:"isHeadquarter" xml:"isHeadquarter"`
+	SwiftCode     string  `json:"swiftCode" xml:"swiftCode"`
+	Score         float64 `json:"score" xml:"score"`
 }
 
 type AddSwiftCodeReq struct {
@@ -65,5 +128,77 @@ type AddSwiftCodeReq struct {
 	CountryISO2   string `json:"countryISO2" validate:"required,uppercase,country_code"`
 	CountryName   string `json:"countryName" validate:"required,uppercase"`
 	IsHeadquarter bool   `json:"isHeadquarter"` // Can't validate:"required" because zero-value for bool is false, meaning a branch bank won't be accepted
-	SwiftCode     string `json:"swiftCode" validate:"required,len=11"`
+	SwiftCode     string `json:"swiftCode" validate:"required,len=11,bic"`
+}
+
+type AddSwiftCodeRes struct {
+	XMLName        xml.Name `json:"-" xml:"response"`
+	Message        string   `json:"message" xml:"message"`
+	LinkedBranches *int64   `json:"linkedBranches,omitempty" xml:"linkedBranches,omitempty"` // Only set for HQs, counts branches added before their HQ
+}
+
+type RestoreSwiftCodeRes struct {
+	XMLName        xml.Name `json:"-" xml:"response"`
+	Message        string   `json:"message" xml:"message"`
+	LinkedBranches *int64   `json:"linkedBranches,omitempty" xml:"linkedBranches,omitempty"` // Only set for HQs
+}
+
+type BatchAddSwiftCodesRes struct {
+	XMLName xml.Name                  `json:"-" xml:"batch"`
+	Mode    string                    `json:"mode" xml:"mode"`
+	Results []BatchAddSwiftCodeResult `json:"results" xml:"results>result"` // Same order as the request
+}
+
+type BatchAddSwiftCodeResult struct {
+	Index          int    `json:"index" xml:"index"`
+	SwiftCode      string `json:"swiftCode" xml:"swiftCode"` // Normalized
+	Status         int    `json:"status" xml:"status"`       // Status code the item would get from POST /v1/swift-codes, 424 if it wasn't added because of other items
+	Message        string `json:"message" xml:"message"`
+	LinkedBranches *int64 `json:"linkedBranches,omitempty" xml:"linkedBranches,omitempty"`
+}
+
+// Fields left out of the request keep their current values
+type PatchSwiftCodeReq struct {
+	Address       *string `json:"address"`
+	BankName      *string `json:"bankName"`
+	CountryISO2   *string `json:"countryISO2"`
+	CountryName   *string `json:"countryName"`
+	IsHeadquarter *bool   `json:"isHeadquarter"`
+	SwiftCode     *string `json:"swiftCode"`
+}
+
+// One line of a JSON Lines export or one row of a Parquet export, also a bank's state in its history
+type ExportSwiftCode struct {
+	SwiftCode     string  `json:"swiftCode" xml:"swiftCode" parquet:"swiftCode"`
+	HqSwiftCode   *string `json:"hqSwiftCode,omitempty" xml:"hqSwiftCode,omitempty" parquet:"hqSwiftCode,optional"` // Not set for HQs and branches without an HQ
+	IsHeadquarter bool    `json:"isHeadquarter" xml:"isHeadquarter" parquet:"isHeadquarter"`
+	BankName      string  `json:"bankName" xml:"bankName" parquet:"bankName"`
+	Address       string  `json:"address" xml:"address" parquet:"address"`
+	TownName      string  `json:"townName" xml:"townName" parquet:"townName"`
+	CountryISO2   string  `json:"countryISO2" xml:"countryISO2" parquet:"countryISO2"`
+	CountryName   string  `json:"countryName" xml:"countryName" parquet:"countryName"`
+}
+
+type GetSwiftCodeHistoryRes struct {
+	XMLName   xml.Name                   `json:"-" xml:"history"`
+	SwiftCode string                     `json:"swiftCode" xml:"swiftCode"`
+	Changes   []GetSwiftCodeHistoryEntry `json:"changes" xml:"changes>change"` // Latest first
+}
+
+type GetSwiftCodeHistoryEntry struct {
+	Operation string           `json:"operation" xml:"operation"` // insert, update or delete
+	ChangedAt time.Time        `json:"changedAt" xml:"changedAt"`
+	Actor     string           `json:"actor" xml:"actor"`
+	Source    string           `json:"source" xml:"source"`           // api or import
+	Before    *ExportSwiftCode `json:"before" xml:"before,omitempty"` // null for inserts
+	After     *ExportSwiftCode `json:"after" xml:"after,omitempty"`   // null for deletes
+}
+
+type GetCacheStatsRes struct {
+	XMLName   xml.Name `json:"-" xml:"cache"`
+	Hits      uint64   `json:"hits" xml:"hits"`
+	Misses    uint64   `json:"misses" xml:"misses"`
+	HitRatio  float64  `json:"hitRatio" xml:"hitRatio"` // 0 before the first lookup
+	Evictions uint64   `json:"evictions" xml:"evictions"`
+	Entries   int      `json:"entries" xml:"entries"`
 }
@@ -0,0 +1,82 @@
+// Authentication with API keys and JWT bearer tokens. Keys are random strings given to clients, the server only knows
+// their SHA-256 hashes and the role each key has. Tokens get a role from their scopes, see TokenVerifier.
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+)
+
+type Role string
+
+// Each role can do everything the ones before it can
+const (
+	RoleReader Role = "reader" // GET routes and lookups
+	RoleEditor Role = "editor" // Adding, changing, deleting and restoring banks
+	RoleAdmin  Role = "admin"  // Purging deleted banks
+)
+
+var roleRanks = map[Role]int{
+	RoleReader: 1,
+	RoleEditor: 2,
+	RoleAdmin:  3,
+}
+
+func ParseRole(s string) (Role, error) {
+	role := Role(s)
+	if _, ok := roleRanks[role]; !ok {
+		return "", fmt.Errorf("Invalid role '%s', must be one of: reader, editor, admin", s)
+	}
+	return role, nil
+}
+
+// Whether a key with this role can access routes that require the other one
+func (r Role) Allows(required Role) bool {
+	rank, ok := roleRanks[r]
+	return ok && rank >= roleRanks[required]
+}
+
+// An authenticated API key or token. The name is recorded as the actor of changes made with it.
+type Key struct {
+	Name string
+	Role Role
+}
+
+const (
+	keyPrefix   = "swk_"
+	keyBytesLen = 32
+	HashLen     = sha256.Size * 2 // Hex encoded
+)
+
+// Generates a new random key, give it to the client and store only its HashKey
+func GenerateKey() (string, error) {
+	b := make([]byte, keyBytesLen)
+	_, err := rand.Read(b)
+	if err != nil {
+		return "", err
+	}
+
+	return keyPrefix + base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// Keys are long and random, so a plain hash is enough, no need for a slow password hash
+func HashKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
+
+type contextKey struct{}
+
+func WithKey(ctx context.Context, key Key) context.Context {
+	return context.WithValue(ctx, contextKey{}, key)
+}
+
+// Returns false if the request wasn't authenticated
+func KeyFromContext(ctx context.Context) (Key, bool) {
+	key, ok := ctx.Value(contextKey{}).(Key)
+	return key, ok
+}
@@ -0,0 +1,163 @@
+package auth
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/mwojtyna/swift-api/internal/db"
+	"github.com/mwojtyna/swift-api/internal/migrate"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRoleAllows(t *testing.T) {
+	tests := []struct {
+		role     Role
+		required Role
+		expected bool
+	}{
+		{RoleReader, RoleReader, true},
+		{RoleReader, RoleEditor, false},
+		{RoleEditor, RoleReader, true},
+		{RoleEditor, RoleAdmin, false},
+		{RoleAdmin, RoleEditor, true},
+		{Role("owner"), RoleReader, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(string(tt.role)+"/"+string(tt.required), func(t *testing.T) {
+			assert.Equal(t, tt.expected, tt.role.Allows(tt.required))
+		})
+	}
+}
+
+func TestGenerateKey(t *testing.T) {
+	// Act
+	a, err := GenerateKey()
+	require.NoError(t, err)
+	b, err := GenerateKey()
+	require.NoError(t, err)
+
+	// Assert
+	assert.NotEqual(t, a, b)
+	assert.True(t, strings.HasPrefix(a, keyPrefix))
+	assert.Len(t, HashKey(a), HashLen)
+	assert.Equal(t, HashKey(a), HashKey(a))
+	assert.True(t, isHash(HashKey(a)))
+}
+
+func TestLoadKeysFile(t *testing.T) {
+	hash := HashKey("secret")
+
+	tests := []struct {
+		name     string
+		content  string
+		expected FileKeyStore
+		wantErr  bool
+	}{
+		{
+			name:     "correct",
+			content:  `[{"name":"ci","role":"editor","hash":"` + hash + `"}]`,
+			expected: FileKeyStore{hash: {Name: "ci", Role: RoleEditor}},
+		},
+		{
+			name:     "empty",
+			content:  `[]`,
+			expected: FileKeyStore{},
+		},
+		{
+			name:    "invalid role",
+			content: `[{"name":"ci","role":"owner","hash":"` + hash + `"}]`,
+			wantErr: true,
+		},
+		{
+			name:    "invalid hash",
+			content: `[{"name":"ci","role":"editor","hash":"secret"}]`,
+			wantErr: true,
+		},
+		{
+			name:    "missing name",
+			content: `[{"role":"editor","hash":"` + hash + `"}]`,
+			wantErr: true,
+		},
+		{
+			name:    "duplicate name",
+			content: `[{"name":"ci","role":"editor","hash":"` + hash + `"},{"name":"ci","role":"reader","hash":"` + HashKey("other") + `"}]`,
+			wantErr: true,
+		},
+		{
+			name:    "duplicate hash",
+			content: `[{"name":"ci","role":"editor","hash":"` + hash + `"},{"name":"ops","role":"reader","hash":"` + hash + `"}]`,
+			wantErr: true,
+		},
+		{
+			name:    "not json",
+			content: `ci=editor`,
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Arrange
+			path := filepath.Join(t.TempDir(), "keys.json")
+			require.NoError(t, os.WriteFile(path, []byte(tt.content), 0o600))
+
+			// Act
+			store, err := LoadKeysFile(path)
+
+			// Assert
+			if tt.wantErr {
+				assert.Error(t, err)
+			} else {
+				require.NoError(t, err)
+				assert.Equal(t, tt.expected, store)
+			}
+		})
+	}
+}
+
+func TestKeyStores(t *testing.T) {
+	// Arrange
+	conn, err := db.ConnectSqlite(filepath.Join(t.TempDir(), "swift.db"))
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		conn.Close()
+	})
+	migrator, err := migrate.New(conn)
+	require.NoError(t, err)
+	_, err = migrator.Up()
+	require.NoError(t, err)
+
+	require.NoError(t, db.InsertApiKey(conn, db.ApiKey{Name: "from-db", KeyHash: HashKey("db-key"), Role: "admin"}))
+	require.NoError(t, db.InsertApiKey(conn, db.ApiKey{Name: "shadowed", KeyHash: HashKey("both-key"), Role: "admin"}))
+	stores := KeyStores{
+		FileKeyStore{HashKey("file-key"): {Name: "from-file", Role: RoleReader}, HashKey("both-key"): {Name: "from-file-too", Role: RoleReader}},
+		NewDbKeyStore(conn),
+	}
+
+	tests := []struct {
+		key      string
+		expected Key
+		found    bool
+	}{
+		{"file-key", Key{Name: "from-file", Role: RoleReader}, true},
+		{"db-key", Key{Name: "from-db", Role: RoleAdmin}, true},
+		{"both-key", Key{Name: "from-file-too", Role: RoleReader}, true},
+		{"unknown-key", Key{}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.key, func(t *testing.T) {
+			// Act
+			key, found, err := stores.Lookup(HashKey(tt.key))
+
+			// Assert
+			require.NoError(t, err)
+			assert.Equal(t, tt.found, found)
+			assert.Equal(t, tt.expected, key)
+		})
+	}
+}
@@ -0,0 +1,282 @@
+package auth
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+)
+
+var ErrJwksUnavailable = errors.New("JWKS unavailable")
+
+// Public keys that tokens can be signed with, looked up by the token's "kid" header
+type KeySet interface {
+	PublicKey(kid string) (crypto.PublicKey, error)
+}
+
+// A JSON Web Key Set (RFC 7517). Only RSA, EC and Ed25519 signing keys are kept, others are skipped.
+type Jwks struct {
+	keys map[string]crypto.PublicKey
+}
+
+type jwk struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	Crv string `json:"crv"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+func ParseJwks(raw []byte) (*Jwks, error) {
+	var set struct {
+		Keys []jwk `json:"keys"`
+	}
+	err := json.Unmarshal(raw, &set)
+	if err != nil {
+		return nil, err
+	}
+
+	jwks := &Jwks{keys: make(map[string]crypto.PublicKey, len(set.Keys))}
+	for i, k := range set.Keys {
+		if k.Use != "" && k.Use != "sig" {
+			continue
+		}
+
+		key, err := k.publicKey()
+		if errors.Is(err, errUnsupportedKey) {
+			continue
+		} else if err != nil {
+			return nil, fmt.Errorf("Key %d ('%s'): %w", i+1, k.Kid, err)
+		}
+		if _, ok := jwks.keys[k.Kid]; ok {
+			return nil, fmt.Errorf("Key %d: duplicate kid '%s'", i+1, k.Kid)
+		}
+		jwks.keys[k.Kid] = key
+	}
+	if len(jwks.keys) == 0 {
+		return nil, errors.New("JWKS has no supported signing keys")
+	}
+
+	return jwks, nil
+}
+
+func LoadJwksFile(path string) (*Jwks, error) {
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return ParseJwks(raw)
+}
+
+// A token without a kid can only be verified if there's one key in the set
+func (s *Jwks) PublicKey(kid string) (crypto.PublicKey, error) {
+	if kid == "" && len(s.keys) == 1 {
+		for _, key := range s.keys {
+			return key, nil
+		}
+	}
+
+	key, ok := s.keys[kid]
+	if !ok {
+		return nil, fmt.Errorf("Unknown key '%s'", kid)
+	}
+	return key, nil
+}
+
+func (s *Jwks) Len() int {
+	return len(s.keys)
+}
+
+var errUnsupportedKey = errors.New("unsupported key")
+
+func (k jwk) publicKey() (crypto.PublicKey, error) {
+	switch k.Kty {
+	case "RSA":
+		n, err := decodeBigInt(k.N)
+		if err != nil {
+			return nil, fmt.Errorf("Invalid n: %w", err)
+		}
+		e, err := decodeBigInt(k.E)
+		if err != nil || !e.IsInt64() || e.Int64() > 1<<31-1 {
+			return nil, errors.New("Invalid e")
+		}
+		return &rsa.PublicKey{N: n, E: int(e.Int64())}, nil
+
+	case "EC":
+		var curve elliptic.Curve
+		switch k.Crv {
+		case "P-256":
+			curve = elliptic.P256()
+		case "P-384":
+			curve = elliptic.P384()
+		case "P-521":
+			curve = elliptic.P521()
+		default:
+			return nil, errUnsupportedKey
+		}
+
+		x, err := decodeBigInt(k.X)
+		if err != nil {
+			return nil, fmt.Errorf("Invalid x: %w", err)
+		}
+		y, err := decodeBigInt(k.Y)
+		if err != nil {
+			return nil, fmt.Errorf("Invalid y: %w", err)
+		}
+		if !curve.IsOnCurve(x, y) {
+			return nil, errors.New("Point isn't on the curve")
+		}
+		return &ecdsa.PublicKey{Curve: curve, X: x, Y: y}, nil
+
+	case "OKP":
+		if k.Crv != "Ed25519" {
+			return nil, errUnsupportedKey
+		}
+		x, err := base64.RawURLEncoding.DecodeString(k.X)
+		if err != nil || len(x) != ed25519.PublicKeySize {
+			return nil, errors.New("Invalid x")
+		}
+		return ed25519.PublicKey(x), nil
+
+	default:
+		return nil, errUnsupportedKey
+	}
+}
+
+func decodeBigInt(s string) (*big.Int, error) {
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, err
+	}
+	if len(b) == 0 {
+		return nil, errors.New("empty")
+	}
+	return new(big.Int).SetBytes(b), nil
+}
+
+// Don't let tokens with made up kids make us fetch the JWKS on every request
+const jwksMinRefreshInterval = time.Minute
+
+// A JWKS served by the identity provider. It's fetched again when a token is signed with an unknown key,
+// since providers rotate their keys.
+type RemoteJwks struct {
+	url       string
+	client    *http.Client
+	mu        sync.Mutex
+	jwks      *Jwks
+	fetchedAt time.Time
+	fetching  *jwksFetch // The fetch in progress, nil if there isn't one
+}
+
+// Lets concurrent requests with unknown keys wait for the same fetch
+type jwksFetch struct {
+	done chan struct{}
+	err  error
+}
+
+// Fetches the JWKS right away, so a wrong URL is noticed on start
+func FetchJwks(url string) (*RemoteJwks, error) {
+	r := &RemoteJwks{
+		url:    url,
+		client: &http.Client{Timeout: 10 * time.Second},
+	}
+
+	jwks, err := r.fetch()
+	if err != nil {
+		return nil, err
+	}
+	r.jwks = jwks
+	r.fetchedAt = time.Now()
+
+	return r, nil
+}
+
+// If the key is unknown and the JWKS can't be fetched, the error wraps ErrJwksUnavailable as well as
+// the unknown key error, since the token still can't be verified.
+func (r *RemoteJwks) PublicKey(kid string) (crypto.PublicKey, error) {
+	key, err := r.current().PublicKey(kid)
+	if err == nil {
+		return key, nil
+	}
+
+	fetchErr := r.refresh()
+	if fetchErr != nil {
+		return nil, fmt.Errorf("%w, %w: %w", err, ErrJwksUnavailable, fetchErr)
+	}
+	return r.current().PublicKey(kid)
+}
+
+func (r *RemoteJwks) Len() int {
+	return r.current().Len()
+}
+
+func (r *RemoteJwks) current() *Jwks {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.jwks
+}
+
+// Fetches the JWKS again unless it was fetched recently, or waits for a fetch that's already in progress.
+// The lock isn't held while fetching, so requests with known keys don't wait for the provider.
+// Keeps the old keys if fetching fails.
+func (r *RemoteJwks) refresh() error {
+	r.mu.Lock()
+	if f := r.fetching; f != nil {
+		r.mu.Unlock()
+		<-f.done
+		return f.err
+	}
+	if time.Since(r.fetchedAt) < jwksMinRefreshInterval {
+		r.mu.Unlock()
+		return nil
+	}
+	f := &jwksFetch{done: make(chan struct{})}
+	r.fetching = f
+	r.fetchedAt = time.Now()
+	r.mu.Unlock()
+
+	jwks, err := r.fetch()
+
+	r.mu.Lock()
+	if err == nil {
+		r.jwks = jwks
+	}
+	r.fetching = nil
+	r.mu.Unlock()
+
+	f.err = err
+	close(f.done)
+	return err
+}
+
+func (r *RemoteJwks) fetch() (*Jwks, error) {
+	res, err := r.client.Get(r.url)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("GET %s returned %d", r.url, res.StatusCode)
+	}
+
+	raw, err := io.ReadAll(io.LimitReader(res.Body, 1<<20))
+	if err != nil {
+		return nil, err
+	}
+	return ParseJwks(raw)
+}
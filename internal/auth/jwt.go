@@ -0,0 +1,97 @@
+package auth
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// OAuth scopes that tokens need for each role, a token gets the highest role it has a scope for
+const (
+	ScopeRead  = "swift:read"
+	ScopeWrite = "swift:write"
+	ScopeAdmin = "swift:admin"
+)
+
+var scopeRoles = map[string]Role{
+	ScopeRead:  RoleReader,
+	ScopeWrite: RoleEditor,
+	ScopeAdmin: RoleAdmin,
+}
+
+var ErrNoScope = fmt.Errorf("token has none of the scopes %s, %s, %s", ScopeRead, ScopeWrite, ScopeAdmin)
+
+// Tolerated clock difference between us and the identity provider
+const tokenLeeway = 30 * time.Second
+
+// Validates JWT bearer tokens (e.g. OIDC access tokens) signed with a key from the key set
+type TokenVerifier struct {
+	keys   KeySet
+	parser *jwt.Parser
+}
+
+// Tokens must have this issuer and audience, and an expiry
+func NewTokenVerifier(keys KeySet, issuer string, audience string) *TokenVerifier {
+	return &TokenVerifier{
+		keys: keys,
+		parser: jwt.NewParser(
+			jwt.WithValidMethods([]string{"RS256", "RS384", "RS512", "PS256", "PS384", "PS512", "ES256", "ES384", "ES512", "EdDSA"}),
+			jwt.WithIssuer(issuer),
+			jwt.WithAudience(audience),
+			jwt.WithExpirationRequired(),
+			jwt.WithIssuedAt(),
+			jwt.WithLeeway(tokenLeeway),
+		),
+	}
+}
+
+type tokenClaims struct {
+	jwt.RegisteredClaims
+	Scope string           `json:"scope"` // Space separated (RFC 8693)
+	Scp   jwt.ClaimStrings `json:"scp"`   // Some providers use a list instead
+}
+
+func (c tokenClaims) scopes() []string {
+	return append(strings.Fields(c.Scope), c.Scp...)
+}
+
+// Returns the token's subject as the key name. Returns ErrNoScope for valid tokens without any of the swift scopes,
+// and an error wrapping ErrJwksUnavailable if the token's key is unknown and the key set couldn't be fetched again.
+func (v *TokenVerifier) Verify(token string) (Key, error) {
+	var claims tokenClaims
+	_, err := v.parser.ParseWithClaims(token, &claims, func(t *jwt.Token) (any, error) {
+		kid, _ := t.Header["kid"].(string)
+		return v.keys.PublicKey(kid)
+	})
+	if err != nil {
+		return Key{}, err
+	}
+	if claims.Subject == "" {
+		return Key{}, errors.New("token has no subject")
+	}
+
+	var role Role
+	for _, scope := range claims.scopes() {
+		if r, ok := scopeRoles[scope]; ok && !role.Allows(r) {
+			role = r
+		}
+	}
+	if role == "" {
+		return Key{}, ErrNoScope
+	}
+
+	return Key{Name: claims.Subject, Role: role}, nil
+}
+
+// The scope a token needs for routes that require the role
+func RoleScope(role Role) string {
+	for scope, r := range scopeRoles {
+		if r == role {
+			return scope
+		}
+	}
+	return ""
+}
@@ -0,0 +1,341 @@
+package auth
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/pem"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// testdata/jwks.json has the public keys of the private keys next to it, kids "test-rsa" and "test-ec".
+// It also has an encryption key, which must be skipped.
+const (
+	testIssuer   = "https://id.example.com"
+	testAudience = "swift-api"
+)
+
+func loadTestPrivateKey(t *testing.T, name string) crypto.Signer {
+	t.Helper()
+
+	raw, err := os.ReadFile("testdata/" + name)
+	require.NoError(t, err)
+	block, _ := pem.Decode(raw)
+	require.NotNil(t, block)
+	key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	require.NoError(t, err)
+
+	return key.(crypto.Signer)
+}
+
+func signTestToken(t *testing.T, method jwt.SigningMethod, kid string, key crypto.Signer, claims jwt.MapClaims) string {
+	t.Helper()
+
+	token := jwt.NewWithClaims(method, claims)
+	if kid != "" {
+		token.Header["kid"] = kid
+	}
+	signed, err := token.SignedString(key)
+	require.NoError(t, err)
+
+	return signed
+}
+
+// Tokens signed with a shared secret must be rejected, even if the secret is a public key
+func signTestHmacToken(t *testing.T, claims jwt.MapClaims) string {
+	t.Helper()
+
+	signed, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString([]byte("secret"))
+	require.NoError(t, err)
+
+	return signed
+}
+
+func validTestClaims(scope string) jwt.MapClaims {
+	return jwt.MapClaims{
+		"iss":   testIssuer,
+		"aud":   testAudience,
+		"sub":   "service-a",
+		"iat":   time.Now().Unix(),
+		"exp":   time.Now().Add(time.Hour).Unix(),
+		"scope": scope,
+	}
+}
+
+func withClaim(claims jwt.MapClaims, name string, value any) jwt.MapClaims {
+	claims[name] = value
+	if value == nil {
+		delete(claims, name)
+	}
+	return claims
+}
+
+func TestTokenVerifierVerify(t *testing.T) {
+	jwks, err := LoadJwksFile("testdata/jwks.json")
+	require.NoError(t, err)
+	verifier := NewTokenVerifier(jwks, testIssuer, testAudience)
+
+	rsaKey := loadTestPrivateKey(t, "rsa_private_key.pem")
+	ecKey := loadTestPrivateKey(t, "ec_private_key.pem")
+	otherKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	tests := []struct {
+		name     string
+		token    string
+		expected Key
+		wantErr  error // Only checked if set
+		invalid  bool
+	}{
+		{
+			name:     "rsa read",
+			token:    signTestToken(t, jwt.SigningMethodRS256, "test-rsa", rsaKey, validTestClaims("openid swift:read")),
+			expected: Key{Name: "service-a", Role: RoleReader},
+		},
+		{
+			name:     "ec highest scope",
+			token:    signTestToken(t, jwt.SigningMethodES256, "test-ec", ecKey, validTestClaims("swift:admin swift:read")),
+			expected: Key{Name: "service-a", Role: RoleAdmin},
+		},
+		{
+			name:     "scp list",
+			token:    signTestToken(t, jwt.SigningMethodRS256, "test-rsa", rsaKey, withClaim(validTestClaims(""), "scp", []string{"swift:write"})),
+			expected: Key{Name: "service-a", Role: RoleEditor},
+		},
+		{
+			name:    "no swift scope",
+			token:   signTestToken(t, jwt.SigningMethodRS256, "test-rsa", rsaKey, validTestClaims("openid profile")),
+			wantErr: ErrNoScope,
+			invalid: true,
+		},
+		{
+			name:    "expired",
+			token:   signTestToken(t, jwt.SigningMethodRS256, "test-rsa", rsaKey, withClaim(validTestClaims("swift:read"), "exp", time.Now().Add(-time.Hour).Unix())),
+			wantErr: jwt.ErrTokenExpired,
+			invalid: true,
+		},
+		{
+			name:    "no expiry",
+			token:   signTestToken(t, jwt.SigningMethodRS256, "test-rsa", rsaKey, withClaim(validTestClaims("swift:read"), "exp", nil)),
+			invalid: true,
+		},
+		{
+			name:    "wrong issuer",
+			token:   signTestToken(t, jwt.SigningMethodRS256, "test-rsa", rsaKey, withClaim(validTestClaims("swift:read"), "iss", "https://evil.example.com")),
+			wantErr: jwt.ErrTokenInvalidIssuer,
+			invalid: true,
+		},
+		{
+			name:    "wrong audience",
+			token:   signTestToken(t, jwt.SigningMethodRS256, "test-rsa", rsaKey, withClaim(validTestClaims("swift:read"), "aud", "other-api")),
+			wantErr: jwt.ErrTokenInvalidAudience,
+			invalid: true,
+		},
+		{
+			name:    "no subject",
+			token:   signTestToken(t, jwt.SigningMethodRS256, "test-rsa", rsaKey, withClaim(validTestClaims("swift:read"), "sub", nil)),
+			invalid: true,
+		},
+		{
+			name:    "unknown signing key",
+			token:   signTestToken(t, jwt.SigningMethodES256, "test-ec", otherKey, validTestClaims("swift:read")),
+			wantErr: jwt.ErrTokenSignatureInvalid,
+			invalid: true,
+		},
+		{
+			name:    "unknown kid",
+			token:   signTestToken(t, jwt.SigningMethodRS256, "other", rsaKey, validTestClaims("swift:read")),
+			invalid: true,
+		},
+		{
+			name:    "encryption key",
+			token:   signTestToken(t, jwt.SigningMethodRS256, "test-enc", rsaKey, validTestClaims("swift:read")),
+			invalid: true,
+		},
+		{
+			name:    "hmac",
+			token:   signTestHmacToken(t, validTestClaims("swift:read")),
+			invalid: true,
+		},
+		{
+			name:    "not a jwt",
+			token:   "swk_abc",
+			invalid: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Act
+			key, err := verifier.Verify(tt.token)
+
+			// Assert
+			if tt.invalid {
+				assert.Error(t, err)
+				if tt.wantErr != nil {
+					assert.ErrorIs(t, err, tt.wantErr)
+				}
+			} else {
+				require.NoError(t, err)
+				assert.Equal(t, tt.expected, key)
+			}
+		})
+	}
+}
+
+func TestParseJwks(t *testing.T) {
+	tests := []struct {
+		name    string
+		raw     string
+		keys    int
+		wantErr bool
+	}{
+		{
+			name: "skips unsupported keys",
+			raw:  `{"keys":[{"kty":"OKP","crv":"Ed25519","kid":"ed","x":"11qYAYKxCrfVS_7TyWQHOg7hcvPapiMlrwIaaPcHURo"},{"kty":"oct","kid":"hmac","k":"c2VjcmV0"}]}`,
+			keys: 1,
+		},
+		{
+			name:    "no keys",
+			raw:     `{"keys":[]}`,
+			wantErr: true,
+		},
+		{
+			name:    "point not on curve",
+			raw:     `{"keys":[{"kty":"EC","crv":"P-256","kid":"ec","x":"AQ","y":"AQ"}]}`,
+			wantErr: true,
+		},
+		{
+			name:    "duplicate kid",
+			raw:     `{"keys":[{"kty":"RSA","kid":"a","n":"AQAB","e":"AQAB"},{"kty":"RSA","kid":"a","n":"AQAB","e":"AQAB"}]}`,
+			wantErr: true,
+		},
+		{
+			name:    "not json",
+			raw:     `keys`,
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Act
+			jwks, err := ParseJwks([]byte(tt.raw))
+
+			// Assert
+			if tt.wantErr {
+				assert.Error(t, err)
+			} else {
+				require.NoError(t, err)
+				assert.Equal(t, tt.keys, jwks.Len())
+			}
+		})
+	}
+}
+
+func TestRemoteJwks(t *testing.T) {
+	// Arrange
+	raw, err := os.ReadFile("testdata/jwks.json")
+	require.NoError(t, err)
+	var fetches atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fetches.Add(1)
+		w.Write(raw)
+	}))
+	defer server.Close()
+
+	// Act
+	jwks, err := FetchJwks(server.URL)
+	require.NoError(t, err)
+	verifier := NewTokenVerifier(jwks, testIssuer, testAudience)
+	key, err := verifier.Verify(signTestToken(t, jwt.SigningMethodRS256, "test-rsa", loadTestPrivateKey(t, "rsa_private_key.pem"), validTestClaims("swift:read")))
+	require.NoError(t, err)
+	_, unknownErr := jwks.PublicKey("rotated")
+
+	// Assert
+	assert.Equal(t, Key{Name: "service-a", Role: RoleReader}, key)
+	assert.Error(t, unknownErr)
+	// Unknown kids don't refetch right after a fetch
+	assert.Equal(t, int32(1), fetches.Load())
+
+	server.Close()
+	_, err = FetchJwks(server.URL)
+	assert.Error(t, err)
+}
+
+func TestRemoteJwksRefresh(t *testing.T) {
+	// Arrange
+	raw, err := os.ReadFile("testdata/jwks.json")
+	require.NoError(t, err)
+	var fetches atomic.Int32
+	var down atomic.Bool
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// The first fetch is FetchJwks, later ones wait until the test lets them through
+		if fetches.Add(1) > 1 {
+			<-release
+		}
+		if down.Load() {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.Write(raw)
+	}))
+	defer server.Close()
+	jwks, err := FetchJwks(server.URL)
+	require.NoError(t, err)
+
+	t.Run("fetches once for concurrent unknown kids without blocking known ones", func(t *testing.T) {
+		// Arrange
+		jwks.fetchedAt = time.Time{}
+		var unknown sync.WaitGroup
+		for range 5 {
+			unknown.Add(1)
+			go func() {
+				defer unknown.Done()
+				_, err := jwks.PublicKey("rotated")
+				assert.Error(t, err)
+				assert.NotErrorIs(t, err, ErrJwksUnavailable)
+			}()
+		}
+		require.Eventually(t, func() bool { return fetches.Load() == 2 }, time.Second, time.Millisecond)
+
+		// Act
+		key, err := jwks.PublicKey("test-rsa")
+		close(release)
+		unknown.Wait()
+
+		// Assert
+		require.NoError(t, err)
+		assert.NotNil(t, key)
+		assert.Equal(t, int32(2), fetches.Load())
+	})
+
+	t.Run("unknown kid while the provider is down", func(t *testing.T) {
+		// Arrange
+		down.Store(true)
+		jwks.fetchedAt = time.Time{}
+
+		// Act
+		_, unknownErr := jwks.PublicKey("rotated")
+		key, knownErr := jwks.PublicKey("test-ec")
+
+		// Assert
+		assert.ErrorIs(t, unknownErr, ErrJwksUnavailable)
+		assert.ErrorContains(t, unknownErr, "Unknown key 'rotated'")
+		require.NoError(t, knownErr, "the old keys are kept")
+		assert.NotNil(t, key)
+	})
+}
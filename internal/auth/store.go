@@ -0,0 +1,121 @@
+package auth
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/mwojtyna/swift-api/internal/db"
+)
+
+// Finds the key with the given HashKey, returns false if there isn't one
+type KeyStore interface {
+	Lookup(keyHash string) (Key, bool, error)
+}
+
+// Keys from a JSON file, see LoadKeysFile. Maps hashes to keys.
+type FileKeyStore map[string]Key
+
+type keysFileEntry struct {
+	Name string `json:"name"`
+	Role string `json:"role"`
+	Hash string `json:"hash"` // HashKey of the key
+}
+
+// Reads keys from a JSON array of {"name", "role", "hash"} objects. Names and hashes must be unique.
+func LoadKeysFile(path string) (FileKeyStore, error) {
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var entries []keysFileEntry
+	err = json.Unmarshal(raw, &entries)
+	if err != nil {
+		return nil, err
+	}
+
+	store := make(FileKeyStore, len(entries))
+	names := make(map[string]bool, len(entries))
+	for i, e := range entries {
+		if e.Name == "" {
+			return nil, fmt.Errorf("Key %d: missing name", i+1)
+		}
+		if names[e.Name] {
+			return nil, fmt.Errorf("Key '%s': duplicate name", e.Name)
+		}
+		role, err := ParseRole(e.Role)
+		if err != nil {
+			return nil, fmt.Errorf("Key '%s': %w", e.Name, err)
+		}
+		if !isHash(e.Hash) {
+			return nil, fmt.Errorf("Key '%s': hash must be %d lowercase hex characters", e.Name, HashLen)
+		}
+		if _, ok := store[e.Hash]; ok {
+			return nil, fmt.Errorf("Key '%s': duplicate hash", e.Name)
+		}
+
+		names[e.Name] = true
+		store[e.Hash] = Key{Name: e.Name, Role: role}
+	}
+
+	return store, nil
+}
+
+func (s FileKeyStore) Lookup(keyHash string) (Key, bool, error) {
+	key, ok := s[keyHash]
+	return key, ok, nil
+}
+
+func isHash(s string) bool {
+	if len(s) != HashLen {
+		return false
+	}
+	for _, c := range s {
+		if (c < '0' || c > '9') && (c < 'a' || c > 'f') {
+			return false
+		}
+	}
+	return true
+}
+
+// Keys in the api_key table, managed with cmd/apikey
+type DbKeyStore struct {
+	db *sqlx.DB
+}
+
+func NewDbKeyStore(db *sqlx.DB) *DbKeyStore {
+	return &DbKeyStore{db: db}
+}
+
+func (s *DbKeyStore) Lookup(keyHash string) (Key, bool, error) {
+	apiKey, err := db.GetApiKeyByHash(s.db, keyHash)
+	if errors.Is(err, sql.ErrNoRows) {
+		return Key{}, false, nil
+	} else if err != nil {
+		return Key{}, false, err
+	}
+
+	role, err := ParseRole(apiKey.Role)
+	if err != nil {
+		return Key{}, false, err
+	}
+
+	return Key{Name: apiKey.Name, Role: role}, true, nil
+}
+
+// Looks keys up in each store in order, the first match wins
+type KeyStores []KeyStore
+
+func (s KeyStores) Lookup(keyHash string) (Key, bool, error) {
+	for _, store := range s {
+		key, ok, err := store.Lookup(keyHash)
+		if err != nil || ok {
+			return key, ok, err
+		}
+	}
+	return Key{}, false, nil
+}
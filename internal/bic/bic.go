@@ -0,0 +1,166 @@
+package bic
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/go-playground/validator/v10"
+	"github.com/mwojtyna/swift-api/internal/utils"
+)
+
+// Structure of a BIC (ISO 9362): AAAA BB CC [DDD]
+// AAAA - institution code, BB - country code, CC - location code, DDD - optional branch code
+const (
+	Bic8Len  = 8
+	Bic11Len = 11
+
+	// Branch code of the primary office, BIC8 codes implicitly have it
+	PrimaryOfficeBranchCode = "XXX"
+)
+
+// Validator tag, use after registering it with RegisterValidation
+const Tag = "bic"
+
+type Part string
+
+const (
+	PartLength      Part = "length"
+	PartInstitution Part = "institution"
+	PartCountry     Part = "country"
+	PartLocation    Part = "location"
+	PartBranch      Part = "branch"
+)
+
+type Reason struct {
+	Part     Part   `json:"part"`
+	Position int    `json:"position"` // 1-based position of the offending character, 0 if it's about the whole part
+	Message  string `json:"message"`
+}
+
+func (r Reason) String() string {
+	if r.Position == 0 {
+		return fmt.Sprintf("%s: %s", r.Part, r.Message)
+	}
+	return fmt.Sprintf("%s (position %d): %s", r.Part, r.Position, r.Message)
+}
+
+type ValidationError struct {
+	Code    string
+	Reasons []Reason
+}
+
+func (e *ValidationError) Error() string {
+	reasons := utils.Map(e.Reasons, func(r Reason) string { return r.String() })
+	return fmt.Sprintf(`invalid BIC "%s": %s`, e.Code, strings.Join(reasons, "; "))
+}
+
+type BIC struct {
+	Institution string
+	Country     string
+	Location    string
+	Branch      string // Empty for BIC8 codes
+}
+
+// Test BICs have "0" as the second character of the location code
+func (b BIC) IsTest() bool {
+	return b.Location[1] == '0'
+}
+
+func (b BIC) IsPrimaryOffice() bool {
+	return b.Branch == "" || b.Branch == PrimaryOfficeBranchCode
+}
+
+// Splits the code into its parts, returns *ValidationError listing every rule the code breaks.
+// The code must be uppercase and without whitespace.
+func Parse(code string) (BIC, error) {
+	if len(code) != Bic8Len && len(code) != Bic11Len {
+		return BIC{}, &ValidationError{
+			Code:    code,
+			Reasons: []Reason{{Part: PartLength, Message: fmt.Sprintf("must be %d or %d characters long", Bic8Len, Bic11Len)}},
+		}
+	}
+
+	b := BIC{
+		Institution: code[0:4],
+		Country:     code[4:6],
+		Location:    code[6:8],
+		Branch:      code[8:],
+	}
+	var reasons []Reason
+
+	for i, c := range []byte(b.Institution) {
+		if !isLetter(c) {
+			reasons = append(reasons, Reason{Part: PartInstitution, Position: 1 + i, Message: "must be an uppercase letter"})
+		}
+	}
+
+	countryValid := true
+	for i, c := range []byte(b.Country) {
+		if !isLetter(c) {
+			countryValid = false
+			reasons = append(reasons, Reason{Part: PartCountry, Position: 5 + i, Message: "must be an uppercase letter"})
+		}
+	}
+	if countryValid && !IsCountryCode(b.Country) {
+		reasons = append(reasons, Reason{Part: PartCountry, Message: fmt.Sprintf(`"%s" is not an ISO 3166-1 country code`, b.Country)})
+	}
+
+	for i, c := range []byte(b.Location) {
+		if !isLetter(c) && !isDigit(c) {
+			reasons = append(reasons, Reason{Part: PartLocation, Position: 7 + i, Message: "must be an uppercase letter or a digit"})
+		}
+	}
+	if b.Location[0] == '0' || b.Location[0] == '1' {
+		reasons = append(reasons, Reason{Part: PartLocation, Position: 7, Message: `can't be "0" or "1"`})
+	}
+	// Not allowed to avoid confusion with "0", which marks test BICs
+	if b.Location[1] == 'O' {
+		reasons = append(reasons, Reason{Part: PartLocation, Position: 8, Message: `can't be the letter "O"`})
+	}
+
+	for i, c := range []byte(b.Branch) {
+		if !isLetter(c) && !isDigit(c) {
+			reasons = append(reasons, Reason{Part: PartBranch, Position: 9 + i, Message: "must be an uppercase letter or a digit"})
+		}
+	}
+	if b.Branch != "" && b.Branch[0] == 'X' && b.Branch != PrimaryOfficeBranchCode {
+		reasons = append(reasons, Reason{Part: PartBranch, Position: 9, Message: fmt.Sprintf(`"X" is reserved for the primary office code "%s"`, PrimaryOfficeBranchCode)})
+	}
+
+	if len(reasons) > 0 {
+		return BIC{}, &ValidationError{Code: code, Reasons: reasons}
+	}
+
+	return b, nil
+}
+
+// Uppercases the code, removes all whitespace and expands BIC8 codes to BIC11 with the primary office branch code.
+// Doesn't validate the code.
+func Normalize(code string) string {
+	code = strings.ToUpper(strings.Join(strings.Fields(code), ""))
+	if len(code) == Bic8Len {
+		code += PrimaryOfficeBranchCode
+	}
+
+	return code
+}
+
+func Validate(code string) error {
+	_, err := Parse(code)
+	return err
+}
+
+// Registers the "bic" tag, which checks a string field with Validate
+func RegisterValidation(v *validator.Validate) error {
+	return v.RegisterValidation(Tag, func(fl validator.FieldLevel) bool {
+		return Validate(fl.Field().String()) == nil
+	})
+}
+
+func isLetter(c byte) bool {
+	return c >= 'A' && c <= 'Z'
+}
+
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
@@ -0,0 +1,154 @@
+package bic
+
+import (
+	"testing"
+
+	"github.com/go-playground/validator/v10"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		name        string
+		code        string
+		want        BIC
+		wantReasons []Reason
+	}{
+		{
+			name: "valid BIC11",
+			code: "BPHKPLPKCUS",
+			want: BIC{Institution: "BPHK", Country: "PL", Location: "PK", Branch: "CUS"},
+		},
+		{
+			name: "valid BIC8",
+			code: "BPHKPLPK",
+			want: BIC{Institution: "BPHK", Country: "PL", Location: "PK"},
+		},
+		{
+			name: "valid test BIC",
+			code: "BPHKPLP0XXX",
+			want: BIC{Institution: "BPHK", Country: "PL", Location: "P0", Branch: "XXX"},
+		},
+		{
+			name:        "invalid length",
+			code:        "BPHKPLPKXX",
+			wantReasons: []Reason{{Part: PartLength, Message: "must be 8 or 11 characters long"}},
+		},
+		{
+			name: "digits in institution code",
+			code: "BP1KPLPKXXX",
+			wantReasons: []Reason{
+				{Part: PartInstitution, Position: 3, Message: "must be an uppercase letter"},
+			},
+		},
+		{
+			name: "unknown country code",
+			code: "BPHKQQPKXXX",
+			wantReasons: []Reason{
+				{Part: PartCountry, Message: `"QQ" is not an ISO 3166-1 country code`},
+			},
+		},
+		{
+			name: "lowercase country code",
+			code: "BPHKplPKXXX",
+			wantReasons: []Reason{
+				{Part: PartCountry, Position: 5, Message: "must be an uppercase letter"},
+				{Part: PartCountry, Position: 6, Message: "must be an uppercase letter"},
+			},
+		},
+		{
+			name: "location code starting with 1",
+			code: "BPHKPL1KXXX",
+			wantReasons: []Reason{
+				{Part: PartLocation, Position: 7, Message: `can't be "0" or "1"`},
+			},
+		},
+		{
+			name: "letter O in location code",
+			code: "BPHKPLPOXXX",
+			wantReasons: []Reason{
+				{Part: PartLocation, Position: 8, Message: `can't be the letter "O"`},
+			},
+		},
+		{
+			name: "branch code starting with X",
+			code: "BPHKPLPKX01",
+			wantReasons: []Reason{
+				{Part: PartBranch, Position: 9, Message: `"X" is reserved for the primary office code "XXX"`},
+			},
+		},
+		{
+			name: "multiple failures",
+			code: "1PHKQQPK-01",
+			wantReasons: []Reason{
+				{Part: PartInstitution, Position: 1, Message: "must be an uppercase letter"},
+				{Part: PartCountry, Message: `"QQ" is not an ISO 3166-1 country code`},
+				{Part: PartBranch, Position: 9, Message: "must be an uppercase letter or a digit"},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Parse(tt.code)
+
+			if tt.wantReasons != nil {
+				var ve *ValidationError
+				require.ErrorAs(t, err, &ve)
+				assert.Equal(t, tt.code, ve.Code)
+				assert.Equal(t, tt.wantReasons, ve.Reasons)
+			} else {
+				require.NoError(t, err)
+				assert.Equal(t, tt.want, got)
+			}
+		})
+	}
+}
+
+func TestBIC(t *testing.T) {
+	t.Run("test BIC", func(t *testing.T) {
+		b, err := Parse("BPHKPLP0")
+		require.NoError(t, err)
+		assert.True(t, b.IsTest())
+		assert.True(t, b.IsPrimaryOffice())
+	})
+	t.Run("branch", func(t *testing.T) {
+		b, err := Parse("BPHKPLPKCUS")
+		require.NoError(t, err)
+		assert.False(t, b.IsTest())
+		assert.False(t, b.IsPrimaryOffice())
+	})
+}
+
+func TestNormalize(t *testing.T) {
+	tests := []struct {
+		name string
+		code string
+		want string
+	}{
+		{"BIC11 unchanged", "BPHKPLPKCUS", "BPHKPLPKCUS"},
+		{"BIC8 expanded", "BPHKPLPK", "BPHKPLPKXXX"},
+		{"lowercase", "bphkplpkcus", "BPHKPLPKCUS"},
+		{"whitespace", " BPHK PL PK\t", "BPHKPLPKXXX"},
+		{"invalid length left alone", "BPHKPL", "BPHKPL"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, Normalize(tt.code))
+		})
+	}
+}
+
+func TestRegisterValidation(t *testing.T) {
+	type ts struct {
+		SwiftCode string `validate:"bic"`
+	}
+
+	validate := validator.New()
+	require.NoError(t, RegisterValidation(validate))
+
+	assert.NoError(t, validate.Struct(ts{SwiftCode: "BPHKPLPKXXX"}))
+	assert.Error(t, validate.Struct(ts{SwiftCode: "BPHKPLPK-XX"}))
+}
@@ -0,0 +1,86 @@
+package cache
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCacheEvictsLeastRecentlyUsed(t *testing.T) {
+	// Arrange
+	c := New[string, int](2, time.Hour)
+	c.Set("a", 1)
+	c.Set("b", 2)
+	c.Get("a")
+
+	// Act
+	c.Set("c", 3)
+
+	// Assert
+	_, ok := c.Get("b")
+	assert.False(t, ok)
+	v, ok := c.Get("a")
+	assert.True(t, ok)
+	assert.Equal(t, 1, v)
+	v, ok = c.Get("c")
+	assert.True(t, ok)
+	assert.Equal(t, 3, v)
+	assert.Equal(t, Stats{Hits: 3, Misses: 1, Evictions: 1, Entries: 2}, c.Stats())
+}
+
+func TestCacheExpires(t *testing.T) {
+	// Arrange
+	now := time.Now()
+	c := New[string, int](2, time.Minute)
+	c.now = func() time.Time { return now }
+	c.Set("a", 1)
+	now = now.Add(30 * time.Second)
+	c.Set("b", 2)
+
+	// Act
+	now = now.Add(30 * time.Second)
+	_, aOk := c.Get("a")
+	_, bOk := c.Get("b")
+
+	// Assert
+	assert.False(t, aOk)
+	assert.True(t, bOk)
+	assert.Equal(t, Stats{Hits: 1, Misses: 1, Evictions: 0, Entries: 1}, c.Stats())
+}
+
+func TestCacheSetReplaces(t *testing.T) {
+	// Arrange
+	c := New[string, int](2, time.Hour)
+	c.Set("a", 1)
+
+	// Act
+	c.Set("a", 2)
+
+	// Assert
+	v, _ := c.Get("a")
+	assert.Equal(t, 2, v)
+	assert.Equal(t, 1, c.Stats().Entries)
+}
+
+func TestCacheDelete(t *testing.T) {
+	// Arrange
+	c := New[string, int](10, time.Hour)
+	for i, key := range []string{"a1", "a2", "b1", "b2"} {
+		c.Set(key, i)
+	}
+
+	// Act
+	c.Delete("b1")
+	c.Delete("missing")
+	c.DeleteFunc(func(key string, value int) bool {
+		return key[0] == 'a' && value > 0
+	})
+
+	// Assert
+	_, ok := c.Get("a1")
+	assert.True(t, ok)
+	_, ok = c.Get("b2")
+	assert.True(t, ok)
+	assert.Equal(t, Stats{Hits: 2, Entries: 2}, c.Stats())
+}
@@ -0,0 +1,62 @@
+package db
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"github.com/jmoiron/sqlx"
+)
+
+var ErrApiKeyExists = errors.New("API key with this name or hash already exists")
+
+// Returns sql.ErrNoRows if there's no key with this hash
+func GetApiKeyByHash(db *sqlx.DB, keyHash string) (ApiKey, error) {
+	var key ApiKey
+
+	err := db.Get(&key, "SELECT * FROM api_key WHERE key_hash=$1;", keyHash)
+	if err != nil {
+		return ApiKey{}, err
+	}
+
+	return key, nil
+}
+
+func GetApiKeys(db *sqlx.DB) ([]ApiKey, error) {
+	var keys []ApiKey
+
+	err := db.Select(&keys, "SELECT * FROM api_key ORDER BY name;")
+	if err != nil {
+		return nil, err
+	}
+
+	return keys, nil
+}
+
+// CreatedAt is set by the DB
+func InsertApiKey(db *sqlx.DB, key ApiKey) error {
+	_, err := db.Exec("INSERT INTO api_key (name, key_hash, role) VALUES ($1, $2, $3);", key.Name, key.KeyHash, key.Role)
+
+	if errors.Is(dialectOf(db).mapError(err), ErrAlreadyExists) {
+		return fmt.Errorf("%w: %w", ErrApiKeyExists, err)
+	}
+	return err
+}
+
+// Returns sql.ErrNoRows if there's no key with this name
+func DeleteApiKey(db *sqlx.DB, name string) error {
+	res, err := db.Exec("DELETE FROM api_key WHERE name=$1;", name)
+	if err != nil {
+		return err
+	}
+
+	deleted, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if deleted == 0 {
+		return sql.ErrNoRows
+	}
+
+	return nil
+}
@@ -0,0 +1,41 @@
+package db
+
+import (
+	"database/sql"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestApiKeys(t *testing.T) {
+	// Arrange
+	db := testSqlite(t)
+	ci := ApiKey{Name: "ci", KeyHash: strings.Repeat("a", 64), Role: "editor"}
+	ops := ApiKey{Name: "ops", KeyHash: strings.Repeat("b", 64), Role: "admin"}
+
+	// Act & Assert
+	require.NoError(t, InsertApiKey(db, ops))
+	require.NoError(t, InsertApiKey(db, ci))
+	assert.ErrorIs(t, InsertApiKey(db, ApiKey{Name: "ci", KeyHash: strings.Repeat("c", 64), Role: "reader"}), ErrApiKeyExists)
+	assert.ErrorIs(t, InsertApiKey(db, ApiKey{Name: "other", KeyHash: ci.KeyHash, Role: "reader"}), ErrApiKeyExists)
+	assert.Error(t, InsertApiKey(db, ApiKey{Name: "bad", KeyHash: strings.Repeat("d", 64), Role: "owner"}))
+
+	got, err := GetApiKeyByHash(db, ci.KeyHash)
+	require.NoError(t, err)
+	assert.Equal(t, "ci", got.Name)
+	assert.Equal(t, "editor", got.Role)
+	assert.False(t, got.CreatedAt.IsZero())
+
+	keys, err := GetApiKeys(db)
+	require.NoError(t, err)
+	require.Len(t, keys, 2)
+	assert.Equal(t, "ci", keys[0].Name)
+	assert.Equal(t, "ops", keys[1].Name)
+
+	require.NoError(t, DeleteApiKey(db, "ci"))
+	assert.ErrorIs(t, DeleteApiKey(db, "ci"), sql.ErrNoRows)
+	_, err = GetApiKeyByHash(db, ci.KeyHash)
+	assert.ErrorIs(t, err, sql.ErrNoRows)
+}
@@ -0,0 +1,139 @@
+package db
+
+import (
+	"errors"
+	"fmt"
+	"iter"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+)
+
+var (
+	ErrAlreadyExists = errors.New("bank already exists")
+	ErrHqNotFound    = errors.New("HQ bank doesn't exist")
+	ErrNotDeleted    = errors.New("bank isn't deleted")
+	// The bank was changed since the version the update was made against
+	ErrVersionConflict = errors.New("bank was changed by someone else")
+)
+
+// Everything the API needs from storage. Implementations return sql.ErrNoRows when a bank doesn't exist,
+// ErrAlreadyExists when inserting a SWIFT code which is taken (also by a soft deleted bank), ErrHqNotFound
+// when a branch points to a missing HQ, ErrNotDeleted when restoring or purging a bank which isn't deleted
+// and ErrVersionConflict when changing a bank whose version isn't the one the change expects (0 expects any).
+// Every change, including branches losing or getting their HQ, is recorded in the history with the given audit.
+// See the package functions with the same names for details.
+type BankRepository interface {
+	GetBank(swiftCode string) (Bank, error)
+	GetDeletedBank(swiftCode string) (Bank, error)
+	GetBankBranches(swiftCode string) ([]Bank, error)
+	GetBanksWithBranches(swiftCodes []string) ([]Bank, error)
+	GetBanksInCountry(countryCode string) ([]Bank, error)
+	GetBanksInCountryPage(countryCode string, after string, limit int) ([]Bank, error)
+	SearchBanks(query string, limit int) ([]BankSearchResult, error)
+	StreamBanks(filter BankFilter) iter.Seq2[Bank, error]
+	CheckBankHqExists(hqSwiftCode string) (bool, error)
+	InsertBank(bank Bank, audit Audit) error
+	InsertHqBank(bank Bank, audit Audit) (int64, error)
+	InsertBankBatch(banks []Bank, atomic bool, audit Audit) ([]BatchInsertResult, bool, error)
+	UpdateBank(bank Bank, audit Audit) error
+	DeleteBank(swiftCode string, version int64, audit Audit) error
+	RestoreBank(swiftCode string, version int64, audit Audit) (int64, error)
+	PurgeBank(swiftCode string, version int64, audit Audit) error
+	GetBankHistory(swiftCode string) ([]BankHistory, error)
+}
+
+// Stores banks in Postgres using the package functions
+type PostgresRepository struct {
+	db *sqlx.DB
+}
+
+func NewPostgresRepository(db *sqlx.DB) *PostgresRepository {
+	return &PostgresRepository{db: db}
+}
+
+func (r *PostgresRepository) GetBank(swiftCode string) (Bank, error) {
+	return GetBank(r.db, swiftCode)
+}
+
+func (r *PostgresRepository) GetDeletedBank(swiftCode string) (Bank, error) {
+	return GetDeletedBank(r.db, swiftCode)
+}
+
+func (r *PostgresRepository) GetBankBranches(swiftCode string) ([]Bank, error) {
+	return GetBankBranches(r.db, swiftCode)
+}
+
+func (r *PostgresRepository) GetBanksWithBranches(swiftCodes []string) ([]Bank, error) {
+	return GetBanksWithBranches(r.db, swiftCodes)
+}
+
+func (r *PostgresRepository) GetBanksInCountry(countryCode string) ([]Bank, error) {
+	return GetBanksInCountry(r.db, countryCode)
+}
+
+func (r *PostgresRepository) GetBanksInCountryPage(countryCode string, after string, limit int) ([]Bank, error) {
+	return GetBanksInCountryPage(r.db, countryCode, after, limit)
+}
+
+func (r *PostgresRepository) SearchBanks(query string, limit int) ([]BankSearchResult, error) {
+	return SearchBanks(r.db, query, limit)
+}
+
+func (r *PostgresRepository) StreamBanks(filter BankFilter) iter.Seq2[Bank, error] {
+	return StreamBanks(r.db, filter)
+}
+
+func (r *PostgresRepository) CheckBankHqExists(hqSwiftCode string) (bool, error) {
+	return CheckBankHqExists(r.db, hqSwiftCode)
+}
+
+func (r *PostgresRepository) InsertBank(bank Bank, audit Audit) error {
+	return mapPgError(InsertBank(r.db, bank, audit))
+}
+
+func (r *PostgresRepository) InsertHqBank(bank Bank, audit Audit) (int64, error) {
+	linked, err := InsertHqBank(r.db, bank, audit)
+	return linked, mapPgError(err)
+}
+
+func (r *PostgresRepository) InsertBankBatch(banks []Bank, atomic bool, audit Audit) ([]BatchInsertResult, bool, error) {
+	return InsertBankBatch(r.db, banks, atomic, audit)
+}
+
+func (r *PostgresRepository) UpdateBank(bank Bank, audit Audit) error {
+	return UpdateBank(r.db, bank, audit)
+}
+
+func (r *PostgresRepository) DeleteBank(swiftCode string, version int64, audit Audit) error {
+	return DeleteBank(r.db, swiftCode, version, audit)
+}
+
+func (r *PostgresRepository) RestoreBank(swiftCode string, version int64, audit Audit) (int64, error) {
+	return RestoreBank(r.db, swiftCode, version, audit)
+}
+
+func (r *PostgresRepository) PurgeBank(swiftCode string, version int64, audit Audit) error {
+	return PurgeBank(r.db, swiftCode, version, audit)
+}
+
+func (r *PostgresRepository) GetBankHistory(swiftCode string) ([]BankHistory, error) {
+	return GetBankHistory(r.db, swiftCode)
+}
+
+// Wraps constraint violations in the repository errors, the original error is kept for logging
+func mapPgError(err error) error {
+	var pgErr *pq.Error
+	if !errors.As(err, &pgErr) {
+		return err
+	}
+
+	switch pgErr.Code {
+	case UniqueViolationErrorCode:
+		return fmt.Errorf("%w: %w", ErrAlreadyExists, err)
+	case ForeignKeyViolationErrorCode:
+		return fmt.Errorf("%w: %w", ErrHqNotFound, err)
+	default:
+		return err
+	}
+}
@@ -0,0 +1,487 @@
+package db
+
+import (
+	"database/sql"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// Behaviour shared by the repositories which don't need Docker, Postgres is covered by the package function tests
+
+type newRepositoryFunc func(t *testing.T, banks []Bank) (BankRepository, error)
+
+var repositories = map[string]newRepositoryFunc{
+	"memory": func(t *testing.T, banks []Bank) (BankRepository, error) {
+		return NewMemoryRepository(banks)
+	},
+	"sqlite": func(t *testing.T, banks []Bank) (BankRepository, error) {
+		db := testSqlite(t)
+		err := InsertBanks(db, banks, testAudit)
+		return NewSqliteRepository(db), mapSqliteError(err)
+	},
+	// Reads are cached, so the shared tests check that writes invalidate them
+	"cached": func(t *testing.T, banks []Bank) (BankRepository, error) {
+		repo, err := NewMemoryRepository(banks)
+		return NewCachedRepository(repo, 100, time.Hour), err
+	},
+}
+
+func forEachRepository(t *testing.T, f func(t *testing.T, newRepo newRepositoryFunc)) {
+	for name, newRepo := range repositories {
+		t.Run(name, func(t *testing.T) {
+			f(t, newRepo)
+		})
+	}
+}
+
+func TestBankRepositoryGet(t *testing.T) {
+	forEachRepository(t, func(t *testing.T, newRepo newRepositoryFunc) {
+		// Arrange
+		repo, err := newRepo(t, []Bank{memOtherBank, memHqBank, memBranchBank})
+		require.NoError(t, err)
+
+		t.Run("missing bank", func(t *testing.T) {
+			_, err := repo.GetBank("MISSINGXXXX")
+			assert.ErrorIs(t, err, sql.ErrNoRows)
+		})
+
+		t.Run("branches", func(t *testing.T) {
+			branches, err := repo.GetBankBranches(memHqBank.SwiftCode)
+			require.NoError(t, err)
+			assert.Equal(t, []Bank{memBranchBank}, withoutRevisions(branches))
+		})
+
+		t.Run("banks with branches", func(t *testing.T) {
+			banks, err := repo.GetBanksWithBranches([]string{memHqBank.SwiftCode, "MISSINGXXXX"})
+			require.NoError(t, err)
+			assert.Equal(t, []Bank{memBranchBank, memHqBank}, withoutRevisions(banks))
+		})
+
+		t.Run("country pages", func(t *testing.T) {
+			page, err := repo.GetBanksInCountryPage("PL", "", 1)
+			require.NoError(t, err)
+			assert.Equal(t, []Bank{memBranchBank}, withoutRevisions(page))
+
+			page, err = repo.GetBanksInCountryPage("PL", memBranchBank.SwiftCode, 1)
+			require.NoError(t, err)
+			assert.Equal(t, []Bank{memHqBank}, withoutRevisions(page))
+		})
+
+		t.Run("stream filter", func(t *testing.T) {
+			var codes []string
+			for bank, err := range repo.StreamBanks(BankFilter{HqOnly: true}) {
+				require.NoError(t, err)
+				codes = append(codes, bank.SwiftCode)
+			}
+			assert.Equal(t, []string{memHqBank.SwiftCode, memOtherBank.SwiftCode}, codes)
+		})
+
+		t.Run("search ranks prefix matches first", func(t *testing.T) {
+			results, err := repo.SearchBanks("WARS", 10)
+			require.NoError(t, err)
+
+			codes := make([]string, len(results))
+			for i, r := range results {
+				codes[i] = r.SwiftCode
+			}
+			assert.Equal(t, []string{memBranchBank.SwiftCode, memHqBank.SwiftCode, memOtherBank.SwiftCode}, codes)
+			assert.Greater(t, results[0].Rank, 2.0)
+			assert.Less(t, results[2].Rank, 2.0)
+		})
+	})
+}
+
+func TestBankRepositoryWrite(t *testing.T) {
+	forEachRepository(t, func(t *testing.T, newRepo newRepositoryFunc) {
+		t.Run("insert checks keys", func(t *testing.T) {
+			// Arrange
+			repo, err := newRepo(t, []Bank{memHqBank})
+			require.NoError(t, err)
+
+			// Act & Assert
+			assert.ErrorIs(t, repo.InsertBank(memHqBank, testAudit), ErrAlreadyExists)
+			assert.ErrorIs(t, repo.InsertBank(Bank{SwiftCode: "CCCCPLPW001", HqSwiftCode: sql.NullString{String: "CCCCPLPWXXX", Valid: true}}, testAudit), ErrHqNotFound)
+			assert.NoError(t, repo.InsertBank(memBranchBank, testAudit))
+		})
+
+		t.Run("hq links orphaned branches", func(t *testing.T) {
+			// Arrange
+			repo, err := newRepo(t, []Bank{orphan(memBranchBank)})
+			require.NoError(t, err)
+
+			// Act
+			linked, err := repo.InsertHqBank(memHqBank, testAudit)
+
+			// Assert
+			require.NoError(t, err)
+			assert.Equal(t, int64(1), linked)
+			branch, err := repo.GetBank(memBranchBank.SwiftCode)
+			require.NoError(t, err)
+			assert.Equal(t, memBranchBank, branch.withoutRevision())
+		})
+
+		t.Run("update keeps code and hq", func(t *testing.T) {
+			// Arrange
+			repo, err := newRepo(t, []Bank{memHqBank, memBranchBank})
+			require.NoError(t, err)
+			updated := memBranchBank
+			updated.BankName = "Renamed"
+			updated.HqSwiftCode = sql.NullString{}
+
+			// Act
+			err = repo.UpdateBank(updated, testAudit)
+
+			// Assert
+			require.NoError(t, err)
+			got, err := repo.GetBank(memBranchBank.SwiftCode)
+			require.NoError(t, err)
+			assert.Equal(t, "Renamed", got.BankName)
+			assert.Equal(t, memBranchBank.HqSwiftCode, got.HqSwiftCode)
+			assert.ErrorIs(t, repo.UpdateBank(Bank{SwiftCode: "MISSINGXXXX"}, testAudit), sql.ErrNoRows)
+		})
+
+		t.Run("changes bump the version", func(t *testing.T) {
+			// Arrange
+			repo, err := newRepo(t, []Bank{memHqBank, memBranchBank})
+			require.NoError(t, err)
+			inserted, err := repo.GetBank(memBranchBank.SwiftCode)
+			require.NoError(t, err)
+			updated := memBranchBank
+			updated.BankName = "Renamed"
+
+			// Act
+			require.NoError(t, repo.UpdateBank(updated, testAudit))
+			require.NoError(t, repo.UpdateBank(updated, testAudit)) // Nothing changes, so the version stays
+			require.NoError(t, repo.DeleteBank(memHqBank.SwiftCode, 0, testAudit))
+
+			// Assert
+			assert.Equal(t, int64(1), inserted.Version)
+			assert.WithinDuration(t, time.Now(), inserted.UpdatedAt, time.Minute)
+			got, err := repo.GetBank(memBranchBank.SwiftCode)
+			require.NoError(t, err)
+			assert.Equal(t, int64(3), got.Version, "renamed, then orphaned")
+			assert.False(t, got.UpdatedAt.Before(inserted.UpdatedAt))
+		})
+
+		t.Run("branch changes bump the hq", func(t *testing.T) {
+			// Arrange
+			repo, err := newRepo(t, []Bank{memHqBank, memBranchBank})
+			require.NoError(t, err)
+			before, err := repo.GetBank(memHqBank.SwiftCode)
+			require.NoError(t, err)
+			history, err := repo.GetBankHistory(memHqBank.SwiftCode)
+			require.NoError(t, err)
+
+			// Act
+			require.NoError(t, repo.DeleteBank(memBranchBank.SwiftCode, 0, testAudit))
+			deleted, err := repo.GetBank(memHqBank.SwiftCode)
+			require.NoError(t, err)
+			require.NoError(t, repo.PurgeBank(memBranchBank.SwiftCode, 0, testAudit))
+			purged, err := repo.GetBank(memHqBank.SwiftCode)
+			require.NoError(t, err)
+
+			// Assert
+			assert.Equal(t, before.Version+1, deleted.Version)
+			assert.False(t, deleted.UpdatedAt.Before(before.UpdatedAt))
+			assert.Equal(t, deleted.Version+1, purged.Version)
+			after, err := repo.GetBankHistory(memHqBank.SwiftCode)
+			require.NoError(t, err)
+			assert.Equal(t, history, after, "bumps aren't recorded")
+		})
+
+		t.Run("update checks the version", func(t *testing.T) {
+			// Arrange
+			repo, err := newRepo(t, []Bank{memHqBank})
+			require.NoError(t, err)
+			updated := memHqBank
+			updated.BankName = "Renamed"
+			updated.Version = 2
+
+			// Act & Assert
+			assert.ErrorIs(t, repo.UpdateBank(updated, testAudit), ErrVersionConflict)
+			updated.Version = 1
+			require.NoError(t, repo.UpdateBank(updated, testAudit))
+			assert.ErrorIs(t, repo.UpdateBank(updated, testAudit), ErrVersionConflict, "the first update bumped it")
+			updated.SwiftCode = "MISSINGXXXX"
+			assert.ErrorIs(t, repo.UpdateBank(updated, testAudit), sql.ErrNoRows)
+		})
+
+		t.Run("delete, restore and purge check the version", func(t *testing.T) {
+			// Arrange
+			repo, err := newRepo(t, []Bank{memOtherBank})
+			require.NoError(t, err)
+			bank, err := repo.GetBank(memOtherBank.SwiftCode)
+			require.NoError(t, err)
+			code := bank.SwiftCode
+
+			// Act & Assert
+			assert.ErrorIs(t, repo.DeleteBank(code, bank.Version+1, testAudit), ErrVersionConflict)
+			require.NoError(t, repo.DeleteBank(code, bank.Version, testAudit))
+			deleted, err := repo.GetDeletedBank(code)
+			require.NoError(t, err)
+			assert.Greater(t, deleted.Version, bank.Version)
+
+			_, err = repo.RestoreBank(code, bank.Version, testAudit)
+			assert.ErrorIs(t, err, ErrVersionConflict, "the delete bumped it")
+			_, err = repo.RestoreBank(code, deleted.Version, testAudit)
+			require.NoError(t, err)
+
+			require.NoError(t, repo.DeleteBank(code, 0, testAudit))
+			assert.ErrorIs(t, repo.PurgeBank(code, deleted.Version, testAudit), ErrVersionConflict)
+			deleted, err = repo.GetDeletedBank(code)
+			require.NoError(t, err)
+			require.NoError(t, repo.PurgeBank(code, deleted.Version, testAudit))
+			_, err = repo.GetDeletedBank(code)
+			assert.ErrorIs(t, err, sql.ErrNoRows)
+		})
+
+		t.Run("delete orphans branches", func(t *testing.T) {
+			// Arrange
+			repo, err := newRepo(t, []Bank{memHqBank, memBranchBank})
+			require.NoError(t, err)
+
+			// Act
+			err = repo.DeleteBank(memHqBank.SwiftCode, 0, testAudit)
+
+			// Assert
+			require.NoError(t, err)
+			branch, err := repo.GetBank(memBranchBank.SwiftCode)
+			require.NoError(t, err)
+			assert.Equal(t, orphan(memBranchBank), branch.withoutRevision())
+			assert.ErrorIs(t, repo.DeleteBank(memHqBank.SwiftCode, 0, testAudit), sql.ErrNoRows)
+		})
+	})
+}
+
+func TestBankRepositoryHistory(t *testing.T) {
+	forEachRepository(t, func(t *testing.T, newRepo newRepositoryFunc) {
+		// Arrange
+		repo, err := newRepo(t, []Bank{memHqBank})
+		require.NoError(t, err)
+		editor := Audit{Actor: "editor", Source: HistorySourceApi}
+		importer := Audit{Actor: "importer", Source: HistorySourceImport}
+		renamed := memBranchBank
+		renamed.BankName = "Renamed"
+
+		// Act
+		require.NoError(t, repo.InsertBank(memBranchBank, editor))
+		require.NoError(t, repo.UpdateBank(renamed, editor))
+		require.NoError(t, repo.UpdateBank(renamed, editor)) // Nothing changes, so nothing is recorded
+		require.NoError(t, repo.DeleteBank(memHqBank.SwiftCode, 0, importer))
+
+		// Assert
+		history, err := repo.GetBankHistory(memBranchBank.SwiftCode)
+		require.NoError(t, err)
+		type change struct {
+			operation string
+			actor     string
+			source    string
+			before    *BankSnapshot
+			after     *BankSnapshot
+		}
+		snapshot := func(bank Bank) *BankSnapshot {
+			s := BankSnapshot(bank)
+			return &s
+		}
+		expected := []change{
+			{HistoryOperationUpdate, importer.Actor, importer.Source, snapshot(renamed), snapshot(orphan(renamed))},
+			{HistoryOperationUpdate, editor.Actor, editor.Source, snapshot(memBranchBank), snapshot(renamed)},
+			{HistoryOperationInsert, editor.Actor, editor.Source, nil, snapshot(memBranchBank)},
+		}
+		got := make([]change, len(history))
+		for i, entry := range history {
+			assert.Equal(t, memBranchBank.SwiftCode, entry.SwiftCode)
+			assert.WithinDuration(t, time.Now(), entry.ChangedAt, time.Minute)
+			got[i] = change{entry.Operation, entry.Actor, entry.Source, entry.Before, entry.After}
+		}
+		assert.Equal(t, expected, got)
+
+		// Deleted banks keep their history
+		history, err = repo.GetBankHistory(memHqBank.SwiftCode)
+		require.NoError(t, err)
+		require.Len(t, history, 2)
+		assert.Equal(t, HistoryOperationDelete, history[0].Operation)
+		assert.Equal(t, snapshot(memHqBank), history[0].Before)
+		assert.Nil(t, history[0].After)
+		assert.Equal(t, HistoryOperationInsert, history[1].Operation)
+
+		history, err = repo.GetBankHistory("MISSINGXXXX")
+		require.NoError(t, err)
+		assert.Empty(t, history)
+	})
+}
+
+func TestBankRepositoryRestore(t *testing.T) {
+	forEachRepository(t, func(t *testing.T, newRepo newRepositoryFunc) {
+		t.Run("hq gets its branches back", func(t *testing.T) {
+			// Arrange
+			repo, err := newRepo(t, []Bank{memHqBank, memBranchBank})
+			require.NoError(t, err)
+			require.NoError(t, repo.DeleteBank(memHqBank.SwiftCode, 0, testAudit))
+
+			// Act
+			linked, err := repo.RestoreBank(memHqBank.SwiftCode, 0, testAudit)
+
+			// Assert
+			require.NoError(t, err)
+			assert.Equal(t, int64(1), linked)
+			hq, err := repo.GetBank(memHqBank.SwiftCode)
+			require.NoError(t, err)
+			assert.Equal(t, memHqBank, hq.withoutRevision())
+			branches, err := repo.GetBankBranches(memHqBank.SwiftCode)
+			require.NoError(t, err)
+			assert.Equal(t, []Bank{memBranchBank}, withoutRevisions(branches))
+			history, err := repo.GetBankHistory(memHqBank.SwiftCode)
+			require.NoError(t, err)
+			assert.Equal(t, HistoryOperationRestore, history[0].Operation)
+			assert.Nil(t, history[0].Before)
+			assert.Equal(t, memHqBank.BankName, history[0].After.BankName)
+		})
+
+		t.Run("branch gets its hq back", func(t *testing.T) {
+			// Arrange
+			repo, err := newRepo(t, []Bank{memHqBank, memBranchBank})
+			require.NoError(t, err)
+			require.NoError(t, repo.DeleteBank(memBranchBank.SwiftCode, 0, testAudit))
+			require.NoError(t, repo.DeleteBank(memHqBank.SwiftCode, 0, testAudit))
+
+			// Act
+			linked, err := repo.RestoreBank(memHqBank.SwiftCode, 0, testAudit)
+			require.NoError(t, err)
+			assert.Equal(t, int64(0), linked, "deleted branches are only linked when restored")
+			_, err = repo.RestoreBank(memBranchBank.SwiftCode, 0, testAudit)
+
+			// Assert
+			require.NoError(t, err)
+			branch, err := repo.GetBank(memBranchBank.SwiftCode)
+			require.NoError(t, err)
+			assert.Equal(t, memBranchBank, branch.withoutRevision())
+		})
+
+		t.Run("only deleted banks", func(t *testing.T) {
+			// Arrange
+			repo, err := newRepo(t, []Bank{memHqBank})
+			require.NoError(t, err)
+
+			// Act & Assert
+			_, err = repo.RestoreBank(memHqBank.SwiftCode, 0, testAudit)
+			assert.ErrorIs(t, err, ErrNotDeleted)
+			_, err = repo.RestoreBank("MISSINGXXXX", 0, testAudit)
+			assert.ErrorIs(t, err, sql.ErrNoRows)
+		})
+	})
+}
+
+func TestBankRepositoryPurge(t *testing.T) {
+	forEachRepository(t, func(t *testing.T, newRepo newRepositoryFunc) {
+		// Arrange
+		repo, err := newRepo(t, []Bank{memOtherBank})
+		require.NoError(t, err)
+
+		// Act & Assert
+		assert.ErrorIs(t, repo.PurgeBank(memOtherBank.SwiftCode, 0, testAudit), ErrNotDeleted)
+		assert.ErrorIs(t, repo.PurgeBank("MISSINGXXXX", 0, testAudit), sql.ErrNoRows)
+
+		require.NoError(t, repo.DeleteBank(memOtherBank.SwiftCode, 0, testAudit))
+		assert.ErrorIs(t, repo.InsertBank(memOtherBank, testAudit), ErrAlreadyExists, "deleted banks keep their code")
+		require.NoError(t, repo.PurgeBank(memOtherBank.SwiftCode, 0, testAudit))
+		assert.ErrorIs(t, repo.PurgeBank(memOtherBank.SwiftCode, 0, testAudit), sql.ErrNoRows)
+		_, err = repo.RestoreBank(memOtherBank.SwiftCode, 0, testAudit)
+		assert.ErrorIs(t, err, sql.ErrNoRows)
+		require.NoError(t, repo.InsertBank(memOtherBank, testAudit))
+
+		history, err := repo.GetBankHistory(memOtherBank.SwiftCode)
+		require.NoError(t, err)
+		operations := make([]string, len(history))
+		for i, entry := range history {
+			operations[i] = entry.Operation
+		}
+		expected := []string{HistoryOperationInsert, HistoryOperationPurge, HistoryOperationDelete, HistoryOperationInsert}
+		assert.Equal(t, expected, operations)
+	})
+}
+
+func TestBankRepositoryInsertBankBatch(t *testing.T) {
+	forEachRepository(t, func(t *testing.T, newRepo newRepositoryFunc) {
+		tests := []struct {
+			name          string
+			atomic        bool
+			wantCommitted bool
+			wantCodes     []string
+		}{
+			{
+				name:          "atomic",
+				atomic:        true,
+				wantCommitted: false,
+				wantCodes:     []string{memOtherBank.SwiftCode},
+			},
+			{
+				name:          "best effort",
+				atomic:        false,
+				wantCommitted: true,
+				wantCodes:     []string{memBranchBank.SwiftCode, memHqBank.SwiftCode, memOtherBank.SwiftCode},
+			},
+		}
+
+		for _, tt := range tests {
+			t.Run(tt.name, func(t *testing.T) {
+				// Arrange
+				repo, err := newRepo(t, []Bank{memOtherBank})
+				require.NoError(t, err)
+
+				// Act
+				results, committed, err := repo.InsertBankBatch([]Bank{memBranchBank, memOtherBank, memHqBank}, tt.atomic, testAudit)
+
+				// Assert
+				require.NoError(t, err)
+				assert.Equal(t, tt.wantCommitted, committed)
+				assert.Equal(t, []BatchInsertResult{{}, {Duplicate: true}, {}}, results)
+
+				var codes []string
+				for bank, err := range repo.StreamBanks(BankFilter{}) {
+					require.NoError(t, err)
+					codes = append(codes, bank.SwiftCode)
+				}
+				assert.Equal(t, tt.wantCodes, codes)
+				if committed {
+					branch, err := repo.GetBank(memBranchBank.SwiftCode)
+					require.NoError(t, err)
+					assert.Equal(t, memBranchBank.HqSwiftCode, branch.HqSwiftCode)
+				}
+			})
+		}
+	})
+}
+
+func TestBankRepositoryConcurrentUse(t *testing.T) {
+	forEachRepository(t, func(t *testing.T, newRepo newRepositoryFunc) {
+		// Arrange
+		repo, err := newRepo(t, []Bank{memHqBank})
+		require.NoError(t, err)
+
+		// Act
+		var wg sync.WaitGroup
+		for i := range 50 {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				branch := memBranchBank
+				branch.SwiftCode = fmt.Sprintf("AAAAPLPW%03d", i+100)
+				assert.NoError(t, repo.InsertBank(branch, testAudit))
+				_, err := repo.GetBankBranches(memHqBank.SwiftCode)
+				assert.NoError(t, err)
+			}()
+		}
+		wg.Wait()
+
+		// Assert
+		branches, err := repo.GetBankBranches(memHqBank.SwiftCode)
+		require.NoError(t, err)
+		assert.Len(t, branches, 50)
+	})
+}
@@ -0,0 +1,115 @@
+package db
+
+import (
+	"database/sql"
+
+	"github.com/jmoiron/sqlx"
+)
+
+type BatchInsertResult struct {
+	Duplicate      bool  // The bank already exists, either in the DB or earlier in the batch
+	LinkedBranches int64 // Only for HQs, counts branches added before their HQ
+}
+
+// Inserts banks in one transaction and reports the result of each one, in the same order as banks.
+// Every bank gets its own savepoint, so a duplicate doesn't abort the others. HQs are inserted before branches,
+// branches are expected to have their presumed HQ code set and are only linked if that HQ was inserted in the batch
+// or already is in the DB. If atomic, nothing is committed when any bank fails.
+// Returns whether the transaction was committed, errors other than duplicates abort the whole batch.
+func InsertBankBatch(db *sqlx.DB, banks []Bank, atomic bool, audit Audit) ([]BatchInsertResult, bool, error) {
+	tx, err := beginAudited(db, audit)
+	if err != nil {
+		return nil, false, err
+	}
+	defer tx.Rollback()
+
+	d := dialectOf(db)
+	results := make([]BatchInsertResult, len(banks))
+	failed := false
+
+	// HQs first, so branches in the same batch can be linked to them
+	for i, bank := range banks {
+		if !bank.IsHeadquarter {
+			continue
+		}
+
+		results[i].Duplicate, err = insertBatchItem(tx.Tx, d, bank)
+		if err != nil {
+			return nil, false, err
+		}
+		if results[i].Duplicate {
+			failed = true
+			continue
+		}
+
+		results[i].LinkedBranches, err = linkOrphanedBranches(tx, bank.SwiftCode)
+		if err != nil {
+			return nil, false, err
+		}
+	}
+
+	// One query for all HQs, whether they were inserted above or were already there
+	var hqCodes []string
+	for _, bank := range banks {
+		if !bank.IsHeadquarter && bank.HqSwiftCode.Valid {
+			hqCodes = append(hqCodes, bank.HqSwiftCode.String)
+		}
+	}
+	var existingHqCodes []string
+	err = tx.Select(&existingHqCodes, "SELECT swift_code FROM bank WHERE "+d.inCodes("swift_code")+" AND deleted_at IS NULL;", d.codesArg(hqCodes))
+	if err != nil {
+		return nil, false, err
+	}
+	existingHqs := make(map[string]struct{}, len(existingHqCodes))
+	for _, code := range existingHqCodes {
+		existingHqs[code] = struct{}{}
+	}
+
+	for i, bank := range banks {
+		if bank.IsHeadquarter {
+			continue
+		}
+
+		if _, ok := existingHqs[bank.HqSwiftCode.String]; !ok {
+			bank.HqSwiftCode = sql.NullString{}
+		}
+
+		results[i].Duplicate, err = insertBatchItem(tx.Tx, d, bank)
+		if err != nil {
+			return nil, false, err
+		}
+		if results[i].Duplicate {
+			failed = true
+		}
+	}
+
+	if atomic && failed {
+		return results, false, nil
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return nil, false, err
+	}
+
+	return results, true, nil
+}
+
+// Returns true if the bank already exists, the transaction can still be used then
+func insertBatchItem(tx *sqlx.Tx, d dialect, bank Bank) (bool, error) {
+	_, err := tx.Exec("SAVEPOINT batch_item;")
+	if err != nil {
+		return false, err
+	}
+
+	err = execInsertBanks(tx, []Bank{bank})
+	if d.isUniqueViolation(err) {
+		_, err := tx.Exec("ROLLBACK TO SAVEPOINT batch_item;")
+		return true, err
+	} else if err != nil {
+		return false, err
+	}
+
+	_, err = tx.Exec("RELEASE SAVEPOINT batch_item;")
+	return false, err
+}
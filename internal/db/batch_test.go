@@ -0,0 +1,116 @@
+package db
+
+import (
+	"testing"
+
+	"github.com/mwojtyna/swift-api/internal/utils"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestInsertBankBatch(t *testing.T) {
+	t.Parallel()
+	utils.TestWithPostgres(func(args utils.TestWithPostgresArgs) {
+		db, err := Connect(args.Env.DB_USER, args.Env.DB_PASS, args.Env.DB_NAME, args.Env.DB_HOST, args.Port)
+		require.NoError(t, err)
+		t.Cleanup(func() {
+			db.Close()
+		})
+
+		t.Run("links branches to HQs in the batch", func(t *testing.T) {
+			// Arrange
+			t.Cleanup(func() {
+				truncateBanks(db)
+			})
+
+			// Act
+			results, committed, err := InsertBankBatch(db, []Bank{syncBranch, syncHq}, true, testAudit)
+
+			// Assert
+			require.NoError(t, err)
+			assert.True(t, committed)
+			assert.Equal(t, []BatchInsertResult{{}, {}}, results)
+
+			bank, err := GetBank(db, syncBranch.SwiftCode)
+			require.NoError(t, err)
+			assert.Equal(t, syncBranch, bank.withoutRevision())
+		})
+
+		t.Run("links orphaned branches in the DB", func(t *testing.T) {
+			// Arrange
+			orphan := syncBranch
+			orphan.HqSwiftCode.Valid = false
+			err := insertBank(db, orphan)
+			require.NoError(t, err)
+			t.Cleanup(func() {
+				truncateBanks(db)
+			})
+
+			// Act
+			results, committed, err := InsertBankBatch(db, []Bank{syncHq}, true, testAudit)
+
+			// Assert
+			require.NoError(t, err)
+			assert.True(t, committed)
+			assert.Equal(t, []BatchInsertResult{{LinkedBranches: 1}}, results)
+		})
+
+		t.Run("unlinks branches without HQ", func(t *testing.T) {
+			// Arrange
+			t.Cleanup(func() {
+				truncateBanks(db)
+			})
+
+			// Act
+			_, _, err := InsertBankBatch(db, []Bank{syncBranch}, true, testAudit)
+
+			// Assert
+			require.NoError(t, err)
+
+			bank, err := GetBank(db, syncBranch.SwiftCode)
+			require.NoError(t, err)
+			assert.False(t, bank.HqSwiftCode.Valid)
+		})
+
+		t.Run("atomic batch with duplicate inserts nothing", func(t *testing.T) {
+			// Arrange
+			err := insertBank(db, syncOther)
+			require.NoError(t, err)
+			t.Cleanup(func() {
+				truncateBanks(db)
+			})
+
+			// Act
+			results, committed, err := InsertBankBatch(db, []Bank{syncHq, syncOther}, true, testAudit)
+
+			// Assert
+			require.NoError(t, err)
+			assert.False(t, committed)
+			assert.Equal(t, []BatchInsertResult{{}, {Duplicate: true}}, results)
+
+			_, err = GetBank(db, syncHq.SwiftCode)
+			assert.Error(t, err)
+		})
+
+		t.Run("best effort batch with duplicate inserts the rest", func(t *testing.T) {
+			// Arrange
+			err := insertBank(db, syncOther)
+			require.NoError(t, err)
+			t.Cleanup(func() {
+				truncateBanks(db)
+			})
+
+			// Act
+			results, committed, err := InsertBankBatch(db, []Bank{syncHq, syncOther, syncBranch}, false, testAudit)
+
+			// Assert
+			require.NoError(t, err)
+			assert.True(t, committed)
+			assert.Equal(t, []BatchInsertResult{{}, {Duplicate: true}, {}}, results)
+
+			bank, err := GetBank(db, syncBranch.SwiftCode)
+			require.NoError(t, err)
+			assert.Equal(t, syncBranch, bank.withoutRevision())
+		})
+	})
+}
@@ -0,0 +1,334 @@
+package db
+
+import (
+	"database/sql"
+	"errors"
+	"iter"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mwojtyna/swift-api/internal/bic"
+	"github.com/mwojtyna/swift-api/internal/cache"
+)
+
+type cacheKind int
+
+const (
+	cacheKindBank     cacheKind = iota // A single bank, or sql.ErrNoRows
+	cacheKindBranches                  // Branches of an HQ
+	cacheKindCountry                   // A page of banks in a country, or the whole country if limit is 0
+)
+
+type cacheKey struct {
+	kind  cacheKind
+	code  string // SWIFT code, or country code for cacheKindCountry
+	after string // Only for cacheKindCountry
+	limit int    // Only for cacheKindCountry
+}
+
+// Longer lists aren't cached, so every entry is small and the cache size bounds the memory it takes.
+// Fits the biggest country page the API asks for, which is 1000 banks and one to tell if there's a next page.
+const maxCachedBanks = 1001
+
+type cacheValue struct {
+	bank  Bank
+	banks []Bank
+	err   error
+}
+
+// Caches single banks, HQ branches and country pages of another repository in memory. Writes go through the cache
+// and invalidate the entries they affect, everything else isn't cached.
+// Changes made directly in the DB (e.g. by the parser's sync) are only seen when the entries expire.
+type CachedRepository struct {
+	repo  BankRepository
+	cache *cache.Cache[cacheKey, cacheValue]
+
+	// Bumped by every invalidation. A read which started before one could have read the banks before the write,
+	// so it's not cached, otherwise it would stay in the cache after the invalidation it raced with.
+	mu         sync.Mutex
+	generation uint64
+}
+
+// Size is the maximum number of entries and must be positive, entries expire after ttl
+func NewCachedRepository(repo BankRepository, size int, ttl time.Duration) *CachedRepository {
+	return &CachedRepository{
+		repo:  repo,
+		cache: cache.New[cacheKey, cacheValue](size, ttl),
+	}
+}
+
+func (r *CachedRepository) CacheStats() cache.Stats {
+	return r.cache.Stats()
+}
+
+func (r *CachedRepository) GetBank(swiftCode string) (Bank, error) {
+	key := cacheKey{kind: cacheKindBank, code: swiftCode}
+	if v, ok := r.cache.Get(key); ok {
+		return v.bank, v.err
+	}
+
+	generation := r.currentGeneration()
+	bank, err := r.repo.GetBank(swiftCode)
+	if err == nil || errors.Is(err, sql.ErrNoRows) {
+		r.set(generation, key, cacheValue{bank: bank, err: err})
+	}
+	return bank, err
+}
+
+// The repository the cache reads from, for reads which must see the latest changes
+func (r *CachedRepository) Uncached() BankRepository {
+	return r.repo
+}
+
+// Deleted banks are only read before restoring or purging them, so they aren't cached
+func (r *CachedRepository) GetDeletedBank(swiftCode string) (Bank, error) {
+	return r.repo.GetDeletedBank(swiftCode)
+}
+
+func (r *CachedRepository) GetBankBranches(swiftCode string) ([]Bank, error) {
+	key := cacheKey{kind: cacheKindBranches, code: swiftCode}
+	if v, ok := r.cache.Get(key); ok {
+		return slices.Clone(v.banks), nil
+	}
+
+	generation := r.currentGeneration()
+	branches, err := r.repo.GetBankBranches(swiftCode)
+	if err != nil {
+		return nil, err
+	}
+	r.set(generation, key, cacheValue{banks: slices.Clone(branches)})
+
+	return branches, nil
+}
+
+// Only small countries are cached, bigger ones are read through pages
+func (r *CachedRepository) GetBanksInCountry(countryCode string) ([]Bank, error) {
+	return r.countryBanks(cacheKey{kind: cacheKindCountry, code: countryCode}, func() ([]Bank, error) {
+		return r.repo.GetBanksInCountry(countryCode)
+	})
+}
+
+// Each page is cached on its own, so reading one doesn't read the rest of the country
+func (r *CachedRepository) GetBanksInCountryPage(countryCode string, after string, limit int) ([]Bank, error) {
+	return r.countryBanks(cacheKey{kind: cacheKindCountry, code: countryCode, after: after, limit: limit}, func() ([]Bank, error) {
+		return r.repo.GetBanksInCountryPage(countryCode, after, limit)
+	})
+}
+
+func (r *CachedRepository) countryBanks(key cacheKey, get func() ([]Bank, error)) ([]Bank, error) {
+	if v, ok := r.cache.Get(key); ok {
+		return slices.Clone(v.banks), nil
+	}
+
+	generation := r.currentGeneration()
+	banks, err := get()
+	if err != nil {
+		return nil, err
+	}
+	if len(banks) <= maxCachedBanks {
+		r.set(generation, key, cacheValue{banks: slices.Clone(banks)})
+	}
+
+	return banks, nil
+}
+
+func (r *CachedRepository) GetBanksWithBranches(swiftCodes []string) ([]Bank, error) {
+	return r.repo.GetBanksWithBranches(swiftCodes)
+}
+
+func (r *CachedRepository) SearchBanks(query string, limit int) ([]BankSearchResult, error) {
+	return r.repo.SearchBanks(query, limit)
+}
+
+func (r *CachedRepository) StreamBanks(filter BankFilter) iter.Seq2[Bank, error] {
+	return r.repo.StreamBanks(filter)
+}
+
+func (r *CachedRepository) CheckBankHqExists(hqSwiftCode string) (bool, error) {
+	return r.repo.CheckBankHqExists(hqSwiftCode)
+}
+
+func (r *CachedRepository) InsertBank(bank Bank, audit Audit) error {
+	err := r.repo.InsertBank(bank, audit)
+	if err == nil {
+		r.invalidate(bank)
+	}
+	return err
+}
+
+func (r *CachedRepository) InsertHqBank(bank Bank, audit Audit) (int64, error) {
+	linked, err := r.repo.InsertHqBank(bank, audit)
+	if err == nil {
+		r.invalidate(bank)
+		if linked > 0 {
+			r.invalidateInstitution(bank.SwiftCode)
+		}
+	}
+	return linked, err
+}
+
+func (r *CachedRepository) InsertBankBatch(banks []Bank, atomic bool, audit Audit) ([]BatchInsertResult, bool, error) {
+	results, committed, err := r.repo.InsertBankBatch(banks, atomic, audit)
+	if err != nil || !committed {
+		return results, committed, err
+	}
+
+	for i, res := range results {
+		if res.Duplicate {
+			continue
+		}
+		r.invalidate(banks[i])
+		if res.LinkedBranches > 0 {
+			r.invalidateInstitution(banks[i].SwiftCode)
+		}
+	}
+	return results, committed, nil
+}
+
+// The bank before the update is read first, so entries of its old country and HQ are invalidated too
+func (r *CachedRepository) UpdateBank(bank Bank, audit Audit) error {
+	before, beforeErr := r.repo.GetBank(bank.SwiftCode)
+
+	err := r.repo.UpdateBank(bank, audit)
+	if err != nil {
+		return err
+	}
+
+	r.invalidate(bank)
+	if beforeErr == nil {
+		r.invalidate(before)
+	} else {
+		r.invalidateInstitution(bank.SwiftCode)
+	}
+	return nil
+}
+
+// Deleting an HQ changes its branches, which lose their HQ
+func (r *CachedRepository) DeleteBank(swiftCode string, version int64, audit Audit) error {
+	before, beforeErr := r.repo.GetBank(swiftCode)
+
+	err := r.repo.DeleteBank(swiftCode, version, audit)
+	if err != nil {
+		return err
+	}
+
+	if beforeErr != nil {
+		r.invalidateInstitution(swiftCode)
+		return nil
+	}
+	r.invalidate(before)
+	if before.IsHeadquarter {
+		r.invalidateInstitution(swiftCode)
+	}
+	return nil
+}
+
+// A restored HQ gets its branches back, and a restored branch is added to its HQ's branches
+func (r *CachedRepository) RestoreBank(swiftCode string, version int64, audit Audit) (int64, error) {
+	linked, err := r.repo.RestoreBank(swiftCode, version, audit)
+	if err != nil {
+		return linked, err
+	}
+
+	after, err := r.repo.GetBank(swiftCode)
+	if err != nil {
+		r.invalidateInstitution(swiftCode)
+		return linked, nil
+	}
+	r.invalidate(after)
+	if linked > 0 {
+		r.invalidateInstitution(swiftCode)
+	}
+	return linked, nil
+}
+
+// Purged banks were already deleted, but a purged branch gives its HQ a new version
+func (r *CachedRepository) PurgeBank(swiftCode string, version int64, audit Audit) error {
+	err := r.repo.PurgeBank(swiftCode, version, audit)
+	if err != nil {
+		return err
+	}
+
+	r.invalidateInstitution(swiftCode)
+	return nil
+}
+
+func (r *CachedRepository) GetBankHistory(swiftCode string) ([]BankHistory, error) {
+	return r.repo.GetBankHistory(swiftCode)
+}
+
+// Read before reading from the repository, and passed to set
+func (r *CachedRepository) currentGeneration() uint64 {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return r.generation
+}
+
+// Caches the value unless an invalidation happened since the generation was read
+func (r *CachedRepository) set(generation uint64, key cacheKey, value cacheValue) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if generation == r.generation {
+		r.cache.Set(key, value)
+	}
+}
+
+// Removes the bank, its country, its HQ's branches and, for HQs, their own branches
+func (r *CachedRepository) invalidate(bank Bank) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.generation++
+
+	r.cache.Delete(cacheKey{kind: cacheKindBank, code: bank.SwiftCode})
+	countries := map[string]bool{bank.CountryISO2Code: true}
+	if bank.HqSwiftCode.Valid {
+		// Changes of a branch give its HQ a new version, see the bank_touch_parents trigger
+		hq := bank.HqSwiftCode.String
+		r.cache.Delete(cacheKey{kind: cacheKindBranches, code: hq})
+		r.cache.Delete(cacheKey{kind: cacheKindBank, code: hq})
+		if len(hq) >= bic.Bic8Len {
+			countries[hq[4:6]] = true
+		}
+	}
+	if bank.IsHeadquarter {
+		r.cache.Delete(cacheKey{kind: cacheKindBranches, code: bank.SwiftCode})
+	}
+	r.deleteCountries(countries)
+}
+
+// Removes every bank and branch list of the institution and location (the first 8 characters of the code),
+// and the countries of those banks. Used when branches get or lose their HQ, since they're linked by this prefix.
+func (r *CachedRepository) invalidateInstitution(swiftCode string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.generation++
+
+	prefix := swiftCode[:min(len(swiftCode), bic.Bic8Len)]
+
+	// Branches are almost always in the country of their code
+	countries := make(map[string]bool)
+	if len(prefix) == bic.Bic8Len {
+		countries[prefix[4:6]] = true
+	}
+	r.cache.DeleteFunc(func(key cacheKey, value cacheValue) bool {
+		if key.kind == cacheKindCountry || !strings.HasPrefix(key.code, prefix) {
+			return false
+		}
+		if key.kind == cacheKindBank && value.err == nil {
+			countries[value.bank.CountryISO2Code] = true
+		}
+		return true
+	})
+	r.deleteCountries(countries)
+}
+
+// Removes every page of the countries
+func (r *CachedRepository) deleteCountries(countries map[string]bool) {
+	r.cache.DeleteFunc(func(key cacheKey, _ cacheValue) bool {
+		return key.kind == cacheKindCountry && countries[key.code]
+	})
+}
@@ -0,0 +1,308 @@
+package db
+
+import (
+	"database/sql"
+	"fmt"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// Reads everything the cache holds, so the tests can check that writes don't serve stale entries
+func warmCache(t *testing.T, repo *CachedRepository, codes ...string) {
+	t.Helper()
+
+	for _, code := range codes {
+		repo.GetBank(code)
+		_, err := repo.GetBankBranches(code)
+		require.NoError(t, err)
+	}
+	for _, country := range []string{"PL", "GB"} {
+		_, err := repo.GetBanksInCountry(country)
+		require.NoError(t, err)
+	}
+}
+
+func newTestCachedRepository(t *testing.T, banks ...Bank) *CachedRepository {
+	t.Helper()
+
+	inner, err := NewMemoryRepository(banks)
+	require.NoError(t, err)
+
+	return NewCachedRepository(inner, 100, time.Hour)
+}
+
+func TestCachedRepositoryServesFromCache(t *testing.T) {
+	// Arrange
+	repo := newTestCachedRepository(t, memHqBank, memBranchBank, memOtherBank)
+
+	// Act
+	warmCache(t, repo, memHqBank.SwiftCode)
+	before := repo.CacheStats()
+	bank, err := repo.GetBank(memHqBank.SwiftCode)
+	require.NoError(t, err)
+	branches, err := repo.GetBankBranches(memHqBank.SwiftCode)
+	require.NoError(t, err)
+	_, missingErr := repo.GetBank("ZZZZPLPWXXX")
+	_, missingErr = repo.GetBank("ZZZZPLPWXXX")
+	after := repo.CacheStats()
+
+	// Assert
+	assert.Equal(t, memHqBank, bank.withoutRevision())
+	assert.Equal(t, []Bank{memBranchBank}, withoutRevisions(branches))
+	assert.ErrorIs(t, missingErr, sql.ErrNoRows)
+	assert.Equal(t, before.Hits+3, after.Hits)
+	assert.Equal(t, before.Misses+1, after.Misses)
+}
+
+func TestCachedRepositoryCountryPages(t *testing.T) {
+	// Arrange
+	inner, err := NewMemoryRepository([]Bank{memHqBank, memBranchBank, memOtherBank})
+	require.NoError(t, err)
+	repo := NewCachedRepository(inner, 100, time.Hour)
+
+	for _, after := range []string{"", "AAAAPLPW001", "AAAAPLPW002", "AAAAPLPWXXX"} {
+		for _, limit := range []int{1, 2, 3} {
+			// Act
+			expected, err := inner.GetBanksInCountryPage("PL", after, limit)
+			require.NoError(t, err)
+			actual, err := repo.GetBanksInCountryPage("PL", after, limit)
+			require.NoError(t, err)
+
+			// Assert
+			assert.Equal(t, expected, actual, "after %s, limit %d", after, limit)
+		}
+	}
+	assert.Equal(t, 12, repo.CacheStats().Entries, "only the pages are cached")
+	_, err = repo.GetBanksInCountryPage("PL", "", 1)
+	require.NoError(t, err)
+	assert.Equal(t, uint64(1), repo.CacheStats().Hits)
+}
+
+func TestCachedRepositoryLongLists(t *testing.T) {
+	// Arrange
+	banks := make([]Bank, maxCachedBanks+1)
+	for i := range banks {
+		banks[i] = Bank{SwiftCode: fmt.Sprintf("%04dDEFFXXX", i), IsHeadquarter: true, CountryISO2Code: "DE", CountryName: "GERMANY"}
+	}
+	repo := newTestCachedRepository(t, banks...)
+
+	// Act
+	country, err := repo.GetBanksInCountry("DE")
+	require.NoError(t, err)
+	page, err := repo.GetBanksInCountryPage("DE", "", maxCachedBanks)
+	require.NoError(t, err)
+
+	// Assert
+	assert.Len(t, country, maxCachedBanks+1)
+	assert.Len(t, page, maxCachedBanks)
+	assert.Equal(t, 1, repo.CacheStats().Entries, "only the page fits")
+}
+
+// Blocks the first GetBank until released, to make a read overlap a write
+type blockingRepository struct {
+	BankRepository
+	blocked atomic.Bool
+	reading chan struct{}
+	release chan struct{}
+}
+
+func (r *blockingRepository) GetBank(swiftCode string) (Bank, error) {
+	bank, err := r.BankRepository.GetBank(swiftCode)
+	if r.blocked.CompareAndSwap(false, true) {
+		r.reading <- struct{}{}
+		<-r.release
+	}
+	return bank, err
+}
+
+func TestCachedRepositoryReadRacingInvalidation(t *testing.T) {
+	// Arrange
+	inner, err := NewMemoryRepository([]Bank{memOtherBank})
+	require.NoError(t, err)
+	blocking := &blockingRepository{BankRepository: inner, reading: make(chan struct{}), release: make(chan struct{})}
+	repo := NewCachedRepository(blocking, 100, time.Hour)
+	updated := memOtherBank
+	updated.BankName = "Renamed"
+
+	// Act
+	read := make(chan Bank)
+	go func() {
+		bank, _ := repo.GetBank(memOtherBank.SwiftCode)
+		read <- bank
+	}()
+	<-blocking.reading
+	// The read got the bank before the update, and caches it after the update invalidated it
+	require.NoError(t, repo.UpdateBank(updated, testAudit))
+	close(blocking.release)
+	stale := <-read
+	bank, err := repo.GetBank(memOtherBank.SwiftCode)
+	require.NoError(t, err)
+
+	// Assert
+	assert.Equal(t, memOtherBank.BankName, stale.BankName)
+	assert.Equal(t, updated.BankName, bank.BankName, "the stale read isn't cached")
+}
+
+func TestCachedRepositoryInvalidation(t *testing.T) {
+	newBranch := Bank{
+		SwiftCode:       "AAAAPLPW002",
+		HqSwiftCode:     sql.NullString{String: memHqBank.SwiftCode, Valid: true},
+		BankName:        "Warsaw Bank",
+		Address:         "Pulawska 3",
+		TownName:        "WARSZAWA",
+		CountryISO2Code: "PL",
+		CountryName:     "POLAND",
+	}
+
+	t.Run("insert branch", func(t *testing.T) {
+		// Arrange
+		repo := newTestCachedRepository(t, memHqBank, memBranchBank, memOtherBank)
+		warmCache(t, repo, memHqBank.SwiftCode, newBranch.SwiftCode, memOtherBank.SwiftCode)
+		hqBefore, err := repo.GetBank(memHqBank.SwiftCode)
+		require.NoError(t, err)
+		hits := repo.CacheStats().Hits
+
+		// Act
+		require.NoError(t, repo.InsertBank(newBranch, testAudit))
+
+		// Assert
+		bank, err := repo.GetBank(newBranch.SwiftCode)
+		require.NoError(t, err)
+		assert.Equal(t, newBranch, bank.withoutRevision())
+		branches, err := repo.GetBankBranches(memHqBank.SwiftCode)
+		require.NoError(t, err)
+		assert.Len(t, branches, 2)
+		pl, err := repo.GetBanksInCountry("PL")
+		require.NoError(t, err)
+		assert.Len(t, pl, 3)
+		hq, err := repo.GetBank(memHqBank.SwiftCode)
+		require.NoError(t, err)
+		assert.Equal(t, hqBefore.Version+1, hq.Version, "the new branch gives the HQ a new version")
+		assert.Equal(t, hits, repo.CacheStats().Hits, "affected entries are invalidated")
+
+		// Other entries are kept
+		_, err = repo.GetBank(memOtherBank.SwiftCode)
+		require.NoError(t, err)
+		_, err = repo.GetBanksInCountry("GB")
+		require.NoError(t, err)
+		assert.Equal(t, hits+2, repo.CacheStats().Hits)
+	})
+
+	t.Run("insert hq links branches", func(t *testing.T) {
+		// Arrange
+		repo := newTestCachedRepository(t, orphan(memBranchBank), memOtherBank)
+		warmCache(t, repo, memHqBank.SwiftCode, memBranchBank.SwiftCode)
+
+		// Act
+		linked, err := repo.InsertHqBank(memHqBank, testAudit)
+		require.NoError(t, err)
+		require.Equal(t, int64(1), linked)
+
+		// Assert
+		branch, err := repo.GetBank(memBranchBank.SwiftCode)
+		require.NoError(t, err)
+		assert.Equal(t, memBranchBank.HqSwiftCode, branch.HqSwiftCode)
+		branches, err := repo.GetBankBranches(memHqBank.SwiftCode)
+		require.NoError(t, err)
+		assert.Equal(t, []Bank{memBranchBank}, withoutRevisions(branches))
+		pl, err := repo.GetBanksInCountry("PL")
+		require.NoError(t, err)
+		assert.Contains(t, withoutRevisions(pl), memBranchBank)
+	})
+
+	t.Run("update moves country", func(t *testing.T) {
+		// Arrange
+		repo := newTestCachedRepository(t, memHqBank, memBranchBank, memOtherBank)
+		warmCache(t, repo, memHqBank.SwiftCode, memBranchBank.SwiftCode)
+		updated := memBranchBank
+		updated.CountryISO2Code = "GB"
+		updated.CountryName = "UNITED KINGDOM"
+
+		// Act
+		require.NoError(t, repo.UpdateBank(updated, testAudit))
+
+		// Assert
+		bank, err := repo.GetBank(updated.SwiftCode)
+		require.NoError(t, err)
+		assert.Equal(t, "GB", bank.CountryISO2Code)
+		branches, err := repo.GetBankBranches(memHqBank.SwiftCode)
+		require.NoError(t, err)
+		assert.Equal(t, []Bank{updated}, withoutRevisions(branches))
+		pl, err := repo.GetBanksInCountry("PL")
+		require.NoError(t, err)
+		assert.Len(t, pl, 1)
+		gb, err := repo.GetBanksInCountry("GB")
+		require.NoError(t, err)
+		assert.Len(t, gb, 2)
+	})
+
+	t.Run("delete and restore hq", func(t *testing.T) {
+		// Arrange
+		repo := newTestCachedRepository(t, memHqBank, memBranchBank, memOtherBank)
+		warmCache(t, repo, memHqBank.SwiftCode, memBranchBank.SwiftCode)
+
+		// Act & Assert
+		require.NoError(t, repo.DeleteBank(memHqBank.SwiftCode, 0, testAudit))
+		_, err := repo.GetBank(memHqBank.SwiftCode)
+		assert.ErrorIs(t, err, sql.ErrNoRows)
+		branch, err := repo.GetBank(memBranchBank.SwiftCode)
+		require.NoError(t, err)
+		assert.False(t, branch.HqSwiftCode.Valid)
+		pl, err := repo.GetBanksInCountry("PL")
+		require.NoError(t, err)
+		assert.Equal(t, []Bank{orphan(memBranchBank)}, withoutRevisions(pl))
+
+		linked, err := repo.RestoreBank(memHqBank.SwiftCode, 0, testAudit)
+		require.NoError(t, err)
+		require.Equal(t, int64(1), linked)
+		hq, err := repo.GetBank(memHqBank.SwiftCode)
+		require.NoError(t, err)
+		assert.Equal(t, memHqBank.SwiftCode, hq.SwiftCode)
+		branch, err = repo.GetBank(memBranchBank.SwiftCode)
+		require.NoError(t, err)
+		assert.Equal(t, memBranchBank.HqSwiftCode, branch.HqSwiftCode)
+		branches, err := repo.GetBankBranches(memHqBank.SwiftCode)
+		require.NoError(t, err)
+		assert.Len(t, branches, 1)
+	})
+
+	t.Run("delete branch", func(t *testing.T) {
+		// Arrange
+		repo := newTestCachedRepository(t, memHqBank, memBranchBank, memOtherBank)
+		warmCache(t, repo, memHqBank.SwiftCode, memBranchBank.SwiftCode)
+
+		// Act
+		require.NoError(t, repo.DeleteBank(memBranchBank.SwiftCode, 0, testAudit))
+
+		// Assert
+		branches, err := repo.GetBankBranches(memHqBank.SwiftCode)
+		require.NoError(t, err)
+		assert.Empty(t, branches)
+		pl, err := repo.GetBanksInCountry("PL")
+		require.NoError(t, err)
+		assert.Len(t, pl, 1)
+	})
+
+	t.Run("batch", func(t *testing.T) {
+		// Arrange
+		repo := newTestCachedRepository(t, orphan(memBranchBank), memOtherBank)
+		warmCache(t, repo, memHqBank.SwiftCode, memBranchBank.SwiftCode, newBranch.SwiftCode)
+
+		// Act
+		_, committed, err := repo.InsertBankBatch([]Bank{memHqBank, newBranch, memOtherBank}, false, testAudit)
+		require.NoError(t, err)
+		require.True(t, committed)
+
+		// Assert
+		branches, err := repo.GetBankBranches(memHqBank.SwiftCode)
+		require.NoError(t, err)
+		assert.Len(t, branches, 2)
+		branch, err := repo.GetBank(memBranchBank.SwiftCode)
+		require.NoError(t, err)
+		assert.True(t, branch.HqSwiftCode.Valid)
+	})
+}
@@ -5,11 +5,17 @@ import (
 
 	"github.com/jmoiron/sqlx"
 	"github.com/lib/pq"
+	sqlite3 "modernc.org/sqlite/lib"
 )
 
 const (
 	ForeignKeyViolationErrorCode = pq.ErrorCode("23503")
 	UniqueViolationErrorCode     = pq.ErrorCode("23505")
+
+	// SQLite extended result codes for the same violations, a duplicate primary key has its own code
+	SqliteForeignKeyViolationErrorCode = sqlite3.SQLITE_CONSTRAINT_FOREIGNKEY
+	SqlitePrimaryKeyViolationErrorCode = sqlite3.SQLITE_CONSTRAINT_PRIMARYKEY
+	SqliteUniqueViolationErrorCode     = sqlite3.SQLITE_CONSTRAINT_UNIQUE
 )
 
 const Port = "5432"
@@ -31,6 +37,7 @@ func Connect(user string, password string, dbName string, host string, port stri
 	return db, nil
 }
 
+// Soft deleted banks count too, their SWIFT codes are still taken
 func IsEmpty(db *sqlx.DB) (bool, error) {
 	var count int
 
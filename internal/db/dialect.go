@@ -0,0 +1,63 @@
+package db
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+)
+
+// SQL which differs between Postgres and SQLite, everything else is written so both understand it
+type dialect struct {
+	lockBankTable string // Empty if write transactions already lock the whole database
+	lockRows      string // Ends SELECTs of rows which the transaction changes later, empty like lockBankTable
+	codesParam    string // Matches %s against a list of codes passed with codesArg
+	codesArg      func(codes []string) any
+	mapError      func(err error) error // Maps constraint violations to ErrAlreadyExists and ErrHqNotFound
+	setAudit      string                // Makes the bank_history triggers record $1 as the actor and $2 as the source
+	clearAudit    string                // Run before committing, empty if the audit only lasts until the end of the transaction
+}
+
+var postgresDialect = dialect{
+	lockBankTable: "LOCK TABLE bank IN EXCLUSIVE MODE;",
+	lockRows:      " FOR UPDATE",
+	codesParam:    "%s=ANY($1)",
+	codesArg:      func(codes []string) any { return pq.Array(codes) },
+	mapError:      mapPgError,
+	setAudit:      "SELECT set_config('swiftapi.actor', $1, true), set_config('swiftapi.source', $2, true);",
+	clearAudit:    "",
+}
+
+var sqliteDialect = dialect{
+	lockBankTable: "", // Transactions are opened with BEGIN IMMEDIATE, see ConnectSqlite
+	lockRows:      "",
+	codesParam:    "%s IN (SELECT value FROM json_each($1))",
+	codesArg: func(codes []string) any {
+		if codes == nil {
+			return "[]"
+		}
+		// Can't fail for strings
+		codesJson, _ := json.Marshal(codes)
+		return string(codesJson)
+	},
+	mapError:   mapSqliteError,
+	setAudit:   "INSERT OR REPLACE INTO bank_history_context (id, actor, source) VALUES (1, $1, $2);",
+	clearAudit: "DELETE FROM bank_history_context;",
+}
+
+func dialectOf(db *sqlx.DB) dialect {
+	if db.DriverName() == sqliteDriver {
+		return sqliteDialect
+	}
+	return postgresDialect
+}
+
+func (d dialect) inCodes(column string) string {
+	return fmt.Sprintf(d.codesParam, column)
+}
+
+func (d dialect) isUniqueViolation(err error) bool {
+	return errors.Is(d.mapError(err), ErrAlreadyExists)
+}
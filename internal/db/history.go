@@ -0,0 +1,51 @@
+package db
+
+import (
+	"github.com/jmoiron/sqlx"
+)
+
+// Changes to the bank table are recorded in bank_history by triggers (see the migrations),
+// these transactions tell them who made the change
+type auditedTx struct {
+	*sqlx.Tx
+	d dialect
+}
+
+func beginAudited(db *sqlx.DB, audit Audit) (*auditedTx, error) {
+	d := dialectOf(db)
+	tx, err := db.Beginx()
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = tx.Exec(d.setAudit, audit.Actor, audit.Source)
+	if err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+
+	return &auditedTx{Tx: tx, d: d}, nil
+}
+
+func (tx *auditedTx) Commit() error {
+	if tx.d.clearAudit != "" {
+		_, err := tx.Exec(tx.d.clearAudit)
+		if err != nil {
+			return err
+		}
+	}
+
+	return tx.Tx.Commit()
+}
+
+// Returns all changes to the bank, latest first. Empty if it never existed.
+func GetBankHistory(db *sqlx.DB, swiftCode string) ([]BankHistory, error) {
+	var history []BankHistory
+
+	err := db.Select(&history, "SELECT * FROM bank_history WHERE swift_code=$1 ORDER BY id DESC;", swiftCode)
+	if err != nil {
+		return nil, err
+	}
+
+	return history, nil
+}
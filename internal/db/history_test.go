@@ -0,0 +1,52 @@
+package db
+
+import (
+	"testing"
+
+	"github.com/mwojtyna/swift-api/internal/utils"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGetBankHistory(t *testing.T) {
+	t.Parallel()
+	utils.TestWithPostgres(func(args utils.TestWithPostgresArgs) {
+		db, err := Connect(args.Env.DB_USER, args.Env.DB_PASS, args.Env.DB_NAME, args.Env.DB_HOST, args.Port)
+		require.NoError(t, err)
+		t.Cleanup(func() {
+			db.Close()
+		})
+
+		// Arrange
+		editor := Audit{Actor: "editor", Source: HistorySourceApi}
+		updated := hqBank
+		updated.BankName = "Renamed"
+
+		// Act
+		require.NoError(t, InsertBank(db, hqBank, editor))
+		require.NoError(t, UpdateBank(db, updated, editor))
+		require.NoError(t, UpdateBank(db, updated, editor)) // Nothing changes, so nothing is recorded
+		require.NoError(t, DeleteBank(db, hqBank.SwiftCode, 0, Audit{}))
+
+		// Assert
+		history, err := GetBankHistory(db, hqBank.SwiftCode)
+		require.NoError(t, err)
+		require.Len(t, history, 3)
+
+		assert.Equal(t, HistoryOperationDelete, history[0].Operation)
+		assert.Equal(t, unknownAuditValue, history[0].Actor)
+		assert.Equal(t, unknownAuditValue, history[0].Source)
+		assert.Equal(t, BankSnapshot(updated), *history[0].Before)
+		assert.Nil(t, history[0].After)
+
+		assert.Equal(t, HistoryOperationUpdate, history[1].Operation)
+		assert.Equal(t, editor.Actor, history[1].Actor)
+		assert.Equal(t, BankSnapshot(hqBank), *history[1].Before)
+		assert.Equal(t, BankSnapshot(updated), *history[1].After)
+
+		assert.Equal(t, HistoryOperationInsert, history[2].Operation)
+		assert.Equal(t, HistorySourceApi, history[2].Source)
+		assert.Nil(t, history[2].Before)
+		assert.Equal(t, BankSnapshot(hqBank), *history[2].After)
+	})
+}
@@ -0,0 +1,76 @@
+package db
+
+import (
+	"iter"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+)
+
+// Streams banks into the DB with COPY FROM in a single transaction, returns how many were inserted.
+// Banks can come in any order. Branches are only linked to HQs which were loaded too or already are in the DB,
+// the rest are inserted without an HQ. SWIFT codes must be unique, importers reject repeated ones before they get here.
+// Stops at the first error from the iterator and inserts nothing.
+func LoadBanks(db *sqlx.DB, banks iter.Seq2[Bank, error], audit Audit) (int64, error) {
+	tx, err := beginAudited(db, audit)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	// Copy into a table without constraints first, so HQs don't have to come before their branches
+	_, err = tx.Exec("CREATE TEMP TABLE bank_import (LIKE bank INCLUDING DEFAULTS) ON COMMIT DROP;")
+	if err != nil {
+		return 0, err
+	}
+
+	stmt, err := tx.Prepare(pq.CopyIn("bank_import",
+		"swift_code", "hq_swift_code", "is_headquarter", "bank_name", "address", "town_name", "country_iso2_code", "country_name"))
+	if err != nil {
+		return 0, err
+	}
+	defer stmt.Close()
+
+	for b, err := range banks {
+		if err != nil {
+			return 0, err
+		}
+
+		_, err = stmt.Exec(b.SwiftCode, b.HqSwiftCode, b.IsHeadquarter, b.BankName, b.Address, b.TownName, b.CountryISO2Code, b.CountryName)
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	// Flush buffered rows
+	_, err = stmt.Exec()
+	if err != nil {
+		return 0, err
+	}
+	err = stmt.Close()
+	if err != nil {
+		return 0, err
+	}
+
+	// EDGE CASE: Remove bank's hq_code if HQ doesn't exist (e.g. ALBPPLP1XXX doesn't exist, but ALBPPLP1BMW does)
+	res, err := tx.Exec(`
+		INSERT INTO bank (swift_code, hq_swift_code, is_headquarter, bank_name, address, town_name, country_iso2_code, country_name)
+		SELECT i.swift_code, hq.swift_code, i.is_headquarter, i.bank_name, i.address, i.town_name, i.country_iso2_code, i.country_name
+		FROM bank_import AS i
+		LEFT JOIN (SELECT swift_code FROM bank_import UNION SELECT swift_code FROM bank WHERE deleted_at IS NULL) AS hq ON hq.swift_code=i.hq_swift_code;
+		`)
+	if err != nil {
+		return 0, err
+	}
+	inserted, err := res.RowsAffected()
+	if err != nil {
+		return 0, err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return 0, err
+	}
+
+	return inserted, nil
+}
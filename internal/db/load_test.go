@@ -0,0 +1,113 @@
+package db
+
+import (
+	"database/sql"
+	"errors"
+	"iter"
+	"testing"
+
+	"github.com/mwojtyna/swift-api/internal/utils"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLoadBanks(t *testing.T) {
+	t.Parallel()
+	utils.TestWithPostgres(func(args utils.TestWithPostgresArgs) {
+		db, err := Connect(args.Env.DB_USER, args.Env.DB_PASS, args.Env.DB_NAME, args.Env.DB_HOST, args.Port)
+		require.NoError(t, err)
+		t.Cleanup(func() {
+			db.Close()
+		})
+
+		t.Run("branches before their HQ", func(t *testing.T) {
+			// Arrange
+			t.Cleanup(func() {
+				truncateBanks(db)
+			})
+
+			// Act
+			inserted, err := LoadBanks(db, seqOf(syncBranch, syncHq), testAudit)
+
+			// Assert
+			require.NoError(t, err)
+			assert.Equal(t, int64(2), inserted)
+
+			var banks []Bank
+			err = db.Select(&banks, "SELECT * FROM bank ORDER BY swift_code")
+			require.NoError(t, err)
+			assert.Equal(t, []Bank{syncBranch, syncHq}, withoutRevisions(banks))
+		})
+
+		t.Run("branch of an HQ already in the DB", func(t *testing.T) {
+			// Arrange
+			err := insertBank(db, syncHq)
+			require.NoError(t, err)
+			t.Cleanup(func() {
+				truncateBanks(db)
+			})
+
+			// Act
+			inserted, err := LoadBanks(db, seqOf(syncBranch), testAudit)
+
+			// Assert
+			require.NoError(t, err)
+			assert.Equal(t, int64(1), inserted)
+
+			bank, err := GetBank(db, syncBranch.SwiftCode)
+			require.NoError(t, err)
+			assert.Equal(t, syncBranch, bank.withoutRevision())
+		})
+
+		t.Run("branch without HQ isn't linked", func(t *testing.T) {
+			// Arrange
+			t.Cleanup(func() {
+				truncateBanks(db)
+			})
+
+			// Act
+			_, err := LoadBanks(db, seqOf(syncBranch), testAudit)
+
+			// Assert
+			require.NoError(t, err)
+
+			bank, err := GetBank(db, syncBranch.SwiftCode)
+			require.NoError(t, err)
+			assert.Equal(t, sql.NullString{}, bank.HqSwiftCode)
+		})
+
+		t.Run("iterator error inserts nothing", func(t *testing.T) {
+			// Arrange
+			t.Cleanup(func() {
+				truncateBanks(db)
+			})
+			iterErr := errors.New("invalid row")
+			banks := func(yield func(Bank, error) bool) {
+				if !yield(syncHq, nil) {
+					return
+				}
+				yield(Bank{}, iterErr)
+			}
+
+			// Act
+			_, err := LoadBanks(db, banks, testAudit)
+
+			// Assert
+			assert.ErrorIs(t, err, iterErr)
+
+			empty, err := IsEmpty(db)
+			require.NoError(t, err)
+			assert.True(t, empty)
+		})
+	})
+}
+
+func seqOf(banks ...Bank) iter.Seq2[Bank, error] {
+	return func(yield func(Bank, error) bool) {
+		for _, b := range banks {
+			if !yield(b, nil) {
+				return
+			}
+		}
+	}
+}
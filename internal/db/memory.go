@@ -0,0 +1,538 @@
+package db
+
+import (
+	"cmp"
+	"database/sql"
+	"fmt"
+	"iter"
+	"maps"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mwojtyna/swift-api/internal/bic"
+)
+
+// Keeps all banks in memory, for running without a database in demos and tests. Safe for concurrent use.
+// Behaves like PostgresRepository, except that search only ranks prefix and substring matches, there's no fuzzy matching.
+type MemoryRepository struct {
+	mu      sync.RWMutex
+	banks   map[string]Bank
+	deleted map[string]Bank // Soft deleted banks, kept apart so reads don't have to skip them
+	history []BankHistory   // Oldest first
+}
+
+// Banks are expected in the order parser.ParseCsv returns them, HQs before their branches. They're recorded
+// in the history as imported by an unknown actor.
+// Returns an error for duplicate SWIFT codes and branches whose HQ isn't among the banks.
+func NewMemoryRepository(banks []Bank) (*MemoryRepository, error) {
+	r := &MemoryRepository{banks: make(map[string]Bank, len(banks)), deleted: make(map[string]Bank)}
+
+	c := r.change(Audit{Source: HistorySourceImport})
+	for _, bank := range banks {
+		err := c.insert(bank)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %s", err, bank.SwiftCode)
+		}
+	}
+	r.apply(c)
+
+	return r, nil
+}
+
+func (r *MemoryRepository) GetBank(swiftCode string) (Bank, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	bank, ok := r.banks[swiftCode]
+	if !ok {
+		return Bank{}, sql.ErrNoRows
+	}
+
+	return bank, nil
+}
+
+func (r *MemoryRepository) GetDeletedBank(swiftCode string) (Bank, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	bank, ok := r.deleted[swiftCode]
+	if !ok {
+		return Bank{}, sql.ErrNoRows
+	}
+
+	return bank, nil
+}
+
+func (r *MemoryRepository) GetBankBranches(swiftCode string) ([]Bank, error) {
+	return r.filter(func(b Bank) bool {
+		return b.HqSwiftCode.Valid && b.HqSwiftCode.String == swiftCode
+	}), nil
+}
+
+func (r *MemoryRepository) GetBanksWithBranches(swiftCodes []string) ([]Bank, error) {
+	codes := make(map[string]struct{}, len(swiftCodes))
+	for _, code := range swiftCodes {
+		codes[code] = struct{}{}
+	}
+
+	return r.filter(func(b Bank) bool {
+		_, ok := codes[b.SwiftCode]
+		_, hqOk := codes[b.HqSwiftCode.String]
+		return ok || (b.HqSwiftCode.Valid && hqOk)
+	}), nil
+}
+
+func (r *MemoryRepository) GetBanksInCountry(countryCode string) ([]Bank, error) {
+	return r.filter(func(b Bank) bool {
+		return b.CountryISO2Code == countryCode
+	}), nil
+}
+
+func (r *MemoryRepository) GetBanksInCountryPage(countryCode string, after string, limit int) ([]Bank, error) {
+	banks := r.filter(func(b Bank) bool {
+		return b.CountryISO2Code == countryCode && b.SwiftCode > after
+	})
+
+	return banks[:min(limit, len(banks))], nil
+}
+
+func (r *MemoryRepository) SearchBanks(query string, limit int) ([]BankSearchResult, error) {
+	query = strings.ToLower(query)
+
+	var results []BankSearchResult
+	for _, bank := range r.filter(func(Bank) bool { return true }) {
+		rank := searchRank(query, bank)
+		if rank > 0 {
+			results = append(results, BankSearchResult{Bank: bank, Rank: rank})
+		}
+	}
+
+	// Banks are already sorted by SWIFT code and the sort is stable
+	slices.SortStableFunc(results, byRankDesc)
+
+	return results[:min(limit, len(results))], nil
+}
+
+// Same ranking as SearchBanks without the trigram part: 2 for a prefix match, 1 for a substring match,
+// plus the part of the field the query covers to break ties. 0 if nothing matches.
+func searchRank(query string, bank Bank) float64 {
+	best := 0.0
+	for _, field := range []string{bank.BankName, bank.Address, bank.TownName} {
+		field = strings.ToLower(field)
+
+		var rank float64
+		if strings.HasPrefix(field, query) {
+			rank = 2
+		} else if strings.Contains(field, query) {
+			rank = 1
+		} else {
+			continue
+		}
+		rank += float64(len(query)) / float64(len(field))
+
+		best = max(best, rank)
+	}
+
+	return best
+}
+
+func byRankDesc(a, b BankSearchResult) int {
+	return cmp.Compare(b.Rank, a.Rank)
+}
+
+// Takes a snapshot of the matching banks, so the repository can be used while iterating
+func (r *MemoryRepository) StreamBanks(filter BankFilter) iter.Seq2[Bank, error] {
+	return func(yield func(Bank, error) bool) {
+		banks := r.filter(func(b Bank) bool {
+			return (filter.CountryISO2Code == "" || b.CountryISO2Code == filter.CountryISO2Code) && (!filter.HqOnly || b.IsHeadquarter)
+		})
+
+		for _, bank := range banks {
+			if !yield(bank, nil) {
+				return
+			}
+		}
+	}
+}
+
+func (r *MemoryRepository) CheckBankHqExists(hqSwiftCode string) (bool, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	_, ok := r.banks[hqSwiftCode]
+	return ok, nil
+}
+
+func (r *MemoryRepository) InsertBank(bank Bank, audit Audit) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	c := r.change(audit)
+	err := c.insert(bank)
+	if err != nil {
+		return err
+	}
+
+	r.apply(c)
+	return nil
+}
+
+func (r *MemoryRepository) InsertHqBank(bank Bank, audit Audit) (int64, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	c := r.change(audit)
+	err := c.insert(bank)
+	if err != nil {
+		return 0, err
+	}
+	linked := c.linkOrphans(bank.SwiftCode)
+
+	r.apply(c)
+	return linked, nil
+}
+
+// See InsertBankBatch. Changes are made on a copy, which replaces the banks once the batch is committed.
+func (r *MemoryRepository) InsertBankBatch(banks []Bank, atomic bool, audit Audit) ([]BatchInsertResult, bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	c := r.change(audit)
+	c.banks = maps.Clone(r.banks)
+	c.deleted = maps.Clone(r.deleted)
+	results := make([]BatchInsertResult, len(banks))
+	failed := false
+
+	// HQs first, so branches in the same batch can be linked to them
+	for i, bank := range banks {
+		if !bank.IsHeadquarter {
+			continue
+		}
+
+		if c.exists(bank.SwiftCode) {
+			results[i].Duplicate = true
+			failed = true
+			continue
+		}
+		c.insert(bank)
+		results[i].LinkedBranches = c.linkOrphans(bank.SwiftCode)
+	}
+
+	for i, bank := range banks {
+		if bank.IsHeadquarter {
+			continue
+		}
+
+		if c.exists(bank.SwiftCode) {
+			results[i].Duplicate = true
+			failed = true
+			continue
+		}
+		if _, ok := c.banks[bank.HqSwiftCode.String]; !ok {
+			bank.HqSwiftCode = sql.NullString{}
+		}
+		c.insert(bank)
+	}
+
+	if atomic && failed {
+		return results, false, nil
+	}
+
+	r.apply(c)
+	return results, true, nil
+}
+
+func (r *MemoryRepository) UpdateBank(bank Bank, audit Audit) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	existing, ok := r.banks[bank.SwiftCode]
+	if !ok {
+		return sql.ErrNoRows
+	}
+	if err := existing.checkVersion(bank.Version); err != nil {
+		return err
+	}
+
+	existing.BankName = bank.BankName
+	existing.Address = bank.Address
+	existing.CountryISO2Code = bank.CountryISO2Code
+	existing.CountryName = bank.CountryName
+
+	c := r.change(audit)
+	c.update(existing)
+	r.apply(c)
+
+	return nil
+}
+
+func (r *MemoryRepository) DeleteBank(swiftCode string, version int64, audit Audit) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	bank, ok := r.banks[swiftCode]
+	if !ok {
+		return sql.ErrNoRows
+	}
+	if err := bank.checkVersion(version); err != nil {
+		return err
+	}
+
+	c := r.change(audit)
+	c.delete(swiftCode)
+	r.apply(c)
+
+	return nil
+}
+
+// See RestoreBank
+func (r *MemoryRepository) RestoreBank(swiftCode string, version int64, audit Audit) (int64, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	bank, ok := r.deleted[swiftCode]
+	if !ok {
+		return 0, r.notDeletedError(swiftCode)
+	}
+	if err := bank.checkVersion(version); err != nil {
+		return 0, err
+	}
+
+	bank = touched(bank, bank)
+	bank.DeletedAt = sql.NullTime{}
+	if !bank.IsHeadquarter && !bank.HqSwiftCode.Valid && len(swiftCode) == bic.Bic11Len {
+		hqSwiftCode := swiftCode[:bic.Bic8Len] + bic.PrimaryOfficeBranchCode
+		if _, ok := r.banks[hqSwiftCode]; ok {
+			bank.HqSwiftCode = sql.NullString{String: hqSwiftCode, Valid: true}
+		}
+	}
+
+	c := r.change(audit)
+	delete(c.deleted, swiftCode)
+	c.banks[swiftCode] = bank
+	c.record(HistoryOperationRestore, nil, &bank)
+	var linked int64
+	if bank.IsHeadquarter {
+		linked = c.linkOrphans(swiftCode)
+	}
+	r.apply(c)
+
+	return linked, nil
+}
+
+func (r *MemoryRepository) PurgeBank(swiftCode string, version int64, audit Audit) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	bank, ok := r.deleted[swiftCode]
+	if !ok {
+		return r.notDeletedError(swiftCode)
+	}
+	if err := bank.checkVersion(version); err != nil {
+		return err
+	}
+
+	c := r.change(audit)
+	delete(c.deleted, swiftCode)
+	c.record(HistoryOperationPurge, &bank, nil)
+	r.apply(c)
+
+	return nil
+}
+
+// For banks which aren't soft deleted
+func (r *MemoryRepository) notDeletedError(swiftCode string) error {
+	if _, ok := r.banks[swiftCode]; ok {
+		return ErrNotDeleted
+	}
+	return sql.ErrNoRows
+}
+
+func (r *MemoryRepository) GetBankHistory(swiftCode string) ([]BankHistory, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	var history []BankHistory
+	for _, entry := range slices.Backward(r.history) {
+		if entry.SwiftCode == swiftCode {
+			history = append(history, entry)
+		}
+	}
+
+	return history, nil
+}
+
+// Returns matching banks ordered by SWIFT code
+func (r *MemoryRepository) filter(match func(Bank) bool) []Bank {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	var banks []Bank
+	for _, bank := range r.banks {
+		if match(bank) {
+			banks = append(banks, bank)
+		}
+	}
+	slices.SortFunc(banks, func(a, b Bank) int {
+		return strings.Compare(a.SwiftCode, b.SwiftCode)
+	})
+
+	return banks
+}
+
+// Changes to the banks, each one recorded in the history like the bank_history triggers do.
+// The caller must hold the write lock until the changes are applied or discarded.
+type memoryChange struct {
+	banks   map[string]Bank
+	deleted map[string]Bank
+	history []BankHistory
+	audit   Audit
+}
+
+// Changes banks in place, unless the caller replaces the maps with copies
+func (r *MemoryRepository) change(audit Audit) *memoryChange {
+	// Clipped, so appending never writes to the repository's history before it's applied
+	return &memoryChange{banks: r.banks, deleted: r.deleted, history: slices.Clip(r.history), audit: audit}
+}
+
+func (r *MemoryRepository) apply(c *memoryChange) {
+	r.banks = c.banks
+	r.deleted = c.deleted
+	r.history = c.history
+}
+
+// Soft deleted banks' codes are taken too
+func (c *memoryChange) exists(swiftCode string) bool {
+	_, ok := c.banks[swiftCode]
+	_, deletedOk := c.deleted[swiftCode]
+	return ok || deletedOk
+}
+
+// Enforces the primary and foreign keys
+func (c *memoryChange) insert(bank Bank) error {
+	if c.exists(bank.SwiftCode) {
+		return ErrAlreadyExists
+	}
+	if bank.HqSwiftCode.Valid {
+		if _, ok := c.banks[bank.HqSwiftCode.String]; !ok {
+			return ErrHqNotFound
+		}
+	}
+
+	bank.UpdatedAt = time.Now().UTC()
+	bank.Version = 1
+	c.banks[bank.SwiftCode] = bank
+	c.record(HistoryOperationInsert, nil, &bank)
+	return nil
+}
+
+// Unchanged banks aren't recorded and keep their version
+func (c *memoryChange) update(bank Bank) {
+	before := c.banks[bank.SwiftCode]
+	if before.withoutRevision() == bank.withoutRevision() {
+		return
+	}
+
+	bank = touched(before, bank)
+	c.banks[bank.SwiftCode] = bank
+	c.record(HistoryOperationUpdate, &before, &bank)
+}
+
+// Same as softDeleteBanks, branches lose their HQ, deleted ones too
+func (c *memoryChange) delete(swiftCode string) {
+	for _, code := range slices.Sorted(maps.Keys(c.deleted)) {
+		bank := c.deleted[code]
+		if bank.HqSwiftCode.Valid && bank.HqSwiftCode.String == swiftCode {
+			before := bank
+			bank.HqSwiftCode = sql.NullString{}
+			bank = touched(before, bank)
+			c.deleted[code] = bank
+			c.record(HistoryOperationUpdate, &before, &bank)
+		}
+	}
+	for _, code := range slices.Sorted(maps.Keys(c.banks)) {
+		bank := c.banks[code]
+		if bank.HqSwiftCode.Valid && bank.HqSwiftCode.String == swiftCode {
+			bank.HqSwiftCode = sql.NullString{}
+			c.update(bank)
+		}
+	}
+
+	before := c.banks[swiftCode]
+	deleted := touched(before, before)
+	deleted.DeletedAt = sql.NullTime{Time: time.Now().UTC(), Valid: true}
+	delete(c.banks, swiftCode)
+	c.deleted[swiftCode] = deleted
+	c.record(HistoryOperationDelete, &before, nil)
+}
+
+// Same as linkOrphanedBranches
+func (c *memoryChange) linkOrphans(hqSwiftCode string) int64 {
+	var linked int64
+	for _, code := range slices.Sorted(maps.Keys(c.banks)) {
+		bank := c.banks[code]
+		if !bank.HqSwiftCode.Valid && !bank.IsHeadquarter && code != hqSwiftCode && sameHqPrefix(code, hqSwiftCode) {
+			bank.HqSwiftCode = sql.NullString{String: hqSwiftCode, Valid: true}
+			c.update(bank)
+			linked++
+		}
+	}
+
+	return linked
+}
+
+func (c *memoryChange) record(operation string, before *Bank, after *Bank) {
+	entry := BankHistory{
+		ID:        int64(len(c.history) + 1),
+		Operation: operation,
+		ChangedAt: time.Now().UTC(),
+		Actor:     cmp.Or(c.audit.Actor, unknownAuditValue),
+		Source:    cmp.Or(c.audit.Source, unknownAuditValue),
+	}
+	if before != nil {
+		snapshot := BankSnapshot(before.withoutRevision())
+		entry.SwiftCode = before.SwiftCode
+		entry.Before = &snapshot
+	}
+	if after != nil {
+		snapshot := BankSnapshot(after.withoutRevision())
+		entry.SwiftCode = after.SwiftCode
+		entry.After = &snapshot
+	}
+
+	c.history = append(c.history, entry)
+	c.touchHqs(before, after)
+}
+
+// Like the bank_touch_parents trigger, gives the HQs of the changed branch the next version without recording it
+func (c *memoryChange) touchHqs(banks ...*Bank) {
+	var hqSwiftCodes []string
+	for _, bank := range banks {
+		if bank != nil && bank.HqSwiftCode.Valid && !slices.Contains(hqSwiftCodes, bank.HqSwiftCode.String) {
+			hqSwiftCodes = append(hqSwiftCodes, bank.HqSwiftCode.String)
+		}
+	}
+
+	for _, code := range hqSwiftCodes {
+		if hq, ok := c.banks[code]; ok {
+			c.banks[code] = touched(hq, hq)
+		} else if hq, ok := c.deleted[code]; ok {
+			c.deleted[code] = touched(hq, hq)
+		}
+	}
+}
+
+// Gives the changed bank the next version, like the bank_touch trigger
+func touched(before Bank, after Bank) Bank {
+	after.UpdatedAt = time.Now().UTC()
+	after.Version = before.Version + 1
+	return after
+}
+
+// Like SUBSTR(a, 1, 8)=SUBSTR(b, 1, 8)
+func sameHqPrefix(a, b string) bool {
+	const hqPartLen = 8
+	return a[:min(hqPartLen, len(a))] == b[:min(hqPartLen, len(b))]
+}
@@ -0,0 +1,95 @@
+package db
+
+import (
+	"database/sql"
+	"testing"
+
+	"github.com/mwojtyna/swift-api/internal/utils"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var (
+	memHqBank = Bank{
+		SwiftCode:       "AAAAPLPWXXX",
+		IsHeadquarter:   true,
+		BankName:        "Warsaw Bank",
+		Address:         "Marszalkowska 1",
+		TownName:        "WARSZAWA",
+		CountryISO2Code: "PL",
+		CountryName:     "POLAND",
+	}
+	memBranchBank = Bank{
+		SwiftCode:       "AAAAPLPW001",
+		HqSwiftCode:     sql.NullString{String: "AAAAPLPWXXX", Valid: true},
+		BankName:        "Warsaw Bank",
+		Address:         "Pulawska 2",
+		TownName:        "WARSZAWA",
+		CountryISO2Code: "PL",
+		CountryName:     "POLAND",
+	}
+	memOtherBank = Bank{
+		SwiftCode:       "BBBBGB2LXXX",
+		IsHeadquarter:   true,
+		BankName:        "London Bank of Warsaw",
+		Address:         "1 Bank Street",
+		TownName:        "LONDON",
+		CountryISO2Code: "GB",
+		CountryName:     "UNITED KINGDOM",
+	}
+)
+
+func orphan(bank Bank) Bank {
+	bank.HqSwiftCode = sql.NullString{}
+	return bank
+}
+
+// Repositories set UpdatedAt and Version themselves, so they're left out when comparing with the fixtures
+func withoutRevisions(banks []Bank) []Bank {
+	if banks == nil {
+		return nil
+	}
+	return utils.Map(banks, Bank.withoutRevision)
+}
+
+func TestNewMemoryRepository(t *testing.T) {
+	tests := []struct {
+		name    string
+		banks   []Bank
+		wantErr error
+	}{
+		{
+			name:  "valid",
+			banks: []Bank{memHqBank, memBranchBank, memOtherBank},
+		},
+		{
+			name:    "duplicate",
+			banks:   []Bank{memHqBank, memHqBank},
+			wantErr: ErrAlreadyExists,
+		},
+		{
+			name:    "branch before its hq",
+			banks:   []Bank{memBranchBank, memHqBank},
+			wantErr: ErrHqNotFound,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Act
+			repo, err := NewMemoryRepository(tt.banks)
+
+			// Assert
+			if tt.wantErr != nil {
+				assert.ErrorIs(t, err, tt.wantErr)
+				return
+			}
+			require.NoError(t, err)
+			for _, bank := range tt.banks {
+				got, err := repo.GetBank(bank.SwiftCode)
+				require.NoError(t, err)
+				assert.Equal(t, bank, got.withoutRevision())
+			}
+		})
+	}
+}
@@ -2,6 +2,9 @@ package db
 
 import (
 	"database/sql"
+	"encoding/json"
+	"fmt"
+	"time"
 )
 
 type Bank struct {
@@ -10,6 +13,118 @@ type Bank struct {
 	IsHeadquarter   bool           `db:"is_headquarter"`
 	BankName        string         `db:"bank_name"`
 	Address         string         `db:"address"`
+	TownName        string         `db:"town_name"`
 	CountryISO2Code string         `db:"country_iso2_code"`
 	CountryName     string         `db:"country_name"`
+	DeletedAt       sql.NullTime   `db:"deleted_at"` // Only set for soft deleted banks, which reads leave out
+	UpdatedAt       time.Time      `db:"updated_at"` // Set by the DB, like Version
+	Version         int64          `db:"version"`    // Starts at 1, goes up with every change including soft deletes and restores
+}
+
+// The bank without UpdatedAt and Version, for comparing the data regardless of when it was changed
+func (b Bank) withoutRevision() Bank {
+	b.UpdatedAt = time.Time{}
+	b.Version = 0
+	return b
+}
+
+// Returns ErrVersionConflict unless the bank is at the version, which can be 0 for any version
+func (b Bank) checkVersion(version int64) error {
+	if version != 0 && b.Version != version {
+		return ErrVersionConflict
+	}
+	return nil
+}
+
+type BankSearchResult struct {
+	Bank
+	Rank float64 `db:"rank"`
+}
+
+const (
+	HistorySourceApi    = "api"
+	HistorySourceImport = "import"
+)
+
+// Recorded in bank_history instead of an empty actor or source, same as in the triggers
+const unknownAuditValue = "unknown"
+
+// Who makes a change, recorded in bank_history
+type Audit struct {
+	Actor  string
+	Source string // HistorySourceApi or HistorySourceImport
+}
+
+const (
+	HistoryOperationInsert  = "insert"
+	HistoryOperationUpdate  = "update"
+	HistoryOperationDelete  = "delete"  // Soft delete
+	HistoryOperationRestore = "restore" // Of a soft deleted bank
+	HistoryOperationPurge   = "purge"   // Permanent removal of a soft deleted bank
+)
+
+type BankHistory struct {
+	ID        int64         `db:"id"`
+	SwiftCode string        `db:"swift_code"`
+	Operation string        `db:"operation"`
+	ChangedAt time.Time     `db:"changed_at"`
+	Actor     string        `db:"actor"`
+	Source    string        `db:"source"`
+	Before    *BankSnapshot `db:"before"` // nil for inserts and restores
+	After     *BankSnapshot `db:"after"`  // nil for deletes and purges
+}
+
+// A bank as stored in bank_history, JSON with the column names as keys
+type BankSnapshot Bank
+
+type bankSnapshotJson struct {
+	SwiftCode       string  `json:"swift_code"`
+	HqSwiftCode     *string `json:"hq_swift_code"`
+	IsHeadquarter   bool    `json:"is_headquarter"`
+	BankName        string  `json:"bank_name"`
+	Address         string  `json:"address"`
+	TownName        string  `json:"town_name"`
+	CountryISO2Code string  `json:"country_iso2_code"`
+	CountryName     string  `json:"country_name"`
+}
+
+func (s *BankSnapshot) Scan(src any) error {
+	var raw []byte
+	switch v := src.(type) {
+	case []byte:
+		raw = v
+	case string:
+		raw = []byte(v)
+	default:
+		return fmt.Errorf("Can't scan %T into BankSnapshot", src)
+	}
+
+	var v bankSnapshotJson
+	err := json.Unmarshal(raw, &v)
+	if err != nil {
+		return err
+	}
+
+	*s = BankSnapshot{
+		SwiftCode:       v.SwiftCode,
+		IsHeadquarter:   v.IsHeadquarter,
+		BankName:        v.BankName,
+		Address:         v.Address,
+		TownName:        v.TownName,
+		CountryISO2Code: v.CountryISO2Code,
+		CountryName:     v.CountryName,
+	}
+	if v.HqSwiftCode != nil {
+		s.HqSwiftCode = sql.NullString{String: *v.HqSwiftCode, Valid: true}
+	}
+
+	return nil
+}
+
+// An API key as stored in the DB, see internal/auth
+type ApiKey struct {
+	Name      string    `db:"name"`
+	KeyHash   string    `db:"key_hash"` // Hex SHA-256 of the key
+	Role      string    `db:"role"`
+	CreatedAt time.Time `db:"created_at"`
 }
@@ -3,14 +3,31 @@ package db
 import (
 	"database/sql"
 	"errors"
+	"iter"
+	"slices"
+	"strings"
+	"time"
 
 	"github.com/jmoiron/sqlx"
+	"github.com/mwojtyna/swift-api/internal/bic"
 )
 
 func GetBank(db *sqlx.DB, swiftCode string) (Bank, error) {
 	var bank Bank
 
-	err := db.Get(&bank, "SELECT * FROM bank WHERE swift_code=$1;", swiftCode)
+	err := db.Get(&bank, "SELECT * FROM bank WHERE swift_code=$1 AND deleted_at IS NULL;", swiftCode)
+	if err != nil {
+		return Bank{}, err
+	}
+
+	return bank, nil
+}
+
+// Returns sql.ErrNoRows if the bank doesn't exist or isn't deleted
+func GetDeletedBank(db *sqlx.DB, swiftCode string) (Bank, error) {
+	var bank Bank
+
+	err := db.Get(&bank, "SELECT * FROM bank WHERE swift_code=$1 AND deleted_at IS NOT NULL;", swiftCode)
 	if err != nil {
 		return Bank{}, err
 	}
@@ -25,7 +42,7 @@ func GetBankBranches(db *sqlx.DB, swiftCode string) ([]Bank, error) {
 	err := db.Select(&branches, `
 		SELECT b2.* FROM bank AS b1 
 		JOIN bank AS b2 ON b2.hq_swift_code=b1.swift_code
-		WHERE b1.swift_code=$1;
+		WHERE b1.swift_code=$1 AND b1.deleted_at IS NULL AND b2.deleted_at IS NULL;
 		`, swiftCode)
 	if err != nil {
 		return nil, err
@@ -34,10 +51,46 @@ func GetBankBranches(db *sqlx.DB, swiftCode string) ([]Bank, error) {
 	return branches, nil
 }
 
+// Gets the banks with the given codes and the branches of those which are HQs, in one query.
+// Codes which don't exist are left out.
+func GetBanksWithBranches(db *sqlx.DB, swiftCodes []string) ([]Bank, error) {
+	var banks []Bank
+	d := dialectOf(db)
+
+	err := db.Select(&banks, `
+		SELECT * FROM bank
+		WHERE deleted_at IS NULL AND (`+d.inCodes("swift_code")+` OR `+d.inCodes("hq_swift_code")+`)
+		ORDER BY swift_code;
+		`, d.codesArg(swiftCodes))
+	if err != nil {
+		return nil, err
+	}
+
+	return banks, nil
+}
+
 func GetBanksInCountry(db *sqlx.DB, countryCode string) ([]Bank, error) {
 	var banks []Bank
 
-	err := db.Select(&banks, "SELECT * FROM bank WHERE country_iso2_code=$1;", countryCode)
+	err := db.Select(&banks, "SELECT * FROM bank WHERE country_iso2_code=$1 AND deleted_at IS NULL;", countryCode)
+	if err != nil {
+		return nil, err
+	}
+
+	return banks, nil
+}
+
+// Returns at most limit banks with a SWIFT code greater than after, ordered by SWIFT code.
+// Pass an empty after to get the first page.
+func GetBanksInCountryPage(db *sqlx.DB, countryCode string, after string, limit int) ([]Bank, error) {
+	var banks []Bank
+
+	err := db.Select(&banks, `
+		SELECT * FROM bank
+		WHERE country_iso2_code=$1 AND swift_code>$2 AND deleted_at IS NULL
+		ORDER BY swift_code
+		LIMIT $3;
+		`, countryCode, after, limit)
 	if err != nil {
 		return nil, err
 	}
@@ -45,6 +98,74 @@ func GetBanksInCountry(db *sqlx.DB, countryCode string) ([]Bank, error) {
 	return banks, nil
 }
 
+type BankFilter struct {
+	CountryISO2Code string // All countries if empty
+	HqOnly          bool
+}
+
+// Yields matching banks ordered by SWIFT code one at a time, so the whole table never has to fit in memory.
+// The query stays open until iteration ends.
+func StreamBanks(db *sqlx.DB, filter BankFilter) iter.Seq2[Bank, error] {
+	return func(yield func(Bank, error) bool) {
+		rows, err := db.Queryx(`
+			SELECT * FROM bank
+			WHERE ($1='' OR country_iso2_code=$1) AND (NOT $2 OR is_headquarter) AND deleted_at IS NULL
+			ORDER BY swift_code;
+			`, filter.CountryISO2Code, filter.HqOnly)
+		if err != nil {
+			yield(Bank{}, err)
+			return
+		}
+		defer rows.Close()
+
+		for rows.Next() {
+			var bank Bank
+			err := rows.StructScan(&bank)
+			if !yield(bank, err) || err != nil {
+				return
+			}
+		}
+
+		if err := rows.Err(); err != nil {
+			yield(Bank{}, err)
+		}
+	}
+}
+
+// Matches the query against bank name, address and town name. Results are ranked by match type
+// (prefix, then substring, then fuzzy), ties are broken by trigram word similarity.
+func SearchBanks(db *sqlx.DB, query string, limit int) ([]BankSearchResult, error) {
+	var results []BankSearchResult
+
+	err := db.Select(&results, `
+		SELECT * FROM (
+			SELECT *,
+				CASE
+					WHEN bank_name ILIKE $2 || '%' OR address ILIKE $2 || '%' OR town_name ILIKE $2 || '%' THEN 2
+					WHEN bank_name ILIKE '%' || $2 || '%' OR address ILIKE '%' || $2 || '%' OR town_name ILIKE '%' || $2 || '%' THEN 1
+					ELSE 0
+				END + GREATEST(word_similarity($1, bank_name), word_similarity($1, address), word_similarity($1, town_name)) AS rank
+			FROM bank
+			WHERE deleted_at IS NULL AND (bank_name ILIKE '%' || $2 || '%' OR address ILIKE '%' || $2 || '%' OR town_name ILIKE '%' || $2 || '%'
+				OR $1 <% bank_name OR $1 <% address OR $1 <% town_name)
+		) AS matches
+		ORDER BY rank DESC, swift_code
+		LIMIT $3;
+		`, query, escapeLike(query), limit)
+	if err != nil {
+		return nil, err
+	}
+
+	return results, nil
+}
+
+var likeEscaper = strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`)
+
+// Escapes LIKE wildcards so user input is matched literally
+func escapeLike(s string) string {
+	return likeEscaper.Replace(s)
+}
+
 func CheckBankHqExists(db *sqlx.DB, hqSwiftCode string) (bool, error) {
 	_, err := GetBank(db, hqSwiftCode)
 
@@ -60,29 +181,252 @@ func CheckBankHqExists(db *sqlx.DB, hqSwiftCode string) (bool, error) {
 	}
 }
 
-func InsertBank(db *sqlx.DB, bank Bank) error {
-	return InsertBanks(db, []Bank{bank})
+func InsertBank(db *sqlx.DB, bank Bank, audit Audit) error {
+	return InsertBanks(db, []Bank{bank}, audit)
 }
 
-func InsertBanks(db *sqlx.DB, banks []Bank) error {
-	_, err := db.NamedExec(`INSERT INTO bank (swift_code, hq_swift_code, is_headquarter, bank_name, address, country_iso2_code, country_name) 
-		VALUES (:swift_code, :hq_swift_code, :is_headquarter, :bank_name, :address, :country_iso2_code, :country_name);`, banks)
+// Inserts all banks in one transaction, in batches to stay under Postgres' bind parameter limit
+func InsertBanks(db *sqlx.DB, banks []Bank, audit Audit) error {
+	tx, err := beginAudited(db, audit)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	err = execInsertBanks(tx, banks)
 	if err != nil {
 		return err
 	}
 
+	return tx.Commit()
+}
+
+// Inserts an HQ bank and, in the same transaction, links branches with the same 8 character prefix
+// which don't have an HQ yet. Returns how many branches were linked.
+func InsertHqBank(db *sqlx.DB, bank Bank, audit Audit) (int64, error) {
+	tx, err := beginAudited(db, audit)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	err = execInsertBanks(tx, []Bank{bank})
+	if err != nil {
+		return 0, err
+	}
+
+	linked, err := linkOrphanedBranches(tx, bank.SwiftCode)
+	if err != nil {
+		return 0, err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return 0, err
+	}
+
+	return linked, nil
+}
+
+// Branches end up without an HQ when it didn't exist at the time they were added, or when it got deleted.
+// Deleted branches are left alone, they're linked when restored.
+func linkOrphanedBranches(e sqlx.Execer, hqSwiftCode string) (int64, error) {
+	res, err := e.Exec(`UPDATE bank SET hq_swift_code=$1
+		WHERE hq_swift_code IS NULL AND NOT is_headquarter AND swift_code<>$1 AND SUBSTR(swift_code, 1, 8)=SUBSTR($1, 1, 8)
+			AND deleted_at IS NULL;`, hqSwiftCode)
+	if err != nil {
+		return 0, err
+	}
+
+	return res.RowsAffected()
+}
+
+// Postgres allows at most 65535 bind parameters per query, each bank takes 8
+const insertBatchSize = 1000
+
+func execInsertBanks(e sqlx.Ext, banks []Bank) error {
+	for batch := range slices.Chunk(banks, insertBatchSize) {
+		_, err := sqlx.NamedExec(e, `INSERT INTO bank (swift_code, hq_swift_code, is_headquarter, bank_name, address, town_name, country_iso2_code, country_name) 
+			VALUES (:swift_code, :hq_swift_code, :is_headquarter, :bank_name, :address, :town_name, :country_iso2_code, :country_name);`, batch)
+		if err != nil {
+			return err
+		}
+	}
+
 	return nil
 }
 
-func DeleteBank(db *sqlx.DB, swiftCode string) error {
-	// Automatically sets all branches' hq_swift_code to NULL (defined in schema)
-	row := db.QueryRow("DELETE FROM bank WHERE swift_code=$1 RETURNING swift_code;", swiftCode)
+// Updates everything except the SWIFT code and HQ fields, which are derived from the code.
+// If bank.Version isn't 0, the bank is only updated if it's still at that version.
+// Returns sql.ErrNoRows if the bank doesn't exist and ErrVersionConflict if it's at another version.
+func UpdateBank(db *sqlx.DB, bank Bank, audit Audit) error {
+	tx, err := beginAudited(db, audit)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	row := tx.QueryRow(`UPDATE bank SET bank_name=$2, address=$3, country_iso2_code=$4, country_name=$5
+		WHERE swift_code=$1 AND deleted_at IS NULL AND (version=$6 OR $6=0) RETURNING swift_code;`,
+		bank.SwiftCode, bank.BankName, bank.Address, bank.CountryISO2Code, bank.CountryName, bank.Version)
 
 	var returnedCode string
-	err := row.Scan(&returnedCode)
+	err = row.Scan(&returnedCode)
+	if errors.Is(err, sql.ErrNoRows) && bank.Version != 0 {
+		// Tell a missing bank apart from one at another version
+		var exists bool
+		err = tx.Get(&exists, "SELECT COUNT(*) > 0 FROM bank WHERE swift_code=$1 AND deleted_at IS NULL;", bank.SwiftCode)
+		if err != nil {
+			return err
+		}
+		if exists {
+			return ErrVersionConflict
+		}
+		return sql.ErrNoRows
+	}
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// Soft deletes the bank, so it can be restored with RestoreBank. Its branches lose their HQ, like they would
+// if it was removed for good. If version isn't 0, the bank is only deleted if it's still at that version.
+// Returns sql.ErrNoRows if the bank doesn't exist or is already deleted and ErrVersionConflict if it's at another version.
+func DeleteBank(db *sqlx.DB, swiftCode string, version int64, audit Audit) error {
+	d := dialectOf(db)
+	tx, err := beginAudited(db, audit)
 	if err != nil {
 		return err
 	}
+	defer tx.Rollback()
+
+	// Checked before the branches lose their HQ, which gives it a new version
+	var bank Bank
+	err = tx.Get(&bank, "SELECT * FROM bank WHERE swift_code=$1 AND deleted_at IS NULL"+d.lockRows+";", swiftCode)
+	if err != nil {
+		return err
+	}
+	err = bank.checkVersion(version)
+	if err != nil {
+		return err
+	}
+
+	err = softDeleteBanks(tx, d, []string{swiftCode})
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// Returns sql.ErrNoRows unless all banks exist and none are deleted
+func softDeleteBanks(e sqlx.Execer, d dialect, swiftCodes []string) error {
+	_, err := e.Exec("UPDATE bank SET hq_swift_code=NULL WHERE "+d.inCodes("hq_swift_code")+";", d.codesArg(swiftCodes))
+	if err != nil {
+		return err
+	}
+
+	res, err := e.Exec("UPDATE bank SET deleted_at=$2 WHERE "+d.inCodes("swift_code")+" AND deleted_at IS NULL;",
+		d.codesArg(swiftCodes), time.Now().UTC())
+	if err != nil {
+		return err
+	}
+	deleted, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if deleted != int64(len(swiftCodes)) {
+		return sql.ErrNoRows
+	}
 
 	return nil
 }
+
+// Brings back a soft deleted bank. A branch is linked to its HQ if that exists, an HQ gets its branches
+// back like from InsertHqBank. Returns how many branches were linked to the restored HQ. Checks version like DeleteBank.
+// Returns sql.ErrNoRows if the bank doesn't exist, ErrNotDeleted if it isn't deleted and ErrVersionConflict.
+func RestoreBank(db *sqlx.DB, swiftCode string, version int64, audit Audit) (int64, error) {
+	d := dialectOf(db)
+	tx, err := beginAudited(db, audit)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	var bank Bank
+	err = tx.Get(&bank, "SELECT * FROM bank WHERE swift_code=$1"+d.lockRows+";", swiftCode)
+	if err != nil {
+		return 0, err
+	}
+	if !bank.DeletedAt.Valid {
+		return 0, ErrNotDeleted
+	}
+	err = bank.checkVersion(version)
+	if err != nil {
+		return 0, err
+	}
+
+	// Set in the same statement, so restoring is recorded as a single change
+	hqSwiftCode := bank.HqSwiftCode
+	if !bank.IsHeadquarter && !hqSwiftCode.Valid && len(swiftCode) == bic.Bic11Len {
+		// NULL if the HQ doesn't exist
+		err = tx.Get(&hqSwiftCode, "SELECT MAX(swift_code) FROM bank WHERE swift_code=$1 AND deleted_at IS NULL;",
+			swiftCode[:bic.Bic8Len]+bic.PrimaryOfficeBranchCode)
+		if err != nil {
+			return 0, err
+		}
+	}
+	_, err = tx.Exec("UPDATE bank SET deleted_at=NULL, hq_swift_code=$2 WHERE swift_code=$1;", swiftCode, hqSwiftCode)
+	if err != nil {
+		return 0, err
+	}
+
+	var linked int64
+	if bank.IsHeadquarter {
+		linked, err = linkOrphanedBranches(tx, swiftCode)
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return 0, err
+	}
+
+	return linked, nil
+}
+
+// Permanently removes a soft deleted bank, its history is kept. Checks version like DeleteBank.
+// Returns sql.ErrNoRows if the bank doesn't exist, ErrNotDeleted if it isn't deleted and ErrVersionConflict.
+func PurgeBank(db *sqlx.DB, swiftCode string, version int64, audit Audit) error {
+	d := dialectOf(db)
+	tx, err := beginAudited(db, audit)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var bank Bank
+	err = tx.Get(&bank, "SELECT * FROM bank WHERE swift_code=$1"+d.lockRows+";", swiftCode)
+	if err != nil {
+		return err
+	}
+	if !bank.DeletedAt.Valid {
+		return ErrNotDeleted
+	}
+	err = bank.checkVersion(version)
+	if err != nil {
+		return err
+	}
+
+	// Nothing references it anymore, its branches were detached when it was deleted
+	_, err = tx.Exec("DELETE FROM bank WHERE swift_code=$1;", swiftCode)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
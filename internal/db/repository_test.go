@@ -13,6 +13,8 @@ import (
 )
 
 var (
+	testAudit = Audit{Actor: "test", Source: HistorySourceApi}
+
 	hqBank = Bank{
 		SwiftCode:       "HQTESTBANK",
 		HqSwiftCode:     sql.NullString{},
@@ -108,7 +110,7 @@ func TestGetBank(t *testing.T) {
 
 		t.Run("successfully retrieves HQ bank", func(t *testing.T) {
 			// Arrange
-			err := InsertBank(db, hqBank)
+			err := InsertBank(db, hqBank, testAudit)
 			require.NoError(t, err)
 			t.Cleanup(func() {
 				truncateBanks(db)
@@ -119,14 +121,14 @@ func TestGetBank(t *testing.T) {
 
 			// Assert
 			require.NoError(t, err)
-			assert.Equal(t, hqBank, result)
+			assert.Equal(t, hqBank, result.withoutRevision())
 		})
 
 		t.Run("successfully retrieves branch bank", func(t *testing.T) {
 			// Arrange
-			err := InsertBank(db, hqBank)
+			err := InsertBank(db, hqBank, testAudit)
 			require.NoError(t, err)
-			err = InsertBank(db, branchBank)
+			err = InsertBank(db, branchBank, testAudit)
 			require.NoError(t, err)
 			t.Cleanup(func() {
 				truncateBanks(db)
@@ -137,7 +139,7 @@ func TestGetBank(t *testing.T) {
 
 			// Assert
 			require.NoError(t, err)
-			assert.Equal(t, branchBank, result)
+			assert.Equal(t, branchBank, result.withoutRevision())
 		})
 
 		t.Run("returns error for non-existent bank", func(t *testing.T) {
@@ -164,11 +166,11 @@ func TestGetBankBranches(t *testing.T) {
 
 		t.Run("returns branches for valid HQ bank", func(t *testing.T) {
 			// Arrange
-			err := InsertBank(db, hqBank)
+			err := InsertBank(db, hqBank, testAudit)
 			require.NoError(t, err)
-			err = InsertBank(db, branch1)
+			err = InsertBank(db, branch1, testAudit)
 			require.NoError(t, err)
-			err = InsertBank(db, branch2)
+			err = InsertBank(db, branch2, testAudit)
 			require.NoError(t, err)
 			t.Cleanup(func() {
 				truncateBanks(db)
@@ -180,13 +182,13 @@ func TestGetBankBranches(t *testing.T) {
 			// Assert
 			require.NoError(t, err)
 			require.Len(t, branches, 2)
-			assert.Contains(t, branches, branch1)
-			assert.Contains(t, branches, branch2)
+			assert.Contains(t, withoutRevisions(branches), branch1)
+			assert.Contains(t, withoutRevisions(branches), branch2)
 		})
 
 		t.Run("returns empty slice for HQ with no branches", func(t *testing.T) {
 			// Arrange
-			err := InsertBank(db, hqBank)
+			err := InsertBank(db, hqBank, testAudit)
 			require.NoError(t, err)
 			t.Cleanup(func() {
 				truncateBanks(db)
@@ -211,9 +213,9 @@ func TestGetBankBranches(t *testing.T) {
 
 		t.Run("returns empty slice when querying a branch", func(t *testing.T) {
 			// Arrange
-			err := InsertBank(db, hqBank)
+			err := InsertBank(db, hqBank, testAudit)
 			require.NoError(t, err)
-			err = InsertBank(db, branch1)
+			err = InsertBank(db, branch1, testAudit)
 			require.NoError(t, err)
 			t.Cleanup(func() {
 				truncateBanks(db)
@@ -229,11 +231,11 @@ func TestGetBankBranches(t *testing.T) {
 
 		t.Run("returns only branches for specified HQ", func(t *testing.T) {
 			// Arrange
-			err := InsertBank(db, hqBank)
+			err := InsertBank(db, hqBank, testAudit)
 			require.NoError(t, err)
-			err = InsertBank(db, branch1)
+			err = InsertBank(db, branch1, testAudit)
 			require.NoError(t, err)
-			err = InsertBank(db, otherBank)
+			err = InsertBank(db, otherBank, testAudit)
 			require.NoError(t, err)
 			t.Cleanup(func() {
 				truncateBanks(db)
@@ -245,12 +247,48 @@ func TestGetBankBranches(t *testing.T) {
 			// Assert
 			require.NoError(t, err)
 			require.Len(t, branches, 1)
-			assert.Contains(t, branches, branch1)
-			assert.NotContains(t, branches, otherBank)
+			assert.Contains(t, withoutRevisions(branches), branch1)
+			assert.NotContains(t, withoutRevisions(branches), otherBank)
 		})
 	})
 }
 
+func TestGetBanksWithBranches(t *testing.T) {
+	t.Parallel()
+	utils.TestWithPostgres(func(args utils.TestWithPostgresArgs) {
+		db, err := Connect(args.Env.DB_USER, args.Env.DB_PASS, args.Env.DB_NAME, args.Env.DB_HOST, args.Port)
+		require.NoError(t, err)
+		t.Cleanup(func() {
+			db.Close()
+		})
+
+		err = insertBanks(db, []Bank{hqBank, branchBank, otherBank, usBank1})
+		require.NoError(t, err)
+
+		testCases := []struct {
+			name     string
+			codes    []string
+			expected []Bank
+		}{
+			{"hq with branches", []string{hqBank.SwiftCode}, []Bank{branchBank, hqBank}},
+			{"branch only", []string{branchBank.SwiftCode}, []Bank{branchBank}},
+			{"many codes and missing ones", []string{otherBank.SwiftCode, "MISSING", usBank1.SwiftCode}, []Bank{otherBank, usBank1}},
+			{"nothing found", []string{"MISSING"}, nil},
+		}
+
+		for _, tt := range testCases {
+			t.Run(tt.name, func(t *testing.T) {
+				// Act
+				banks, err := GetBanksWithBranches(db, tt.codes)
+
+				// Assert
+				require.NoError(t, err)
+				assert.Equal(t, tt.expected, withoutRevisions(banks))
+			})
+		}
+	})
+}
+
 func TestGetBanksInCountry(t *testing.T) {
 	t.Parallel()
 	utils.TestWithPostgres(func(args utils.TestWithPostgresArgs) {
@@ -281,9 +319,9 @@ func TestGetBanksInCountry(t *testing.T) {
 			// Assert
 			require.NoError(t, err)
 			require.Len(t, banks, 2)
-			assert.Contains(t, banks, usBank1)
-			assert.Contains(t, banks, usBank2)
-			assert.NotContains(t, banks, ukBank)
+			assert.Contains(t, withoutRevisions(banks), usBank1)
+			assert.Contains(t, withoutRevisions(banks), usBank2)
+			assert.NotContains(t, withoutRevisions(banks), ukBank)
 		})
 
 		t.Run("returns empty slice for country with no banks", func(t *testing.T) {
@@ -304,6 +342,200 @@ func TestGetBanksInCountry(t *testing.T) {
 	})
 }
 
+func TestGetBanksInCountryPage(t *testing.T) {
+	t.Parallel()
+	utils.TestWithPostgres(func(args utils.TestWithPostgresArgs) {
+		db, err := Connect(args.Env.DB_USER, args.Env.DB_PASS, args.Env.DB_NAME, args.Env.DB_HOST, args.Port)
+		require.NoError(t, err)
+		t.Cleanup(func() {
+			db.Close()
+		})
+
+		t.Run("returns first page ordered by swift code", func(t *testing.T) {
+			// Arrange
+			err := insertBanks(db, []Bank{usBank1, usBank2, ukBank})
+			require.NoError(t, err)
+			t.Cleanup(func() {
+				truncateBanks(db)
+			})
+
+			// Act
+			banks, err := GetBanksInCountryPage(db, "US", "", 1)
+
+			// Assert
+			require.NoError(t, err)
+			assert.Equal(t, []Bank{usBank1}, withoutRevisions(banks))
+		})
+
+		t.Run("returns banks after cursor", func(t *testing.T) {
+			// Arrange
+			err := insertBanks(db, []Bank{usBank1, usBank2, ukBank})
+			require.NoError(t, err)
+			t.Cleanup(func() {
+				truncateBanks(db)
+			})
+
+			// Act
+			banks, err := GetBanksInCountryPage(db, "US", usBank1.SwiftCode, 10)
+
+			// Assert
+			require.NoError(t, err)
+			assert.Equal(t, []Bank{usBank2}, withoutRevisions(banks))
+		})
+
+		t.Run("returns empty slice after last bank", func(t *testing.T) {
+			// Arrange
+			err := insertBanks(db, []Bank{usBank1, usBank2})
+			require.NoError(t, err)
+			t.Cleanup(func() {
+				truncateBanks(db)
+			})
+
+			// Act
+			banks, err := GetBanksInCountryPage(db, "US", usBank2.SwiftCode, 10)
+
+			// Assert
+			require.NoError(t, err)
+			assert.Empty(t, banks)
+		})
+	})
+}
+
+func TestStreamBanks(t *testing.T) {
+	t.Parallel()
+	utils.TestWithPostgres(func(args utils.TestWithPostgresArgs) {
+		db, err := Connect(args.Env.DB_USER, args.Env.DB_PASS, args.Env.DB_NAME, args.Env.DB_HOST, args.Port)
+		require.NoError(t, err)
+		t.Cleanup(func() {
+			db.Close()
+		})
+
+		err = insertBanks(db, []Bank{hqBank, branchBank, otherBank})
+		require.NoError(t, err)
+
+		testCases := []struct {
+			name     string
+			filter   BankFilter
+			expected []Bank
+		}{
+			{"all banks ordered by swift code", BankFilter{}, []Bank{branchBank, hqBank, otherBank}},
+			{"country", BankFilter{CountryISO2Code: "GB"}, []Bank{branchBank, hqBank}},
+			{"HQs only", BankFilter{HqOnly: true}, []Bank{hqBank}},
+			{"no matches", BankFilter{CountryISO2Code: "PL"}, nil},
+		}
+
+		for _, tt := range testCases {
+			t.Run(tt.name, func(t *testing.T) {
+				// Act
+				var banks []Bank
+				for bank, err := range StreamBanks(db, tt.filter) {
+					require.NoError(t, err)
+					banks = append(banks, bank)
+				}
+
+				// Assert
+				assert.Equal(t, tt.expected, withoutRevisions(banks))
+			})
+		}
+	})
+}
+
+func TestSearchBanks(t *testing.T) {
+	t.Parallel()
+	utils.TestWithPostgres(func(args utils.TestWithPostgresArgs) {
+		db, err := Connect(args.Env.DB_USER, args.Env.DB_PASS, args.Env.DB_NAME, args.Env.DB_HOST, args.Port)
+		require.NoError(t, err)
+		t.Cleanup(func() {
+			db.Close()
+		})
+
+		t.Run("matches bank name prefix", func(t *testing.T) {
+			// Arrange
+			err := insertBanks(db, []Bank{usBank1, ukBank, otherBank})
+			require.NoError(t, err)
+			t.Cleanup(func() {
+				truncateBanks(db)
+			})
+
+			// Act
+			results, err := SearchBanks(db, "uk", 10)
+
+			// Assert
+			require.NoError(t, err)
+			require.NotEmpty(t, results)
+			assert.Equal(t, ukBank, results[0].Bank.withoutRevision())
+		})
+
+		t.Run("matches town name", func(t *testing.T) {
+			// Arrange
+			bank := usBank1
+			bank.TownName = "NEW YORK"
+			err := insertBanks(db, []Bank{bank, ukBank})
+			require.NoError(t, err)
+			t.Cleanup(func() {
+				truncateBanks(db)
+			})
+
+			// Act
+			results, err := SearchBanks(db, "york", 10)
+
+			// Assert
+			require.NoError(t, err)
+			require.Len(t, results, 1)
+			assert.Equal(t, bank, results[0].Bank.withoutRevision())
+		})
+
+		t.Run("matches with typos", func(t *testing.T) {
+			// Arrange
+			err := insertBanks(db, []Bank{otherBank, ukBank})
+			require.NoError(t, err)
+			t.Cleanup(func() {
+				truncateBanks(db)
+			})
+
+			// Act
+			results, err := SearchBanks(db, "otherr", 10)
+
+			// Assert
+			require.NoError(t, err)
+			require.Len(t, results, 1)
+			assert.Equal(t, otherBank, results[0].Bank.withoutRevision())
+		})
+
+		t.Run("treats LIKE wildcards literally", func(t *testing.T) {
+			// Arrange
+			err := insertBanks(db, []Bank{usBank1, ukBank})
+			require.NoError(t, err)
+			t.Cleanup(func() {
+				truncateBanks(db)
+			})
+
+			// Act
+			results, err := SearchBanks(db, "%", 10)
+
+			// Assert
+			require.NoError(t, err)
+			assert.Empty(t, results)
+		})
+
+		t.Run("respects limit", func(t *testing.T) {
+			// Arrange
+			err := insertBanks(db, []Bank{usBank1, usBank2, ukBank})
+			require.NoError(t, err)
+			t.Cleanup(func() {
+				truncateBanks(db)
+			})
+
+			// Act
+			results, err := SearchBanks(db, "bank", 2)
+
+			// Assert
+			require.NoError(t, err)
+			assert.Len(t, results, 2)
+		})
+	})
+}
+
 func TestCheckBankHqExists(t *testing.T) {
 	t.Parallel()
 	utils.TestWithPostgres(func(args utils.TestWithPostgresArgs) {
@@ -368,7 +600,7 @@ func TestInsertBanks(t *testing.T) {
 			})
 
 			// Act
-			err := InsertBanks(db, banks)
+			err := InsertBanks(db, banks, testAudit)
 
 			// Assert
 			require.NoError(t, err)
@@ -383,7 +615,7 @@ func TestInsertBanks(t *testing.T) {
 
 		t.Run("returns error for duplicate swift code", func(t *testing.T) {
 			// Arrange - insert first bank
-			err := InsertBank(db, hqBank)
+			err := InsertBank(db, hqBank, testAudit)
 			require.NoError(t, err)
 			t.Cleanup(func() {
 				truncateBanks(db)
@@ -393,7 +625,7 @@ func TestInsertBanks(t *testing.T) {
 			banks := []Bank{hqBank}
 
 			// Act
-			err = InsertBanks(db, banks)
+			err = InsertBanks(db, banks, testAudit)
 
 			// Assert
 			require.Error(t, err)
@@ -418,7 +650,7 @@ func TestInsertBanks(t *testing.T) {
 			})
 
 			// Act
-			err := InsertBanks(db, banks)
+			err := InsertBanks(db, banks, testAudit)
 
 			// Assert
 			require.Error(t, err)
@@ -445,7 +677,7 @@ func TestInsertBank(t *testing.T) {
 			})
 
 			// Act
-			err := InsertBank(db, hqBank)
+			err := InsertBank(db, hqBank, testAudit)
 
 			// Assert
 			require.NoError(t, err)
@@ -454,19 +686,19 @@ func TestInsertBank(t *testing.T) {
 			var insertedBank Bank
 			err = db.Get(&insertedBank, "SELECT * FROM bank WHERE swift_code = $1", hqBank.SwiftCode)
 			require.NoError(t, err)
-			assert.Equal(t, hqBank, insertedBank)
+			assert.Equal(t, hqBank, insertedBank.withoutRevision())
 		})
 
 		t.Run("successfully inserts branch bank", func(t *testing.T) {
 			// Arrange - first insert HQ bank
-			err := InsertBank(db, hqBank)
+			err := InsertBank(db, hqBank, testAudit)
 			require.NoError(t, err)
 			t.Cleanup(func() {
 				truncateBanks(db)
 			})
 
 			// Act
-			err = InsertBank(db, branchBank)
+			err = InsertBank(db, branchBank, testAudit)
 
 			// Assert
 			require.NoError(t, err)
@@ -475,19 +707,19 @@ func TestInsertBank(t *testing.T) {
 			var insertedBank Bank
 			err = db.Get(&insertedBank, "SELECT * FROM bank WHERE swift_code = $1", branchBank.SwiftCode)
 			require.NoError(t, err)
-			assert.Equal(t, branchBank, insertedBank)
+			assert.Equal(t, branchBank, insertedBank.withoutRevision())
 		})
 
 		t.Run("returns error for duplicate swift code", func(t *testing.T) {
 			// Arrange
-			err := InsertBank(db, hqBank)
+			err := InsertBank(db, hqBank, testAudit)
 			require.NoError(t, err)
 			t.Cleanup(func() {
 				truncateBanks(db)
 			})
 
 			// Act - try to insert same bank again
-			err = InsertBank(db, hqBank)
+			err = InsertBank(db, hqBank, testAudit)
 
 			// Assert
 			require.Error(t, err)
@@ -511,7 +743,7 @@ func TestInsertBank(t *testing.T) {
 			})
 
 			// Act
-			err := InsertBank(db, invalidBranch)
+			err := InsertBank(db, invalidBranch, testAudit)
 
 			// Assert
 			require.Error(t, err)
@@ -522,6 +754,168 @@ func TestInsertBank(t *testing.T) {
 	})
 }
 
+func TestInsertHqBank(t *testing.T) {
+	t.Parallel()
+	utils.TestWithPostgres(func(args utils.TestWithPostgresArgs) {
+		db, err := Connect(args.Env.DB_USER, args.Env.DB_PASS, args.Env.DB_NAME, args.Env.DB_HOST, args.Port)
+		require.NoError(t, err)
+		t.Cleanup(func() {
+			db.Close()
+		})
+
+		hq := Bank{
+			SwiftCode:       "ABCDGB2LXXX",
+			IsHeadquarter:   true,
+			BankName:        "HQ Bank",
+			Address:         "456 HQ Street",
+			CountryISO2Code: "GB",
+			CountryName:     "United Kingdom",
+		}
+		orphan := Bank{
+			SwiftCode:       "ABCDGB2L001",
+			IsHeadquarter:   false,
+			BankName:        "Branch 1",
+			Address:         "123 Branch St",
+			CountryISO2Code: "GB",
+			CountryName:     "United Kingdom",
+		}
+		unrelated := Bank{
+			SwiftCode:       "EFGHGB2L001",
+			IsHeadquarter:   false,
+			BankName:        "Branch 2",
+			Address:         "456 Branch Ave",
+			CountryISO2Code: "GB",
+			CountryName:     "United Kingdom",
+		}
+
+		t.Run("links orphaned branches with the same prefix", func(t *testing.T) {
+			// Arrange
+			err := insertBanks(db, []Bank{orphan, unrelated})
+			require.NoError(t, err)
+			t.Cleanup(func() {
+				truncateBanks(db)
+			})
+
+			// Act
+			linked, err := InsertHqBank(db, hq, testAudit)
+
+			// Assert
+			require.NoError(t, err)
+			assert.Equal(t, int64(1), linked)
+
+			branches, err := GetBankBranches(db, hq.SwiftCode)
+			require.NoError(t, err)
+			require.Len(t, branches, 1)
+			assert.Equal(t, orphan.SwiftCode, branches[0].SwiftCode)
+		})
+
+		t.Run("links nothing without orphans", func(t *testing.T) {
+			// Arrange
+			t.Cleanup(func() {
+				truncateBanks(db)
+			})
+
+			// Act
+			linked, err := InsertHqBank(db, hq, testAudit)
+
+			// Assert
+			require.NoError(t, err)
+			assert.Equal(t, int64(0), linked)
+		})
+
+		t.Run("returns error for duplicate swift code", func(t *testing.T) {
+			// Arrange
+			err := insertBanks(db, []Bank{hq, orphan})
+			require.NoError(t, err)
+			t.Cleanup(func() {
+				truncateBanks(db)
+			})
+
+			// Act
+			_, err = InsertHqBank(db, hq, testAudit)
+
+			// Assert
+			require.Error(t, err)
+			pgErr, ok := err.(*pq.Error)
+			require.True(t, ok)
+			assert.Equal(t, pgErr.Code, UniqueViolationErrorCode)
+		})
+	})
+}
+
+func TestUpdateBank(t *testing.T) {
+	t.Parallel()
+	utils.TestWithPostgres(func(args utils.TestWithPostgresArgs) {
+		db, err := Connect(args.Env.DB_USER, args.Env.DB_PASS, args.Env.DB_NAME, args.Env.DB_HOST, args.Port)
+		require.NoError(t, err)
+		t.Cleanup(func() {
+			db.Close()
+		})
+
+		t.Run("updates bank and leaves hq fields intact", func(t *testing.T) {
+			// Arrange
+			err := insertBanks(db, []Bank{hqBank, branchBank})
+			require.NoError(t, err)
+			t.Cleanup(func() {
+				truncateBanks(db)
+			})
+
+			updated := branchBank
+			updated.BankName = "Renamed Branch"
+			updated.Address = "1 New Street"
+			updated.HqSwiftCode = sql.NullString{}
+			updated.IsHeadquarter = true
+
+			// Act
+			err = UpdateBank(db, updated, testAudit)
+
+			// Assert
+			require.NoError(t, err)
+
+			result, err := GetBank(db, branchBank.SwiftCode)
+			require.NoError(t, err)
+			expected := branchBank
+			expected.BankName = updated.BankName
+			expected.Address = updated.Address
+			assert.Equal(t, expected, result.withoutRevision())
+			assert.Equal(t, int64(2), result.Version)
+		})
+
+		t.Run("checks the version", func(t *testing.T) {
+			// Arrange
+			err := insertBanks(db, []Bank{hqBank})
+			require.NoError(t, err)
+			t.Cleanup(func() {
+				truncateBanks(db)
+			})
+
+			updated := hqBank
+			updated.BankName = "Renamed"
+			updated.Version = 2
+
+			// Act
+			err = UpdateBank(db, updated, testAudit)
+
+			// Assert
+			assert.ErrorIs(t, err, ErrVersionConflict)
+			updated.Version = 1
+			require.NoError(t, UpdateBank(db, updated, testAudit))
+			result, err := GetBank(db, hqBank.SwiftCode)
+			require.NoError(t, err)
+			assert.Equal(t, "Renamed", result.BankName)
+		})
+
+		t.Run("returns error when bank doesn't exist", func(t *testing.T) {
+			// Act
+			err := UpdateBank(db, hqBank, testAudit)
+
+			// Assert
+			require.Error(t, err)
+			assert.True(t, errors.Is(err, sql.ErrNoRows))
+		})
+	})
+}
+
 func TestDeleteBank(t *testing.T) {
 	t.Parallel()
 	utils.TestWithPostgres(func(args utils.TestWithPostgresArgs) {
@@ -531,7 +925,7 @@ func TestDeleteBank(t *testing.T) {
 			db.Close()
 		})
 
-		t.Run("successfully deletes HQ bank and nullifies branches", func(t *testing.T) {
+		t.Run("soft deletes HQ bank and nullifies branches", func(t *testing.T) {
 			// Arrange
 			err := insertBank(db, hqBank)
 			require.NoError(t, err)
@@ -544,16 +938,18 @@ func TestDeleteBank(t *testing.T) {
 			})
 
 			// Act
-			err = DeleteBank(db, hqBank.SwiftCode)
+			err = DeleteBank(db, hqBank.SwiftCode, 0, testAudit)
 
 			// Assert
 			require.NoError(t, err)
 
-			// Verify HQ bank was deleted
-			var count int
-			err = db.Get(&count, "SELECT COUNT(*) FROM bank WHERE swift_code = $1", hqBank.SwiftCode)
+			// Verify HQ bank was soft deleted
+			var deletedAt sql.NullTime
+			err = db.Get(&deletedAt, "SELECT deleted_at FROM bank WHERE swift_code = $1", hqBank.SwiftCode)
 			require.NoError(t, err)
-			assert.Equal(t, 0, count)
+			assert.True(t, deletedAt.Valid)
+			_, err = GetBank(db, hqBank.SwiftCode)
+			assert.ErrorIs(t, err, sql.ErrNoRows)
 
 			// Verify branch's hq_swift_code was set to NULL
 			var branchHqCode sql.NullString
@@ -562,7 +958,7 @@ func TestDeleteBank(t *testing.T) {
 			assert.False(t, branchHqCode.Valid)
 		})
 
-		t.Run("successfully deletes standalone bank", func(t *testing.T) {
+		t.Run("soft deletes standalone bank", func(t *testing.T) {
 			// Arrange
 			err := insertBank(db, hqBank)
 			require.NoError(t, err)
@@ -571,21 +967,52 @@ func TestDeleteBank(t *testing.T) {
 			})
 
 			// Act
-			err = DeleteBank(db, hqBank.SwiftCode)
+			err = DeleteBank(db, hqBank.SwiftCode, 0, testAudit)
 
 			// Assert
 			require.NoError(t, err)
 
-			// Verify bank was deleted
+			// Verify bank was soft deleted
 			var count int
-			err = db.Get(&count, "SELECT COUNT(*) FROM bank WHERE swift_code = $1", hqBank.SwiftCode)
+			err = db.Get(&count, "SELECT COUNT(*) FROM bank WHERE swift_code = $1 AND deleted_at IS NULL", hqBank.SwiftCode)
 			require.NoError(t, err)
 			assert.Equal(t, 0, count)
 		})
 
+		t.Run("checks the version before the branches give the HQ a new one", func(t *testing.T) {
+			// Arrange
+			require.NoError(t, insertBank(db, hqBank))
+			require.NoError(t, insertBank(db, branchBank))
+			t.Cleanup(func() {
+				truncateBanks(db)
+			})
+			bank, err := GetBank(db, hqBank.SwiftCode)
+			require.NoError(t, err)
+
+			// Act & Assert
+			assert.ErrorIs(t, DeleteBank(db, hqBank.SwiftCode, bank.Version-1, testAudit), ErrVersionConflict)
+			require.NoError(t, DeleteBank(db, hqBank.SwiftCode, bank.Version, testAudit))
+		})
+
+		t.Run("returns error when bank is already deleted", func(t *testing.T) {
+			// Arrange
+			err := insertBank(db, hqBank)
+			require.NoError(t, err)
+			t.Cleanup(func() {
+				truncateBanks(db)
+			})
+			require.NoError(t, DeleteBank(db, hqBank.SwiftCode, 0, testAudit))
+
+			// Act
+			err = DeleteBank(db, hqBank.SwiftCode, 0, testAudit)
+
+			// Assert
+			assert.ErrorIs(t, err, sql.ErrNoRows)
+		})
+
 		t.Run("returns error when bank doesn't exist", func(t *testing.T) {
 			// Act
-			err := DeleteBank(db, "NONEXISTENT")
+			err := DeleteBank(db, "NONEXISTENT", 0, testAudit)
 
 			// Assert
 			require.Error(t, err)
@@ -594,9 +1021,120 @@ func TestDeleteBank(t *testing.T) {
 	})
 }
 
+func TestRestoreBank(t *testing.T) {
+	t.Parallel()
+	utils.TestWithPostgres(func(args utils.TestWithPostgresArgs) {
+		db, err := Connect(args.Env.DB_USER, args.Env.DB_PASS, args.Env.DB_NAME, args.Env.DB_HOST, args.Port)
+		require.NoError(t, err)
+		t.Cleanup(func() {
+			db.Close()
+		})
+
+		t.Run("restores HQ bank and links its branches", func(t *testing.T) {
+			// Arrange
+			err := insertBanks(db, []Bank{memHqBank, memBranchBank})
+			require.NoError(t, err)
+			t.Cleanup(func() {
+				truncateBanks(db)
+			})
+			require.NoError(t, DeleteBank(db, memHqBank.SwiftCode, 0, testAudit))
+
+			// Act
+			linked, err := RestoreBank(db, memHqBank.SwiftCode, 0, testAudit)
+
+			// Assert
+			require.NoError(t, err)
+			assert.Equal(t, int64(1), linked)
+			restored, err := GetBank(db, memHqBank.SwiftCode)
+			require.NoError(t, err)
+			assert.Equal(t, memHqBank, restored.withoutRevision())
+			branch, err := GetBank(db, memBranchBank.SwiftCode)
+			require.NoError(t, err)
+			assert.Equal(t, memBranchBank, branch.withoutRevision())
+		})
+
+		t.Run("returns error when bank isn't deleted", func(t *testing.T) {
+			// Arrange
+			err := insertBank(db, hqBank)
+			require.NoError(t, err)
+			t.Cleanup(func() {
+				truncateBanks(db)
+			})
+
+			// Act
+			_, err = RestoreBank(db, hqBank.SwiftCode, 0, testAudit)
+
+			// Assert
+			assert.ErrorIs(t, err, ErrNotDeleted)
+		})
+
+		t.Run("returns error when bank doesn't exist", func(t *testing.T) {
+			// Act
+			_, err := RestoreBank(db, "NONEXISTENT", 0, testAudit)
+
+			// Assert
+			assert.ErrorIs(t, err, sql.ErrNoRows)
+		})
+	})
+}
+
+func TestPurgeBank(t *testing.T) {
+	t.Parallel()
+	utils.TestWithPostgres(func(args utils.TestWithPostgresArgs) {
+		db, err := Connect(args.Env.DB_USER, args.Env.DB_PASS, args.Env.DB_NAME, args.Env.DB_HOST, args.Port)
+		require.NoError(t, err)
+		t.Cleanup(func() {
+			db.Close()
+		})
+
+		t.Run("permanently removes deleted bank", func(t *testing.T) {
+			// Arrange
+			err := insertBank(db, hqBank)
+			require.NoError(t, err)
+			t.Cleanup(func() {
+				truncateBanks(db)
+			})
+			require.NoError(t, DeleteBank(db, hqBank.SwiftCode, 0, testAudit))
+
+			// Act
+			err = PurgeBank(db, hqBank.SwiftCode, 0, testAudit)
+
+			// Assert
+			require.NoError(t, err)
+			var count int
+			err = db.Get(&count, "SELECT COUNT(*) FROM bank WHERE swift_code = $1", hqBank.SwiftCode)
+			require.NoError(t, err)
+			assert.Equal(t, 0, count)
+		})
+
+		t.Run("returns error when bank isn't deleted", func(t *testing.T) {
+			// Arrange
+			err := insertBank(db, hqBank)
+			require.NoError(t, err)
+			t.Cleanup(func() {
+				truncateBanks(db)
+			})
+
+			// Act
+			err = PurgeBank(db, hqBank.SwiftCode, 0, testAudit)
+
+			// Assert
+			assert.ErrorIs(t, err, ErrNotDeleted)
+		})
+
+		t.Run("returns error when bank doesn't exist", func(t *testing.T) {
+			// Act
+			err := PurgeBank(db, "NONEXISTENT", 0, testAudit)
+
+			// Assert
+			assert.ErrorIs(t, err, sql.ErrNoRows)
+		})
+	})
+}
+
 func insertBanks(db *sqlx.DB, bank []Bank) error {
-	_, err := db.NamedExec(`INSERT INTO bank (swift_code, hq_swift_code, is_headquarter, bank_name, address, country_iso2_code, country_name)
-		VALUES (:swift_code, :hq_swift_code, :is_headquarter, :bank_name, :address, :country_iso2_code, :country_name)`,
+	_, err := db.NamedExec(`INSERT INTO bank (swift_code, hq_swift_code, is_headquarter, bank_name, address, town_name, country_iso2_code, country_name)
+		VALUES (:swift_code, :hq_swift_code, :is_headquarter, :bank_name, :address, :town_name, :country_iso2_code, :country_name)`,
 		bank)
 	return err
 }
@@ -0,0 +1,148 @@
+package db
+
+import (
+	"errors"
+	"fmt"
+	"iter"
+	"slices"
+	"strings"
+
+	"github.com/jmoiron/sqlx"
+	"modernc.org/sqlite"
+)
+
+const sqliteDriver = "sqlite"
+
+// Opens the SQLite database at path, creating it if it doesn't exist. Migrations are applied with internal/migrate.
+// Foreign keys are enforced and write transactions lock the database right away, so concurrent writers wait
+// for each other instead of failing when upgrading a read lock.
+func ConnectSqlite(path string) (*sqlx.DB, error) {
+	connStr := fmt.Sprintf("file:%s?_pragma=foreign_keys(1)&_pragma=busy_timeout(5000)&_pragma=journal_mode(WAL)&_txlock=immediate", path)
+
+	db, err := sqlx.Open(sqliteDriver, connStr)
+	if err != nil {
+		return nil, err
+	}
+
+	err = db.Ping()
+	if err != nil {
+		return nil, err
+	}
+
+	return db, nil
+}
+
+// Stores banks in a SQLite database opened with ConnectSqlite. Uses the same package functions as PostgresRepository,
+// except for search, which only ranks prefix and substring matches like MemoryRepository.
+type SqliteRepository struct {
+	db *sqlx.DB
+}
+
+func NewSqliteRepository(db *sqlx.DB) *SqliteRepository {
+	return &SqliteRepository{db: db}
+}
+
+func (r *SqliteRepository) GetBank(swiftCode string) (Bank, error) {
+	return GetBank(r.db, swiftCode)
+}
+
+func (r *SqliteRepository) GetDeletedBank(swiftCode string) (Bank, error) {
+	return GetDeletedBank(r.db, swiftCode)
+}
+
+func (r *SqliteRepository) GetBankBranches(swiftCode string) ([]Bank, error) {
+	return GetBankBranches(r.db, swiftCode)
+}
+
+func (r *SqliteRepository) GetBanksWithBranches(swiftCodes []string) ([]Bank, error) {
+	return GetBanksWithBranches(r.db, swiftCodes)
+}
+
+func (r *SqliteRepository) GetBanksInCountry(countryCode string) ([]Bank, error) {
+	return GetBanksInCountry(r.db, countryCode)
+}
+
+func (r *SqliteRepository) GetBanksInCountryPage(countryCode string, after string, limit int) ([]Bank, error) {
+	return GetBanksInCountryPage(r.db, countryCode, after, limit)
+}
+
+func (r *SqliteRepository) SearchBanks(query string, limit int) ([]BankSearchResult, error) {
+	var banks []Bank
+
+	// LIKE is case-insensitive in SQLite
+	err := r.db.Select(&banks, `
+		SELECT * FROM bank
+		WHERE deleted_at IS NULL AND (bank_name LIKE $1 ESCAPE '\' OR address LIKE $1 ESCAPE '\' OR town_name LIKE $1 ESCAPE '\')
+		ORDER BY swift_code;
+		`, "%"+escapeLike(query)+"%")
+	if err != nil {
+		return nil, err
+	}
+
+	query = strings.ToLower(query)
+	results := make([]BankSearchResult, 0, len(banks))
+	for _, bank := range banks {
+		results = append(results, BankSearchResult{Bank: bank, Rank: searchRank(query, bank)})
+	}
+	slices.SortStableFunc(results, byRankDesc)
+
+	return results[:min(limit, len(results))], nil
+}
+
+func (r *SqliteRepository) StreamBanks(filter BankFilter) iter.Seq2[Bank, error] {
+	return StreamBanks(r.db, filter)
+}
+
+func (r *SqliteRepository) CheckBankHqExists(hqSwiftCode string) (bool, error) {
+	return CheckBankHqExists(r.db, hqSwiftCode)
+}
+
+func (r *SqliteRepository) InsertBank(bank Bank, audit Audit) error {
+	return mapSqliteError(InsertBank(r.db, bank, audit))
+}
+
+func (r *SqliteRepository) InsertHqBank(bank Bank, audit Audit) (int64, error) {
+	linked, err := InsertHqBank(r.db, bank, audit)
+	return linked, mapSqliteError(err)
+}
+
+func (r *SqliteRepository) InsertBankBatch(banks []Bank, atomic bool, audit Audit) ([]BatchInsertResult, bool, error) {
+	return InsertBankBatch(r.db, banks, atomic, audit)
+}
+
+func (r *SqliteRepository) UpdateBank(bank Bank, audit Audit) error {
+	return UpdateBank(r.db, bank, audit)
+}
+
+func (r *SqliteRepository) DeleteBank(swiftCode string, version int64, audit Audit) error {
+	return DeleteBank(r.db, swiftCode, version, audit)
+}
+
+func (r *SqliteRepository) RestoreBank(swiftCode string, version int64, audit Audit) (int64, error) {
+	return RestoreBank(r.db, swiftCode, version, audit)
+}
+
+func (r *SqliteRepository) PurgeBank(swiftCode string, version int64, audit Audit) error {
+	return PurgeBank(r.db, swiftCode, version, audit)
+}
+
+func (r *SqliteRepository) GetBankHistory(swiftCode string) ([]BankHistory, error) {
+	return GetBankHistory(r.db, swiftCode)
+}
+
+// Same as mapPgError. A duplicate SWIFT code violates the primary key, not a unique index like in Postgres.
+func mapSqliteError(err error) error {
+	var sqliteErr *sqlite.Error
+	if !errors.As(err, &sqliteErr) {
+		return err
+	}
+
+	switch sqliteErr.Code() {
+	case SqlitePrimaryKeyViolationErrorCode, SqliteUniqueViolationErrorCode:
+		return fmt.Errorf("%w: %w", ErrAlreadyExists, err)
+	case SqliteForeignKeyViolationErrorCode:
+		return fmt.Errorf("%w: %w", ErrHqNotFound, err)
+	default:
+		return err
+	}
+}
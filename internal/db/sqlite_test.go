@@ -0,0 +1,91 @@
+package db
+
+import (
+	"database/sql"
+	"path/filepath"
+	"testing"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/mwojtyna/swift-api/internal/migrate"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// Opens a migrated SQLite database in a temporary directory, it's removed after the test
+func testSqlite(t *testing.T) *sqlx.DB {
+	t.Helper()
+
+	db, err := ConnectSqlite(filepath.Join(t.TempDir(), "swift.db"))
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		db.Close()
+	})
+
+	migrator, err := migrate.New(db)
+	require.NoError(t, err)
+	_, err = migrator.Up()
+	require.NoError(t, err)
+
+	return db
+}
+
+func TestMapSqliteError(t *testing.T) {
+	// Arrange
+	db := testSqlite(t)
+	require.NoError(t, InsertBanks(db, []Bank{memHqBank}, testAudit))
+
+	tests := []struct {
+		name    string
+		bank    Bank
+		wantErr error
+	}{
+		{
+			name:    "duplicate primary key",
+			bank:    memHqBank,
+			wantErr: ErrAlreadyExists,
+		},
+		{
+			name:    "missing hq",
+			bank:    Bank{SwiftCode: "CCCCPLPW001", HqSwiftCode: sql.NullString{String: "CCCCPLPWXXX", Valid: true}},
+			wantErr: ErrHqNotFound,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Act
+			err := mapSqliteError(InsertBank(db, tt.bank, testAudit))
+
+			// Assert
+			assert.ErrorIs(t, err, tt.wantErr)
+		})
+	}
+}
+
+func TestSqliteSyncBanks(t *testing.T) {
+	// Arrange
+	db := testSqlite(t)
+	require.NoError(t, InsertBanks(db, []Bank{memHqBank, memBranchBank, memOtherBank}, testAudit))
+	changed := memOtherBank
+	changed.BankName = "Renamed"
+
+	// Act
+	diff, err := SyncBanks(db, []Bank{changed}, SyncOptions{DeleteMissing: true}, testAudit)
+
+	// Assert
+	require.NoError(t, err)
+	assert.Equal(t, []Bank{changed}, diff.Changed)
+	assert.ElementsMatch(t, []string{memHqBank.SwiftCode, memBranchBank.SwiftCode}, diff.Removed)
+
+	var codes []string
+	require.NoError(t, db.Select(&codes, "SELECT swift_code FROM bank WHERE deleted_at IS NULL;"))
+	assert.Equal(t, []string{memOtherBank.SwiftCode}, codes)
+
+	// Removed banks are only soft deleted, so syncing them again restores them
+	diff, err = SyncBanks(db, []Bank{memHqBank, memBranchBank, changed}, SyncOptions{}, testAudit)
+	require.NoError(t, err)
+	assert.Equal(t, []Bank{memHqBank, memBranchBank}, diff.Added)
+	branch, err := GetBank(db, memBranchBank.SwiftCode)
+	require.NoError(t, err)
+	assert.Equal(t, memBranchBank, branch.withoutRevision())
+}
@@ -0,0 +1,167 @@
+package db
+
+import (
+	"slices"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/mwojtyna/swift-api/internal/bic"
+)
+
+type BankDiff struct {
+	Added   []Bank
+	Changed []Bank // New values of the changed banks
+	Removed []string
+}
+
+func (d BankDiff) IsEmpty() bool {
+	return len(d.Added) == 0 && len(d.Changed) == 0 && len(d.Removed) == 0
+}
+
+type SyncOptions struct {
+	DeleteMissing bool // Delete banks which aren't in the import
+	DryRun        bool // Only compute the diff, don't change anything
+}
+
+// Compares banks currently in the DB with the imported ones.
+// Banks missing from the import are only reported as removed if deleteMissing is true.
+func DiffBanks(current []Bank, incoming []Bank, deleteMissing bool) BankDiff {
+	var diff BankDiff
+
+	currentByCode := make(map[string]Bank, len(current))
+	for _, b := range current {
+		currentByCode[b.SwiftCode] = b
+	}
+	incomingCodes := make(map[string]struct{}, len(incoming))
+	for _, b := range incoming {
+		incomingCodes[b.SwiftCode] = struct{}{}
+	}
+
+	// Codes which will be in the DB after syncing
+	remaining := make(map[string]struct{}, len(current)+len(incoming))
+	for code := range incomingCodes {
+		remaining[code] = struct{}{}
+	}
+	for _, b := range current {
+		_, inImport := incomingCodes[b.SwiftCode]
+		if !inImport && deleteMissing {
+			diff.Removed = append(diff.Removed, b.SwiftCode)
+		} else {
+			remaining[b.SwiftCode] = struct{}{}
+		}
+	}
+	slices.Sort(diff.Removed)
+
+	for _, b := range incoming {
+		// The import only links branches to HQs from the same file, so link the ones whose HQ stays in the DB too
+		if !b.IsHeadquarter && !b.HqSwiftCode.Valid && len(b.SwiftCode) == bic.Bic11Len {
+			hqCode := b.SwiftCode[:bic.Bic8Len] + bic.PrimaryOfficeBranchCode
+			if _, ok := remaining[hqCode]; ok {
+				b.HqSwiftCode.String = hqCode
+				b.HqSwiftCode.Valid = true
+			}
+		}
+
+		old, exists := currentByCode[b.SwiftCode]
+		if !exists {
+			diff.Added = append(diff.Added, b)
+		} else if old.withoutRevision() != b.withoutRevision() {
+			diff.Changed = append(diff.Changed, b)
+		}
+	}
+
+	// Insert HQs first to prevent foreign key errors
+	slices.SortStableFunc(diff.Added, func(a, b Bank) int {
+		switch {
+		case a.IsHeadquarter == b.IsHeadquarter:
+			return 0
+		case a.IsHeadquarter:
+			return -1
+		default:
+			return 1
+		}
+	})
+
+	return diff
+}
+
+// Makes the bank table match the imported banks in a single transaction, returns what was (or with DryRun - would be) changed.
+// Removed banks are soft deleted.
+func SyncBanks(db *sqlx.DB, banks []Bank, opts SyncOptions, audit Audit) (BankDiff, error) {
+	d := dialectOf(db)
+	tx, err := beginAudited(db, audit)
+	if err != nil {
+		return BankDiff{}, err
+	}
+	defer tx.Rollback()
+
+	if !opts.DryRun && d.lockBankTable != "" {
+		// Block writes from the API until we're done, reads are still allowed
+		_, err = tx.Exec(d.lockBankTable)
+		if err != nil {
+			return BankDiff{}, err
+		}
+	}
+
+	var current []Bank
+	err = tx.Select(&current, "SELECT * FROM bank WHERE deleted_at IS NULL;")
+	if err != nil {
+		return BankDiff{}, err
+	}
+	var deletedCodes []string
+	err = tx.Select(&deletedCodes, "SELECT swift_code FROM bank WHERE deleted_at IS NOT NULL;")
+	if err != nil {
+		return BankDiff{}, err
+	}
+
+	diff := DiffBanks(current, banks, opts.DeleteMissing)
+	if opts.DryRun || diff.IsEmpty() {
+		return diff, nil
+	}
+
+	// Soft deleted banks which are in the import are restored with the imported values instead of inserted
+	deleted := make(map[string]struct{}, len(deletedCodes))
+	for _, code := range deletedCodes {
+		deleted[code] = struct{}{}
+	}
+	var inserted, updated []Bank
+	for _, b := range diff.Added {
+		if _, ok := deleted[b.SwiftCode]; ok {
+			updated = append(updated, b)
+		} else {
+			inserted = append(inserted, b)
+		}
+	}
+	updated = append(updated, diff.Changed...)
+
+	// Restored banks' HQs can be among the inserted ones
+	if len(inserted) > 0 {
+		err = execInsertBanks(tx, inserted)
+		if err != nil {
+			return BankDiff{}, err
+		}
+	}
+
+	for _, b := range updated {
+		_, err = tx.NamedExec(`UPDATE bank SET hq_swift_code=:hq_swift_code, is_headquarter=:is_headquarter, bank_name=:bank_name,
+			address=:address, town_name=:town_name, country_iso2_code=:country_iso2_code, country_name=:country_name, deleted_at=NULL
+			WHERE swift_code=:swift_code;`, b)
+		if err != nil {
+			return BankDiff{}, err
+		}
+	}
+
+	if len(diff.Removed) > 0 {
+		// Soft deleted like from the API, so they can be restored
+		err = softDeleteBanks(tx, d, diff.Removed)
+		if err != nil {
+			return BankDiff{}, err
+		}
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return BankDiff{}, err
+	}
+
+	return diff, nil
+}
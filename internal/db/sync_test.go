@@ -0,0 +1,167 @@
+package db
+
+import (
+	"database/sql"
+	"testing"
+
+	"github.com/mwojtyna/swift-api/internal/utils"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var (
+	syncHq = Bank{
+		SwiftCode:       "ABCDGB2LXXX",
+		IsHeadquarter:   true,
+		BankName:        "HQ Bank",
+		Address:         "456 HQ Street",
+		CountryISO2Code: "GB",
+		CountryName:     "UNITED KINGDOM",
+	}
+	syncBranch = Bank{
+		SwiftCode:       "ABCDGB2L001",
+		HqSwiftCode:     sql.NullString{String: syncHq.SwiftCode, Valid: true},
+		BankName:        "Branch Bank",
+		Address:         "123 Branch St",
+		CountryISO2Code: "GB",
+		CountryName:     "UNITED KINGDOM",
+	}
+	syncOther = Bank{
+		SwiftCode:       "EFGHPLPWXXX",
+		IsHeadquarter:   true,
+		BankName:        "Other Bank",
+		Address:         "789 Other St",
+		CountryISO2Code: "PL",
+		CountryName:     "POLAND",
+	}
+)
+
+func TestDiffBanks(t *testing.T) {
+	changedHq := syncHq
+	changedHq.Address = "1 New Street"
+	unlinkedBranch := syncBranch
+	unlinkedBranch.HqSwiftCode = sql.NullString{}
+
+	tests := []struct {
+		name          string
+		current       []Bank
+		incoming      []Bank
+		deleteMissing bool
+		want          BankDiff
+	}{
+		{
+			name:     "nothing changed",
+			current:  []Bank{syncHq, syncBranch},
+			incoming: []Bank{syncHq, syncBranch},
+			want:     BankDiff{},
+		},
+		{
+			name:     "added banks have HQs first",
+			current:  []Bank{},
+			incoming: []Bank{syncBranch, syncHq},
+			want:     BankDiff{Added: []Bank{syncHq, syncBranch}},
+		},
+		{
+			name:     "changed bank",
+			current:  []Bank{syncHq, syncBranch},
+			incoming: []Bank{changedHq, syncBranch},
+			want:     BankDiff{Changed: []Bank{changedHq}},
+		},
+		{
+			name:     "missing banks are kept by default",
+			current:  []Bank{syncHq, syncBranch, syncOther},
+			incoming: []Bank{syncHq, syncBranch},
+			want:     BankDiff{},
+		},
+		{
+			name:          "missing banks are removed with deleteMissing",
+			current:       []Bank{syncHq, syncBranch, syncOther},
+			incoming:      []Bank{syncHq, syncBranch},
+			deleteMissing: true,
+			want:          BankDiff{Removed: []string{syncOther.SwiftCode}},
+		},
+		{
+			name:     "branch stays linked to HQ missing from the import",
+			current:  []Bank{syncHq, syncBranch},
+			incoming: []Bank{unlinkedBranch},
+			want:     BankDiff{},
+		},
+		{
+			name:          "branch is unlinked when its HQ is removed",
+			current:       []Bank{syncHq, syncBranch},
+			incoming:      []Bank{unlinkedBranch},
+			deleteMissing: true,
+			want:          BankDiff{Changed: []Bank{unlinkedBranch}, Removed: []string{syncHq.SwiftCode}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := DiffBanks(tt.current, tt.incoming, tt.deleteMissing)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestSyncBanks(t *testing.T) {
+	t.Parallel()
+	utils.TestWithPostgres(func(args utils.TestWithPostgresArgs) {
+		db, err := Connect(args.Env.DB_USER, args.Env.DB_PASS, args.Env.DB_NAME, args.Env.DB_HOST, args.Port)
+		require.NoError(t, err)
+		t.Cleanup(func() {
+			db.Close()
+		})
+
+		changedBranch := syncBranch
+		changedBranch.BankName = "Renamed Branch"
+
+		t.Run("adds, changes and removes banks", func(t *testing.T) {
+			// Arrange
+			err := insertBanks(db, []Bank{syncHq, syncBranch, syncOther})
+			require.NoError(t, err)
+			t.Cleanup(func() {
+				truncateBanks(db)
+			})
+			newBank := ukBank
+
+			// Act
+			diff, err := SyncBanks(db, []Bank{syncHq, changedBranch, newBank}, SyncOptions{DeleteMissing: true}, testAudit)
+
+			// Assert
+			require.NoError(t, err)
+			assert.Equal(t, BankDiff{Added: []Bank{newBank}, Changed: []Bank{changedBranch}, Removed: []string{syncOther.SwiftCode}}, diff)
+
+			var banks []Bank
+			err = db.Select(&banks, "SELECT * FROM bank WHERE deleted_at IS NULL ORDER BY swift_code")
+			require.NoError(t, err)
+			assert.Equal(t, []Bank{changedBranch, syncHq, newBank}, withoutRevisions(banks))
+
+			// Removed banks are only soft deleted
+			var deletedCodes []string
+			err = db.Select(&deletedCodes, "SELECT swift_code FROM bank WHERE deleted_at IS NOT NULL")
+			require.NoError(t, err)
+			assert.Equal(t, []string{syncOther.SwiftCode}, deletedCodes)
+		})
+
+		t.Run("dry run changes nothing", func(t *testing.T) {
+			// Arrange
+			err := insertBanks(db, []Bank{syncHq, syncBranch, syncOther})
+			require.NoError(t, err)
+			t.Cleanup(func() {
+				truncateBanks(db)
+			})
+
+			// Act
+			diff, err := SyncBanks(db, []Bank{syncHq, changedBranch}, SyncOptions{DeleteMissing: true, DryRun: true}, testAudit)
+
+			// Assert
+			require.NoError(t, err)
+			assert.Equal(t, BankDiff{Changed: []Bank{changedBranch}, Removed: []string{syncOther.SwiftCode}}, diff)
+
+			var banks []Bank
+			err = db.Select(&banks, "SELECT * FROM bank ORDER BY swift_code")
+			require.NoError(t, err)
+			assert.Equal(t, []Bank{syncBranch, syncHq, syncOther}, withoutRevisions(banks))
+		})
+	})
+}
@@ -0,0 +1,332 @@
+package migrate
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io/fs"
+	"regexp"
+	"slices"
+	"strconv"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/mwojtyna/swift-api/migrations"
+)
+
+type Migration struct {
+	Version int
+	Name    string
+	Up      string
+	Down    string
+}
+
+type Status struct {
+	Migration
+	Applied bool
+}
+
+// Applies the embedded migrations of the database's driver. The current version is kept in a schema_migrations table
+// compatible with golang-migrate, so databases migrated with its CLI can be taken over.
+type Migrator struct {
+	db         *sqlx.DB
+	migrations []Migration
+}
+
+// Postgres and SQLite are supported, picked by the driver name
+func New(db *sqlx.DB) (*Migrator, error) {
+	var fsys fs.FS
+	switch db.DriverName() {
+	case "postgres":
+		fsys = migrations.Postgres
+	case "sqlite":
+		sub, err := fs.Sub(migrations.Sqlite, "sqlite")
+		if err != nil {
+			return nil, err
+		}
+		fsys = sub
+	default:
+		return nil, fmt.Errorf(`No migrations for driver "%s"`, db.DriverName())
+	}
+
+	loaded, err := Load(fsys)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Migrator{db: db, migrations: loaded}, nil
+}
+
+var fileNameRegex = regexp.MustCompile(`^(\d+)_(.+)\.(up|down)\.sql$`)
+
+// Reads migrations named like 000001_create_bank.up.sql from the root of fsys, ordered by version.
+// Every version needs both an up and a down file, other files are ignored.
+func Load(fsys fs.FS) ([]Migration, error) {
+	entries, err := fs.ReadDir(fsys, ".")
+	if err != nil {
+		return nil, err
+	}
+
+	byVersion := make(map[int]*Migration)
+	for _, entry := range entries {
+		match := fileNameRegex.FindStringSubmatch(entry.Name())
+		if entry.IsDir() || match == nil {
+			continue
+		}
+
+		version, err := strconv.Atoi(match[1])
+		if err != nil || version == 0 {
+			return nil, fmt.Errorf("Invalid migration version in '%s'", entry.Name())
+		}
+		contents, err := fs.ReadFile(fsys, entry.Name())
+		if err != nil {
+			return nil, err
+		}
+
+		m, ok := byVersion[version]
+		if !ok {
+			m = &Migration{Version: version, Name: match[2]}
+			byVersion[version] = m
+		} else if m.Name != match[2] {
+			return nil, fmt.Errorf("Migrations '%s' and '%s' have the same version", m.Name, match[2])
+		}
+		if match[3] == "up" {
+			m.Up = string(contents)
+		} else {
+			m.Down = string(contents)
+		}
+	}
+
+	loaded := make([]Migration, 0, len(byVersion))
+	for _, m := range byVersion {
+		if m.Up == "" || m.Down == "" {
+			return nil, fmt.Errorf("Migration %d_%s needs both an up and a down file", m.Version, m.Name)
+		}
+		loaded = append(loaded, *m)
+	}
+	slices.SortFunc(loaded, func(a, b Migration) int { return a.Version - b.Version })
+
+	return loaded, nil
+}
+
+// Applies all pending migrations, each in its own transaction. Returns the ones which were applied,
+// none if another instance got to them first.
+func (m *Migrator) Up() ([]Migration, error) {
+	var applied []Migration
+
+	err := m.withLock(func(conn *sqlx.Conn) error {
+		for _, migration := range m.migrations {
+			ran, err := m.step(conn, func(version int) (int, string, bool) {
+				return migration.Version, migration.Up, version < migration.Version
+			})
+			if err != nil {
+				return fmt.Errorf("migration %d_%s failed: %w", migration.Version, migration.Name, err)
+			}
+			if ran {
+				applied = append(applied, migration)
+			}
+		}
+		return nil
+	})
+
+	return applied, err
+}
+
+// Reverts the last steps migrations, each in its own transaction. Returns the ones which were reverted, latest first.
+func (m *Migrator) Down(steps int) ([]Migration, error) {
+	var reverted []Migration
+
+	err := m.withLock(func(conn *sqlx.Conn) error {
+		for range steps {
+			var current Migration
+			unknownVersion := 0
+			ran, err := m.step(conn, func(version int) (int, string, bool) {
+				i := slices.IndexFunc(m.migrations, func(migration Migration) bool { return migration.Version == version })
+				if i == -1 {
+					unknownVersion = version
+					return 0, "", false
+				}
+				current = m.migrations[i]
+
+				previous := 0
+				if i > 0 {
+					previous = m.migrations[i-1].Version
+				}
+				return previous, current.Down, true
+			})
+			if err != nil {
+				return fmt.Errorf("reverting migration %d_%s failed: %w", current.Version, current.Name, err)
+			}
+			if unknownVersion != 0 {
+				return fmt.Errorf("Database is at version %d, which this binary doesn't know how to revert", unknownVersion)
+			}
+			if !ran {
+				break
+			}
+			reverted = append(reverted, current)
+		}
+		return nil
+	})
+
+	return reverted, err
+}
+
+// Returns the version of the last applied migration, 0 if there isn't one, and whether a migration
+// run by golang-migrate failed halfway.
+func (m *Migrator) Version() (int, bool, error) {
+	err := createVersionTable(m.db)
+	if err != nil {
+		return 0, false, err
+	}
+
+	return readVersion(m.db)
+}
+
+// Lists all migrations and whether they're applied
+func (m *Migrator) Status() ([]Status, error) {
+	version, _, err := m.Version()
+	if err != nil {
+		return nil, err
+	}
+
+	statuses := make([]Status, len(m.migrations))
+	for i, migration := range m.migrations {
+		statuses[i] = Status{Migration: migration, Applied: migration.Version <= version}
+	}
+
+	return statuses, nil
+}
+
+// Returns the migrations Up would apply without changing anything in the database, not even creating
+// the schema_migrations table, so it can be used where the database must only be read. Fails if the database is dirty.
+func (m *Migrator) Pending() ([]Migration, error) {
+	exists, err := m.versionTableExists()
+	if err != nil {
+		return nil, err
+	}
+
+	version := 0
+	if exists {
+		var dirty bool
+		version, dirty, err = readVersion(m.db)
+		if err != nil {
+			return nil, err
+		}
+		if dirty {
+			return nil, fmt.Errorf("Database is dirty at version %d, fix the schema by hand and set dirty to false in schema_migrations", version)
+		}
+	}
+
+	var pending []Migration
+	for _, migration := range m.migrations {
+		if migration.Version > version {
+			pending = append(pending, migration)
+		}
+	}
+
+	return pending, nil
+}
+
+func (m *Migrator) versionTableExists() (bool, error) {
+	query := "SELECT to_regclass('schema_migrations') IS NOT NULL;"
+	if m.db.DriverName() == "sqlite" {
+		query = "SELECT EXISTS (SELECT 1 FROM sqlite_master WHERE type='table' AND name='schema_migrations');"
+	}
+
+	var exists bool
+	err := m.db.Get(&exists, query)
+	return exists, err
+}
+
+// Arbitrary, only has to be the same for all instances
+const advisoryLockId = 4_142_020_250
+
+// Runs f on a single connection. On Postgres, that connection holds an advisory lock, so concurrent instances
+// wait for each other. On SQLite, every step's transaction locks the whole database anyway.
+func (m *Migrator) withLock(f func(conn *sqlx.Conn) error) error {
+	ctx := context.Background()
+	conn, err := m.db.Connx(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	if m.db.DriverName() == "postgres" {
+		_, err = conn.ExecContext(ctx, "SELECT pg_advisory_lock($1);", advisoryLockId)
+		if err != nil {
+			return err
+		}
+		defer conn.ExecContext(ctx, "SELECT pg_advisory_unlock($1);", advisoryLockId)
+	}
+
+	err = createVersionTable(conn)
+	if err != nil {
+		return err
+	}
+
+	return f(conn)
+}
+
+// Reads the version in a transaction and runs the SQL returned by next, if it says so, setting the new version
+// in the same transaction. Reading the version again for every step means a step another instance already
+// ran is skipped. Returns whether the SQL ran.
+func (m *Migrator) step(conn *sqlx.Conn, next func(version int) (newVersion int, query string, run bool)) (bool, error) {
+	tx, err := conn.BeginTxx(context.Background(), nil)
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback()
+
+	version, dirty, err := readVersion(tx)
+	if err != nil {
+		return false, err
+	}
+	if dirty {
+		return false, fmt.Errorf("Database is dirty at version %d, fix the schema by hand and set dirty to false in schema_migrations", version)
+	}
+
+	newVersion, query, run := next(version)
+	if !run {
+		return false, nil
+	}
+
+	_, err = tx.Exec(query)
+	if err != nil {
+		return false, err
+	}
+
+	_, err = tx.Exec("DELETE FROM schema_migrations;")
+	if err != nil {
+		return false, err
+	}
+	if newVersion > 0 {
+		_, err = tx.Exec("INSERT INTO schema_migrations (version, dirty) VALUES ($1, $2);", newVersion, false)
+		if err != nil {
+			return false, err
+		}
+	}
+
+	return true, tx.Commit()
+}
+
+// Same definition as golang-migrate
+func createVersionTable(e sqlx.ExecerContext) error {
+	_, err := e.ExecContext(context.Background(), "CREATE TABLE IF NOT EXISTS schema_migrations (version BIGINT NOT NULL PRIMARY KEY, dirty BOOLEAN NOT NULL);")
+	return err
+}
+
+func readVersion(q sqlx.Queryer) (int, bool, error) {
+	var row struct {
+		Version int  `db:"version"`
+		Dirty   bool `db:"dirty"`
+	}
+
+	err := sqlx.Get(q, &row, "SELECT version, dirty FROM schema_migrations LIMIT 1;")
+	if errors.Is(err, sql.ErrNoRows) {
+		return 0, false, nil
+	} else if err != nil {
+		return 0, false, err
+	}
+
+	return row.Version, row.Dirty, nil
+}
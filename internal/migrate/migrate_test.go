@@ -0,0 +1,212 @@
+package migrate
+
+import (
+	"path/filepath"
+	"sync"
+	"testing"
+	"testing/fstest"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	_ "modernc.org/sqlite"
+)
+
+func testMigrator(t *testing.T, path string) (*Migrator, *sqlx.DB) {
+	t.Helper()
+
+	// Same as db.ConnectSqlite, which can't be imported here because of an import cycle through utils
+	sqlite, err := sqlx.Open("sqlite", "file:"+path+"?_pragma=foreign_keys(1)&_pragma=busy_timeout(5000)&_pragma=journal_mode(WAL)&_txlock=immediate")
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		sqlite.Close()
+	})
+
+	migrator, err := New(sqlite)
+	require.NoError(t, err)
+
+	return migrator, sqlite
+}
+
+func TestLoad(t *testing.T) {
+	file := func(s string) *fstest.MapFile { return &fstest.MapFile{Data: []byte(s)} }
+
+	tests := []struct {
+		name     string
+		fsys     fstest.MapFS
+		expected []Migration
+		wantErr  bool
+	}{
+		{
+			name: "ordered by version",
+			fsys: fstest.MapFS{
+				"000002_second.up.sql":   file("up 2"),
+				"000002_second.down.sql": file("down 2"),
+				"000001_first.up.sql":    file("up 1"),
+				"000001_first.down.sql":  file("down 1"),
+				"embed.go":               file("package migrations"),
+			},
+			expected: []Migration{
+				{Version: 1, Name: "first", Up: "up 1", Down: "down 1"},
+				{Version: 2, Name: "second", Up: "up 2", Down: "down 2"},
+			},
+		},
+		{
+			name: "missing down",
+			fsys: fstest.MapFS{
+				"000001_first.up.sql": file("up 1"),
+			},
+			wantErr: true,
+		},
+		{
+			name: "same version",
+			fsys: fstest.MapFS{
+				"000001_first.up.sql":   file("up 1"),
+				"000001_first.down.sql": file("down 1"),
+				"000001_other.up.sql":   file("up 1"),
+			},
+			wantErr: true,
+		},
+		{
+			name: "version 0",
+			fsys: fstest.MapFS{
+				"000000_first.up.sql":   file("up 0"),
+				"000000_first.down.sql": file("down 0"),
+			},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Act
+			got, err := Load(tt.fsys)
+
+			// Assert
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.expected, got)
+		})
+	}
+}
+
+func TestMigrator(t *testing.T) {
+	// Arrange
+	migrator, sqlite := testMigrator(t, filepath.Join(t.TempDir(), "swift.db"))
+	latest := migrator.migrations[len(migrator.migrations)-1].Version
+	tableExists := func() bool {
+		var count int
+		require.NoError(t, sqlite.Get(&count, "SELECT COUNT(*) FROM sqlite_master WHERE type='table' AND name='bank';"))
+		return count == 1
+	}
+
+	t.Run("up applies pending migrations", func(t *testing.T) {
+		applied, err := migrator.Up()
+		require.NoError(t, err)
+		assert.Len(t, applied, len(migrator.migrations))
+		assert.True(t, tableExists())
+
+		applied, err = migrator.Up()
+		require.NoError(t, err)
+		assert.Empty(t, applied)
+
+		version, dirty, err := migrator.Version()
+		require.NoError(t, err)
+		assert.Equal(t, latest, version)
+		assert.False(t, dirty)
+	})
+
+	t.Run("down reverts the latest", func(t *testing.T) {
+		reverted, err := migrator.Down(1)
+		require.NoError(t, err)
+		require.Len(t, reverted, 1)
+		assert.Equal(t, latest, reverted[0].Version)
+
+		statuses, err := migrator.Status()
+		require.NoError(t, err)
+		for _, s := range statuses {
+			assert.Equal(t, s.Version != latest, s.Applied, "migration %d", s.Version)
+		}
+	})
+
+	t.Run("down stops at version 0", func(t *testing.T) {
+		reverted, err := migrator.Down(10)
+		require.NoError(t, err)
+		assert.Len(t, reverted, len(migrator.migrations)-1)
+		assert.False(t, tableExists())
+
+		version, _, err := migrator.Version()
+		require.NoError(t, err)
+		assert.Equal(t, 0, version)
+	})
+}
+
+func TestMigratorPending(t *testing.T) {
+	// Arrange
+	migrator, sqlite := testMigrator(t, filepath.Join(t.TempDir(), "swift.db"))
+	versionTableExists := func() bool {
+		var count int
+		require.NoError(t, sqlite.Get(&count, "SELECT COUNT(*) FROM sqlite_master WHERE type='table' AND name='schema_migrations';"))
+		return count == 1
+	}
+
+	// Act & Assert
+	pending, err := migrator.Pending()
+	require.NoError(t, err)
+	assert.Equal(t, migrator.migrations, pending)
+	assert.False(t, versionTableExists(), "checking doesn't change the database")
+
+	_, err = migrator.Up()
+	require.NoError(t, err)
+	_, err = migrator.Down(1)
+	require.NoError(t, err)
+	pending, err = migrator.Pending()
+	require.NoError(t, err)
+	assert.Equal(t, migrator.migrations[len(migrator.migrations)-1:], pending)
+
+	_, err = sqlite.Exec("UPDATE schema_migrations SET dirty = true;")
+	require.NoError(t, err)
+	_, err = migrator.Pending()
+	assert.Error(t, err)
+}
+
+func TestMigratorConcurrentUp(t *testing.T) {
+	// Arrange
+	path := filepath.Join(t.TempDir(), "swift.db")
+	first, _ := testMigrator(t, path)
+	second, _ := testMigrator(t, path)
+
+	// Act
+	var wg sync.WaitGroup
+	var applied [2][]Migration
+	for i, migrator := range []*Migrator{first, second} {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			var err error
+			applied[i], err = migrator.Up()
+			assert.NoError(t, err)
+		}()
+	}
+	wg.Wait()
+
+	// Assert
+	assert.Len(t, append(applied[0], applied[1]...), len(first.migrations), "every migration should run exactly once")
+}
+
+func TestMigratorDirty(t *testing.T) {
+	// Arrange
+	migrator, sqlite := testMigrator(t, filepath.Join(t.TempDir(), "swift.db"))
+	_, err := sqlite.Exec("CREATE TABLE schema_migrations (version BIGINT NOT NULL PRIMARY KEY, dirty BOOLEAN NOT NULL); INSERT INTO schema_migrations VALUES (1, true);")
+	require.NoError(t, err)
+
+	// Act
+	applied, err := migrator.Up()
+
+	// Assert
+	assert.Error(t, err)
+	assert.Empty(t, applied)
+}
@@ -0,0 +1,148 @@
+package parser
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"maps"
+	"slices"
+	"strings"
+
+	"github.com/mwojtyna/swift-api/internal/utils"
+)
+
+// A bank field read from the CSV, named like in the API
+type Field string
+
+const (
+	FieldCountryISO2 Field = "countryISO2"
+	FieldSwiftCode   Field = "swiftCode"
+	FieldBankName    Field = "bankName"
+	FieldAddress     Field = "address"
+	FieldTownName    Field = "townName"
+	FieldCountryName Field = "countryName"
+)
+
+// Fields every CSV must have a column for. The town name is optional, it's only used when the address is empty.
+var requiredFields = []Field{FieldCountryISO2, FieldSwiftCode, FieldBankName, FieldAddress, FieldCountryName}
+
+var allFields = append(slices.Clone(requiredFields), FieldTownName)
+
+// Header names (aliases) of the column holding each field. Headers are matched case-insensitively
+// and ignoring surrounding whitespace, columns which don't match any field are ignored.
+type ColumnMapping map[Field][]string
+
+var DefaultColumnMapping = ColumnMapping{
+	FieldCountryISO2: {"COUNTRY ISO2 CODE", "COUNTRY ISO CODE", "COUNTRY CODE", "COUNTRY"},
+	FieldSwiftCode:   {"SWIFT CODE", "SWIFT", "BIC", "BIC CODE", "SWIFT/BIC"},
+	FieldBankName:    {"NAME", "BANK NAME", "INSTITUTION NAME"},
+	FieldAddress:     {"ADDRESS", "BANK ADDRESS"},
+	FieldTownName:    {"TOWN NAME", "TOWN", "CITY"},
+	FieldCountryName: {"COUNTRY NAME"},
+}
+
+// Reads a JSON object of field names to lists of aliases, e.g. {"swiftCode": ["BIC CODE 11"]}.
+// The aliases are added to the ones in DefaultColumnMapping.
+func LoadColumnMapping(r io.Reader) (ColumnMapping, error) {
+	var extra ColumnMapping
+	err := json.NewDecoder(r).Decode(&extra)
+	if err != nil {
+		return nil, fmt.Errorf("Invalid column mapping: %w", err)
+	}
+
+	mapping := make(ColumnMapping, len(DefaultColumnMapping))
+	for field, aliases := range DefaultColumnMapping {
+		mapping[field] = slices.Clone(aliases)
+	}
+	for field, aliases := range extra {
+		if !slices.Contains(allFields, field) {
+			return nil, fmt.Errorf(`Invalid column mapping: unknown field "%s", must be one of %s`, field, quoteJoin(allFields))
+		}
+		mapping[field] = append(mapping[field], aliases...)
+	}
+
+	err = mapping.validate()
+	if err != nil {
+		return nil, err
+	}
+
+	return mapping, nil
+}
+
+// An alias can only belong to one field, otherwise the column would be ambiguous
+func (m ColumnMapping) validate() error {
+	owners := make(map[string]Field)
+	for _, field := range slices.Sorted(maps.Keys(m)) {
+		for _, alias := range m[field] {
+			name := normalizeHeader(alias)
+			if owner, ok := owners[name]; ok && owner != field {
+				return fmt.Errorf(`Invalid column mapping: "%s" is an alias of both "%s" and "%s"`, alias, owner, field)
+			}
+			owners[name] = field
+		}
+	}
+
+	return nil
+}
+
+// Column index of every field, -1 if the CSV doesn't have the field
+type columns map[Field]int
+
+// Matches the header against the mapping. Fails if a required field has no column or a field has more than one.
+func (m ColumnMapping) resolve(header []string) (columns, error) {
+	cols := make(columns, len(allFields))
+	for _, field := range allFields {
+		cols[field] = -1
+	}
+
+	for i, name := range header {
+		field, ok := m.field(name)
+		if !ok {
+			continue
+		}
+
+		if prev := cols[field]; prev != -1 {
+			return nil, fmt.Errorf(`Invalid CSV header: columns "%s" and "%s" are both "%s"`, strings.TrimSpace(header[prev]), strings.TrimSpace(name), field)
+		}
+		cols[field] = i
+	}
+
+	for _, field := range requiredFields {
+		if cols[field] == -1 {
+			return nil, fmt.Errorf(`Invalid CSV header: missing column for "%s", expected one of %s`, field, quoteJoin(m[field]))
+		}
+	}
+
+	return cols, nil
+}
+
+func (m ColumnMapping) field(headerName string) (Field, bool) {
+	name := normalizeHeader(headerName)
+	for _, field := range allFields {
+		for _, alias := range m[field] {
+			if normalizeHeader(alias) == name {
+				return field, true
+			}
+		}
+	}
+
+	return "", false
+}
+
+// Returns the field's value, or an empty string if the CSV doesn't have it
+func (c columns) get(record []string, field Field) string {
+	i := c[field]
+	if i == -1 {
+		return ""
+	}
+	return record[i]
+}
+
+func normalizeHeader(name string) string {
+	return strings.ToUpper(strings.Join(strings.Fields(name), " "))
+}
+
+func quoteJoin[T ~string](values []T) string {
+	quoted := utils.Map(values, func(v T) string { return fmt.Sprintf(`"%s"`, v) })
+	return strings.Join(quoted, ", ")
+}
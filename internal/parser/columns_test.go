@@ -0,0 +1,124 @@
+package parser
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStreamCsvWithMapping(t *testing.T) {
+	tests := []struct {
+		name        string
+		input       string
+		mapping     ColumnMapping
+		wantCode    string
+		wantTown    string
+		wantAddress string
+		wantErr     string
+	}{
+		{
+			name: "reordered and renamed columns",
+			input: `TIME ZONE,BIC,Bank Name,COUNTRY NAME,  address ,country code
+Europe/Warsaw,BPHKPLPKXXX,BANK BPH SA,POLAND,UL. NORWIDA 1,PL`,
+			mapping:     DefaultColumnMapping,
+			wantCode:    "BPHKPLPKXXX",
+			wantAddress: "UL. NORWIDA 1",
+		},
+		{
+			name: "header with BOM",
+			input: "\ufeffCOUNTRY ISO2 CODE,SWIFT CODE,NAME,ADDRESS,TOWN NAME,COUNTRY NAME\n" +
+				"PL,BPHKPLPKXXX,BANK BPH SA,,GDANSK,POLAND",
+			mapping:     DefaultColumnMapping,
+			wantCode:    "BPHKPLPKXXX",
+			wantTown:    "GDANSK",
+			wantAddress: "GDANSK",
+		},
+		{
+			name: "custom mapping",
+			input: `ISO,CODE11,INSTITUTION,STREET,NATION
+PL,BPHKPLPKXXX,BANK BPH SA,UL. NORWIDA 1,POLAND`,
+			mapping: ColumnMapping{
+				FieldCountryISO2: {"ISO"},
+				FieldSwiftCode:   {"CODE11"},
+				FieldBankName:    {"INSTITUTION"},
+				FieldAddress:     {"STREET"},
+				FieldCountryName: {"NATION"},
+			},
+			wantCode:    "BPHKPLPKXXX",
+			wantAddress: "UL. NORWIDA 1",
+		},
+		{
+			name: "missing required column",
+			input: `COUNTRY ISO2 CODE,NAME,ADDRESS,COUNTRY NAME
+PL,BANK BPH SA,UL. NORWIDA 1,POLAND`,
+			mapping: DefaultColumnMapping,
+			wantErr: `Invalid CSV header: missing column for "swiftCode", expected one of "SWIFT CODE", "SWIFT", "BIC", "BIC CODE", "SWIFT/BIC"`,
+		},
+		{
+			name: "duplicate column",
+			input: `COUNTRY ISO2 CODE,SWIFT CODE,BIC,NAME,ADDRESS,COUNTRY NAME
+PL,BPHKPLPKXXX,BPHKPLPKXXX,BANK BPH SA,UL. NORWIDA 1,POLAND`,
+			mapping: DefaultColumnMapping,
+			wantErr: `Invalid CSV header: columns "SWIFT CODE" and "BIC" are both "swiftCode"`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Act
+			banks, err := CollectBanks(StreamCsvWithMapping(strings.NewReader(tt.input), tt.mapping))
+
+			// Assert
+			if tt.wantErr != "" {
+				assert.EqualError(t, err, tt.wantErr)
+				return
+			}
+			require.NoError(t, err)
+			require.Len(t, banks, 1)
+			assert.Equal(t, tt.wantCode, banks[0].SwiftCode)
+			assert.Equal(t, tt.wantTown, banks[0].TownName)
+			assert.Equal(t, tt.wantAddress, banks[0].Address)
+			assert.Equal(t, "PL", banks[0].CountryISO2Code)
+			assert.Equal(t, "POLAND", banks[0].CountryName)
+			assert.Equal(t, "BANK BPH SA", banks[0].BankName)
+		})
+	}
+}
+
+func TestLoadColumnMapping(t *testing.T) {
+	t.Run("adds aliases to the default ones", func(t *testing.T) {
+		// Act
+		mapping, err := LoadColumnMapping(strings.NewReader(`{"swiftCode": ["CODE11"]}`))
+
+		// Assert
+		require.NoError(t, err)
+		assert.Equal(t, append(DefaultColumnMapping[FieldSwiftCode], "CODE11"), mapping[FieldSwiftCode])
+		assert.Equal(t, DefaultColumnMapping[FieldBankName], mapping[FieldBankName])
+	})
+
+	t.Run("unknown field", func(t *testing.T) {
+		// Act
+		_, err := LoadColumnMapping(strings.NewReader(`{"swift": ["CODE11"]}`))
+
+		// Assert
+		assert.ErrorContains(t, err, `unknown field "swift"`)
+	})
+
+	t.Run("alias of two fields", func(t *testing.T) {
+		// Act
+		_, err := LoadColumnMapping(strings.NewReader(`{"bankName": ["bic"]}`))
+
+		// Assert
+		assert.ErrorContains(t, err, `is an alias of both "bankName" and "swiftCode"`)
+	})
+
+	t.Run("invalid JSON", func(t *testing.T) {
+		// Act
+		_, err := LoadColumnMapping(strings.NewReader(`["BIC"]`))
+
+		// Assert
+		assert.Error(t, err)
+	})
+}
@@ -0,0 +1,189 @@
+package parser
+
+import (
+	"bufio"
+	"io"
+	"iter"
+	"strings"
+
+	"github.com/mwojtyna/swift-api/internal/db"
+)
+
+// Layout of the FI (financial institution) record of SWIFT's fixed-length BIC Directory file (FI.dat), as described
+// in the "BIC Directory - Technical Specifications" SWIFT publishes to directory subscribers on swift.com. The file
+// itself is licensed, so testdata/bic-directory-fi.dat has records of banks from swift-codes.csv instead of a real
+// delivery. Every line is one record starting with a 2 character tag. Lines are padded with spaces to 714
+// characters, but may be cut short after the last non-empty value. HD (header) and TR (trailer) lines, which some
+// distributors wrap the file in, are skipped. Offsets are 0-based.
+//
+//	Offset  Length  Field
+//	0       2       Tag ("FI")
+//	2       1       Modification flag (A - added, M - modified, U - unchanged, D - deleted)
+//	3       11      BIC, with branch code XXX for the primary office
+//	14      6       CHIPS UID
+//	20      105     Institution name
+//	125     70      Branch information
+//	195     35      City heading
+//	230     4       Subtype indication
+//	234     60      Value added services
+//	294     35      Extra info
+//	329     140     Physical address, 4 lines of 35
+//	469     35      Location
+//	504     70      Country name
+//	574     35      POB number
+//	609     35      POB location
+//	644     70      POB country name
+type fixedWidthField struct {
+	name   string
+	offset int
+	length int
+}
+
+var (
+	fwTag              = fixedWidthField{"TAG", 0, 2}
+	fwModificationFlag = fixedWidthField{"MODIFICATION FLAG", 2, 1}
+	fwBic              = fixedWidthField{"BIC CODE", 3, 11}
+	fwInstitutionName  = fixedWidthField{"INSTITUTION NAME", 20, 105}
+	fwCityHeading      = fixedWidthField{"CITY HEADING", 195, 35}
+	fwPhysicalAddress  = fixedWidthField{"PHYSICAL ADDRESS", 329, 140}
+	fwLocation         = fixedWidthField{"LOCATION", 469, 35}
+	fwCountryName      = fixedWidthField{"COUNTRY NAME", 504, 70}
+)
+
+const (
+	fwAddressLineLen = 35
+	fwMinRecordLen   = 14 // Up to the end of the BIC
+)
+
+const (
+	fwTagHeader      = "HD"
+	fwTagInstitution = "FI"
+	fwTagTrailer     = "TR"
+	deletedFlag      = "D"
+)
+
+// Which layout field a bank field comes from, for errors. The country code is taken from the BIC.
+var fwFieldColumns = map[Field]fixedWidthField{
+	FieldCountryISO2: fwBic,
+	FieldSwiftCode:   fwBic,
+	FieldBankName:    fwInstitutionName,
+	FieldAddress:     fwPhysicalAddress,
+	FieldTownName:    fwCityHeading,
+	FieldCountryName: fwCountryName,
+}
+
+// Reads the fixed-width BIC Directory, the layout is described above. Records marked as deleted are skipped.
+type FixedWidthImporter struct{}
+
+func (FixedWidthImporter) Stream(r io.Reader) iter.Seq2[db.Bank, error] {
+	return func(yield func(db.Bank, error) bool) {
+		scanner := bufio.NewScanner(r)
+		seen := make(seenCodes)
+
+		for line := 1; scanner.Scan(); line++ {
+			text := strings.TrimRight(scanner.Text(), "\r")
+			if strings.TrimSpace(text) == "" {
+				continue
+			}
+
+			bank, ok, err := parseFixedWidthRecord(line, text)
+			if !ok {
+				continue
+			}
+			if err == nil {
+				if reason := seen.check(line, bank.SwiftCode); reason != "" {
+					err = &RowError{Line: line, Column: fwBic.name, Reason: reason, Record: []string{text}}
+				}
+			}
+			if !yield(bank, err) {
+				return
+			}
+		}
+
+		if err := scanner.Err(); err != nil {
+			yield(db.Bank{}, err)
+		}
+	}
+}
+
+// Returns false if the record should be skipped
+func parseFixedWidthRecord(line int, text string) (db.Bank, bool, error) {
+	rowError := func(column string, reason string) error {
+		return &RowError{Line: line, Column: column, Reason: reason, Record: []string{text}}
+	}
+
+	switch fwTag.get(text) {
+	case fwTagHeader, fwTagTrailer:
+		return db.Bank{}, false, nil
+	case fwTagInstitution:
+	default:
+		return db.Bank{}, true, rowError(fwTag.name, "unknown record type")
+	}
+
+	if len(text) < fwMinRecordLen {
+		return db.Bank{}, true, rowError("", "record is too short")
+	}
+	if fwModificationFlag.get(text) == deletedFlag {
+		return db.Bank{}, false, nil
+	}
+
+	swiftCode := fwBic.get(text)
+	country := ""
+	if len(swiftCode) >= 6 {
+		country = swiftCode[4:6]
+	}
+
+	// Join address lines like in the CSV, e.g. "UL. NORWIDA 1, GDANSK, 80-280"
+	var addressLines []string
+	address := fwPhysicalAddress.rawValue(text)
+	for i := 0; i < len(address); i += fwAddressLineLen {
+		addressLine := strings.TrimSpace(address[i:min(i+fwAddressLineLen, len(address))])
+		if addressLine != "" {
+			addressLines = append(addressLines, addressLine)
+		}
+	}
+
+	town := fwCityHeading.get(text)
+	if town == "" {
+		town = fwLocation.get(text)
+	}
+
+	bank, field, reason := buildBank(rawBank{
+		FieldCountryISO2: country,
+		FieldSwiftCode:   swiftCode, // BIC8 codes are normalized to XXX
+		FieldBankName:    fwInstitutionName.get(text),
+		FieldAddress:     strings.Join(addressLines, ", "),
+		FieldTownName:    town,
+		FieldCountryName: fwCountryName.get(text),
+	})
+	if reason != "" {
+		return db.Bank{}, true, rowError(fwFieldColumns[field].name, reason)
+	}
+
+	return bank, true, nil
+}
+
+// Returns the field's value without padding, empty if the line ends before it
+func (f fixedWidthField) get(text string) string {
+	return strings.TrimSpace(f.rawValue(text))
+}
+
+func (f fixedWidthField) rawValue(text string) string {
+	if f.offset >= len(text) {
+		return ""
+	}
+	end := min(f.offset+f.length, len(text))
+	return text[f.offset:end]
+}
+
+// Whether the line looks like a record of the fixed-width BIC Directory, used for detecting the format
+func isFixedWidthRecord(line string) bool {
+	tag := fwTag.get(line)
+	if tag != fwTagHeader && tag != fwTagInstitution {
+		return false
+	}
+
+	// A CSV with a column starting with the same letters would have a separator somewhere here
+	start := line[:min(fwMinRecordLen, len(line))]
+	return !strings.ContainsAny(start, ",;\t")
+}
@@ -0,0 +1,87 @@
+package parser
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"iter"
+
+	"github.com/mwojtyna/swift-api/internal/db"
+)
+
+// Reads banks from a file in some format. Like StreamCsv, implementations yield a *RowError for every invalid record,
+// including ones repeating an earlier record's SWIFT code, and keep going, banks come in file order and branches have the HQ code set assuming their HQ exists.
+type Importer interface {
+	Stream(r io.Reader) iter.Seq2[db.Bank, error]
+}
+
+// Reads the whole file with the importer and fails on the first invalid record. See CollectBanks for the order of the result.
+func Import(imp Importer, r io.Reader) ([]db.Bank, error) {
+	return CollectBanks(imp.Stream(r))
+}
+
+type Format string
+
+const (
+	FormatCsv        Format = "csv"
+	FormatFixedWidth Format = "fixed"
+	FormatXml        Format = "xml"
+)
+
+var Formats = []Format{FormatCsv, FormatFixedWidth, FormatXml}
+
+// The mapping is only used for CSV files
+func NewImporter(format Format, mapping ColumnMapping) (Importer, error) {
+	switch format {
+	case FormatCsv:
+		return CsvImporter{Mapping: mapping}, nil
+	case FormatFixedWidth:
+		return FixedWidthImporter{}, nil
+	case FormatXml:
+		return XmlImporter{}, nil
+	default:
+		return nil, fmt.Errorf(`Unknown format "%s", must be one of %s`, format, quoteJoin(Formats))
+	}
+}
+
+// How many bytes DetectFormat looks at
+const detectLen = 512
+
+// Guesses the format from the start of the file without consuming it, so br can be passed to the importer afterwards
+func DetectFormat(br *bufio.Reader) (Format, error) {
+	start, err := br.Peek(detectLen)
+	if err != nil && !errors.Is(err, io.EOF) && !errors.Is(err, bufio.ErrBufferFull) {
+		return "", err
+	}
+
+	start = bytes.TrimPrefix(start, []byte("\ufeff"))
+	start = bytes.TrimLeft(start, " \t\r\n")
+	if len(start) == 0 {
+		return "", fmt.Errorf("Can't detect the format of an empty file")
+	}
+
+	if start[0] == '<' {
+		return FormatXml, nil
+	}
+
+	firstLine, _, _ := bytes.Cut(start, []byte("\n"))
+	if isFixedWidthRecord(string(firstLine)) {
+		return FormatFixedWidth, nil
+	}
+
+	return FormatCsv, nil
+}
+
+type CsvImporter struct {
+	Mapping ColumnMapping // DefaultColumnMapping if nil
+}
+
+func (imp CsvImporter) Stream(r io.Reader) iter.Seq2[db.Bank, error] {
+	mapping := imp.Mapping
+	if mapping == nil {
+		mapping = DefaultColumnMapping
+	}
+	return StreamCsvWithMapping(r, mapping)
+}
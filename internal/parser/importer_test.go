@@ -0,0 +1,228 @@
+package parser
+
+import (
+	"bufio"
+	"database/sql"
+	"errors"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/mwojtyna/swift-api/internal/db"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var (
+	importedHq = db.Bank{
+		SwiftCode:       "BPHKPLPKXXX",
+		IsHeadquarter:   true,
+		BankName:        "BANK BPH SA",
+		Address:         "UL. CYPRIANA KAMILA NORWIDA 1, 80-280 GDANSK",
+		TownName:        "GDANSK",
+		CountryISO2Code: "PL",
+		CountryName:     "POLAND",
+	}
+	importedBranch = db.Bank{
+		SwiftCode:       "BPHKPLPKCUS",
+		HqSwiftCode:     sql.NullString{String: "BPHKPLPKXXX", Valid: true},
+		BankName:        "BANK BPH SA",
+		Address:         "WARSZAWA",
+		TownName:        "WARSZAWA",
+		CountryISO2Code: "PL",
+		CountryName:     "POLAND",
+	}
+)
+
+// Banks in testdata/bic-directory-fi.dat and testdata/bic-directory-fi.xml, in file order. The fixtures have records
+// of banks from swift-codes.csv in the FI record layout of SWIFT's BIC Directory, with the CHIPS UID and POB fields
+// left empty.
+var fixtureBanks = []db.Bank{
+	{
+		SwiftCode:       "ALBPPLPWXXX",
+		IsHeadquarter:   true,
+		BankName:        "ALIOR BANK SPOLKA AKCYJNA",
+		Address:         "LOPUSZANSKA BUSINESS PARK, LOPUSZANSKA 38 D, 02-232 WARSZAWA",
+		TownName:        "WARSZAWA",
+		CountryISO2Code: "PL",
+		CountryName:     "POLAND",
+	},
+	{
+		SwiftCode:       "ALBPPLPWCUS",
+		HqSwiftCode:     sql.NullString{String: "ALBPPLPWXXX", Valid: true},
+		BankName:        "ALIOR BANK SPOLKA AKCYJNA",
+		Address:         "LOPUSZANSKA BUSINESS PARK, LOPUSZANSKA 38 D, 02-232 WARSZAWA",
+		TownName:        "WARSZAWA",
+		CountryISO2Code: "PL",
+		CountryName:     "POLAND",
+	},
+	importedHq,
+	importedBranch,
+}
+
+func readFixture(t *testing.T, name string) string {
+	raw, err := os.ReadFile("testdata/" + name)
+	require.NoError(t, err)
+	return string(raw)
+}
+
+func streamAll(imp Importer, input string) ([]db.Bank, []*RowError, error) {
+	var banks []db.Bank
+	var errs []*RowError
+	for bank, err := range imp.Stream(strings.NewReader(input)) {
+		var rowErr *RowError
+		if errors.As(err, &rowErr) {
+			errs = append(errs, rowErr)
+		} else if err != nil {
+			return nil, nil, err
+		} else {
+			banks = append(banks, bank)
+		}
+	}
+	return banks, errs, nil
+}
+
+func TestFixedWidthImporter(t *testing.T) {
+	// Arrange
+	fixture := readFixture(t, "bic-directory-fi.dat")
+	hqRecord, _, _ := strings.Cut(fixture, "\n")
+	input := strings.Join([]string{
+		"HD20260101BIC DIRECTORY",
+		strings.TrimSuffix(fixture, "\n"),
+		strings.Replace(hqRecord, "ALBPPLPW", "ALBPQQPW", 1),
+		"XX something else",
+		hqRecord,
+		"TR00000005",
+	}, "\n")
+
+	// Act
+	banks, errs, err := streamAll(FixedWidthImporter{}, input)
+
+	// Assert
+	require.NoError(t, err)
+	assert.Equal(t, fixtureBanks, banks)
+	require.Len(t, errs, 3)
+	assert.Equal(t, 7, errs[0].Line)
+	assert.Equal(t, "BIC CODE", errs[0].Column)
+	assert.Equal(t, 8, errs[1].Line)
+	assert.Equal(t, "TAG", errs[1].Column)
+	assert.Equal(t, 9, errs[2].Line)
+	assert.Equal(t, "duplicate SWIFT code, already on line 2", errs[2].Reason)
+}
+
+func TestXmlImporter(t *testing.T) {
+	// Act
+	banks, errs, err := streamAll(XmlImporter{}, readFixture(t, "bic-directory-fi.xml"))
+
+	// Assert
+	require.NoError(t, err)
+	assert.Empty(t, errs)
+	assert.Equal(t, fixtureBanks, banks)
+}
+
+func TestXmlImporterInvalidRecord(t *testing.T) {
+	// Arrange
+	input := `<BICDirectory>
+  <FI>
+    <BicCode>BPHKQQPKXXX</BicCode>
+    <InstitutionName>INVALID BANK</InstitutionName>
+    <CountryName>POLAND</CountryName>
+  </FI>
+  <FI>
+    <BicCode>BPHKPLPKCUS</BicCode>
+    <InstitutionName>BANK BPH SA</InstitutionName>
+    <Location>WARSZAWA</Location>
+    <CountryName>POLAND</CountryName>
+  </FI>
+  <FI>
+    <BicCode>BPHKPLPKCUS</BicCode>
+    <InstitutionName>BANK BPH SA</InstitutionName>
+    <CountryName>POLAND</CountryName>
+  </FI>
+</BICDirectory>`
+
+	// Act
+	banks, errs, err := streamAll(XmlImporter{}, input)
+
+	// Assert
+	require.NoError(t, err)
+	assert.Equal(t, []db.Bank{importedBranch}, banks)
+	require.Len(t, errs, 2)
+	assert.Equal(t, 2, errs[0].Line)
+	assert.Equal(t, "BicCode", errs[0].Column)
+	assert.Equal(t, 13, errs[1].Line)
+	assert.Equal(t, "duplicate SWIFT code, already on line 7", errs[1].Reason)
+}
+
+func TestXmlImporterBrokenDocument(t *testing.T) {
+	// Act
+	_, err := Import(XmlImporter{}, strings.NewReader("<BICDirectory><FI>"))
+
+	// Assert
+	assert.Error(t, err)
+}
+
+func TestDetectFormat(t *testing.T) {
+	tests := []struct {
+		name    string
+		input   string
+		want    Format
+		wantErr bool
+	}{
+		{"csv", "COUNTRY ISO2 CODE,SWIFT CODE,CODE TYPE\nAL,AAISALTRXXX,BIC11", FormatCsv, false},
+		{"csv starting like a fixed-width tag", "FI,SWIFT CODE\n", FormatCsv, false},
+		{"fixed-width with header", "HD20260101BIC DIRECTORY\nFI...", FormatFixedWidth, false},
+		{"fixed-width without header", "FIABPHKPLPKXXX      BANK BPH SA", FormatFixedWidth, false},
+		{"xml", "\ufeff  <?xml version=\"1.0\"?><BICDirectory/>", FormatXml, false},
+		{"empty", " \n", "", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Arrange
+			br := bufio.NewReader(strings.NewReader(tt.input))
+
+			// Act
+			got, err := DetectFormat(br)
+
+			// Assert
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+
+			// Nothing was consumed
+			rest := new(strings.Builder)
+			_, err = br.WriteTo(rest)
+			require.NoError(t, err)
+			assert.Equal(t, tt.input, rest.String())
+		})
+	}
+}
+
+func TestNewImporter(t *testing.T) {
+	for _, format := range Formats {
+		imp, err := NewImporter(format, nil)
+		assert.NoError(t, err)
+		assert.NotNil(t, imp)
+	}
+
+	_, err := NewImporter("json", nil)
+	assert.Error(t, err)
+}
+
+func TestImport(t *testing.T) {
+	// Arrange
+	input := `COUNTRY ISO2 CODE,SWIFT CODE,NAME,ADDRESS,TOWN NAME,COUNTRY NAME
+PL,BPHKPLPKCUS,BANK BPH SA,,WARSZAWA,POLAND
+PL,BPHKPLPKXXX,BANK BPH SA,"UL. CYPRIANA KAMILA NORWIDA 1, 80-280 GDANSK",GDANSK,POLAND`
+
+	// Act
+	banks, err := Import(CsvImporter{}, strings.NewReader(input))
+
+	// Assert
+	require.NoError(t, err)
+	assert.Equal(t, []db.Bank{importedHq, importedBranch}, banks)
+}
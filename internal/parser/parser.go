@@ -3,76 +3,55 @@ package parser
 import (
 	"database/sql"
 	"encoding/csv"
+	"errors"
 	"fmt"
 	"io"
+	"iter"
+	"slices"
 	"strings"
 
+	"github.com/mwojtyna/swift-api/internal/bic"
 	"github.com/mwojtyna/swift-api/internal/db"
 )
 
-func ParseCsv(r io.Reader) ([]db.Bank, error) {
-	reader := csv.NewReader(r)
-	records, err := reader.ReadAll()
-	if err != nil {
-		return nil, err
+// An invalid row, the rest of the file can still be read
+type RowError struct {
+	Line   int    // 1-based line in the file where the row starts
+	Column string // Empty if the row couldn't be split into columns
+	Reason string
+	Record []string // Fields of the row as read, nil if it couldn't be split into columns
+	Header []string // Header of the file, so the record can be written back out
+}
+
+func (e *RowError) Error() string {
+	if e.Column == "" {
+		return fmt.Sprintf(`Invalid row on line %d: %s`, e.Line, e.Reason)
 	}
+	return fmt.Sprintf(`Invalid row on line %d in column "%s": %s`, e.Line, e.Column, e.Reason)
+}
 
+// Reads the whole CSV into memory and fails on the first invalid row. See CollectBanks for the order of the result.
+// For big files use StreamCsv.
+func ParseCsv(r io.Reader) ([]db.Bank, error) {
+	return CollectBanks(StreamCsv(r))
+}
+
+// Collects streamed banks and stops at the first error. HQ banks come first and branches whose HQ isn't among the banks
+// don't have an HQ code, so the result can be inserted as is.
+func CollectBanks(seq iter.Seq2[db.Bank, error]) ([]db.Bank, error) {
 	var banks, hqBanks []db.Bank
-	const hqPartLen = 8
 	hqBankCodes := make(map[string]struct{}) // Dumb hack because Go doesn't have sets
 
-	if len(records) < 2 || (len(records) > 1 && len(records[0]) != 8) {
-		return nil, fmt.Errorf("Invalid CSV")
-	}
-
-	for i, record := range records[1:] { // Skip header row
-		countryCode := strings.TrimSpace(strings.ToUpper(record[0]))
-		swiftCode := strings.TrimSpace(record[1])
-		// Skip index 2 (CODE TYPE) - "Redundant columns in the file may be omitted."
-		bankName := strings.TrimSpace(record[3])
-		bankAddress := strings.TrimSpace(record[4])
-		townName := strings.TrimSpace(record[5]) // Read town name in case the address is empty
-		countryName := strings.TrimSpace(strings.ToUpper(record[6]))
-		// Skip index 7 (TIME ZONE) - "Redundant columns in the file may be omitted."
-
-		if len(countryCode) != 2 {
-			return nil, fmt.Errorf(`Invalid row %d with invalid country code "%s" in "%s"`, i, countryCode, record)
-		}
-		if len(swiftCode) != 11 {
-			return nil, fmt.Errorf(`Invalid row %d with invalid SWIFT code "%s" in "%s"`, i, swiftCode, record)
+	for bank, err := range seq {
+		if err != nil {
+			return nil, err
 		}
 
-		// EDGE CASE: Set address to "town_name" if it is empty
-		var address string
-		if strings.TrimSpace(bankAddress) == "" {
-			address = townName
+		if bank.IsHeadquarter {
+			hqBankCodes[bank.SwiftCode] = struct{}{} // Add to set
+			hqBanks = append(hqBanks, bank)
 		} else {
-			address = bankAddress
-		}
-
-		isHq, hqCode := IsSwiftCodeHq(swiftCode)
-		bank := db.Bank{
-			SwiftCode:       swiftCode,
-			HqSwiftCode:     sql.NullString{},
-			IsHeadquarter:   isHq,
-			BankName:        bankName,
-			Address:         address,
-			CountryISO2Code: countryCode,
-			CountryName:     countryName,
-		}
-		// If swift code doesn't end with XXX, then the first 8 characters are the swift code for this bank's HQ (plus XXX)
-		// We assume that this HQ exists, later we remove ones that don't (we use a set to keep track of HQs that exist)
-		// I think this is the best way to minimize iterating through the banks
-		if !isHq {
-			bank.HqSwiftCode = sql.NullString{
-				String: hqCode,
-				Valid:  true,
-			}
 			banks = append(banks, bank)
-		} else {
-			// If it *does* end with XXX, then it is an HQ code and this bank is the HQ
-			hqBankCodes[swiftCode] = struct{}{} // Add to set
-			hqBanks = append(hqBanks, bank)
 		}
 	}
 
@@ -95,14 +74,191 @@ func ParseCsv(r io.Reader) ([]db.Bank, error) {
 	return sortedBanks, nil
 }
 
+// Reads the CSV one row at a time, so only the current row is kept in memory. Columns are found using DefaultColumnMapping.
+// Banks come in file order and branches have the HQ code set assuming their HQ exists,
+// it's up to the consumer to check that (db.LoadBanks does).
+//
+// Invalid rows, including ones repeating an earlier row's SWIFT code, yield a *RowError and reading continues, so consumers can either stop at the first error
+// or skip invalid rows with SkipInvalid. Any other error ends the iteration.
+func StreamCsv(r io.Reader) iter.Seq2[db.Bank, error] {
+	return StreamCsvWithMapping(r, DefaultColumnMapping)
+}
+
+// Same as StreamCsv, but finds columns using the given mapping
+func StreamCsvWithMapping(r io.Reader, mapping ColumnMapping) iter.Seq2[db.Bank, error] {
+	return func(yield func(db.Bank, error) bool) {
+		reader := csv.NewReader(r)
+		reader.ReuseRecord = true
+
+		header, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			yield(db.Bank{}, fmt.Errorf("Invalid CSV"))
+			return
+		} else if err != nil {
+			yield(db.Bank{}, err)
+			return
+		}
+		header = slices.Clone(header)
+		header[0] = strings.TrimPrefix(header[0], "\ufeff") // Excel likes to save CSVs with a BOM
+
+		cols, err := mapping.resolve(header)
+		if err != nil {
+			yield(db.Bank{}, err)
+			return
+		}
+
+		seen := make(seenCodes)
+		rows := 0
+		for ; ; rows++ {
+			record, err := reader.Read()
+			if errors.Is(err, io.EOF) {
+				break
+			}
+
+			var parseErr *csv.ParseError
+			if errors.As(err, &parseErr) {
+				rowErr := &RowError{Line: parseErr.StartLine, Reason: parseErr.Err.Error(), Header: header}
+				if errors.Is(parseErr.Err, csv.ErrFieldCount) {
+					rowErr.Record = slices.Clone(record)
+				}
+				if !yield(db.Bank{}, rowErr) {
+					return
+				}
+				continue
+			} else if err != nil {
+				yield(db.Bank{}, err)
+				return
+			}
+
+			line, _ := reader.FieldPos(0)
+			bank, err := parseRecord(line, header, cols, record)
+			if err == nil {
+				if reason := seen.check(line, bank.SwiftCode); reason != "" {
+					err = &RowError{Line: line, Column: strings.TrimSpace(header[cols[FieldSwiftCode]]), Reason: reason, Record: slices.Clone(record), Header: header}
+				}
+			}
+			if !yield(bank, err) {
+				return
+			}
+		}
+
+		// Only the header row
+		if rows == 0 {
+			yield(db.Bank{}, fmt.Errorf("Invalid CSV"))
+		}
+	}
+}
+
+// Passes valid banks through and calls onReject for every invalid row instead of yielding it.
+// Errors other than *RowError are still yielded.
+func SkipInvalid(seq iter.Seq2[db.Bank, error], onReject func(*RowError)) iter.Seq2[db.Bank, error] {
+	return func(yield func(db.Bank, error) bool) {
+		for bank, err := range seq {
+			var rowErr *RowError
+			if errors.As(err, &rowErr) {
+				onReject(rowErr)
+				continue
+			}
+
+			if !yield(bank, err) {
+				return
+			}
+		}
+	}
+}
+
+func parseRecord(line int, header []string, cols columns, record []string) (db.Bank, error) {
+	// Other columns are redundant - "Redundant columns in the file may be omitted."
+	raw := make(rawBank, len(allFields))
+	for _, field := range allFields {
+		raw[field] = cols.get(record, field)
+	}
+
+	bank, field, reason := buildBank(raw)
+	if reason != "" {
+		return db.Bank{}, &RowError{Line: line, Column: strings.TrimSpace(header[cols[field]]), Reason: reason, Record: slices.Clone(record), Header: header}
+	}
+
+	return bank, nil
+}
+
+// Lines where SWIFT codes were first seen in a file. A file with the same code twice can't be inserted,
+// so importers reject the repeated rows like other invalid ones.
+type seenCodes map[string]int
+
+// Returns why the bank on the line is a duplicate, empty if its code wasn't seen before
+func (s seenCodes) check(line int, swiftCode string) string {
+	if first, ok := s[swiftCode]; ok {
+		return fmt.Sprintf("duplicate SWIFT code, already on line %d", first)
+	}
+	s[swiftCode] = line
+	return ""
+}
+
+// Field values as read from a file, before cleaning them up
+type rawBank map[Field]string
+
+// Cleans up and validates the values, shared by all importers. If they're invalid,
+// returns the offending field and why it's invalid.
+func buildBank(raw rawBank) (db.Bank, Field, string) {
+	countryCode := strings.TrimSpace(strings.ToUpper(raw[FieldCountryISO2]))
+	swiftCode := bic.Normalize(raw[FieldSwiftCode]) // BIC8 codes are stored as BIC11
+	bankName := strings.TrimSpace(raw[FieldBankName])
+	bankAddress := strings.TrimSpace(raw[FieldAddress])
+	townName := strings.TrimSpace(raw[FieldTownName]) // Read town name in case the address is empty
+	countryName := strings.TrimSpace(strings.ToUpper(raw[FieldCountryName]))
+
+	if len(countryCode) != 2 {
+		return db.Bank{}, FieldCountryISO2, fmt.Sprintf(`invalid country code "%s"`, countryCode)
+	}
+	if err := bic.Validate(swiftCode); err != nil {
+		return db.Bank{}, FieldSwiftCode, err.Error()
+	}
+
+	// EDGE CASE: Set address to "town_name" if it is empty
+	var address string
+	if bankAddress == "" {
+		address = townName
+	} else {
+		address = bankAddress
+	}
+
+	isHq, hqCode := IsSwiftCodeHq(swiftCode)
+	bank := db.Bank{
+		SwiftCode:       swiftCode,
+		HqSwiftCode:     sql.NullString{},
+		IsHeadquarter:   isHq,
+		BankName:        bankName,
+		Address:         address,
+		TownName:        townName,
+		CountryISO2Code: countryCode,
+		CountryName:     countryName,
+	}
+	// If swift code doesn't end with XXX, then the first 8 characters are the swift code for this bank's HQ (plus XXX)
+	// We assume that this HQ exists, consumers remove the ones that don't
+	if !isHq {
+		bank.HqSwiftCode = sql.NullString{
+			String: hqCode,
+			Valid:  true,
+		}
+	}
+
+	return bank, "", ""
+}
+
 const hqPartLen = 8
 
 // Returns whether the bank is the headquarters, if not - returns the bank's headquarters code assuming they exist.
-// Assumes the given swift code is valid.
+// BIC8 codes are always headquarters. Codes too short to tell are treated as not being headquarters without one.
 func IsSwiftCodeHq(code string) (bool, string) {
-	if code[hqPartLen:] == "XXX" {
+	code = bic.Normalize(code)
+	if len(code) < bic.Bic11Len {
+		return false, ""
+	}
+
+	if code[hqPartLen:] == bic.PrimaryOfficeBranchCode {
 		return true, ""
 	} else {
-		return false, code[:hqPartLen] + "XXX"
+		return false, code[:hqPartLen] + bic.PrimaryOfficeBranchCode
 	}
 }
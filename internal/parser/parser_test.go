@@ -7,6 +7,7 @@ import (
 
 	"github.com/mwojtyna/swift-api/internal/db"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func TestParseCsv(t *testing.T) {
@@ -28,6 +29,7 @@ PL,BPHKPLPKCUS,BIC11,BANK BPH SA,"UL. CYPRIANA KAMILA NORWIDA 1  GDANSK, POMORSK
 					IsHeadquarter:   true,
 					BankName:        "BANK BPH SA",
 					Address:         "UL. CYPRIANA KAMILA NORWIDA 1  GDANSK, POMORSKIE, 80-280",
+					TownName:        "GDANSK",
 					CountryISO2Code: "PL",
 					CountryName:     "POLAND",
 				},
@@ -37,6 +39,7 @@ PL,BPHKPLPKCUS,BIC11,BANK BPH SA,"UL. CYPRIANA KAMILA NORWIDA 1  GDANSK, POMORSK
 					IsHeadquarter:   false,
 					BankName:        "BANK BPH SA",
 					Address:         "UL. CYPRIANA KAMILA NORWIDA 1  GDANSK, POMORSKIE, 80-280",
+					TownName:        "GDANSK",
 					CountryISO2Code: "PL",
 					CountryName:     "POLAND",
 				},
@@ -53,6 +56,7 @@ PL,BPHKPLPKXXX,BIC11,BANK BPH SA,,GDANSK,POLAND,Europe/Warsaw`,
 					IsHeadquarter:   true,
 					BankName:        "BANK BPH SA",
 					Address:         "GDANSK",
+					TownName:        "GDANSK",
 					CountryISO2Code: "PL",
 					CountryName:     "POLAND",
 				},
@@ -70,6 +74,40 @@ INVALIDCOUNTRYCODE,BPHKPLPKXXX,BIC11,BANK BPH SA,"UL. CYPRIANA KAMILA NORWIDA 1
 PL,SWIFTINVALID,BIC11,BANK BPH SA,"UL. CYPRIANA KAMILA NORWIDA 1  GDANSK, POMORSKIE, 80-280",GDANSK,POLAND,Europe/Warsaw`,
 			wantErr: true,
 		},
+		{
+			name: "BIC8 and lowercase swift codes are normalized",
+			input: `COUNTRY,SWIFT CODE,CODE TYPE,BANK NAME,BANK ADDRESS,TOWN NAME,COUNTRY NAME,TIME ZONE
+PL,BPHKPLPK,BIC8,BANK BPH SA,,GDANSK,POLAND,Europe/Warsaw
+PL,bphkplpkcus,BIC11,BANK BPH SA,,GDANSK,POLAND,Europe/Warsaw`,
+			want: []db.Bank{
+				{
+					SwiftCode:       "BPHKPLPKXXX",
+					HqSwiftCode:     sql.NullString{},
+					IsHeadquarter:   true,
+					BankName:        "BANK BPH SA",
+					Address:         "GDANSK",
+					TownName:        "GDANSK",
+					CountryISO2Code: "PL",
+					CountryName:     "POLAND",
+				},
+				{
+					SwiftCode:       "BPHKPLPKCUS",
+					HqSwiftCode:     sql.NullString{String: "BPHKPLPKXXX", Valid: true},
+					IsHeadquarter:   false,
+					BankName:        "BANK BPH SA",
+					Address:         "GDANSK",
+					TownName:        "GDANSK",
+					CountryISO2Code: "PL",
+					CountryName:     "POLAND",
+				},
+			},
+		},
+		{
+			name: "swift code breaking BIC rules",
+			input: `COUNTRY,SWIFT CODE,CODE TYPE,BANK NAME,BANK ADDRESS,TOWN NAME,COUNTRY NAME,TIME ZONE
+PL,BPHKQQPKXXX,BIC11,BANK BPH SA,"UL. CYPRIANA KAMILA NORWIDA 1  GDANSK, POMORSKIE, 80-280",GDANSK,POLAND,Europe/Warsaw`,
+			wantErr: true,
+		},
 		{
 			name: "invalid number of columns",
 			input: `COUNTRY,SWIFT CODE,CODE TYPE,BANK NAME,BANK ADDRESS,TOWN NAME,COUNTRY NAME
@@ -87,6 +125,7 @@ PL,ALBPPLP1BMW,BIC11,ALIOR BANK SPOLKA AKCYJNA,"  WARSZAWA, MAZOWIECKIE",WARSZAW
 					IsHeadquarter:   false,
 					BankName:        "ALIOR BANK SPOLKA AKCYJNA",
 					Address:         "WARSZAWA, MAZOWIECKIE",
+					TownName:        "WARSZAWA",
 					CountryISO2Code: "PL",
 					CountryName:     "POLAND",
 				},
@@ -114,6 +153,123 @@ PL,ALBPPLP1BMW,BIC11,ALIOR BANK SPOLKA AKCYJNA,"  WARSZAWA, MAZOWIECKIE",WARSZAW
 	}
 }
 
+func TestStreamCsv(t *testing.T) {
+	header := "COUNTRY,SWIFT CODE,CODE TYPE,BANK NAME,BANK ADDRESS,TOWN NAME,COUNTRY NAME,TIME ZONE\n"
+
+	t.Run("yields banks in file order", func(t *testing.T) {
+		// Arrange
+		r := strings.NewReader(header + `PL,BPHKPLPKCUS,BIC11,BANK BPH SA,,GDANSK,POLAND,Europe/Warsaw
+PL,BPHKPLPKXXX,BIC11,BANK BPH SA,,GDANSK,POLAND,Europe/Warsaw`)
+
+		// Act
+		var codes []string
+		for bank, err := range StreamCsv(r) {
+			require.NoError(t, err)
+			codes = append(codes, bank.SwiftCode)
+		}
+
+		// Assert
+		assert.Equal(t, []string{"BPHKPLPKCUS", "BPHKPLPKXXX"}, codes)
+	})
+
+	t.Run("yields row errors and continues", func(t *testing.T) {
+		// Arrange
+		r := strings.NewReader(header + `PL,BPHKPLPKXXX,BIC11,BANK BPH SA,,GDANSK,POLAND,Europe/Warsaw
+PL,SWIFTINVALID,BIC11,BANK BPH SA,,GDANSK,POLAND,Europe/Warsaw
+PL,BPHKPLPKCUS,BIC11,BANK BPH SA,,GDANSK,POLAND
+POLAND,BPHKPLPKCU2,BIC11,BANK BPH SA,,GDANSK,POLAND,Europe/Warsaw
+PL,BPHKPLPKCU3,BIC11,BANK BPH SA,,GDANSK,POLAND,Europe/Warsaw
+pl,bphkplpk,BIC8,BANK BPH SA,,GDANSK,POLAND,Europe/Warsaw`)
+
+		// Act
+		var codes []string
+		var errs []*RowError
+		for bank, err := range StreamCsv(r) {
+			if err != nil {
+				var rowErr *RowError
+				require.ErrorAs(t, err, &rowErr)
+				errs = append(errs, rowErr)
+			} else {
+				codes = append(codes, bank.SwiftCode)
+			}
+		}
+
+		// Assert
+		assert.Equal(t, []string{"BPHKPLPKXXX", "BPHKPLPKCU3"}, codes)
+		require.Len(t, errs, 4)
+
+		assert.Equal(t, 3, errs[0].Line)
+		assert.Equal(t, "SWIFT CODE", errs[0].Column)
+		assert.Contains(t, errs[0].Reason, "SWIFTINVALID")
+		assert.Equal(t, []string{"PL", "SWIFTINVALID", "BIC11", "BANK BPH SA", "", "GDANSK", "POLAND", "Europe/Warsaw"}, errs[0].Record)
+
+		assert.Equal(t, 4, errs[1].Line)
+		assert.Equal(t, "", errs[1].Column)
+		assert.Len(t, errs[1].Record, 7)
+
+		assert.Equal(t, 5, errs[2].Line)
+		assert.Equal(t, "COUNTRY", errs[2].Column)
+
+		assert.Equal(t, 7, errs[3].Line)
+		assert.Equal(t, "SWIFT CODE", errs[3].Column)
+		assert.Equal(t, "duplicate SWIFT code, already on line 2", errs[3].Reason)
+	})
+
+	t.Run("header only", func(t *testing.T) {
+		// Act
+		var errs []error
+		for _, err := range StreamCsv(strings.NewReader(header)) {
+			errs = append(errs, err)
+		}
+
+		// Assert
+		assert.Len(t, errs, 1)
+		assert.Error(t, errs[0])
+	})
+}
+
+func TestSkipInvalid(t *testing.T) {
+	// Arrange
+	r := strings.NewReader(`COUNTRY,SWIFT CODE,CODE TYPE,BANK NAME,BANK ADDRESS,TOWN NAME,COUNTRY NAME,TIME ZONE
+PL,SWIFTINVALID,BIC11,BANK BPH SA,,GDANSK,POLAND,Europe/Warsaw
+PL,BPHKPLPKXXX,BIC11,BANK BPH SA,,GDANSK,POLAND,Europe/Warsaw`)
+	var rejected []*RowError
+
+	// Act
+	banks, err := CollectBanks(SkipInvalid(StreamCsv(r), func(rowErr *RowError) {
+		rejected = append(rejected, rowErr)
+	}))
+
+	// Assert
+	require.NoError(t, err)
+	require.Len(t, banks, 1)
+	assert.Equal(t, "BPHKPLPKXXX", banks[0].SwiftCode)
+	require.Len(t, rejected, 1)
+	assert.Equal(t, 2, rejected[0].Line)
+}
+
+func TestRejectsWriter(t *testing.T) {
+	// Arrange
+	var buf strings.Builder
+	rw := NewRejectsWriter(&buf)
+
+	// Act
+	header := []string{"COUNTRY", "SWIFT CODE"}
+	err := rw.Write(&RowError{Line: 2, Column: "SWIFT CODE", Reason: "bad, code", Record: []string{"PL", "X"}, Header: header})
+	require.NoError(t, err)
+	err = rw.Write(&RowError{Line: 3, Reason: "wrong number of fields", Header: header})
+	require.NoError(t, err)
+	err = rw.Flush()
+
+	// Assert
+	require.NoError(t, err)
+	assert.Equal(t, 2, rw.Count())
+	assert.Equal(t, `LINE,COLUMN,REASON,COUNTRY,SWIFT CODE
+2,SWIFT CODE,"bad, code",PL,X
+3,,wrong number of fields
+`, buf.String())
+}
+
 func TestIsSwiftCodeHq(t *testing.T) {
 	var tests = []struct {
 		name   string
@@ -123,6 +279,9 @@ func TestIsSwiftCodeHq(t *testing.T) {
 	}{
 		{"hq code", "ABCDEFGHXXX", true, ""},
 		{"not hq code", "ABCDEFGHIJKL", false, "ABCDEFGHXXX"},
+		{"BIC8 code", "ABCDEFGH", true, ""},
+		{"lowercase hq code", "abcdefghxxx", true, ""},
+		{"too short", "ABC", false, ""},
 	}
 
 	for _, tt := range tests {
@@ -0,0 +1,50 @@
+package parser
+
+import (
+	"encoding/csv"
+	"io"
+	"strconv"
+)
+
+// Writes invalid rows as CSV, each one prefixed with where and why it was rejected.
+// The original fields come after that, so a fixed file can be made by cutting the first 3 columns.
+// The header is taken from the first row written.
+type RejectsWriter struct {
+	w           *csv.Writer
+	wroteHeader bool
+	count       int
+}
+
+func NewRejectsWriter(w io.Writer) *RejectsWriter {
+	return &RejectsWriter{w: csv.NewWriter(w)}
+}
+
+func (rw *RejectsWriter) Write(rowErr *RowError) error {
+	if !rw.wroteHeader {
+		header := append([]string{"LINE", "COLUMN", "REASON"}, rowErr.Header...)
+		err := rw.w.Write(header)
+		if err != nil {
+			return err
+		}
+		rw.wroteHeader = true
+	}
+
+	record := append([]string{strconv.Itoa(rowErr.Line), rowErr.Column, rowErr.Reason}, rowErr.Record...)
+	err := rw.w.Write(record)
+	if err != nil {
+		return err
+	}
+	rw.count++
+
+	return nil
+}
+
+// How many rows were written
+func (rw *RejectsWriter) Count() int {
+	return rw.count
+}
+
+func (rw *RejectsWriter) Flush() error {
+	rw.w.Flush()
+	return rw.w.Error()
+}
@@ -0,0 +1,74 @@
+package parser
+
+import (
+	"encoding/csv"
+	"io"
+
+	"github.com/mwojtyna/swift-api/internal/db"
+)
+
+// Columns written by CsvWriter, named with the first alias from DefaultColumnMapping so the file can be parsed again
+var exportFields = []Field{FieldCountryISO2, FieldSwiftCode, FieldBankName, FieldAddress, FieldTownName, FieldCountryName}
+
+// Writes banks as CSV which ParseCsv reads back into the same banks
+type CsvWriter struct {
+	w           *csv.Writer
+	wroteHeader bool
+}
+
+func NewCsvWriter(w io.Writer) *CsvWriter {
+	return &CsvWriter{w: csv.NewWriter(w)}
+}
+
+// Writes the header if it wasn't written yet
+func (cw *CsvWriter) WriteHeader() error {
+	if cw.wroteHeader {
+		return nil
+	}
+
+	header := make([]string, len(exportFields))
+	for i, field := range exportFields {
+		header[i] = DefaultColumnMapping[field][0]
+	}
+	cw.wroteHeader = true
+
+	return cw.w.Write(header)
+}
+
+func (cw *CsvWriter) Write(bank db.Bank) error {
+	err := cw.WriteHeader()
+	if err != nil {
+		return err
+	}
+
+	values := make([]string, len(exportFields))
+	for i, field := range exportFields {
+		values[i] = fieldValue(bank, field)
+	}
+
+	return cw.w.Write(values)
+}
+
+func fieldValue(bank db.Bank, field Field) string {
+	switch field {
+	case FieldCountryISO2:
+		return bank.CountryISO2Code
+	case FieldSwiftCode:
+		return bank.SwiftCode
+	case FieldBankName:
+		return bank.BankName
+	case FieldAddress:
+		return bank.Address
+	case FieldTownName:
+		return bank.TownName
+	case FieldCountryName:
+		return bank.CountryName
+	default:
+		return ""
+	}
+}
+
+func (cw *CsvWriter) Flush() error {
+	cw.w.Flush()
+	return cw.w.Error()
+}
@@ -0,0 +1,48 @@
+package parser
+
+import (
+	"bytes"
+	"database/sql"
+	"testing"
+
+	"github.com/mwojtyna/swift-api/internal/db"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCsvWriter(t *testing.T) {
+	// Arrange
+	banks := []db.Bank{
+		{
+			SwiftCode:       "BPHKPLPKXXX",
+			IsHeadquarter:   true,
+			BankName:        "BANK BPH SA",
+			Address:         `UL. "NORWIDA" 1, GDANSK`,
+			TownName:        "GDANSK",
+			CountryISO2Code: "PL",
+			CountryName:     "POLAND",
+		},
+		{
+			SwiftCode:       "BPHKPLPKCUS",
+			HqSwiftCode:     sql.NullString{String: "BPHKPLPKXXX", Valid: true},
+			BankName:        "BANK BPH SA",
+			Address:         "WARSZAWA",
+			TownName:        "WARSZAWA",
+			CountryISO2Code: "PL",
+			CountryName:     "POLAND",
+		},
+	}
+	var buf bytes.Buffer
+	cw := NewCsvWriter(&buf)
+
+	// Act
+	for _, bank := range banks {
+		require.NoError(t, cw.Write(bank))
+	}
+	require.NoError(t, cw.Flush())
+
+	// Assert
+	parsed, err := ParseCsv(&buf)
+	require.NoError(t, err)
+	assert.Equal(t, banks, parsed)
+}
@@ -0,0 +1,146 @@
+package parser
+
+import (
+	"encoding/xml"
+	"errors"
+	"io"
+	"iter"
+	"strings"
+
+	"github.com/mwojtyna/swift-api/internal/db"
+)
+
+// One FI record of the XML BIC Directory. SWIFT describes the XML delivery with the same record as the fixed-length
+// file (see fixedwidth.go), with one element per field named after it. Fields the API doesn't store are left out here:
+//
+//	<BICDirectory>
+//	  <FI>
+//	    <ModificationFlag>A</ModificationFlag>
+//	    <BicCode>BPHKPLPKXXX</BicCode>
+//	    <ChipsUid></ChipsUid>
+//	    <InstitutionName>BANK BPH SA</InstitutionName>
+//	    <BranchInformation></BranchInformation>
+//	    <CityHeading>GDANSK</CityHeading>
+//	    <SubtypeIndication>SUPE</SubtypeIndication>
+//	    <ValueAddedServices></ValueAddedServices>
+//	    <ExtraInfo></ExtraInfo>
+//	    <PhysicalAddress1>UL. CYPRIANA KAMILA NORWIDA 1</PhysicalAddress1>
+//	    <PhysicalAddress2>80-280 GDANSK</PhysicalAddress2>
+//	    <PhysicalAddress3></PhysicalAddress3>
+//	    <PhysicalAddress4></PhysicalAddress4>
+//	    <Location>GDANSK</Location>
+//	    <CountryName>POLAND</CountryName>
+//	    <PobNumber></PobNumber>
+//	    <PobLocation></PobLocation>
+//	    <PobCountryName></PobCountryName>
+//	  </FI>
+//	</BICDirectory>
+//
+// The country is taken from the BIC, like in the fixed-length file.
+type xmlInstitution struct {
+	ModificationFlag string `xml:"ModificationFlag"`
+	BicCode          string `xml:"BicCode"`
+	InstitutionName  string `xml:"InstitutionName"`
+	CityHeading      string `xml:"CityHeading"`
+	PhysicalAddress1 string `xml:"PhysicalAddress1"`
+	PhysicalAddress2 string `xml:"PhysicalAddress2"`
+	PhysicalAddress3 string `xml:"PhysicalAddress3"`
+	PhysicalAddress4 string `xml:"PhysicalAddress4"`
+	Location         string `xml:"Location"`
+	CountryName      string `xml:"CountryName"`
+}
+
+const xmlInstitutionElement = "FI"
+
+// Which element a bank field comes from, for errors
+var xmlFieldElements = map[Field]string{
+	FieldCountryISO2: "BicCode",
+	FieldSwiftCode:   "BicCode",
+	FieldBankName:    "InstitutionName",
+	FieldAddress:     "PhysicalAddress1",
+	FieldTownName:    "CityHeading",
+	FieldCountryName: "CountryName",
+}
+
+// Reads the XML BIC Directory, the layout is described above. Elements other than FI are ignored,
+// so the root element doesn't matter. Records marked as deleted are skipped.
+type XmlImporter struct{}
+
+func (XmlImporter) Stream(r io.Reader) iter.Seq2[db.Bank, error] {
+	return func(yield func(db.Bank, error) bool) {
+		decoder := xml.NewDecoder(r)
+		seen := make(seenCodes)
+
+		for {
+			token, err := decoder.Token()
+			if errors.Is(err, io.EOF) {
+				return
+			} else if err != nil {
+				// The document is broken, so the rest of it can't be read either
+				yield(db.Bank{}, err)
+				return
+			}
+
+			start, ok := token.(xml.StartElement)
+			if !ok || start.Name.Local != xmlInstitutionElement {
+				continue
+			}
+
+			line, _ := decoder.InputPos()
+			var inst xmlInstitution
+			err = decoder.DecodeElement(&inst, &start)
+			if err != nil {
+				yield(db.Bank{}, err)
+				return
+			}
+			if strings.TrimSpace(inst.ModificationFlag) == deletedFlag {
+				continue
+			}
+
+			bank, err := parseXmlInstitution(line, inst)
+			if err == nil {
+				if reason := seen.check(line, bank.SwiftCode); reason != "" {
+					err = &RowError{Line: line, Column: xmlFieldElements[FieldSwiftCode], Reason: reason, Record: []string{bank.SwiftCode, bank.BankName}}
+				}
+			}
+			if !yield(bank, err) {
+				return
+			}
+		}
+	}
+}
+
+func parseXmlInstitution(line int, inst xmlInstitution) (db.Bank, error) {
+	swiftCode := strings.TrimSpace(inst.BicCode)
+	country := ""
+	if len(swiftCode) >= 6 {
+		country = swiftCode[4:6]
+	}
+
+	var addressLines []string
+	for _, addressLine := range []string{inst.PhysicalAddress1, inst.PhysicalAddress2, inst.PhysicalAddress3, inst.PhysicalAddress4} {
+		addressLine = strings.TrimSpace(addressLine)
+		if addressLine != "" {
+			addressLines = append(addressLines, addressLine)
+		}
+	}
+
+	town := inst.CityHeading
+	if strings.TrimSpace(town) == "" {
+		town = inst.Location
+	}
+
+	bank, field, reason := buildBank(rawBank{
+		FieldCountryISO2: country,
+		FieldSwiftCode:   swiftCode,
+		FieldBankName:    inst.InstitutionName,
+		FieldAddress:     strings.Join(addressLines, ", "),
+		FieldTownName:    town,
+		FieldCountryName: inst.CountryName,
+	})
+	if reason != "" {
+		return db.Bank{}, &RowError{Line: line, Column: xmlFieldElements[field], Reason: reason, Record: []string{swiftCode, inst.InstitutionName}}
+	}
+
+	return bank, nil
+}
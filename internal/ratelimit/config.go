@@ -0,0 +1,129 @@
+package ratelimit
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/netip"
+	"os"
+	"strings"
+	"time"
+)
+
+// Token bucket: clients can make Burst requests at once, then RequestsPerSecond on average
+type Limit struct {
+	RequestsPerSecond float64 `json:"requestsPerSecond"`
+	Burst             int     `json:"burst"`
+}
+
+type Config struct {
+	// Clients without credentials are told apart by this header if it's set, e.g. "X-Client-ID", and by their IP
+	// otherwise. Like X-Forwarded-For, it's only read from trusted proxies, which have to set it.
+	ClientHeader string `json:"clientHeader"`
+	// IPs or CIDRs of proxies in front of the server. X-Forwarded-For is only read from them, to find the IP of
+	// clients without credentials. Other clients can't spoof their IP by sending it.
+	TrustedProxies []string `json:"trustedProxies"`
+	// Clients tracked at once, the least recently seen one is forgotten to make room, along with the quota it used.
+	// Bounds the memory used when many clients show up at once. 100000 if 0.
+	MaxClients int `json:"maxClients"`
+	// For routes without their own limit, nil leaves them unlimited
+	Default *Limit `json:"default"`
+	// Keyed by route pattern without the version prefix, e.g. "GET /swift-codes/{swiftCode}"
+	Routes map[string]Limit `json:"routes"`
+	// Requests per client per day, across all routes. 0 disables the quota.
+	DailyQuota int `json:"dailyQuota"`
+	// UTC time of day ("15:04") when quotas reset, midnight by default
+	QuotaResetAt string `json:"quotaResetAt"`
+}
+
+// Unknown fields are rejected, so typos don't silently turn limits off. Validated by New.
+func LoadConfigFile(path string) (Config, error) {
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return Config{}, err
+	}
+
+	var cfg Config
+	dec := json.NewDecoder(bytes.NewReader(raw))
+	dec.DisallowUnknownFields()
+	err = dec.Decode(&cfg)
+	if err != nil {
+		return Config{}, err
+	}
+
+	return cfg, nil
+}
+
+func (l Limit) validate() error {
+	if l.RequestsPerSecond <= 0 {
+		return fmt.Errorf("requestsPerSecond must be positive, got %v", l.RequestsPerSecond)
+	}
+	if l.Burst < 1 {
+		return fmt.Errorf("burst must be at least 1, got %d", l.Burst)
+	}
+	return nil
+}
+
+func (c Config) validate() error {
+	if c.Default != nil {
+		err := c.Default.validate()
+		if err != nil {
+			return fmt.Errorf("Default limit: %w", err)
+		}
+	}
+	for route, limit := range c.Routes {
+		method, path, found := strings.Cut(route, " ")
+		if !found || method == "" || !strings.HasPrefix(path, "/") {
+			return fmt.Errorf("Route '%s' must be a method and a path, e.g. 'GET /swift-codes/{swiftCode}'", route)
+		}
+		err := limit.validate()
+		if err != nil {
+			return fmt.Errorf("Route '%s': %w", route, err)
+		}
+	}
+	if c.DailyQuota < 0 {
+		return fmt.Errorf("dailyQuota can't be negative, got %d", c.DailyQuota)
+	}
+	if c.MaxClients < 0 {
+		return fmt.Errorf("maxClients can't be negative, got %d", c.MaxClients)
+	}
+	_, err := c.trustedProxies()
+	if err != nil {
+		return err
+	}
+	if c.ClientHeader != "" && len(c.TrustedProxies) == 0 {
+		return fmt.Errorf("clientHeader is only read from trustedProxies, so it needs at least one")
+	}
+	_, err = c.quotaResetAt()
+	return err
+}
+
+// Single IPs are turned into prefixes of their full length
+func (c Config) trustedProxies() ([]netip.Prefix, error) {
+	prefixes := make([]netip.Prefix, 0, len(c.TrustedProxies))
+	for _, proxy := range c.TrustedProxies {
+		if addr, err := netip.ParseAddr(proxy); err == nil {
+			prefixes = append(prefixes, netip.PrefixFrom(addr.Unmap(), addr.Unmap().BitLen()))
+			continue
+		}
+		prefix, err := netip.ParsePrefix(proxy)
+		if err != nil {
+			return nil, fmt.Errorf("trustedProxies must be IPs or CIDRs, got '%s'", proxy)
+		}
+		prefixes = append(prefixes, prefix.Masked())
+	}
+	return prefixes, nil
+}
+
+// Time since midnight UTC
+func (c Config) quotaResetAt() (time.Duration, error) {
+	if c.QuotaResetAt == "" {
+		return 0, nil
+	}
+
+	t, err := time.Parse("15:04", c.QuotaResetAt)
+	if err != nil {
+		return 0, fmt.Errorf("quotaResetAt must be a time like '00:00', got '%s'", c.QuotaResetAt)
+	}
+	return time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute, nil
+}
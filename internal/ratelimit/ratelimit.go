@@ -0,0 +1,289 @@
+// Per-client rate limiting with token buckets and daily quotas. State is kept in memory, so each server instance
+// limits clients separately.
+package ratelimit
+
+import (
+	"container/list"
+	"math"
+	"net/netip"
+	"strings"
+	"sync"
+	"time"
+)
+
+// How a request was limited, and what to tell the client about it
+type Decision struct {
+	Allowed bool
+
+	Limited    bool          // The route has a limit, the fields below are only set if it does
+	Limit      int           // Burst of the route's limit
+	Remaining  int           // Requests the client can make right away
+	Reset      time.Duration // Until the bucket is full again
+	RetryAfter time.Duration // Until the next request is allowed, if it wasn't
+
+	Quota          int // 0 if there's no quota, the fields below are only set if there is
+	QuotaRemaining int
+	QuotaReset     time.Duration
+	QuotaExceeded  bool
+}
+
+type bucket struct {
+	tokens  float64
+	updated time.Time
+}
+
+// Everything tracked about a client. A client without buckets and quota used is the same as one which isn't tracked.
+type client struct {
+	key       string
+	buckets   map[string]*bucket // Keyed by route
+	quotaUsed int
+	el        *list.Element
+}
+
+// Buckets which are full again are removed this often, a missing bucket is the same as a full one
+const cleanupInterval = time.Minute
+
+const defaultMaxClients = 100000
+
+type Limiter struct {
+	cfg            Config
+	maxClients     int
+	trustedProxies []netip.Prefix
+	quotaResetAt   time.Duration
+	now            func() time.Time
+
+	mu          sync.Mutex
+	clients     map[string]*client
+	lru         *list.List // Most recently seen client first
+	lastCleanup time.Time
+	quotaReset  time.Time // When quotas are cleared next
+}
+
+func New(cfg Config) (*Limiter, error) {
+	return newLimiter(cfg, time.Now)
+}
+
+func newLimiter(cfg Config, now func() time.Time) (*Limiter, error) {
+	err := cfg.validate()
+	if err != nil {
+		return nil, err
+	}
+
+	resetAt, _ := cfg.quotaResetAt()
+	proxies, _ := cfg.trustedProxies()
+	l := &Limiter{
+		cfg:            cfg,
+		maxClients:     cfg.MaxClients,
+		trustedProxies: proxies,
+		quotaResetAt:   resetAt,
+		now:            now,
+		clients:        make(map[string]*client),
+		lru:            list.New(),
+	}
+	if l.maxClients == 0 {
+		l.maxClients = defaultMaxClients
+	}
+	l.lastCleanup = now()
+	l.quotaReset = l.nextQuotaReset(now())
+	return l, nil
+}
+
+// The IP to limit a client without credentials by. X-Forwarded-For is followed from the end only through trusted
+// proxies, so entries added by the client itself are ignored. IPv6 clients usually get a whole /64, so they're
+// limited by it, otherwise they could get a new bucket for every address.
+func (l *Limiter) ClientIP(remoteAddr string, forwardedFor []string) string {
+	addr, err := netip.ParseAddrPort(remoteAddr)
+	if err != nil {
+		return remoteAddr
+	}
+	ip := addr.Addr().Unmap()
+
+	var hops []string
+	for _, header := range forwardedFor {
+		hops = append(hops, strings.Split(header, ",")...)
+	}
+	for i := len(hops) - 1; i >= 0 && l.trusted(ip); i-- {
+		hop, err := netip.ParseAddr(strings.TrimSpace(hops[i]))
+		if err != nil {
+			break
+		}
+		ip = hop.Unmap()
+	}
+
+	if ip.Is6() {
+		prefix, _ := ip.Prefix(64)
+		return prefix.String()
+	}
+	return ip.String()
+}
+
+func (l *Limiter) ClientHeader() string {
+	return l.cfg.ClientHeader
+}
+
+// Whether the request came straight from one of the trusted proxies, so the headers they set can be believed
+func (l *Limiter) FromTrustedProxy(remoteAddr string) bool {
+	addr, err := netip.ParseAddrPort(remoteAddr)
+	return err == nil && l.trusted(addr.Addr().Unmap())
+}
+
+func (l *Limiter) trusted(ip netip.Addr) bool {
+	for _, proxy := range l.trustedProxies {
+		if proxy.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// Returns false if requests to the route aren't limited. Routes must be patterns, as in Config.Routes.
+func (l *Limiter) limitFor(route string) (Limit, bool) {
+	if limit, ok := l.cfg.Routes[route]; ok {
+		return limit, true
+	}
+	if l.cfg.Default != nil {
+		return *l.cfg.Default, true
+	}
+	return Limit{}, false
+}
+
+// Routes in the config which aren't in the given list, probably typos
+func (l *Limiter) UnknownRoutes(routes []string) []string {
+	known := make(map[string]bool, len(routes))
+	for _, r := range routes {
+		known[r] = true
+	}
+
+	var unknown []string
+	for r := range l.cfg.Routes {
+		if !known[r] {
+			unknown = append(unknown, r)
+		}
+	}
+	return unknown
+}
+
+// Takes a token from the client's bucket for the route and counts the request against the client's quota.
+// Requests over the quota don't take tokens, and rejected requests don't count against the quota.
+func (l *Limiter) Allow(clientKey string, route string) Decision {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.now()
+	l.cleanup(now)
+	c := l.client(clientKey)
+
+	d := Decision{Allowed: true}
+
+	if l.cfg.DailyQuota > 0 {
+		if !now.Before(l.quotaReset) {
+			for _, other := range l.clients {
+				other.quotaUsed = 0
+			}
+			l.quotaReset = l.nextQuotaReset(now)
+		}
+
+		d.Quota = l.cfg.DailyQuota
+		d.QuotaReset = l.quotaReset.Sub(now)
+		if c.quotaUsed >= l.cfg.DailyQuota {
+			d.Allowed = false
+			d.QuotaExceeded = true
+			d.RetryAfter = d.QuotaReset
+		}
+	}
+
+	limit, ok := l.limitFor(route)
+	if ok {
+		b, ok := c.buckets[route]
+		if !ok {
+			b = &bucket{tokens: float64(limit.Burst), updated: now}
+			c.buckets[route] = b
+		}
+		b.refill(limit, now)
+
+		d.Limited = true
+		d.Limit = limit.Burst
+		if d.Allowed && b.tokens >= 1 {
+			b.tokens--
+		} else if d.Allowed {
+			d.Allowed = false
+			d.RetryAfter = secondsUntil(1-b.tokens, limit)
+		}
+		d.Remaining = int(math.Floor(b.tokens))
+		d.Reset = secondsUntil(float64(limit.Burst)-b.tokens, limit)
+	}
+
+	if d.Quota > 0 {
+		if d.Allowed {
+			c.quotaUsed++
+		}
+		d.QuotaRemaining = d.Quota - c.quotaUsed
+	}
+
+	return d
+}
+
+// Gets or starts tracking the client, forgetting the least recently seen one if there are too many
+func (l *Limiter) client(key string) *client {
+	if c, ok := l.clients[key]; ok {
+		l.lru.MoveToFront(c.el)
+		return c
+	}
+
+	if len(l.clients) >= l.maxClients {
+		l.forget(l.lru.Back().Value.(*client))
+	}
+	c := &client{key: key, buckets: make(map[string]*bucket)}
+	c.el = l.lru.PushFront(c)
+	l.clients[key] = c
+	return c
+}
+
+func (l *Limiter) forget(c *client) {
+	l.lru.Remove(c.el)
+	delete(l.clients, c.key)
+}
+
+func (b *bucket) refill(limit Limit, now time.Time) {
+	elapsed := now.Sub(b.updated).Seconds()
+	b.tokens = min(float64(limit.Burst), b.tokens+elapsed*limit.RequestsPerSecond)
+	b.updated = now
+}
+
+func secondsUntil(tokens float64, limit Limit) time.Duration {
+	return time.Duration(tokens / limit.RequestsPerSecond * float64(time.Second))
+}
+
+// Removes full buckets, and clients which are left with nothing to track
+func (l *Limiter) cleanup(now time.Time) {
+	if now.Sub(l.lastCleanup) < cleanupInterval {
+		return
+	}
+	l.lastCleanup = now
+
+	for _, c := range l.clients {
+		for route, b := range c.buckets {
+			limit, ok := l.limitFor(route)
+			if !ok {
+				delete(c.buckets, route)
+				continue
+			}
+			b.refill(limit, now)
+			if b.tokens >= float64(limit.Burst) {
+				delete(c.buckets, route)
+			}
+		}
+		if len(c.buckets) == 0 && (c.quotaUsed == 0 || !now.Before(l.quotaReset)) {
+			l.forget(c)
+		}
+	}
+}
+
+func (l *Limiter) nextQuotaReset(now time.Time) time.Time {
+	now = now.UTC()
+	reset := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC).Add(l.quotaResetAt)
+	if !reset.After(now) {
+		reset = reset.AddDate(0, 0, 1)
+	}
+	return reset
+}
@@ -0,0 +1,349 @@
+package ratelimit
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type testClock struct {
+	now time.Time
+}
+
+func (c *testClock) Now() time.Time {
+	return c.now
+}
+
+func (c *testClock) Advance(d time.Duration) {
+	c.now = c.now.Add(d)
+}
+
+func newTestLimiter(t *testing.T, cfg Config, start time.Time) (*Limiter, *testClock) {
+	t.Helper()
+
+	clock := &testClock{now: start}
+	l, err := newLimiter(cfg, clock.Now)
+	require.NoError(t, err)
+
+	return l, clock
+}
+
+const testRoute = "GET /swift-codes/{swiftCode}"
+
+func TestLimiterTokenBucket(t *testing.T) {
+	// Arrange
+	l, clock := newTestLimiter(t, Config{Routes: map[string]Limit{testRoute: {RequestsPerSecond: 2, Burst: 3}}}, time.Now())
+
+	// Act & Assert
+	for i := range 3 {
+		d := l.Allow("1.2.3.4", testRoute)
+		require.True(t, d.Allowed, i)
+		assert.Equal(t, 3, d.Limit)
+		assert.Equal(t, 2-i, d.Remaining)
+	}
+
+	d := l.Allow("1.2.3.4", testRoute)
+	assert.False(t, d.Allowed)
+	assert.False(t, d.QuotaExceeded)
+	assert.Equal(t, 500*time.Millisecond, d.RetryAfter)
+	assert.Equal(t, 1500*time.Millisecond, d.Reset)
+
+	// Other clients have their own buckets
+	assert.True(t, l.Allow("5.6.7.8", testRoute).Allowed)
+
+	clock.Advance(500 * time.Millisecond)
+	d = l.Allow("1.2.3.4", testRoute)
+	assert.True(t, d.Allowed)
+	assert.Equal(t, 0, d.Remaining)
+
+	clock.Advance(time.Hour)
+	d = l.Allow("1.2.3.4", testRoute)
+	assert.True(t, d.Allowed)
+	assert.Equal(t, 2, d.Remaining)
+}
+
+func TestLimiterRoutes(t *testing.T) {
+	tests := []struct {
+		name     string
+		cfg      Config
+		route    string
+		limited  bool
+		expected int // Limit
+	}{
+		{
+			name:    "no limits",
+			cfg:     Config{},
+			route:   testRoute,
+			limited: false,
+		},
+		{
+			name:     "default",
+			cfg:      Config{Default: &Limit{RequestsPerSecond: 1, Burst: 5}},
+			route:    testRoute,
+			limited:  true,
+			expected: 5,
+		},
+		{
+			name:     "route overrides default",
+			cfg:      Config{Default: &Limit{RequestsPerSecond: 1, Burst: 5}, Routes: map[string]Limit{testRoute: {RequestsPerSecond: 1, Burst: 2}}},
+			route:    testRoute,
+			limited:  true,
+			expected: 2,
+		},
+		{
+			name:    "other route without default",
+			cfg:     Config{Routes: map[string]Limit{testRoute: {RequestsPerSecond: 1, Burst: 2}}},
+			route:   "GET /export",
+			limited: false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Arrange
+			l, _ := newTestLimiter(t, tt.cfg, time.Now())
+
+			// Act
+			d := l.Allow("client", tt.route)
+
+			// Assert
+			assert.True(t, d.Allowed)
+			assert.Equal(t, tt.limited, d.Limited)
+			assert.Equal(t, tt.expected, d.Limit)
+		})
+	}
+}
+
+func TestLimiterRoutesHaveSeparateBuckets(t *testing.T) {
+	// Arrange
+	l, _ := newTestLimiter(t, Config{Default: &Limit{RequestsPerSecond: 1, Burst: 1}}, time.Now())
+
+	// Act & Assert
+	assert.True(t, l.Allow("client", testRoute).Allowed)
+	assert.False(t, l.Allow("client", testRoute).Allowed)
+	assert.True(t, l.Allow("client", "GET /export").Allowed)
+}
+
+func TestLimiterDailyQuota(t *testing.T) {
+	// Arrange
+	start := time.Date(2025, 3, 1, 11, 0, 0, 0, time.UTC)
+	cfg := Config{Default: &Limit{RequestsPerSecond: 1, Burst: 1}, DailyQuota: 2, QuotaResetAt: "12:00"}
+	l, clock := newTestLimiter(t, cfg, start)
+
+	// Act & Assert
+	d := l.Allow("client", testRoute)
+	require.True(t, d.Allowed)
+	assert.Equal(t, 2, d.Quota)
+	assert.Equal(t, 1, d.QuotaRemaining)
+	assert.Equal(t, time.Hour, d.QuotaReset)
+
+	// Rate limited requests don't count against the quota
+	d = l.Allow("client", testRoute)
+	require.False(t, d.Allowed)
+	assert.False(t, d.QuotaExceeded)
+	assert.Equal(t, 1, d.QuotaRemaining)
+
+	clock.Advance(time.Second)
+	require.True(t, l.Allow("client", testRoute).Allowed)
+
+	clock.Advance(time.Second)
+	d = l.Allow("client", testRoute)
+	assert.False(t, d.Allowed)
+	assert.True(t, d.QuotaExceeded)
+	assert.Equal(t, 0, d.QuotaRemaining)
+	assert.Equal(t, time.Hour-2*time.Second, d.RetryAfter)
+	// Requests over the quota don't take tokens
+	assert.Equal(t, 1, d.Remaining)
+
+	assert.True(t, l.Allow("other", testRoute).Allowed)
+
+	clock.Advance(time.Hour)
+	d = l.Allow("client", testRoute)
+	assert.True(t, d.Allowed)
+	assert.Equal(t, 1, d.QuotaRemaining)
+	assert.Equal(t, 24*time.Hour-2*time.Second, d.QuotaReset)
+}
+
+func TestLimiterCleanup(t *testing.T) {
+	// Arrange
+	l, clock := newTestLimiter(t, Config{Default: &Limit{RequestsPerSecond: 0.1, Burst: 10}}, time.Now())
+	l.Allow("a", testRoute)
+	clock.Advance(cleanupInterval - time.Second)
+	l.Allow("b", testRoute)
+	require.Len(t, l.clients, 2)
+
+	// Act
+	clock.Advance(5 * time.Second)
+	l.Allow("c", testRoute)
+
+	// Assert
+	assert.Len(t, l.clients, 2, "a's bucket is full again, so a is forgotten")
+	assert.NotContains(t, l.clients, "a")
+}
+
+func TestLimiterMaxClients(t *testing.T) {
+	// Arrange
+	l, _ := newTestLimiter(t, Config{Default: &Limit{RequestsPerSecond: 0.001, Burst: 1}, MaxClients: 2}, time.Now())
+	require.True(t, l.Allow("a", testRoute).Allowed)
+	require.True(t, l.Allow("b", testRoute).Allowed)
+	require.False(t, l.Allow("a", testRoute).Allowed)
+
+	// Act
+	l.Allow("c", testRoute)
+
+	// Assert
+	assert.Len(t, l.clients, 2)
+	assert.NotContains(t, l.clients, "b", "b was seen the longest time ago")
+	assert.False(t, l.Allow("a", testRoute).Allowed)
+}
+
+func TestLimiterClientIP(t *testing.T) {
+	tests := []struct {
+		name         string
+		remoteAddr   string
+		forwardedFor []string
+		expected     string
+	}{
+		{"direct", "1.2.3.4:1000", nil, "1.2.3.4"},
+		{"forwarded by untrusted", "1.2.3.4:1000", []string{"5.6.7.8"}, "1.2.3.4"},
+		{"forwarded by proxy", "10.0.0.1:1000", []string{"5.6.7.8"}, "5.6.7.8"},
+		{"spoofed by client", "10.0.0.1:1000", []string{"9.9.9.9, 5.6.7.8"}, "5.6.7.8"},
+		{"through proxies", "10.0.0.1:1000", []string{"5.6.7.8, 10.0.0.2", "192.168.1.1"}, "5.6.7.8"},
+		{"only proxies", "10.0.0.1:1000", []string{"10.0.0.2"}, "10.0.0.2"},
+		{"invalid hop", "10.0.0.1:1000", []string{"5.6.7.8, unknown"}, "10.0.0.1"},
+		{"ipv6 by /64", "[2001:db8:1:2:3:4:5:6]:1000", nil, "2001:db8:1:2::/64"},
+		{"ipv4 mapped", "[::ffff:1.2.3.4]:1000", nil, "1.2.3.4"},
+	}
+
+	l, _ := newTestLimiter(t, Config{TrustedProxies: []string{"10.0.0.0/8", "192.168.1.1"}}, time.Now())
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.expected, l.ClientIP(tt.remoteAddr, tt.forwardedFor))
+		})
+	}
+}
+
+func TestLimiterFromTrustedProxy(t *testing.T) {
+	tests := []struct {
+		remoteAddr string
+		expected   bool
+	}{
+		{"10.0.0.1:1000", true},
+		{"[::ffff:10.0.0.1]:1000", true},
+		{"1.2.3.4:1000", false},
+		{"invalid", false},
+	}
+
+	l, _ := newTestLimiter(t, Config{TrustedProxies: []string{"10.0.0.0/8"}}, time.Now())
+	for _, tt := range tests {
+		t.Run(tt.remoteAddr, func(t *testing.T) {
+			assert.Equal(t, tt.expected, l.FromTrustedProxy(tt.remoteAddr))
+		})
+	}
+}
+
+func TestLimiterUnknownRoutes(t *testing.T) {
+	// Arrange
+	l, _ := newTestLimiter(t, Config{Routes: map[string]Limit{testRoute: {RequestsPerSecond: 1, Burst: 1}, "GET /swift-code": {RequestsPerSecond: 1, Burst: 1}}}, time.Now())
+
+	// Act
+	unknown := l.UnknownRoutes([]string{testRoute, "GET /export"})
+
+	// Assert
+	assert.Equal(t, []string{"GET /swift-code"}, unknown)
+}
+
+func TestLoadConfigFile(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		wantErr bool
+	}{
+		{
+			name: "correct",
+			content: `{
+				"clientHeader": "X-Client-ID",
+				"trustedProxies": ["10.0.0.0/8", "::1"],
+				"maxClients": 1000,
+				"default": {"requestsPerSecond": 10, "burst": 20},
+				"routes": {"GET /export": {"requestsPerSecond": 0.1, "burst": 1}},
+				"dailyQuota": 10000,
+				"quotaResetAt": "02:30"
+			}`,
+		},
+		{
+			name:    "empty",
+			content: `{}`,
+		},
+		{
+			name:    "unknown field",
+			content: `{"defaults": {"requestsPerSecond": 10, "burst": 20}}`,
+			wantErr: true,
+		},
+		{
+			name:    "zero rate",
+			content: `{"default": {"requestsPerSecond": 0, "burst": 20}}`,
+			wantErr: true,
+		},
+		{
+			name:    "zero burst",
+			content: `{"routes": {"GET /export": {"requestsPerSecond": 1, "burst": 0}}}`,
+			wantErr: true,
+		},
+		{
+			name:    "route without method",
+			content: `{"routes": {"/export": {"requestsPerSecond": 1, "burst": 1}}}`,
+			wantErr: true,
+		},
+		{
+			name:    "negative quota",
+			content: `{"dailyQuota": -1}`,
+			wantErr: true,
+		},
+		{
+			name:    "invalid trusted proxy",
+			content: `{"trustedProxies": ["proxy.local"]}`,
+			wantErr: true,
+		},
+		{
+			name:    "client header without trusted proxies",
+			content: `{"clientHeader": "X-Client-ID"}`,
+			wantErr: true,
+		},
+		{
+			name:    "negative max clients",
+			content: `{"maxClients": -1}`,
+			wantErr: true,
+		},
+		{
+			name:    "invalid reset time",
+			content: `{"dailyQuota": 100, "quotaResetAt": "midnight"}`,
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Arrange
+			path := filepath.Join(t.TempDir(), "rate-limits.json")
+			require.NoError(t, os.WriteFile(path, []byte(tt.content), 0o600))
+
+			// Act
+			cfg, err := LoadConfigFile(path)
+			if err == nil {
+				_, err = New(cfg)
+			}
+
+			// Assert
+			if tt.wantErr {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
@@ -3,17 +3,18 @@ package utils
 import (
 	"context"
 	"log"
-	"path/filepath"
 	"time"
 
+	"github.com/jmoiron/sqlx"
+	_ "github.com/lib/pq"
 	"github.com/mwojtyna/swift-api/config"
+	"github.com/mwojtyna/swift-api/internal/migrate"
 	"github.com/testcontainers/testcontainers-go"
 	"github.com/testcontainers/testcontainers-go/modules/postgres"
 	"github.com/testcontainers/testcontainers-go/wait"
 )
 
 const pgImage = "postgres:17"
-const migrationsFolder = "migrations"
 
 type TestWithPostgresArgs struct {
 	Pc   *postgres.PostgresContainer
@@ -30,16 +31,8 @@ func TestWithPostgres(f func(TestWithPostgresArgs)) {
 
 	ctx := context.Background()
 
-	// Find all 'up' migrations
-	pattern := filepath.Join(env.ProjectRootPath, migrationsFolder, "*up*.sql")
-	migrations, err := filepath.Glob(pattern)
-	if err != nil {
-		log.Fatalln("Failed to search for migrations")
-	}
-
 	pc, err := postgres.Run(ctx,
 		pgImage,
-		postgres.WithInitScripts(migrations...),
 		postgres.WithDatabase(env.DB_NAME),
 		postgres.WithUsername(env.DB_USER),
 		postgres.WithPassword(env.DB_PASS),
@@ -62,6 +55,12 @@ func TestWithPostgres(f func(TestWithPostgresArgs)) {
 		log.Fatalln("failed to get port")
 	}
 
+	// Same migrations the binaries apply on start
+	err = migrateUp(ctx, pc)
+	if err != nil {
+		log.Fatalf("failed to migrate: %s", err)
+	}
+
 	f(TestWithPostgresArgs{
 		Pc:   pc,
 		Env:  &env,
@@ -69,3 +68,24 @@ func TestWithPostgres(f func(TestWithPostgresArgs)) {
 		Ctx:  ctx,
 	})
 }
+
+func migrateUp(ctx context.Context, pc *postgres.PostgresContainer) error {
+	connStr, err := pc.ConnectionString(ctx, "sslmode=disable")
+	if err != nil {
+		return err
+	}
+
+	pg, err := sqlx.Open("postgres", connStr)
+	if err != nil {
+		return err
+	}
+	defer pg.Close()
+
+	migrator, err := migrate.New(pg)
+	if err != nil {
+		return err
+	}
+
+	_, err = migrator.Up()
+	return err
+}
@@ -0,0 +1,5 @@
+DROP INDEX IF EXISTS idx_bank_town_name_trgm;
+DROP INDEX IF EXISTS idx_bank_address_trgm;
+DROP INDEX IF EXISTS idx_bank_bank_name_trgm;
+
+ALTER TABLE bank DROP COLUMN IF EXISTS town_name;
@@ -0,0 +1,7 @@
+CREATE EXTENSION IF NOT EXISTS pg_trgm;
+
+ALTER TABLE bank ADD COLUMN IF NOT EXISTS town_name TEXT NOT NULL DEFAULT '';
+
+CREATE INDEX IF NOT EXISTS idx_bank_bank_name_trgm ON bank USING GIN (bank_name gin_trgm_ops);
+CREATE INDEX IF NOT EXISTS idx_bank_address_trgm ON bank USING GIN (address gin_trgm_ops);
+CREATE INDEX IF NOT EXISTS idx_bank_town_name_trgm ON bank USING GIN (town_name gin_trgm_ops);
@@ -0,0 +1,3 @@
+-- Covers country lookups as well, so the single column index is no longer needed
+CREATE INDEX IF NOT EXISTS idx_bank_country_iso2_code_swift_code ON bank(country_iso2_code, swift_code);
+DROP INDEX IF EXISTS idx_bank_country_iso2_code;
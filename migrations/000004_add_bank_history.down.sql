@@ -0,0 +1,3 @@
+DROP TRIGGER IF EXISTS bank_history ON bank;
+DROP FUNCTION IF EXISTS record_bank_history();
+DROP TABLE IF EXISTS bank_history;
@@ -0,0 +1,37 @@
+-- Not referencing bank, so the history of deleted banks is kept
+CREATE TABLE IF NOT EXISTS bank_history (
+	id BIGSERIAL PRIMARY KEY,
+	swift_code VARCHAR(11) NOT NULL,
+	operation TEXT NOT NULL,
+	changed_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+	actor TEXT NOT NULL,
+	source TEXT NOT NULL,
+	before JSONB,
+	after JSONB
+);
+
+CREATE INDEX IF NOT EXISTS idx_bank_history_swift_code ON bank_history(swift_code, id);
+
+-- Actor and source are set per transaction with set_config('swiftapi.actor', ..., true)
+CREATE OR REPLACE FUNCTION record_bank_history() RETURNS TRIGGER AS $$
+BEGIN
+	IF TG_OP = 'UPDATE' AND OLD IS NOT DISTINCT FROM NEW THEN
+		RETURN NULL;
+	END IF;
+
+	INSERT INTO bank_history (swift_code, operation, actor, source, before, after)
+	VALUES (
+		COALESCE(NEW.swift_code, OLD.swift_code),
+		LOWER(TG_OP),
+		COALESCE(NULLIF(current_setting('swiftapi.actor', true), ''), 'unknown'),
+		COALESCE(NULLIF(current_setting('swiftapi.source', true), ''), 'unknown'),
+		CASE WHEN TG_OP <> 'INSERT' THEN to_jsonb(OLD) END,
+		CASE WHEN TG_OP <> 'DELETE' THEN to_jsonb(NEW) END
+	);
+	RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
+
+DROP TRIGGER IF EXISTS bank_history ON bank;
+CREATE TRIGGER bank_history AFTER INSERT OR UPDATE OR DELETE ON bank
+	FOR EACH ROW EXECUTE FUNCTION record_bank_history();
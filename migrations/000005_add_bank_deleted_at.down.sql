@@ -0,0 +1,23 @@
+-- Soft deleted banks would come back otherwise
+DELETE FROM bank WHERE deleted_at IS NOT NULL;
+
+CREATE OR REPLACE FUNCTION record_bank_history() RETURNS TRIGGER AS $$
+BEGIN
+	IF TG_OP = 'UPDATE' AND OLD IS NOT DISTINCT FROM NEW THEN
+		RETURN NULL;
+	END IF;
+
+	INSERT INTO bank_history (swift_code, operation, actor, source, before, after)
+	VALUES (
+		COALESCE(NEW.swift_code, OLD.swift_code),
+		LOWER(TG_OP),
+		COALESCE(NULLIF(current_setting('swiftapi.actor', true), ''), 'unknown'),
+		COALESCE(NULLIF(current_setting('swiftapi.source', true), ''), 'unknown'),
+		CASE WHEN TG_OP <> 'INSERT' THEN to_jsonb(OLD) END,
+		CASE WHEN TG_OP <> 'DELETE' THEN to_jsonb(NEW) END
+	);
+	RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
+
+ALTER TABLE bank DROP COLUMN IF EXISTS deleted_at;
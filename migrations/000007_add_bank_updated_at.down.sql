@@ -0,0 +1,37 @@
+DROP TRIGGER IF EXISTS bank_touch_parents ON bank;
+DROP FUNCTION IF EXISTS touch_bank_parents();
+DROP TRIGGER IF EXISTS bank_touch ON bank;
+DROP FUNCTION IF EXISTS touch_bank();
+
+-- Same as in 000005
+CREATE OR REPLACE FUNCTION record_bank_history() RETURNS TRIGGER AS $$
+DECLARE
+	op TEXT := LOWER(TG_OP);
+BEGIN
+	IF TG_OP = 'UPDATE' AND OLD IS NOT DISTINCT FROM NEW THEN
+		RETURN NULL;
+	END IF;
+
+	IF TG_OP = 'UPDATE' AND OLD.deleted_at IS NULL AND NEW.deleted_at IS NOT NULL THEN
+		op := 'delete';
+	ELSIF TG_OP = 'UPDATE' AND OLD.deleted_at IS NOT NULL AND NEW.deleted_at IS NULL THEN
+		op := 'restore';
+	ELSIF TG_OP = 'DELETE' AND OLD.deleted_at IS NOT NULL THEN
+		op := 'purge';
+	END IF;
+
+	INSERT INTO bank_history (swift_code, operation, actor, source, before, after)
+	VALUES (
+		COALESCE(NEW.swift_code, OLD.swift_code),
+		op,
+		COALESCE(NULLIF(current_setting('swiftapi.actor', true), ''), 'unknown'),
+		COALESCE(NULLIF(current_setting('swiftapi.source', true), ''), 'unknown'),
+		CASE WHEN op NOT IN ('insert', 'restore') THEN to_jsonb(OLD) END,
+		CASE WHEN op NOT IN ('delete', 'purge') THEN to_jsonb(NEW) END
+	);
+	RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
+
+ALTER TABLE bank DROP COLUMN IF EXISTS version;
+ALTER TABLE bank DROP COLUMN IF EXISTS updated_at;
@@ -0,0 +1,69 @@
+-- For ETags and Last-Modified in the API. Existing banks count as changed when the column is added.
+ALTER TABLE bank ADD COLUMN IF NOT EXISTS updated_at TIMESTAMPTZ NOT NULL DEFAULT now();
+ALTER TABLE bank ADD COLUMN IF NOT EXISTS version BIGINT NOT NULL DEFAULT 1;
+
+-- Updates which don't change anything, like linking an already linked branch, keep the version
+CREATE OR REPLACE FUNCTION touch_bank() RETURNS TRIGGER AS $$
+BEGIN
+	IF OLD IS DISTINCT FROM NEW THEN
+		NEW.updated_at := now();
+		NEW.version := OLD.version + 1;
+	END IF;
+	RETURN NEW;
+END;
+$$ LANGUAGE plpgsql;
+
+DROP TRIGGER IF EXISTS bank_touch ON bank;
+CREATE TRIGGER bank_touch
+BEFORE UPDATE ON bank
+FOR EACH ROW EXECUTE FUNCTION touch_bank();
+
+-- An HQ's response has its branches, so the HQ gets a new version whenever one of them changes, joins or leaves,
+-- including soft deletes and purges. Bumping the HQ only changes updated_at and version, which doesn't bump
+-- anything further or get recorded in the history.
+CREATE OR REPLACE FUNCTION touch_bank_parents() RETURNS TRIGGER AS $$
+BEGIN
+	IF TG_OP = 'UPDATE' AND to_jsonb(OLD) - 'updated_at' - 'version' = to_jsonb(NEW) - 'updated_at' - 'version' THEN
+		RETURN NULL;
+	END IF;
+
+	UPDATE bank SET version=version+1
+	WHERE swift_code IN (SELECT hq FROM (VALUES (OLD.hq_swift_code), (NEW.hq_swift_code)) AS hqs(hq) WHERE hq IS NOT NULL);
+
+	RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
+
+DROP TRIGGER IF EXISTS bank_touch_parents ON bank;
+CREATE TRIGGER bank_touch_parents AFTER INSERT OR UPDATE OR DELETE ON bank
+	FOR EACH ROW EXECUTE FUNCTION touch_bank_parents();
+
+-- Same as in 000005, except that updates of only updated_at and version aren't recorded
+CREATE OR REPLACE FUNCTION record_bank_history() RETURNS TRIGGER AS $$
+DECLARE
+	op TEXT := LOWER(TG_OP);
+BEGIN
+	IF TG_OP = 'UPDATE' AND to_jsonb(OLD) - 'updated_at' - 'version' = to_jsonb(NEW) - 'updated_at' - 'version' THEN
+		RETURN NULL;
+	END IF;
+
+	IF TG_OP = 'UPDATE' AND OLD.deleted_at IS NULL AND NEW.deleted_at IS NOT NULL THEN
+		op := 'delete';
+	ELSIF TG_OP = 'UPDATE' AND OLD.deleted_at IS NOT NULL AND NEW.deleted_at IS NULL THEN
+		op := 'restore';
+	ELSIF TG_OP = 'DELETE' AND OLD.deleted_at IS NOT NULL THEN
+		op := 'purge';
+	END IF;
+
+	INSERT INTO bank_history (swift_code, operation, actor, source, before, after)
+	VALUES (
+		COALESCE(NEW.swift_code, OLD.swift_code),
+		op,
+		COALESCE(NULLIF(current_setting('swiftapi.actor', true), ''), 'unknown'),
+		COALESCE(NULLIF(current_setting('swiftapi.source', true), ''), 'unknown'),
+		CASE WHEN op NOT IN ('insert', 'restore') THEN to_jsonb(OLD) END,
+		CASE WHEN op NOT IN ('delete', 'purge') THEN to_jsonb(NEW) END
+	);
+	RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
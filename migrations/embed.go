@@ -0,0 +1,12 @@
+// SQL migrations, embedded so binaries can apply them without the source tree. See internal/migrate.
+package migrations
+
+import "embed"
+
+//go:embed *.sql
+var Postgres embed.FS
+
+// Same versions as the Postgres migrations
+//
+//go:embed sqlite/*.sql
+var Sqlite embed.FS
@@ -0,0 +1 @@
+ALTER TABLE bank DROP COLUMN town_name;
@@ -0,0 +1,2 @@
+-- SQLite has no trigram indexes, search scans the table
+ALTER TABLE bank ADD COLUMN town_name TEXT NOT NULL DEFAULT '';
@@ -0,0 +1,2 @@
+CREATE INDEX IF NOT EXISTS idx_bank_country_iso2_code ON bank(country_iso2_code);
+DROP INDEX IF EXISTS idx_bank_country_iso2_code_swift_code;
@@ -0,0 +1,5 @@
+DROP TRIGGER IF EXISTS bank_history_delete;
+DROP TRIGGER IF EXISTS bank_history_update;
+DROP TRIGGER IF EXISTS bank_history_insert;
+DROP TABLE IF EXISTS bank_history_context;
+DROP TABLE IF EXISTS bank_history;
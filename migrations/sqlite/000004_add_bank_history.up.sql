@@ -0,0 +1,49 @@
+-- Not referencing bank, so the history of deleted banks is kept
+CREATE TABLE IF NOT EXISTS bank_history (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	swift_code VARCHAR(11) NOT NULL,
+	operation TEXT NOT NULL,
+	changed_at TIMESTAMP NOT NULL DEFAULT (strftime('%Y-%m-%dT%H:%M:%fZ', 'now')),
+	actor TEXT NOT NULL,
+	source TEXT NOT NULL,
+	before TEXT,
+	after TEXT
+);
+
+CREATE INDEX IF NOT EXISTS idx_bank_history_swift_code ON bank_history(swift_code, id);
+
+-- SQLite has no session variables, so write transactions put the actor and source in the only row of this table
+-- and delete it before committing. Write transactions don't overlap, see db.ConnectSqlite.
+CREATE TABLE IF NOT EXISTS bank_history_context (
+	id INTEGER PRIMARY KEY CHECK (id = 1),
+	actor TEXT NOT NULL,
+	source TEXT NOT NULL
+);
+
+CREATE TRIGGER IF NOT EXISTS bank_history_insert AFTER INSERT ON bank
+BEGIN
+	INSERT INTO bank_history (swift_code, operation, actor, source, before, after)
+	VALUES (NEW.swift_code, 'insert', COALESCE(NULLIF((SELECT actor FROM bank_history_context), ''), 'unknown'), COALESCE(NULLIF((SELECT source FROM bank_history_context), ''), 'unknown'), NULL,
+		json_object('swift_code', NEW.swift_code, 'hq_swift_code', NEW.hq_swift_code, 'is_headquarter', json(CASE WHEN NEW.is_headquarter THEN 'true' ELSE 'false' END),
+		'bank_name', NEW.bank_name, 'address', NEW.address, 'town_name', NEW.town_name, 'country_iso2_code', NEW.country_iso2_code, 'country_name', NEW.country_name));
+END;
+
+CREATE TRIGGER IF NOT EXISTS bank_history_update AFTER UPDATE ON bank
+WHEN (OLD.swift_code, OLD.hq_swift_code, OLD.is_headquarter, OLD.bank_name, OLD.address, OLD.town_name, OLD.country_iso2_code, OLD.country_name)
+	IS NOT (NEW.swift_code, NEW.hq_swift_code, NEW.is_headquarter, NEW.bank_name, NEW.address, NEW.town_name, NEW.country_iso2_code, NEW.country_name)
+BEGIN
+	INSERT INTO bank_history (swift_code, operation, actor, source, before, after)
+	VALUES (NEW.swift_code, 'update', COALESCE(NULLIF((SELECT actor FROM bank_history_context), ''), 'unknown'), COALESCE(NULLIF((SELECT source FROM bank_history_context), ''), 'unknown'),
+		json_object('swift_code', OLD.swift_code, 'hq_swift_code', OLD.hq_swift_code, 'is_headquarter', json(CASE WHEN OLD.is_headquarter THEN 'true' ELSE 'false' END),
+		'bank_name', OLD.bank_name, 'address', OLD.address, 'town_name', OLD.town_name, 'country_iso2_code', OLD.country_iso2_code, 'country_name', OLD.country_name),
+		json_object('swift_code', NEW.swift_code, 'hq_swift_code', NEW.hq_swift_code, 'is_headquarter', json(CASE WHEN NEW.is_headquarter THEN 'true' ELSE 'false' END),
+		'bank_name', NEW.bank_name, 'address', NEW.address, 'town_name', NEW.town_name, 'country_iso2_code', NEW.country_iso2_code, 'country_name', NEW.country_name));
+END;
+
+CREATE TRIGGER IF NOT EXISTS bank_history_delete AFTER DELETE ON bank
+BEGIN
+	INSERT INTO bank_history (swift_code, operation, actor, source, before, after)
+	VALUES (OLD.swift_code, 'delete', COALESCE(NULLIF((SELECT actor FROM bank_history_context), ''), 'unknown'), COALESCE(NULLIF((SELECT source FROM bank_history_context), ''), 'unknown'),
+		json_object('swift_code', OLD.swift_code, 'hq_swift_code', OLD.hq_swift_code, 'is_headquarter', json(CASE WHEN OLD.is_headquarter THEN 'true' ELSE 'false' END),
+		'bank_name', OLD.bank_name, 'address', OLD.address, 'town_name', OLD.town_name, 'country_iso2_code', OLD.country_iso2_code, 'country_name', OLD.country_name), NULL);
+END;
@@ -0,0 +1,30 @@
+ALTER TABLE bank ADD COLUMN deleted_at TIMESTAMP;
+
+-- Soft deletes and restores are updates of deleted_at, purges are deletes of soft deleted banks
+DROP TRIGGER IF EXISTS bank_history_update;
+DROP TRIGGER IF EXISTS bank_history_delete;
+
+CREATE TRIGGER IF NOT EXISTS bank_history_update AFTER UPDATE ON bank
+WHEN (OLD.swift_code, OLD.hq_swift_code, OLD.is_headquarter, OLD.bank_name, OLD.address, OLD.town_name, OLD.country_iso2_code, OLD.country_name, OLD.deleted_at)
+	IS NOT (NEW.swift_code, NEW.hq_swift_code, NEW.is_headquarter, NEW.bank_name, NEW.address, NEW.town_name, NEW.country_iso2_code, NEW.country_name, NEW.deleted_at)
+BEGIN
+	INSERT INTO bank_history (swift_code, operation, actor, source, before, after)
+	SELECT NEW.swift_code, operation, COALESCE(NULLIF((SELECT actor FROM bank_history_context), ''), 'unknown'), COALESCE(NULLIF((SELECT source FROM bank_history_context), ''), 'unknown'),
+		CASE WHEN operation <> 'restore' THEN json_object('swift_code', OLD.swift_code, 'hq_swift_code', OLD.hq_swift_code, 'is_headquarter', json(CASE WHEN OLD.is_headquarter THEN 'true' ELSE 'false' END),
+		'bank_name', OLD.bank_name, 'address', OLD.address, 'town_name', OLD.town_name, 'country_iso2_code', OLD.country_iso2_code, 'country_name', OLD.country_name) END,
+		CASE WHEN operation <> 'delete' THEN json_object('swift_code', NEW.swift_code, 'hq_swift_code', NEW.hq_swift_code, 'is_headquarter', json(CASE WHEN NEW.is_headquarter THEN 'true' ELSE 'false' END),
+		'bank_name', NEW.bank_name, 'address', NEW.address, 'town_name', NEW.town_name, 'country_iso2_code', NEW.country_iso2_code, 'country_name', NEW.country_name) END
+	FROM (SELECT CASE
+		WHEN OLD.deleted_at IS NULL AND NEW.deleted_at IS NOT NULL THEN 'delete'
+		WHEN OLD.deleted_at IS NOT NULL AND NEW.deleted_at IS NULL THEN 'restore'
+		ELSE 'update'
+	END AS operation);
+END;
+
+CREATE TRIGGER IF NOT EXISTS bank_history_delete AFTER DELETE ON bank
+BEGIN
+	INSERT INTO bank_history (swift_code, operation, actor, source, before, after)
+	VALUES (OLD.swift_code, CASE WHEN OLD.deleted_at IS NOT NULL THEN 'purge' ELSE 'delete' END, COALESCE(NULLIF((SELECT actor FROM bank_history_context), ''), 'unknown'), COALESCE(NULLIF((SELECT source FROM bank_history_context), ''), 'unknown'),
+		json_object('swift_code', OLD.swift_code, 'hq_swift_code', OLD.hq_swift_code, 'is_headquarter', json(CASE WHEN OLD.is_headquarter THEN 'true' ELSE 'false' END),
+		'bank_name', OLD.bank_name, 'address', OLD.address, 'town_name', OLD.town_name, 'country_iso2_code', OLD.country_iso2_code, 'country_name', OLD.country_name), NULL);
+END;
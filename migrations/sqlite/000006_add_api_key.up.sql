@@ -0,0 +1,7 @@
+-- Only the SHA-256 hash of a key is stored, the key itself is shown once when it's created
+CREATE TABLE IF NOT EXISTS api_key (
+	name TEXT PRIMARY KEY,
+	key_hash VARCHAR(64) NOT NULL UNIQUE,
+	role TEXT NOT NULL CHECK (role IN ('reader', 'editor', 'admin')),
+	created_at TIMESTAMP NOT NULL DEFAULT (strftime('%Y-%m-%dT%H:%M:%fZ', 'now'))
+);
@@ -0,0 +1,8 @@
+DROP TRIGGER IF EXISTS bank_touch_parents_insert;
+DROP TRIGGER IF EXISTS bank_touch_parents_update;
+DROP TRIGGER IF EXISTS bank_touch_parents_delete;
+DROP TRIGGER IF EXISTS bank_touch_insert;
+DROP TRIGGER IF EXISTS bank_touch_update;
+
+ALTER TABLE bank DROP COLUMN version;
+ALTER TABLE bank DROP COLUMN updated_at;
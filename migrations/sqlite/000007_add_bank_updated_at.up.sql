@@ -0,0 +1,39 @@
+-- Added columns can't default to the current time, so a trigger sets it on insert
+ALTER TABLE bank ADD COLUMN updated_at TIMESTAMP NOT NULL DEFAULT '1970-01-01T00:00:00.000Z';
+ALTER TABLE bank ADD COLUMN version INTEGER NOT NULL DEFAULT 1;
+UPDATE bank SET updated_at=strftime('%Y-%m-%dT%H:%M:%fZ', 'now');
+
+-- The updates below don't change the columns in the WHEN clauses, so they don't record history or fire again
+CREATE TRIGGER IF NOT EXISTS bank_touch_insert AFTER INSERT ON bank
+BEGIN
+	UPDATE bank SET updated_at=strftime('%Y-%m-%dT%H:%M:%fZ', 'now') WHERE swift_code=NEW.swift_code;
+END;
+
+CREATE TRIGGER IF NOT EXISTS bank_touch_update AFTER UPDATE ON bank
+WHEN (OLD.swift_code, OLD.hq_swift_code, OLD.is_headquarter, OLD.bank_name, OLD.address, OLD.town_name, OLD.country_iso2_code, OLD.country_name, OLD.deleted_at)
+	IS NOT (NEW.swift_code, NEW.hq_swift_code, NEW.is_headquarter, NEW.bank_name, NEW.address, NEW.town_name, NEW.country_iso2_code, NEW.country_name, NEW.deleted_at)
+BEGIN
+	UPDATE bank SET updated_at=strftime('%Y-%m-%dT%H:%M:%fZ', 'now'), version=OLD.version+1 WHERE swift_code=NEW.swift_code;
+END;
+
+-- An HQ's response has its branches, so the HQ gets a new version whenever one of them changes, joins or leaves,
+-- including soft deletes and purges. Bumping the HQ doesn't change the columns in the WHEN clauses either.
+CREATE TRIGGER IF NOT EXISTS bank_touch_parents_insert AFTER INSERT ON bank
+WHEN NEW.hq_swift_code IS NOT NULL
+BEGIN
+	UPDATE bank SET updated_at=strftime('%Y-%m-%dT%H:%M:%fZ', 'now'), version=version+1 WHERE swift_code=NEW.hq_swift_code;
+END;
+
+CREATE TRIGGER IF NOT EXISTS bank_touch_parents_update AFTER UPDATE ON bank
+WHEN (OLD.hq_swift_code IS NOT NULL OR NEW.hq_swift_code IS NOT NULL)
+	AND (OLD.swift_code, OLD.hq_swift_code, OLD.is_headquarter, OLD.bank_name, OLD.address, OLD.town_name, OLD.country_iso2_code, OLD.country_name, OLD.deleted_at)
+	IS NOT (NEW.swift_code, NEW.hq_swift_code, NEW.is_headquarter, NEW.bank_name, NEW.address, NEW.town_name, NEW.country_iso2_code, NEW.country_name, NEW.deleted_at)
+BEGIN
+	UPDATE bank SET updated_at=strftime('%Y-%m-%dT%H:%M:%fZ', 'now'), version=version+1 WHERE swift_code IN (OLD.hq_swift_code, NEW.hq_swift_code);
+END;
+
+CREATE TRIGGER IF NOT EXISTS bank_touch_parents_delete AFTER DELETE ON bank
+WHEN OLD.hq_swift_code IS NOT NULL
+BEGIN
+	UPDATE bank SET updated_at=strftime('%Y-%m-%dT%H:%M:%fZ', 'now'), version=version+1 WHERE swift_code=OLD.hq_swift_code;
+END;